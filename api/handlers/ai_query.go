@@ -1,9 +1,15 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"nyasah-backend/models"
 	"nyasah-backend/services"
+	"nyasah-backend/services/retrieval"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -19,9 +25,14 @@ func NewAIQueryHandler(db *gorm.DB, aiService *services.Service) *AIQueryHandler
 	return &AIQueryHandler{db: db, aiService: aiService}
 }
 
+// Query answers a merchant's question from the tenant's own reviews, proofs
+// and entities, with the sources it was given and the reviews it cites.
+// Clients that send "stream": true or accept text/event-stream receive the
+// answer as Server-Sent Events.
 func (h *AIQueryHandler) Query(c *gin.Context) {
 	var input struct {
-		Query string `json:"query" binding:"required"`
+		Query  string `json:"query" binding:"required"`
+		Stream bool   `json:"stream"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -31,8 +42,13 @@ func (h *AIQueryHandler) Query(c *gin.Context) {
 
 	tenantID, _ := c.Get("tenant_id")
 
+	if input.Stream || strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+		h.stream(c, tenantID.(uuid.UUID), input.Query)
+		return
+	}
+
 	// Process query through AI service
-	response, err := h.aiService.ProcessQuery(input.Query, tenantID.(string))
+	response, sources, err := h.aiService.ProcessQuery(c.Request.Context(), input.Query, tenantID.(uuid.UUID))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process query"})
 		return
@@ -40,18 +56,113 @@ func (h *AIQueryHandler) Query(c *gin.Context) {
 
 	// Store query and response
 	aiQuery := models.AIQuery{
-		TenantID: tenantID.(uuid.UUID),
-		Query:    input.Query,
-		Response: response,
+		TenantID:        tenantID.(uuid.UUID),
+		Query:           input.Query,
+		Response:        response,
+		SourceReviewIDs: retrieval.ReviewIDs(sources.Cited(response)),
 	}
 
-	if err := h.db.Create(&aiQuery).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Create(&aiQuery).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save query"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"query":    input.Query,
-		"response": response,
+		"id":                aiQuery.ID,
+		"query":             input.Query,
+		"response":          response,
+		"sources":           sourceList(sources),
+		"source_review_ids": idList(aiQuery.SourceReviewIDs),
+	})
+}
+
+// stream sends a "sources" event with the data given to the provider, a
+// "token" event for each chunk of the answer as the provider generates it,
+// then a "done" event with the stored query and the reviews it cites.
+// Failures after the stream has started are sent as an "error" event. A
+// client that disconnects cancels the provider call, and nothing is stored.
+func (h *AIQueryHandler) stream(c *gin.Context, tenantID uuid.UUID, query string) {
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Streaming unsupported"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	answer, sources, err := h.aiService.StreamQuery(ctx, query, tenantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process query"})
+		return
+	}
+	defer answer.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	writeSSEMessage(c.Writer, "sources", gin.H{"sources": sourceList(sources), "streaming": h.aiService.Streams()})
+	flusher.Flush()
+
+	for {
+		chunk, err := answer.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			writeSSEMessage(c.Writer, "error", gin.H{"error": "Failed to process query"})
+			flusher.Flush()
+			return
+		}
+		writeSSEMessage(c.Writer, "token", gin.H{"text": chunk.Text})
+		flusher.Flush()
+	}
+
+	response := answer.Response().Text
+	aiQuery := models.AIQuery{
+		TenantID:        tenantID,
+		Query:           query,
+		Response:        response,
+		SourceReviewIDs: retrieval.ReviewIDs(sources.Cited(response)),
+	}
+
+	if err := h.db.WithContext(ctx).Create(&aiQuery).Error; err != nil {
+		writeSSEMessage(c.Writer, "error", gin.H{"error": "Failed to save query"})
+		flusher.Flush()
+		return
+	}
+
+	writeSSEMessage(c.Writer, "done", gin.H{
+		"id":                aiQuery.ID,
+		"query":             aiQuery.Query,
+		"response":          aiQuery.Response,
+		"source_review_ids": idList(aiQuery.SourceReviewIDs),
 	})
+	flusher.Flush()
+}
+
+// sourceList and idList keep empty lists from being sent as null
+func sourceList(result retrieval.Result) []retrieval.Source {
+	if result.Sources == nil {
+		return []retrieval.Source{}
+	}
+	return result.Sources
+}
+
+func idList(ids []uuid.UUID) []uuid.UUID {
+	if ids == nil {
+		return []uuid.UUID{}
+	}
+	return ids
+}
+
+func writeSSEMessage(w gin.ResponseWriter, event string, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
 }
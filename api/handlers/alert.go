@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	netmail "net/mail"
+	"net/url"
+	"nyasah-backend/models"
+	"nyasah-backend/services/alerts"
+	"nyasah-backend/services/safehttp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type AlertHandler struct {
+	db     *gorm.DB
+	alerts *alerts.Service
+}
+
+func NewAlertHandler(db *gorm.DB, service *alerts.Service) *AlertHandler {
+	return &AlertHandler{db: db, alerts: service}
+}
+
+type alertRuleInput struct {
+	Name          string     `json:"name"`
+	Enabled       *bool      `json:"enabled"`
+	Metric        string     `json:"metric"`
+	EntityID      *uuid.UUID `json:"entity_id"`
+	Method        string     `json:"method"`
+	Direction     string     `json:"direction"`
+	Threshold     *float64   `json:"threshold"`
+	WindowHours   *int       `json:"window_hours"`
+	MinReviews    *int       `json:"min_reviews"`
+	WebhookURL    *string    `json:"webhook_url"`
+	WebhookSecret *string    `json:"webhook_secret"`
+	Emails        []string   `json:"emails"`
+}
+
+// apply copies the fields that were given onto the rule
+func (in alertRuleInput) apply(rule *models.AlertRule) {
+	if in.Name != "" {
+		rule.Name = in.Name
+	}
+	if in.Enabled != nil {
+		rule.Enabled = *in.Enabled
+	}
+	if in.Metric != "" {
+		rule.Metric = in.Metric
+	}
+	if in.EntityID != nil {
+		rule.EntityID = in.EntityID
+		if *in.EntityID == uuid.Nil {
+			rule.EntityID = nil
+		}
+	}
+	if in.Method != "" {
+		rule.Method = in.Method
+	}
+	if in.Direction != "" {
+		rule.Direction = in.Direction
+	}
+	if in.Threshold != nil {
+		rule.Threshold = *in.Threshold
+	}
+	if in.WindowHours != nil {
+		rule.WindowHours = *in.WindowHours
+	}
+	if in.MinReviews != nil {
+		rule.MinReviews = *in.MinReviews
+	}
+	if in.WebhookURL != nil {
+		rule.WebhookURL = *in.WebhookURL
+	}
+	if in.WebhookSecret != nil {
+		rule.WebhookSecret = *in.WebhookSecret
+	}
+	if in.Emails != nil {
+		rule.Emails = in.Emails
+	}
+}
+
+// validateRule normalizes the rule and checks its delivery channels
+func validateRule(ctx context.Context, rule *models.AlertRule) error {
+	if err := alerts.Normalize(rule); err != nil {
+		return err
+	}
+	if rule.WebhookURL != "" {
+		u, err := url.Parse(rule.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("webhook_url must be an http or https URL")
+		}
+		if err := safehttp.CheckURL(ctx, rule.WebhookURL); err != nil {
+			return errors.New("webhook_url must point to a public address")
+		}
+	}
+	for _, email := range rule.Emails {
+		if _, err := netmail.ParseAddress(email); err != nil {
+			return fmt.Errorf("invalid email address %q", email)
+		}
+	}
+	return nil
+}
+
+func (h *AlertHandler) CreateRule(c *gin.Context) {
+	var input alertRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Rule name required"})
+		return
+	}
+
+	tenantID, _ := c.Get("tenant_id")
+
+	rule := models.AlertRule{TenantID: tenantID.(uuid.UUID), Enabled: true}
+	input.apply(&rule)
+	if err := validateRule(c.Request.Context(), &rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.db.WithContext(c.Request.Context()).Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create alert rule"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (h *AlertHandler) ListRules(c *gin.Context) {
+	tenantID, _ := c.Get("tenant_id")
+
+	var list []models.AlertRule
+	if err := h.db.WithContext(c.Request.Context()).Where("tenant_id = ?", tenantID).Order("created_at").Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch alert rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *AlertHandler) UpdateRule(c *gin.Context) {
+	var input alertRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, ok := h.findRule(c)
+	if !ok {
+		return
+	}
+
+	input.apply(&rule)
+	if err := validateRule(c.Request.Context(), &rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.db.WithContext(c.Request.Context()).Save(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update alert rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteRule removes a rule and resolves its incidents
+func (h *AlertHandler) DeleteRule(c *gin.Context) {
+	rule, ok := h.findRule(c)
+	if !ok {
+		return
+	}
+
+	err := h.db.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Incident{}).
+			Where("rule_id = ? AND status <> ?", rule.ID, alerts.StatusResolved).
+			Updates(map[string]interface{}{"status": alerts.StatusResolved, "resolved_at": time.Now()}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&rule).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete alert rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Alert rule deleted successfully"})
+}
+
+// ListIncidents returns the tenant's most recent incidents, optionally
+// filtered by status, rule and entity
+func (h *AlertHandler) ListIncidents(c *gin.Context) {
+	tenantID, _ := c.Get("tenant_id")
+
+	limit := 50
+	if raw := c.Query("limit"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 && n <= 200 {
+			limit = n
+		}
+	}
+
+	query := h.db.WithContext(c.Request.Context()).Where("tenant_id = ?", tenantID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	for _, param := range []string{"rule_id", "entity_id"} {
+		if raw := c.Query(param); raw != "" {
+			id, err := uuid.Parse(raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+				return
+			}
+			query = query.Where(param+" = ?", id)
+		}
+	}
+
+	var list []models.Incident
+	if err := query.Order("last_detected_at DESC").Limit(limit).Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch incidents"})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *AlertHandler) GetIncident(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid incident ID"})
+		return
+	}
+
+	tenantID, _ := c.Get("tenant_id")
+
+	var incident models.Incident
+	if err := h.db.WithContext(c.Request.Context()).Where("id = ? AND tenant_id = ?", id, tenantID).First(&incident).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Incident not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, incident)
+}
+
+// Acknowledge marks an open incident as being handled. Acknowledging an
+// incident that is already acknowledged or resolved changes nothing.
+func (h *AlertHandler) Acknowledge(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid incident ID"})
+		return
+	}
+
+	tenantID, _ := c.Get("tenant_id")
+	userID, _ := c.Get("user_id")
+
+	incident, err := h.alerts.Acknowledge(tenantID.(uuid.UUID), id, fmt.Sprint(userID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Incident not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to acknowledge incident"})
+		return
+	}
+
+	c.JSON(http.StatusOK, incident)
+}
+
+func (h *AlertHandler) findRule(c *gin.Context) (models.AlertRule, bool) {
+	var rule models.AlertRule
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule ID"})
+		return rule, false
+	}
+
+	tenantID, _ := c.Get("tenant_id")
+	if err := h.db.WithContext(c.Request.Context()).Where("id = ? AND tenant_id = ?", id, tenantID).First(&rule).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert rule not found"})
+		return rule, false
+	}
+
+	return rule, true
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"net/http"
+	"nyasah-backend/models"
+	"nyasah-backend/services/rules"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type DisplayRuleHandler struct {
+	db     *gorm.DB
+	engine *rules.Engine
+}
+
+func NewDisplayRuleHandler(db *gorm.DB, engine *rules.Engine) *DisplayRuleHandler {
+	return &DisplayRuleHandler{db: db, engine: engine}
+}
+
+type displayRuleInput struct {
+	Name         string                 `json:"name"`
+	Priority     *int                   `json:"priority"`
+	Enabled      *bool                  `json:"enabled"`
+	Action       string                 `json:"action"`
+	ProofTypes   []string               `json:"proof_types"`
+	Conditions   *models.RuleConditions `json:"conditions"`
+	FrequencyCap *int                   `json:"frequency_cap"`
+}
+
+func (in displayRuleInput) validAction() bool {
+	return in.Action == "" || in.Action == rules.ActionShow || in.Action == rules.ActionHide
+}
+
+func (h *DisplayRuleHandler) Create(c *gin.Context) {
+	var input displayRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Rule name required"})
+		return
+	}
+	if !input.validAction() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule action"})
+		return
+	}
+
+	tenantID, _ := c.Get("tenant_id")
+
+	rule := models.DisplayRule{
+		TenantID:   tenantID.(uuid.UUID),
+		Name:       input.Name,
+		Enabled:    true,
+		Action:     rules.ActionShow,
+		ProofTypes: input.ProofTypes,
+	}
+	if input.Priority != nil {
+		rule.Priority = *input.Priority
+	}
+	if input.Enabled != nil {
+		rule.Enabled = *input.Enabled
+	}
+	if input.Action != "" {
+		rule.Action = input.Action
+	}
+	if input.Conditions != nil {
+		rule.Conditions = *input.Conditions
+	}
+	if input.FrequencyCap != nil {
+		rule.FrequencyCap = *input.FrequencyCap
+	}
+
+	if err := h.db.WithContext(c.Request.Context()).Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create display rule"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (h *DisplayRuleHandler) List(c *gin.Context) {
+	tenantID, _ := c.Get("tenant_id")
+
+	var list []models.DisplayRule
+	if err := h.db.WithContext(c.Request.Context()).Where("tenant_id = ?", tenantID).Order("priority DESC").Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch display rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *DisplayRuleHandler) Update(c *gin.Context) {
+	var input displayRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !input.validAction() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule action"})
+		return
+	}
+
+	rule, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	if input.Name != "" {
+		rule.Name = input.Name
+	}
+	if input.Priority != nil {
+		rule.Priority = *input.Priority
+	}
+	if input.Enabled != nil {
+		rule.Enabled = *input.Enabled
+	}
+	if input.Action != "" {
+		rule.Action = input.Action
+	}
+	if input.ProofTypes != nil {
+		rule.ProofTypes = input.ProofTypes
+	}
+	if input.Conditions != nil {
+		rule.Conditions = *input.Conditions
+	}
+	if input.FrequencyCap != nil {
+		rule.FrequencyCap = *input.FrequencyCap
+	}
+
+	if err := h.db.WithContext(c.Request.Context()).Save(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update display rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *DisplayRuleHandler) Delete(c *gin.Context) {
+	rule, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.WithContext(c.Request.Context()).Delete(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete display rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Display rule deleted successfully"})
+}
+
+// Evaluate runs the tenant's rules against a sample visitor without counting
+// towards frequency caps, and returns the decision with a per-rule trace
+func (h *DisplayRuleHandler) Evaluate(c *gin.Context) {
+	var visitor rules.Visitor
+	if err := c.ShouldBindJSON(&visitor); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenantID, _ := c.Get("tenant_id")
+
+	decision, trace, err := h.engine.Evaluate(tenantID.(uuid.UUID), visitor)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to evaluate display rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"decision": decision,
+		"trace":    trace,
+	})
+}
+
+func (h *DisplayRuleHandler) find(c *gin.Context) (models.DisplayRule, bool) {
+	var rule models.DisplayRule
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule ID"})
+		return rule, false
+	}
+
+	tenantID, _ := c.Get("tenant_id")
+	if err := h.db.WithContext(c.Request.Context()).Where("id = ? AND tenant_id = ?", id, tenantID).First(&rule).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Display rule not found"})
+		return rule, false
+	}
+
+	return rule, true
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"nyasah-backend/models"
+	"nyasah-backend/services/events"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxEventsPerRequest bounds the size of a single ingestion batch
+const maxEventsPerRequest = 500
+
+type EventHandler struct {
+	ingester *events.Ingester
+}
+
+func NewEventHandler(ingester *events.Ingester) *EventHandler {
+	return &EventHandler{ingester: ingester}
+}
+
+type eventInput struct {
+	ID        string     `json:"id"`
+	Type      string     `json:"type"`
+	ProofID   *uuid.UUID `json:"proof_id"`
+	EntityID  *uuid.UUID `json:"entity_id"`
+	VisitorID string     `json:"visitor_id"`
+	UserID    *uuid.UUID `json:"user_id"`
+	UserToken string     `json:"user_token"` // events.CustomerToken of user_id
+	Value     float64    `json:"value"`
+	Timestamp *time.Time `json:"timestamp"`
+}
+
+// Ingest accepts a batch of impression, click and conversion events. Invalid
+// events are reported back without failing the rest of the batch.
+func (h *EventHandler) Ingest(c *gin.Context) {
+	tenant := c.MustGet("tenant").(models.Tenant)
+
+	var input struct {
+		Events []eventInput `json:"events" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(input.Events) > maxEventsPerRequest {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Too many events in one request"})
+		return
+	}
+
+	now := time.Now()
+	batch := make([]models.ProofEvent, 0, len(input.Events))
+	rejected := []gin.H{}
+
+	for i, in := range input.Events {
+		event := models.ProofEvent{
+			TenantID:   tenant.ID,
+			EventID:    in.ID,
+			Type:       in.Type,
+			ProofID:    in.ProofID,
+			EntityID:   in.EntityID,
+			VisitorID:  in.VisitorID,
+			Value:      in.Value,
+			OccurredAt: now,
+		}
+		// The widget key is public, so a user ID counts only when the tenant signed it.
+		// Unsigned events stay keyed by visitor.
+		if in.UserID != nil && events.VerifyCustomer(tenant.ApiKey, *in.UserID, in.UserToken) {
+			event.UserID = in.UserID
+		}
+		// Trust client clocks only for the past; a skewed future time would break attribution
+		if in.Timestamp != nil && in.Timestamp.Before(now) {
+			event.OccurredAt = *in.Timestamp
+		}
+
+		if err := events.Validate(event); err != nil {
+			rejected = append(rejected, gin.H{"index": i, "id": in.ID, "error": err.Error()})
+			continue
+		}
+		batch = append(batch, event)
+	}
+
+	added, err := h.ingester.Add(batch)
+	if errors.Is(err, events.ErrBufferFull) {
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Event buffer is full, retry later"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to ingest events"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"accepted":   added,
+		"duplicates": len(batch) - added,
+		"rejected":   rejected,
+	})
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"net/http"
+	"nyasah-backend/models"
+	"nyasah-backend/services/experiments"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type ExperimentHandler struct {
+	db          *gorm.DB
+	experiments *experiments.Service
+}
+
+func NewExperimentHandler(db *gorm.DB) *ExperimentHandler {
+	return &ExperimentHandler{db: db, experiments: experiments.NewService(db)}
+}
+
+func (h *ExperimentHandler) Create(c *gin.Context) {
+	var input struct {
+		Name            string  `json:"name" binding:"required"`
+		ProofType       string  `json:"proof_type" binding:"required"`
+		ConfidenceLevel float64 `json:"confidence_level"`
+		MinSampleSize   int     `json:"min_sample_size"`
+		Variants        []struct {
+			Name      string               `json:"name" binding:"required"`
+			IsControl bool                 `json:"is_control"`
+			Weight    int                  `json:"weight"`
+			Config    models.VariantConfig `json:"config"`
+		} `json:"variants" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(input.Variants) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least two variants required"})
+		return
+	}
+	if input.ConfidenceLevel != 0 && (input.ConfidenceLevel < 0.5 || input.ConfidenceLevel >= 1) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Confidence level must be between 0.5 and 1"})
+		return
+	}
+
+	if input.ConfidenceLevel == 0 {
+		input.ConfidenceLevel = 0.95
+	}
+	if input.MinSampleSize <= 0 {
+		input.MinSampleSize = 1000
+	}
+
+	tenantID, _ := c.Get("tenant_id")
+
+	experiment := models.Experiment{
+		TenantID:        tenantID.(uuid.UUID),
+		Name:            input.Name,
+		ProofType:       input.ProofType,
+		Status:          experiments.StatusDraft,
+		ConfidenceLevel: input.ConfidenceLevel,
+		MinSampleSize:   input.MinSampleSize,
+	}
+
+	controls := 0
+	for _, v := range input.Variants {
+		if v.IsControl {
+			controls++
+		}
+		weight := v.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		experiment.Variants = append(experiment.Variants, models.ExperimentVariant{
+			Name:      v.Name,
+			IsControl: v.IsControl,
+			Weight:    weight,
+			Config:    v.Config,
+		})
+	}
+	if controls > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only one variant can be the control"})
+		return
+	}
+	if controls == 0 {
+		experiment.Variants[0].IsControl = true
+	}
+
+	if err := h.db.WithContext(c.Request.Context()).Create(&experiment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create experiment"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, experiment)
+}
+
+func (h *ExperimentHandler) List(c *gin.Context) {
+	tenantID, _ := c.Get("tenant_id")
+
+	query := h.db.WithContext(c.Request.Context()).Preload("Variants").Where("tenant_id = ?", tenantID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var list []models.Experiment
+	if err := query.Order("created_at DESC").Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch experiments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *ExperimentHandler) Get(c *gin.Context) {
+	experiment, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, experiment)
+}
+
+func (h *ExperimentHandler) Start(c *gin.Context) {
+	experiment, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	if experiment.Status != experiments.StatusDraft && experiment.Status != experiments.StatusStopped {
+		c.JSON(http.StatusConflict, gin.H{"error": "Experiment cannot be started from status " + experiment.Status})
+		return
+	}
+
+	var running int64
+	h.db.WithContext(c.Request.Context()).Model(&models.Experiment{}).
+		Where("tenant_id = ? AND proof_type = ? AND status = ? AND id <> ?", experiment.TenantID, experiment.ProofType, experiments.StatusRunning, experiment.ID).
+		Count(&running)
+	if running > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Another experiment is already running for this proof type"})
+		return
+	}
+
+	updates := map[string]interface{}{"status": experiments.StatusRunning}
+	if experiment.StartedAt == nil {
+		updates["started_at"] = time.Now()
+	}
+	if err := h.db.WithContext(c.Request.Context()).Model(&models.Experiment{}).Where("id = ?", experiment.ID).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start experiment"})
+		return
+	}
+
+	h.respond(c, experiment.ID)
+}
+
+func (h *ExperimentHandler) Stop(c *gin.Context) {
+	experiment, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	if experiment.Status != experiments.StatusRunning {
+		c.JSON(http.StatusConflict, gin.H{"error": "Experiment is not running"})
+		return
+	}
+
+	err := h.db.WithContext(c.Request.Context()).Model(&models.Experiment{}).Where("id = ?", experiment.ID).Updates(map[string]interface{}{
+		"status":   experiments.StatusStopped,
+		"ended_at": time.Now(),
+	}).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stop experiment"})
+		return
+	}
+
+	h.respond(c, experiment.ID)
+}
+
+func (h *ExperimentHandler) Results(c *gin.Context) {
+	experiment, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	results, err := h.experiments.Results(experiment)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute experiment results"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"experiment": experiment,
+		"results":    results,
+	})
+}
+
+// Promote applies a variant as the tenant's new default. Without a variant_id
+// the significant winner from the current results is promoted.
+func (h *ExperimentHandler) Promote(c *gin.Context) {
+	var input struct {
+		VariantID string `json:"variant_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	experiment, ok := h.find(c)
+	if !ok {
+		return
+	}
+	if experiment.Status == experiments.StatusCompleted {
+		c.JSON(http.StatusConflict, gin.H{"error": "Experiment already completed"})
+		return
+	}
+
+	if input.VariantID == "" {
+		results, err := h.experiments.Results(experiment)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute experiment results"})
+			return
+		}
+		if results.BestVariantID == "" {
+			c.JSON(http.StatusConflict, gin.H{"error": "No significant winner yet", "results": results})
+			return
+		}
+		input.VariantID = results.BestVariantID
+	}
+
+	variantID, err := uuid.Parse(input.VariantID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	if err := h.experiments.Promote(experiment, variantID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.respond(c, experiment.ID)
+}
+
+func (h *ExperimentHandler) respond(c *gin.Context, id uuid.UUID) {
+	var experiment models.Experiment
+	if err := h.db.WithContext(c.Request.Context()).Preload("Variants").First(&experiment, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch experiment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, experiment)
+}
+
+func (h *ExperimentHandler) find(c *gin.Context) (models.Experiment, bool) {
+	var experiment models.Experiment
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid experiment ID"})
+		return experiment, false
+	}
+
+	tenantID, _ := c.Get("tenant_id")
+	if err := h.db.WithContext(c.Request.Context()).Preload("Variants").Where("id = ? AND tenant_id = ?", id, tenantID).First(&experiment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Experiment not found"})
+		return experiment, false
+	}
+
+	return experiment, true
+}
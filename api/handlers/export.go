@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"nyasah-backend/models"
+	"nyasah-backend/services/exports"
+	"nyasah-backend/services/reports"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type ExportHandler struct {
+	db      *gorm.DB
+	exports *exports.Service
+}
+
+func NewExportHandler(db *gorm.DB, service *exports.Service) *ExportHandler {
+	return &ExportHandler{db: db, exports: service}
+}
+
+type exportInput struct {
+	Dataset string               `json:"dataset"`
+	Format  string               `json:"format"`
+	Filters models.ExportFilters `json:"filters"`
+	Since   string               `json:"since"`
+}
+
+// exportResponse adds a signed download URL to completed exports
+type exportResponse struct {
+	models.Export
+	DownloadURL       string     `json:"download_url,omitempty"`
+	DownloadExpiresAt *time.Time `json:"download_expires_at,omitempty"`
+}
+
+func (h *ExportHandler) response(c *gin.Context, export models.Export) exportResponse {
+	resp := exportResponse{Export: export}
+	if export.Status == exports.StatusCompleted && h.exports.Signed() {
+		path, expires := h.exports.DownloadURL(export.ID, time.Now())
+		scheme := "http"
+		if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		resp.DownloadURL = scheme + "://" + c.Request.Host + path
+		resp.DownloadExpiresAt = &expires
+	}
+	return resp
+}
+
+// Create queues an export. Its file is written in the background; poll the
+// export until its status is completed.
+func (h *ExportHandler) Create(c *gin.Context) {
+	var input exportInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Format == "" {
+		input.Format = exports.FormatCSV
+	}
+	if err := exports.Validate(input.Dataset, input.Format, input.Filters, input.Since); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenantID, _ := c.Get("tenant_id")
+
+	export := models.Export{
+		TenantID: tenantID.(uuid.UUID),
+		Dataset:  input.Dataset,
+		Format:   input.Format,
+		Filters:  input.Filters,
+		Since:    input.Since,
+	}
+	if err := h.exports.Create(&export); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create export"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, h.response(c, export))
+}
+
+func (h *ExportHandler) List(c *gin.Context) {
+	tenantID, _ := c.Get("tenant_id")
+
+	limit := 50
+	if raw := c.Query("limit"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 && n <= 200 {
+			limit = n
+		}
+	}
+
+	query := h.db.WithContext(c.Request.Context()).Where("tenant_id = ?", tenantID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if raw := c.Query("schedule_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule_id"})
+			return
+		}
+		query = query.Where("schedule_id = ?", id)
+	}
+
+	var list []models.Export
+	if err := query.Order("created_at DESC").Limit(limit).Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch exports"})
+		return
+	}
+
+	resp := make([]exportResponse, len(list))
+	for i, export := range list {
+		resp[i] = h.response(c, export)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Get returns an export, with a fresh download URL once it has completed
+func (h *ExportHandler) Get(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export ID"})
+		return
+	}
+
+	tenantID, _ := c.Get("tenant_id")
+
+	var export models.Export
+	if err := h.db.WithContext(c.Request.Context()).Where("id = ? AND tenant_id = ?", id, tenantID).First(&export).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.response(c, export))
+}
+
+// Download serves an export's file. It needs no credentials: the URL's
+// signature and expiry authorize it.
+func (h *ExportHandler) Download(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export ID"})
+		return
+	}
+
+	err = h.exports.Verify(id, c.Query("expires"), c.Query("signature"), time.Now())
+	if errors.Is(err, exports.ErrDownloadsDisabled) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Export downloads are disabled"})
+		return
+	}
+	if errors.Is(err, exports.ErrLinkExpired) {
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	var export models.Export
+	if err := h.db.WithContext(c.Request.Context()).First(&export, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return
+	}
+	if export.Status != exports.StatusCompleted {
+		c.JSON(http.StatusGone, gin.H{"error": "Export file is not available"})
+		return
+	}
+
+	c.Header("Content-Type", exports.ContentType(export.Format))
+	c.FileAttachment(h.exports.File(export), exports.Filename(export))
+}
+
+type exportScheduleInput struct {
+	Name        string                    `json:"name"`
+	Dataset     string                    `json:"dataset"`
+	Format      string                    `json:"format"`
+	Filters     *models.ExportFilters     `json:"filters"`
+	Schedule    string                    `json:"schedule"`
+	Destination *models.ExportDestination `json:"destination"`
+	// SecretAccessKey is write-only; it is never returned
+	SecretAccessKey *string `json:"secret_access_key"`
+	Since           *string `json:"since"`
+	Enabled         *bool   `json:"enabled"`
+}
+
+// apply copies the fields that were given onto the schedule
+func (in exportScheduleInput) apply(schedule *models.ExportSchedule) {
+	if in.Name != "" {
+		schedule.Name = in.Name
+	}
+	if in.Dataset != "" {
+		schedule.Dataset = in.Dataset
+	}
+	if in.Format != "" {
+		schedule.Format = in.Format
+	}
+	if in.Filters != nil {
+		schedule.Filters = *in.Filters
+	}
+	if in.Schedule != "" {
+		schedule.Schedule = in.Schedule
+	}
+	if in.Destination != nil {
+		schedule.Destination = *in.Destination
+	}
+	if in.SecretAccessKey != nil {
+		schedule.DestinationSecret = *in.SecretAccessKey
+	}
+	if in.Since != nil {
+		schedule.Cursor = *in.Since
+	}
+	if in.Enabled != nil {
+		schedule.Enabled = *in.Enabled
+	}
+}
+
+// schedule validates the export schedule and sets its next run, writing the
+// response when it fails
+func (h *ExportHandler) schedule(c *gin.Context, schedule *models.ExportSchedule) bool {
+	if err := exports.ValidateSchedule(schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	err := h.exports.Reschedule(schedule, time.Now())
+	if errors.Is(err, reports.ErrNeverRuns) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule exports"})
+		return false
+	}
+	return true
+}
+
+func (h *ExportHandler) CreateSchedule(c *gin.Context) {
+	var input exportScheduleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Name == "" || input.Schedule == "" || input.Destination == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Schedule name, schedule and destination required"})
+		return
+	}
+
+	tenantID, _ := c.Get("tenant_id")
+
+	schedule := models.ExportSchedule{TenantID: tenantID.(uuid.UUID), Format: exports.FormatCSV, Enabled: true}
+	input.apply(&schedule)
+	if !h.schedule(c, &schedule) {
+		return
+	}
+
+	if err := h.db.WithContext(c.Request.Context()).Create(&schedule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create export schedule"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, schedule)
+}
+
+func (h *ExportHandler) ListSchedules(c *gin.Context) {
+	tenantID, _ := c.Get("tenant_id")
+
+	var list []models.ExportSchedule
+	if err := h.db.WithContext(c.Request.Context()).Where("tenant_id = ?", tenantID).Order("created_at").Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch export schedules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *ExportHandler) GetSchedule(c *gin.Context) {
+	schedule, ok := h.findSchedule(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+// UpdateSchedule changes a schedule. Setting since moves where its next export
+// starts, e.g. "" to export everything again.
+func (h *ExportHandler) UpdateSchedule(c *gin.Context) {
+	var input exportScheduleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schedule, ok := h.findSchedule(c)
+	if !ok {
+		return
+	}
+
+	input.apply(&schedule)
+	if !h.schedule(c, &schedule) {
+		return
+	}
+
+	if err := h.db.WithContext(c.Request.Context()).Save(&schedule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update export schedule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+// DeleteSchedule removes a schedule. Exports it already made are kept until
+// they expire.
+func (h *ExportHandler) DeleteSchedule(c *gin.Context) {
+	schedule, ok := h.findSchedule(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.WithContext(c.Request.Context()).Delete(&schedule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete export schedule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Export schedule deleted successfully"})
+}
+
+func (h *ExportHandler) findSchedule(c *gin.Context) (models.ExportSchedule, bool) {
+	var schedule models.ExportSchedule
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule ID"})
+		return schedule, false
+	}
+
+	tenantID, _ := c.Get("tenant_id")
+	if err := h.db.WithContext(c.Request.Context()).Where("id = ? AND tenant_id = ?", id, tenantID).First(&schedule).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export schedule not found"})
+		return schedule, false
+	}
+
+	return schedule, true
+}
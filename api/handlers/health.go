@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"nyasah-backend/services"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// healthTimeout bounds each dependency check
+const healthTimeout = 3 * time.Second
+
+type HealthHandler struct {
+	db        *gorm.DB
+	aiService *services.Service
+}
+
+func NewHealthHandler(db *gorm.DB, aiService *services.Service) *HealthHandler {
+	return &HealthHandler{db: db, aiService: aiService}
+}
+
+func (h *HealthHandler) pingDatabase(ctx context.Context) error {
+	sqlDB, err := h.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// check runs the named checks and responds 200 when all pass, or 503 with
+// the errors of those that failed
+func check(c *gin.Context, checks map[string]func(ctx context.Context) error) {
+	status := http.StatusOK
+	results := gin.H{}
+	for name, fn := range checks {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), healthTimeout)
+		err := fn(ctx)
+		cancel()
+		if err != nil {
+			status = http.StatusServiceUnavailable
+			results[name] = err.Error()
+			continue
+		}
+		results[name] = "ok"
+	}
+
+	overall := "ok"
+	if status != http.StatusOK {
+		overall = "unavailable"
+	}
+	c.JSON(status, gin.H{"status": overall, "checks": results})
+}
+
+// Healthz reports whether the server is alive, which only needs its database.
+// Use it for liveness probes.
+func (h *HealthHandler) Healthz(c *gin.Context) {
+	check(c, map[string]func(ctx context.Context) error{
+		"database": h.pingDatabase,
+	})
+}
+
+// Readyz reports whether the server can do its work: the database answers
+// and the AI provider's API can be reached. Use it for readiness probes.
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	check(c, map[string]func(ctx context.Context) error{
+		"database":    h.pingDatabase,
+		"ai_provider": h.aiService.PingProvider,
+	})
+}
@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
 	"nyasah-backend/models"
 	"nyasah-backend/services"
+	"nyasah-backend/services/timeframe"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -27,9 +30,9 @@ func (h *InsightsHandler) GetProductInsights(c *gin.Context) {
 	}
 
 	var insights models.ProductInsights
-	if err := h.db.Where("product_id = ?", productID).First(&insights).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Where("product_id = ?", productID).First(&insights).Error; err != nil {
 		// Generate new insights if none exist
-		insights, err = h.aiService.GenerateProductInsights(productID)
+		insights, err = h.aiService.GenerateProductInsights(c.Request.Context(), productID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate insights"})
 			return
@@ -39,10 +42,22 @@ func (h *InsightsHandler) GetProductInsights(c *gin.Context) {
 	c.JSON(http.StatusOK, insights)
 }
 
+// GetRecommendations returns the recommendations stored by the last refresh
+// job, generating them inline when none have been stored yet
 func (h *InsightsHandler) GetRecommendations(c *gin.Context) {
 	tenantID, _ := c.Get("tenant_id")
 
-	recommendations, err := h.aiService.GenerateRecommendations(tenantID.(uuid.UUID))
+	var recommendations []models.AIRecommendation
+	if err := h.db.WithContext(c.Request.Context()).Where("tenant_id = ?", tenantID).Order("confidence DESC").Find(&recommendations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recommendations"})
+		return
+	}
+	if len(recommendations) > 0 {
+		c.JSON(http.StatusOK, recommendations)
+		return
+	}
+
+	recommendations, err := h.aiService.GenerateRecommendations(c.Request.Context(), tenantID.(uuid.UUID))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recommendations"})
 		return
@@ -51,10 +66,36 @@ func (h *InsightsHandler) GetRecommendations(c *gin.Context) {
 	c.JSON(http.StatusOK, recommendations)
 }
 
+// GetTrendAnalysis reports sentiment, engagement and keyword trends over
+// calendar-aligned buckets. The time_zone query parameter overrides the
+// tenant's "time_zone" setting. Without a range the last 12 buckets are
+// returned, weekly by default.
 func (h *InsightsHandler) GetTrendAnalysis(c *gin.Context) {
 	tenantID, _ := c.Get("tenant_id")
 
-	analysis, err := h.aiService.AnalyzeTrends(tenantID.(uuid.UUID))
+	loc, err := h.location(c.Request.Context(), tenantID.(uuid.UUID), c.Query("time_zone"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	from, to, err := parseTimeRange(c, loc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	granularity := c.DefaultQuery("granularity", timeframe.Week)
+	spec := timeframe.Last(12, to, granularity, loc)
+	if !from.IsZero() {
+		spec = timeframe.Spec{From: from, To: to, Granularity: granularity, Location: loc}
+	}
+	if err := spec.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	analysis, err := h.aiService.AnalyzeTrends(c.Request.Context(), tenantID.(uuid.UUID), spec)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to analyze trends"})
 		return
@@ -62,3 +103,16 @@ func (h *InsightsHandler) GetTrendAnalysis(c *gin.Context) {
 
 	c.JSON(http.StatusOK, analysis)
 }
+
+// location resolves the requested time zone, falling back to the tenant's setting
+func (h *InsightsHandler) location(ctx context.Context, tenantID uuid.UUID, name string) (*time.Location, error) {
+	if name != "" {
+		return timeframe.LoadLocation(name)
+	}
+
+	var tenant models.Tenant
+	if err := h.db.WithContext(ctx).Select("settings").First(&tenant, "id = ?", tenantID).Error; err != nil {
+		return time.UTC, nil
+	}
+	return timeframe.TenantLocation(tenant.Settings), nil
+}
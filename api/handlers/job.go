@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"nyasah-backend/models"
+	"nyasah-backend/services/jobs"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type JobHandler struct {
+	db   *gorm.DB
+	jobs *jobs.Queue
+}
+
+func NewJobHandler(db *gorm.DB, queue *jobs.Queue) *JobHandler {
+	return &JobHandler{db: db, jobs: queue}
+}
+
+// List returns the tenant's most recent jobs, optionally filtered by status and type
+func (h *JobHandler) List(c *gin.Context) {
+	tenantID, _ := c.Get("tenant_id")
+
+	limit := 50
+	if raw := c.Query("limit"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 && n <= 200 {
+			limit = n
+		}
+	}
+
+	query := h.db.WithContext(c.Request.Context()).Where("tenant_id = ?", tenantID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if jobType := c.Query("type"); jobType != "" {
+		query = query.Where("type = ?", jobType)
+	}
+
+	var list []models.Job
+	if err := query.Order("created_at DESC").Limit(limit).Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch jobs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// Stats counts the tenant's jobs by status
+func (h *JobHandler) Stats(c *gin.Context) {
+	tenantID, _ := c.Get("tenant_id")
+
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	err := h.db.WithContext(c.Request.Context()).Model(&models.Job{}).
+		Select("status, COUNT(*) AS count").
+		Where("tenant_id = ?", tenantID).
+		Group("status").
+		Scan(&rows).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch job stats"})
+		return
+	}
+
+	stats := map[string]int64{
+		jobs.StatusQueued:    0,
+		jobs.StatusRunning:   0,
+		jobs.StatusSucceeded: 0,
+		jobs.StatusDead:      0,
+	}
+	for _, row := range rows {
+		stats[row.Status] = row.Count
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+func (h *JobHandler) Get(c *gin.Context) {
+	tenantID, _ := c.Get("tenant_id")
+
+	var job models.Job
+	if err := h.db.WithContext(c.Request.Context()).Where("tenant_id = ?", tenantID).First(&job, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// Retry requeues a dead-lettered job
+func (h *JobHandler) Retry(c *gin.Context) {
+	jobID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	tenantID, _ := c.Get("tenant_id")
+
+	job, err := h.jobs.Retry(tenantID.(uuid.UUID), jobID)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	case errors.Is(err, jobs.ErrNotDead):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry job"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"nyasah-backend/models"
+	"nyasah-backend/services/presence"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type PresenceHandler struct {
+	tracker *presence.Tracker
+}
+
+func NewPresenceHandler(tracker *presence.Tracker) *PresenceHandler {
+	return &PresenceHandler{tracker: tracker}
+}
+
+type presenceInput struct {
+	EntityID  uuid.UUID `json:"entity_id" binding:"required"`
+	VisitorID string    `json:"visitor_id" binding:"required"`
+}
+
+// Ping records a heartbeat from a storefront visitor and returns the count to display
+func (h *PresenceHandler) Ping(c *gin.Context) {
+	tenant := c.MustGet("tenant").(models.Tenant)
+
+	var input presenceInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.tracker.Ping(tenant.ID, input.EntityID, input.VisitorID); err != nil {
+		if errors.Is(err, presence.ErrUnknownEntity) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Entity not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record presence"})
+		return
+	}
+
+	c.JSON(http.StatusOK, presence.RulesFromSettings(tenant.Settings).Apply(h.tracker.Actual(tenant.ID, input.EntityID)))
+}
+
+// Leave removes a visitor right away, e.g. when the page is hidden
+func (h *PresenceHandler) Leave(c *gin.Context) {
+	tenant := c.MustGet("tenant").(models.Tenant)
+
+	var input presenceInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.tracker.Leave(tenant.ID, input.EntityID, input.VisitorID)
+
+	c.Status(http.StatusNoContent)
+}
+
+// Get returns the displayable viewer count for an entity
+func (h *PresenceHandler) Get(c *gin.Context) {
+	tenant := c.MustGet("tenant").(models.Tenant)
+
+	entityID, err := uuid.Parse(c.Param("entity_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid entity ID"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, presence.RulesFromSettings(tenant.Settings).Apply(h.tracker.Actual(tenant.ID, entityID)))
+}
+
+// EntityPresence shows tenant users the real count alongside what storefronts display
+func (h *PresenceHandler) EntityPresence(c *gin.Context) {
+	entityID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid entity ID"})
+		return
+	}
+
+	tenantID, _ := c.Get("tenant_id")
+	rules := h.tracker.Rules(tenantID.(uuid.UUID))
+	actual := h.tracker.Actual(tenantID.(uuid.UUID), entityID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"actual":  actual,
+		"display": rules.Apply(actual),
+		"rules":   rules,
+	})
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"net/http"
+	"nyasah-backend/models"
+	"nyasah-backend/services/proofs"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ProofPolicyHandler struct {
+	db     *gorm.DB
+	proofs *proofs.Service
+}
+
+func NewProofPolicyHandler(db *gorm.DB) *ProofPolicyHandler {
+	return &ProofPolicyHandler{db: db, proofs: proofs.NewService(db)}
+}
+
+func (h *ProofPolicyHandler) List(c *gin.Context) {
+	tenantID, _ := c.Get("tenant_id")
+
+	var list []models.ProofPolicy
+	if err := h.db.WithContext(c.Request.Context()).Where("tenant_id = ?", tenantID).Order("type").Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch proof policies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// Get returns the effective policy for a type, including built-in defaults
+func (h *ProofPolicyHandler) Get(c *gin.Context) {
+	tenantID, _ := c.Get("tenant_id")
+
+	policy, err := h.proofs.Policy(tenantID.(uuid.UUID), c.Param("type"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch proof policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// Put creates or replaces the policy for a proof type and re-applies archival
+func (h *ProofPolicyHandler) Put(c *gin.Context) {
+	var input struct {
+		TTLMinutes    int    `json:"ttl_minutes"`
+		Rotation      string `json:"rotation"`
+		DedupeMinutes int    `json:"dedupe_minutes"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Rotation == "" {
+		input.Rotation = proofs.RotationRecent
+	}
+	if !proofs.ValidRotation(input.Rotation) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rotation strategy"})
+		return
+	}
+	if input.TTLMinutes < 0 || input.DedupeMinutes < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "TTL and dedupe window cannot be negative"})
+		return
+	}
+
+	tenantID, _ := c.Get("tenant_id")
+
+	policy := models.ProofPolicy{
+		TenantID:      tenantID.(uuid.UUID),
+		Type:          c.Param("type"),
+		TTLMinutes:    input.TTLMinutes,
+		Rotation:      input.Rotation,
+		DedupeMinutes: input.DedupeMinutes,
+	}
+
+	err := h.db.WithContext(c.Request.Context()).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "tenant_id"}, {Name: "type"}},
+		DoUpdates: clause.AssignmentColumns([]string{"ttl_minutes", "rotation", "dedupe_minutes", "updated_at"}),
+	}).Create(&policy).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save proof policy"})
+		return
+	}
+
+	if err := h.proofs.Refresh(policy.TenantID, policy.Type); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply proof policy"})
+		return
+	}
+
+	h.Get(c)
+}
+
+// Delete removes the tenant's policy so the type falls back to the default
+func (h *ProofPolicyHandler) Delete(c *gin.Context) {
+	tenantID, _ := c.Get("tenant_id")
+
+	result := h.db.WithContext(c.Request.Context()).Where("tenant_id = ? AND type = ?", tenantID, c.Param("type")).Delete(&models.ProofPolicy{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete proof policy"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Proof policy not found"})
+		return
+	}
+
+	if err := h.proofs.Refresh(tenantID.(uuid.UUID), c.Param("type")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply proof policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Proof policy deleted successfully"})
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"net/http"
+	"nyasah-backend/models"
+	"nyasah-backend/services/templates"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type ProofTemplateHandler struct {
+	db *gorm.DB
+}
+
+func NewProofTemplateHandler(db *gorm.DB) *ProofTemplateHandler {
+	return &ProofTemplateHandler{db: db}
+}
+
+var nameStyles = map[string]bool{
+	templates.NameFull:         true,
+	templates.NameFirst:        true,
+	templates.NameFirstInitial: true,
+	templates.NameAnonymous:    true,
+}
+
+func (h *ProofTemplateHandler) Create(c *gin.Context) {
+	var input struct {
+		Type      string `json:"type" binding:"required"`
+		Locale    string `json:"locale" binding:"required"`
+		Body      string `json:"body" binding:"required"`
+		NameStyle string `json:"name_style"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.NameStyle == "" {
+		input.NameStyle = templates.NameFirstInitial
+	}
+	if !nameStyles[input.NameStyle] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid name style"})
+		return
+	}
+
+	tenantID, _ := c.Get("tenant_id")
+
+	tmpl := models.ProofTemplate{
+		TenantID:  tenantID.(uuid.UUID),
+		Type:      input.Type,
+		Locale:    input.Locale,
+		Body:      input.Body,
+		NameStyle: input.NameStyle,
+	}
+
+	if err := h.db.WithContext(c.Request.Context()).Create(&tmpl).Error; err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Template already exists for this type and locale"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, tmpl)
+}
+
+func (h *ProofTemplateHandler) List(c *gin.Context) {
+	tenantID, _ := c.Get("tenant_id")
+
+	var tmpls []models.ProofTemplate
+	if err := h.db.WithContext(c.Request.Context()).Where("tenant_id = ?", tenantID).Order("type, locale").Find(&tmpls).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch templates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tmpls)
+}
+
+func (h *ProofTemplateHandler) Update(c *gin.Context) {
+	var input struct {
+		Body      string `json:"body"`
+		NameStyle string `json:"name_style"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tmpl, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	updates := make(map[string]interface{})
+	if input.Body != "" {
+		updates["body"] = input.Body
+	}
+	if input.NameStyle != "" {
+		if !nameStyles[input.NameStyle] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid name style"})
+			return
+		}
+		updates["name_style"] = input.NameStyle
+	}
+
+	if err := h.db.WithContext(c.Request.Context()).Model(&tmpl).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update template"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tmpl)
+}
+
+func (h *ProofTemplateHandler) Delete(c *gin.Context) {
+	tmpl, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.WithContext(c.Request.Context()).Delete(&tmpl).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete template"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Template deleted successfully"})
+}
+
+// Preview renders a template body against sample proof data without saving it
+func (h *ProofTemplateHandler) Preview(c *gin.Context) {
+	var input struct {
+		Body       string      `json:"body" binding:"required"`
+		Locale     string      `json:"locale"`
+		NameStyle  string      `json:"name_style"`
+		EntityName string      `json:"entity_name"`
+		Data       models.JSON `json:"data"`
+		MinutesAgo int         `json:"minutes_ago"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Locale == "" {
+		input.Locale = "en"
+	}
+
+	now := time.Now()
+	proof := models.SocialProof{
+		Metadata:  input.Data,
+		CreatedAt: now.Add(-time.Duration(input.MinutesAgo) * time.Minute),
+	}
+	vars := templates.ProofVars(proof, input.EntityName, input.NameStyle, input.Locale, now)
+
+	c.JSON(http.StatusOK, gin.H{"content": templates.Format(input.Body, vars, input.Locale)})
+}
+
+func (h *ProofTemplateHandler) find(c *gin.Context) (models.ProofTemplate, bool) {
+	var tmpl models.ProofTemplate
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+		return tmpl, false
+	}
+
+	tenantID, _ := c.Get("tenant_id")
+	if err := h.db.WithContext(c.Request.Context()).Where("id = ? AND tenant_id = ?", id, tenantID).First(&tmpl).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return tmpl, false
+	}
+
+	return tmpl, true
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"nyasah-backend/services/attribution"
+	"nyasah-backend/services/cohorts"
+	"nyasah-backend/services/timeframe"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type ReportHandler struct {
+	attribution *attribution.Service
+	cohorts     *cohorts.Service
+	window      time.Duration
+}
+
+// NewReportHandler creates the report handler. attributionWindow is how far
+// back a conversion looks for the proofs that led to it.
+func NewReportHandler(db *gorm.DB, attributionWindow time.Duration) *ReportHandler {
+	return &ReportHandler{attribution: attribution.NewService(db), cohorts: cohorts.NewService(db), window: attributionWindow}
+}
+
+// Funnel reports impressions, clicks and conversions per proof type or
+// entity, with conversions credited under first-touch, last-touch and linear
+// attribution. from and to default to the last 30 days.
+func (h *ReportHandler) Funnel(c *gin.Context) {
+	tenantID, _ := c.Get("tenant_id")
+
+	from, to, ok := reportRange(c)
+	if !ok {
+		return
+	}
+
+	report, err := h.attribution.Funnel(attribution.FunnelQuery{
+		TenantID: tenantID.(uuid.UUID),
+		From:     from,
+		To:       to,
+		GroupBy:  c.Query("group_by"),
+		Window:   h.window,
+	})
+	switch {
+	case errors.Is(err, attribution.ErrInvalidGroup), errors.Is(err, attribution.ErrInvalidRange):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build funnel report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// Lift compares the conversion rate of visitors shown proof with the holdout
+// group. confidence sets the level of the intervals and defaults to 0.95.
+func (h *ReportHandler) Lift(c *gin.Context) {
+	tenantID, _ := c.Get("tenant_id")
+
+	from, to, ok := reportRange(c)
+	if !ok {
+		return
+	}
+
+	query := attribution.LiftQuery{TenantID: tenantID.(uuid.UUID), From: from, To: to}
+	if raw := c.Query("confidence"); raw != "" {
+		confidence, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": attribution.ErrInvalidConfidence.Error()})
+			return
+		}
+		query.Confidence = confidence
+	}
+
+	lift, err := h.attribution.Lift(query)
+	switch {
+	case errors.Is(err, attribution.ErrInvalidConfidence), errors.Is(err, attribution.ErrInvalidRange):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build lift report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, lift)
+}
+
+// Cohorts reports how customers whose first review or purchase fell in the
+// same week or month came back to review, buy and engage in the periods
+// after. from and to select the cohorts and default to the last 12 of them.
+func (h *ReportHandler) Cohorts(c *gin.Context) {
+	tenantID, _ := c.Get("tenant_id")
+
+	from, to, err := parseTimeRange(c, time.UTC)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := cohorts.Query{
+		TenantID:    tenantID.(uuid.UUID),
+		By:          c.Query("cohort"),
+		Granularity: c.Query("granularity"),
+		From:        from,
+		To:          to,
+	}
+	if raw := c.Query("periods"); raw != "" {
+		periods, err := strconv.Atoi(raw)
+		if err != nil || periods < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": cohorts.ErrInvalidPeriods.Error()})
+			return
+		}
+		query.Periods = periods
+	}
+	if query.From.IsZero() {
+		if query.Granularity == timeframe.Month {
+			query.From = to.AddDate(0, -11, 0)
+		} else {
+			query.From = to.AddDate(0, 0, -7*11)
+		}
+	}
+
+	report, err := h.cohorts.Report(query)
+	switch {
+	case errors.Is(err, cohorts.ErrInvalidCohort), errors.Is(err, cohorts.ErrInvalidGranularity),
+		errors.Is(err, cohorts.ErrInvalidPeriods), errors.Is(err, cohorts.ErrInvalidRange):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build cohort report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+func reportRange(c *gin.Context) (time.Time, time.Time, bool) {
+	from, to, err := parseTimeRange(c, time.UTC)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return from, to, false
+	}
+	if from.IsZero() {
+		from = to.AddDate(0, 0, -30)
+	}
+	return from, to, true
+}
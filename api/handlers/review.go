@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
 	"nyasah-backend/models"
+	"nyasah-backend/services/importer"
+	"nyasah-backend/services/jobs"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -10,11 +13,12 @@ import (
 )
 
 type ReviewHandler struct {
-	db *gorm.DB
+	db   *gorm.DB
+	jobs *jobs.Queue
 }
 
-func NewReviewHandler(db *gorm.DB) *ReviewHandler {
-	return &ReviewHandler{db: db}
+func NewReviewHandler(db *gorm.DB, queue *jobs.Queue) *ReviewHandler {
+	return &ReviewHandler{db: db, jobs: queue}
 }
 
 func (h *ReviewHandler) Create(c *gin.Context) {
@@ -30,8 +34,10 @@ func (h *ReviewHandler) Create(c *gin.Context) {
 	}
 
 	userID, _ := c.Get("user_id")
+	tenantID, _ := c.Get("tenant_id")
 
 	review := models.Review{
+		TenantID: tenantID.(uuid.UUID),
 		UserID:   userID.(uuid.UUID),
 		EntityID: input.ProductID,
 		Rating:   input.Rating,
@@ -39,17 +45,27 @@ func (h *ReviewHandler) Create(c *gin.Context) {
 		Verified: true,
 	}
 
-	if err := h.db.Create(&review).Error; err != nil {
+	// Fingerprinted like imported reviews, so importing the same review later is skipped
+	var user models.User
+	h.db.WithContext(c.Request.Context()).Select("email").Where("id = ?", review.UserID).Take(&user)
+	review.ContentHash = importer.ContentHash(review.EntityID, importer.AuthorKey("", user.Email), review.Content)
+
+	if err := h.db.WithContext(c.Request.Context()).Create(&review).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create review"})
 		return
 	}
 
+	// Sentiment, keywords and the entity's insights are computed in the background
+	if err := h.jobs.ReviewCreated(review); err != nil {
+		log.Printf("Failed to queue analysis for review %s: %v", review.ID, err)
+	}
+
 	c.JSON(http.StatusCreated, review)
 }
 
 func (h *ReviewHandler) List(c *gin.Context) {
 	var reviews []models.Review
-	if err := h.db.Find(&reviews).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Find(&reviews).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
 		return
 	}
@@ -65,7 +81,7 @@ func (h *ReviewHandler) Get(c *gin.Context) {
 	}
 
 	var review models.Review
-	if err := h.db.First(&review, id).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).First(&review, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
 		return
 	}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"nyasah-backend/models"
+	"nyasah-backend/services/importer"
+	"nyasah-backend/services/jobs"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type ReviewImportHandler struct {
+	db       *gorm.DB
+	importer *importer.Importer
+	jobs     *jobs.Queue
+}
+
+func NewReviewImportHandler(db *gorm.DB, queue *jobs.Queue) *ReviewImportHandler {
+	return &ReviewImportHandler{
+		db:       db,
+		importer: importer.NewImporter(db),
+		jobs:     queue,
+	}
+}
+
+// Import accepts a multipart upload with a "file" part plus form fields:
+// format (csv|ndjson), preset (yotpo, judgeme, ...), mapping (JSON) and entity_id.
+func (h *ReviewImportHandler) Import(c *gin.Context) {
+	format := c.DefaultPostForm("format", importer.FormatCSV)
+	preset := c.PostForm("preset")
+
+	var overrides *importer.FieldMapping
+	if raw := c.PostForm("mapping"); raw != "" {
+		overrides = &importer.FieldMapping{}
+		if err := json.Unmarshal([]byte(raw), overrides); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid field mapping"})
+			return
+		}
+	}
+
+	mapping, err := importer.ResolveMapping(preset, overrides)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var defaultEntityID uuid.UUID
+	if raw := c.PostForm("entity_id"); raw != "" {
+		defaultEntityID, err = uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid entity ID"})
+			return
+		}
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Import file required"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read import file"})
+		return
+	}
+	defer file.Close()
+
+	tenantID, _ := c.Get("tenant_id")
+
+	result, err := h.importer.Import(file, importer.Options{
+		TenantID:        tenantID.(uuid.UUID),
+		Format:          format,
+		Mapping:         mapping,
+		DefaultEntityID: defaultEntityID,
+		Source:          preset,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Queue analysis of the imported reviews
+	for _, id := range result.ReviewIDs {
+		review := models.Review{ID: id, TenantID: tenantID.(uuid.UUID)}
+		if err := h.jobs.ReviewCreated(review); err != nil {
+			log.Printf("Failed to queue analysis for review %s: %v", id, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	netmail "net/mail"
+	"nyasah-backend/models"
+	"nyasah-backend/services/reports"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type ScheduledReportHandler struct {
+	db      *gorm.DB
+	reports *reports.Service
+}
+
+func NewScheduledReportHandler(db *gorm.DB, service *reports.Service) *ScheduledReportHandler {
+	return &ScheduledReportHandler{db: db, reports: service}
+}
+
+type reportDefinitionInput struct {
+	Name       string   `json:"name"`
+	Schedule   string   `json:"schedule"`
+	Sections   []string `json:"sections"`
+	Recipients []string `json:"recipients"`
+	Enabled    *bool    `json:"enabled"`
+}
+
+// apply copies the fields that were given onto the definition
+func (in reportDefinitionInput) apply(def *models.ReportDefinition) {
+	if in.Name != "" {
+		def.Name = in.Name
+	}
+	if in.Schedule != "" {
+		def.Schedule = in.Schedule
+	}
+	if in.Sections != nil {
+		def.Sections = in.Sections
+	}
+	if in.Recipients != nil {
+		def.Recipients = in.Recipients
+	}
+	if in.Enabled != nil {
+		def.Enabled = *in.Enabled
+	}
+}
+
+// validateDefinition normalizes the definition and checks its recipients
+func validateDefinition(def *models.ReportDefinition) error {
+	if err := reports.Normalize(def); err != nil {
+		return err
+	}
+	for _, email := range def.Recipients {
+		if _, err := netmail.ParseAddress(email); err != nil {
+			return fmt.Errorf("invalid email address %q", email)
+		}
+	}
+	return nil
+}
+
+// schedule validates the definition and sets its next run, writing the
+// response when it fails
+func (h *ScheduledReportHandler) schedule(c *gin.Context, def *models.ReportDefinition) bool {
+	if err := validateDefinition(def); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	err := h.reports.Reschedule(def, time.Now())
+	if errors.Is(err, reports.ErrNeverRuns) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule report"})
+		return false
+	}
+	return true
+}
+
+func (h *ScheduledReportHandler) Create(c *gin.Context) {
+	var input reportDefinitionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Name == "" || input.Schedule == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Report name and schedule required"})
+		return
+	}
+
+	tenantID, _ := c.Get("tenant_id")
+
+	def := models.ReportDefinition{TenantID: tenantID.(uuid.UUID), Enabled: true}
+	input.apply(&def)
+	if !h.schedule(c, &def) {
+		return
+	}
+
+	if err := h.db.WithContext(c.Request.Context()).Create(&def).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create report"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, def)
+}
+
+func (h *ScheduledReportHandler) List(c *gin.Context) {
+	tenantID, _ := c.Get("tenant_id")
+
+	var list []models.ReportDefinition
+	if err := h.db.WithContext(c.Request.Context()).Where("tenant_id = ?", tenantID).Order("created_at").Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reports"})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *ScheduledReportHandler) Get(c *gin.Context) {
+	def, ok := h.findDefinition(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, def)
+}
+
+func (h *ScheduledReportHandler) Update(c *gin.Context) {
+	var input reportDefinitionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	def, ok := h.findDefinition(c)
+	if !ok {
+		return
+	}
+
+	input.apply(&def)
+	if !h.schedule(c, &def) {
+		return
+	}
+
+	if err := h.db.WithContext(c.Request.Context()).Save(&def).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, def)
+}
+
+// Delete removes a report definition along with its past runs
+func (h *ScheduledReportHandler) Delete(c *gin.Context) {
+	def, ok := h.findDefinition(c)
+	if !ok {
+		return
+	}
+
+	err := h.db.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("definition_id = ?", def.ID).Delete(&models.ReportRun{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&def).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Report deleted successfully"})
+}
+
+// Run queues a run covering the time since the last scheduled one, without
+// changing the schedule
+func (h *ScheduledReportHandler) Run(c *gin.Context) {
+	def, ok := h.findDefinition(c)
+	if !ok {
+		return
+	}
+
+	job, err := h.reports.Trigger(def, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue report"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// ListRuns returns a definition's most recent runs
+func (h *ScheduledReportHandler) ListRuns(c *gin.Context) {
+	def, ok := h.findDefinition(c)
+	if !ok {
+		return
+	}
+
+	limit := 50
+	if raw := c.Query("limit"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 && n <= 200 {
+			limit = n
+		}
+	}
+
+	var runs []models.ReportRun
+	if err := h.db.WithContext(c.Request.Context()).Where("definition_id = ?", def.ID).Order("period_end DESC").Limit(limit).Find(&runs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch report runs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, runs)
+}
+
+// Download returns a past run as HTML, or as CSV with format=csv
+func (h *ScheduledReportHandler) Download(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid report run ID"})
+		return
+	}
+
+	format := c.DefaultQuery("format", "html")
+	if format != "html" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be html or csv"})
+		return
+	}
+
+	tenantID, _ := c.Get("tenant_id")
+
+	var run models.ReportRun
+	if err := h.db.WithContext(c.Request.Context()).Where("id = ? AND tenant_id = ?", id, tenantID).First(&run).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report run not found"})
+		return
+	}
+
+	var def models.ReportDefinition
+	h.db.WithContext(c.Request.Context()).Select("id", "name").First(&def, "id = ?", run.DefinitionID)
+	end := run.PeriodEnd
+	if loc, err := h.reports.Location(run.TenantID); err == nil {
+		end = end.In(loc)
+	}
+	filename := reports.Filename(def.Name, end, format)
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if format == "csv" {
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", []byte(run.CSV))
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(run.HTML))
+}
+
+func (h *ScheduledReportHandler) findDefinition(c *gin.Context) (models.ReportDefinition, bool) {
+	var def models.ReportDefinition
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid report ID"})
+		return def, false
+	}
+
+	tenantID, _ := c.Get("tenant_id")
+	if err := h.db.WithContext(c.Request.Context()).Where("id = ? AND tenant_id = ?", id, tenantID).First(&def).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report not found"})
+		return def, false
+	}
+
+	return def, true
+}
@@ -1,8 +1,20 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"log"
 	"net/http"
 	"nyasah-backend/models"
+	"nyasah-backend/services/analytics"
+	"nyasah-backend/services/jobs"
+	"nyasah-backend/services/proofs"
+	"nyasah-backend/services/stream"
+	"nyasah-backend/services/templates"
+	"nyasah-backend/services/timeframe"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -10,18 +22,32 @@ import (
 )
 
 type SocialProofHandler struct {
-	db *gorm.DB
+	db        *gorm.DB
+	hub       *stream.Hub
+	templates *templates.Service
+	proofs    *proofs.Service
+	analytics *analytics.Service
+	jobs      *jobs.Queue
 }
 
-func NewSocialProofHandler(db *gorm.DB) *SocialProofHandler {
-	return &SocialProofHandler{db: db}
+func NewSocialProofHandler(db *gorm.DB, hub *stream.Hub, queue *jobs.Queue) *SocialProofHandler {
+	return &SocialProofHandler{
+		db:        db,
+		hub:       hub,
+		templates: templates.NewService(db),
+		proofs:    proofs.NewService(db),
+		analytics: analytics.NewService(db),
+		jobs:      queue,
+	}
 }
 
 func (h *SocialProofHandler) Create(c *gin.Context) {
 	var input struct {
-		Type      string    `json:"type" binding:"required"`
-		ProductID uuid.UUID `json:"product_id" binding:"required"`
-		Content   string    `json:"content"`
+		Type      string      `json:"type" binding:"required"`
+		ProductID uuid.UUID   `json:"product_id" binding:"required"`
+		Content   string      `json:"content"`
+		MediaType string      `json:"media_type"`
+		Data      models.JSON `json:"data"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -30,44 +56,193 @@ func (h *SocialProofHandler) Create(c *gin.Context) {
 	}
 
 	userID, _ := c.Get("user_id")
+	tenantID, _ := c.Get("tenant_id")
 
 	proof := models.SocialProof{
-		Type:     input.Type,
-		EntityID: input.ProductID,
-		UserID:   userID.(uuid.UUID),
-		Content:  input.Content,
+		TenantID:  tenantID.(uuid.UUID),
+		Type:      input.Type,
+		EntityID:  input.ProductID,
+		UserID:    userID.(uuid.UUID),
+		Content:   input.Content,
+		MediaType: input.MediaType,
+		Metadata:  input.Data,
 	}
 
-	if err := h.db.Create(&proof).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Create(&proof).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create social proof"})
 		return
 	}
 
+	// Push the new proof to live storefront feeds, rendered in the tenant's default locale
+	rendered := []models.SocialProof{proof}
+	if err := h.templates.RenderProofs(proof.TenantID, rendered, ""); err != nil {
+		log.Printf("Failed to render proof %s for live feeds: %v", proof.ID, err)
+	}
+
+	h.hub.Publish(stream.Event{
+		TenantID: proof.TenantID,
+		EntityID: proof.EntityID,
+		Type:     "proof",
+		Data: gin.H{
+			"id":         proof.ID,
+			"type":       proof.Type,
+			"content":    rendered[0].Content,
+			"media_type": proof.MediaType,
+			"data":       proof.Metadata,
+		},
+		CreatedAt: proof.CreatedAt,
+	})
+
+	// Refresh the entity's insights and the tenant's recommendations in the background
+	if err := h.jobs.ProofCreated(proof); err != nil {
+		log.Printf("Failed to queue refresh for proof %s: %v", proof.ID, err)
+	}
+
 	c.JSON(http.StatusCreated, proof)
 }
 
+// List returns the tenant's proofs with content rendered from templates in
+// the viewer's locale (the locale query parameter or Accept-Language).
+// Expired proofs are left out and each type is de-duplicated and rotated per
+// its policy; archived=true lists archived proofs instead.
 func (h *SocialProofHandler) List(c *gin.Context) {
-	var proofs []models.SocialProof
-	if err := h.db.Find(&proofs).Error; err != nil {
+	tenantID, _ := c.Get("tenant_id")
+
+	query := proofs.Query{TenantID: tenantID.(uuid.UUID), Limit: 50}
+	if raw := c.Query("type"); raw != "" {
+		query.Types = strings.Split(raw, ",")
+	}
+	if raw := c.Query("entity_id"); raw != "" {
+		entityID, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid entity ID"})
+			return
+		}
+		query.EntityID = entityID
+	}
+	if raw := c.Query("limit"); raw != "" {
+		if limit, err := strconv.Atoi(raw); err == nil && limit > 0 && limit <= 200 {
+			query.Limit = limit
+		}
+	}
+
+	var list []models.SocialProof
+	var err error
+	if c.Query("archived") == "true" {
+		list, err = h.archived(c.Request.Context(), query)
+	} else {
+		list, err = h.proofs.Select(query)
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch social proofs"})
 		return
 	}
 
-	c.JSON(http.StatusOK, proofs)
+	locale := c.Query("locale")
+	if locale == "" {
+		locale = templates.LocaleFromHeader(c.GetHeader("Accept-Language"))
+	}
+	if err := h.templates.RenderProofs(tenantID.(uuid.UUID), list, locale); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render social proofs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *SocialProofHandler) archived(ctx context.Context, q proofs.Query) ([]models.SocialProof, error) {
+	query := h.db.WithContext(ctx).Preload("Entity").Preload("User").
+		Where("tenant_id = ? AND archived_at IS NOT NULL", q.TenantID)
+	if len(q.Types) > 0 {
+		query = query.Where("type IN ?", q.Types)
+	}
+	if q.EntityID != uuid.Nil {
+		query = query.Where("entity_id = ?", q.EntityID)
+	}
+
+	var list []models.SocialProof
+	err := query.Order("archived_at DESC").Limit(q.Limit).Find(&list).Error
+	return list, err
 }
 
+// GetAnalytics reports the tenant's impressions, clicks and conversions from
+// the hourly rollups. from and to accept RFC 3339 timestamps or dates (to is
+// inclusive for dates) and default to the last 30 days. granularity is hour,
+// day, week or month, and group_by is a comma-separated list of type, media
+// and entity.
 func (h *SocialProofHandler) GetAnalytics(c *gin.Context) {
-	var stats struct {
-		TotalProofs    int64 `json:"total_proofs"`
-		PurchaseProofs int64 `json:"purchase_proofs"`
-		ReviewProofs   int64 `json:"review_proofs"`
-		ViewProofs     int64 `json:"view_proofs"`
+	tenantID, _ := c.Get("tenant_id")
+
+	from, to, err := parseTimeRange(c, time.UTC)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if from.IsZero() {
+		from = to.AddDate(0, 0, -30)
 	}
 
-	h.db.Model(&models.SocialProof{}).Count(&stats.TotalProofs)
-	h.db.Model(&models.SocialProof{}).Where("type = ?", "purchase").Count(&stats.PurchaseProofs)
-	h.db.Model(&models.SocialProof{}).Where("type = ?", "review").Count(&stats.ReviewProofs)
-	h.db.Model(&models.SocialProof{}).Where("type = ?", "view").Count(&stats.ViewProofs)
+	query := analytics.Query{
+		TenantID:    tenantID.(uuid.UUID),
+		From:        from,
+		To:          to,
+		Granularity: c.Query("granularity"),
+	}
+	if raw := c.Query("group_by"); raw != "" {
+		query.GroupBy = strings.Split(raw, ",")
+	}
+	if raw := c.Query("limit"); raw != "" {
+		if limit, err := strconv.Atoi(raw); err == nil && limit > 0 {
+			query.Limit = limit
+		}
+	}
 
-	c.JSON(http.StatusOK, stats)
+	report, err := h.analytics.Report(query)
+	switch {
+	case errors.Is(err, analytics.ErrInvalidGroup), errors.Is(err, timeframe.ErrInvalidGranularity),
+		errors.Is(err, timeframe.ErrInvalidRange), errors.Is(err, timeframe.ErrTooManyFrames):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analytics"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// parseTimeRange reads the from and to query parameters as RFC 3339 times or
+// dates in loc. A date to includes that whole day. to defaults to now and
+// from is zero when not given.
+func parseTimeRange(c *gin.Context, loc *time.Location) (time.Time, time.Time, error) {
+	var from time.Time
+	to := time.Now()
+
+	if raw := c.Query("to"); raw != "" {
+		t, dateOnly, err := parseTime(raw, loc)
+		if err != nil {
+			return from, to, errors.New("invalid to time")
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		to = t
+	}
+	if raw := c.Query("from"); raw != "" {
+		t, _, err := parseTime(raw, loc)
+		if err != nil {
+			return from, to, errors.New("invalid from time")
+		}
+		from = t
+	}
+
+	return from, to, nil
+}
+
+func parseTime(raw string, loc *time.Location) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation("2006-01-02", raw, loc); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	return t, false, err
 }
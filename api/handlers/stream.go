@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"nyasah-backend/services/metrics"
+	"nyasah-backend/services/stream"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	streamHeartbeat  = 15 * time.Second
+	streamWriteLimit = 10 * time.Second
+)
+
+type StreamHandler struct {
+	hub      *stream.Hub
+	upgrader websocket.Upgrader
+}
+
+func NewStreamHandler(hub *stream.Hub) *StreamHandler {
+	return &StreamHandler{
+		hub: hub,
+		upgrader: websocket.Upgrader{
+			// Origins are already checked against the tenant domain by WidgetMiddleware
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	}
+}
+
+// subscribe parses the feed parameters shared by SSE and WebSocket and
+// registers the subscriber with the hub
+func (h *StreamHandler) subscribe(c *gin.Context) (*stream.Subscription, []stream.Event, bool) {
+	tenantID, _ := c.Get("tenant_id")
+
+	var entityID uuid.UUID
+	if raw := c.Query("entity_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid entity ID"})
+			return nil, nil, false
+		}
+		entityID = id
+	}
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	lastID, _ := strconv.ParseUint(lastEventID, 10, 64)
+
+	sub, replay, err := h.hub.Subscribe(tenantID.(uuid.UUID), entityID, lastID)
+	if errors.Is(err, stream.ErrTooManyConnections) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many open connections"})
+		return nil, nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open stream"})
+		return nil, nil, false
+	}
+
+	return sub, replay, true
+}
+
+// SSE streams proof events as Server-Sent Events. Browsers reconnect
+// automatically and send Last-Event-ID so missed events are replayed.
+func (h *StreamHandler) SSE(c *gin.Context) {
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Streaming unsupported"})
+		return
+	}
+
+	sub, replay, ok := h.subscribe(c)
+	if !ok {
+		return
+	}
+	defer h.hub.Unsubscribe(sub)
+	defer metrics.StreamOpened("sse")()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	fmt.Fprintf(c.Writer, "retry: 3000\n\n")
+	for _, event := range replay {
+		writeSSEEvent(c.Writer, event)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	ctx := c.Request.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, open := <-sub.Events:
+			if !open {
+				return
+			}
+			writeSSEEvent(c.Writer, event)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprintf(c.Writer, ": heartbeat\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func writeSSEEvent(w gin.ResponseWriter, event stream.Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+}
+
+// WebSocket streams proof events as JSON messages. Clients pass
+// last_event_id when reconnecting to receive missed events.
+func (h *StreamHandler) WebSocket(c *gin.Context) {
+	sub, replay, ok := h.subscribe(c)
+	if !ok {
+		return
+	}
+	defer h.hub.Unsubscribe(sub)
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	defer metrics.StreamOpened("websocket")()
+
+	// Drain client frames so pongs and close messages are processed
+	closed := make(chan struct{})
+	conn.SetReadDeadline(time.Now().Add(2 * streamHeartbeat))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * streamHeartbeat))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for _, event := range replay {
+		if !writeWSEvent(conn, event) {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case event, open := <-sub.Events:
+			if !open {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "reconnect"),
+					time.Now().Add(streamWriteLimit))
+				return
+			}
+			if !writeWSEvent(conn, event) {
+				return
+			}
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteLimit)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeWSEvent(conn *websocket.Conn, event stream.Event) bool {
+	conn.SetWriteDeadline(time.Now().Add(streamWriteLimit))
+	return conn.WriteJSON(event) == nil
+}
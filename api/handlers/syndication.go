@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"nyasah-backend/models"
+	"nyasah-backend/services/syndication"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type SyndicationHandler struct {
+	db          *gorm.DB
+	syndication *syndication.Service
+}
+
+func NewSyndicationHandler(db *gorm.DB) *SyndicationHandler {
+	return &SyndicationHandler{db: db, syndication: syndication.NewService(db)}
+}
+
+func (h *SyndicationHandler) CreateGroup(c *gin.Context) {
+	var input struct {
+		Name              string      `json:"name" binding:"required"`
+		EntityIDs         []uuid.UUID `json:"entity_ids"`
+		CountInAggregates bool        `json:"count_in_aggregates"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenantID, _ := c.Get("tenant_id")
+
+	if !h.entitiesBelongToTenant(c.Request.Context(), tenantID.(uuid.UUID), input.EntityIDs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown entity in group"})
+		return
+	}
+
+	group := models.SyndicationGroup{
+		TenantID:          tenantID.(uuid.UUID),
+		Name:              input.Name,
+		Enabled:           true,
+		CountInAggregates: input.CountInAggregates,
+	}
+	for _, entityID := range input.EntityIDs {
+		group.Members = append(group.Members, models.SyndicationMember{EntityID: entityID})
+	}
+
+	if err := h.db.WithContext(c.Request.Context()).Create(&group).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create syndication group"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, group)
+}
+
+func (h *SyndicationHandler) ListGroups(c *gin.Context) {
+	tenantID, _ := c.Get("tenant_id")
+
+	var groups []models.SyndicationGroup
+	if err := h.db.WithContext(c.Request.Context()).Preload("Members").Where("tenant_id = ?", tenantID).Find(&groups).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch syndication groups"})
+		return
+	}
+
+	c.JSON(http.StatusOK, groups)
+}
+
+func (h *SyndicationHandler) UpdateGroup(c *gin.Context) {
+	var input struct {
+		Name              string `json:"name"`
+		Enabled           *bool  `json:"enabled"`
+		CountInAggregates *bool  `json:"count_in_aggregates"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	group, ok := h.findGroup(c)
+	if !ok {
+		return
+	}
+
+	updates := make(map[string]interface{})
+	if input.Name != "" {
+		updates["name"] = input.Name
+	}
+	if input.Enabled != nil {
+		updates["enabled"] = *input.Enabled
+	}
+	if input.CountInAggregates != nil {
+		updates["count_in_aggregates"] = *input.CountInAggregates
+	}
+
+	if err := h.db.WithContext(c.Request.Context()).Model(&group).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update syndication group"})
+		return
+	}
+
+	h.respondGroup(c, group.ID)
+}
+
+func (h *SyndicationHandler) DeleteGroup(c *gin.Context) {
+	group, ok := h.findGroup(c)
+	if !ok {
+		return
+	}
+
+	err := h.db.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", group.ID).Delete(&models.SyndicationMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&group).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete syndication group"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Syndication group deleted successfully"})
+}
+
+func (h *SyndicationHandler) AddEntity(c *gin.Context) {
+	var input struct {
+		EntityID uuid.UUID `json:"entity_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	group, ok := h.findGroup(c)
+	if !ok {
+		return
+	}
+
+	if !h.entitiesBelongToTenant(c.Request.Context(), group.TenantID, []uuid.UUID{input.EntityID}) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown entity"})
+		return
+	}
+
+	member := models.SyndicationMember{GroupID: group.ID, EntityID: input.EntityID}
+	if err := h.db.WithContext(c.Request.Context()).Create(&member).Error; err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Entity already in group"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, member)
+}
+
+func (h *SyndicationHandler) RemoveEntity(c *gin.Context) {
+	entityID, err := uuid.Parse(c.Param("entity_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid entity ID"})
+		return
+	}
+
+	group, ok := h.findGroup(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.WithContext(c.Request.Context()).Where("group_id = ? AND entity_id = ?", group.ID, entityID).Delete(&models.SyndicationMember{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove entity"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Entity removed from group"})
+}
+
+// EntityReviews lists an entity's reviews including those syndicated from siblings
+func (h *SyndicationHandler) EntityReviews(c *gin.Context) {
+	entityID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid entity ID"})
+		return
+	}
+
+	tenantID, _ := c.Get("tenant_id")
+
+	reviews, err := h.syndication.ListReviews(tenantID.(uuid.UUID), entityID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
+		return
+	}
+
+	c.JSON(http.StatusOK, reviews)
+}
+
+// EntityRating returns the rating aggregate for an entity
+func (h *SyndicationHandler) EntityRating(c *gin.Context) {
+	entityID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid entity ID"})
+		return
+	}
+
+	tenantID, _ := c.Get("tenant_id")
+
+	summary, err := h.syndication.Summarize(tenantID.(uuid.UUID), entityID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to aggregate ratings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// respondGroup reloads the group so the response shows its stored values
+func (h *SyndicationHandler) respondGroup(c *gin.Context, id uuid.UUID) {
+	var group models.SyndicationGroup
+	if err := h.db.WithContext(c.Request.Context()).Preload("Members").First(&group, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch syndication group"})
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+func (h *SyndicationHandler) findGroup(c *gin.Context) (models.SyndicationGroup, bool) {
+	var group models.SyndicationGroup
+
+	groupID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return group, false
+	}
+
+	tenantID, _ := c.Get("tenant_id")
+	if err := h.db.WithContext(c.Request.Context()).Where("id = ? AND tenant_id = ?", groupID, tenantID).First(&group).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Syndication group not found"})
+		return group, false
+	}
+
+	return group, true
+}
+
+func (h *SyndicationHandler) entitiesBelongToTenant(ctx context.Context, tenantID uuid.UUID, entityIDs []uuid.UUID) bool {
+	if len(entityIDs) == 0 {
+		return true
+	}
+
+	var count int64
+	h.db.WithContext(ctx).Model(&models.Entity{}).Where("tenant_id = ? AND id IN ?", tenantID, entityIDs).Count(&count)
+	return count == int64(len(entityIDs))
+}
@@ -56,15 +56,16 @@ func (h *TenantHandler) Create(c *gin.Context) {
 		Settings: input.Settings,
 	}
 
-	if err := h.db.Create(&tenant).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Create(&tenant).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create tenant"})
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
-		"id":      tenant.ID,
-		"api_key": tenant.ApiKey,
-		"message": "Tenant created successfully",
+		"id":         tenant.ID,
+		"api_key":    tenant.ApiKey,
+		"widget_key": tenant.WidgetKey,
+		"message":    "Tenant created successfully",
 	})
 }
 
@@ -72,7 +73,7 @@ func (h *TenantHandler) Get(c *gin.Context) {
 	tenantID := c.Param("id")
 	var tenant models.Tenant
 
-	if err := h.db.First(&tenant, "id = ?", tenantID).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).First(&tenant, "id = ?", tenantID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
 		return
 	}
@@ -94,7 +95,7 @@ func (h *TenantHandler) Update(c *gin.Context) {
 	}
 
 	var tenant models.Tenant
-	if err := h.db.First(&tenant, "id = ?", tenantID).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).First(&tenant, "id = ?", tenantID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
 		return
 	}
@@ -110,7 +111,7 @@ func (h *TenantHandler) Update(c *gin.Context) {
 		updates["active"] = *input.Active
 	}
 
-	if err := h.db.Model(&tenant).Updates(updates).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Model(&tenant).Updates(updates).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tenant"})
 		return
 	}
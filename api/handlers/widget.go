@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"nyasah-backend/models"
+	"nyasah-backend/services/attribution"
+	"nyasah-backend/services/experiments"
+	"nyasah-backend/services/presence"
+	"nyasah-backend/services/rules"
+	"nyasah-backend/services/templates"
+	"nyasah-backend/services/widgets"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type WidgetHandler struct {
+	db          *gorm.DB
+	renderer    *widgets.Renderer
+	rules       *rules.Engine
+	experiments *experiments.Service
+	attribution *attribution.Service
+	geoHeader   string
+	publicURL   string
+}
+
+// NewWidgetHandler creates the widget handler. geoHeader names the request
+// header carrying the visitor's country, as set by the CDN or proxy.
+// publicURL is the base URL the loader calls back to.
+func NewWidgetHandler(db *gorm.DB, engine *rules.Engine, tracker *presence.Tracker, geoHeader, publicURL string) *WidgetHandler {
+	return &WidgetHandler{
+		db:          db,
+		renderer:    widgets.NewRenderer(db, time.Minute, tracker),
+		rules:       engine,
+		experiments: experiments.NewService(db),
+		attribution: attribution.NewService(db),
+		geoHeader:   geoHeader,
+		publicURL:   publicURL,
+	}
+}
+
+// Loader serves the JS snippet storefronts embed with
+// <script src="/widget/loader.js?key=WIDGET_KEY" async></script>
+func (h *WidgetHandler) Loader(c *gin.Context) {
+	tenant := c.MustGet("tenant").(models.Tenant)
+
+	if h.publicURL != "" {
+		script := widgets.LoaderScript(h.publicURL, tenant.WidgetKey)
+		c.Header("Cache-Control", "public, max-age=86400")
+		writeCached(c, "application/javascript; charset=utf-8", []byte(script))
+		return
+	}
+
+	// Without a configured URL the loader points back at the requested host.
+	// The Host header is client supplied, so shared caches must not keep it.
+	scheme := "https"
+	if c.Request.TLS == nil && c.GetHeader("X-Forwarded-Proto") != "https" {
+		scheme = "http"
+	}
+	script := widgets.LoaderScript(scheme+"://"+c.Request.Host, tenant.WidgetKey)
+	c.Header("Cache-Control", "private, no-cache")
+	writeCached(c, "application/javascript; charset=utf-8", []byte(script))
+}
+
+func (h *WidgetHandler) Render(c *gin.Context) {
+	tenant := c.MustGet("tenant").(models.Tenant)
+
+	req := widgets.Request{Type: c.Param("type"), Locale: c.Query("locale")}
+	if req.Locale == "" {
+		req.Locale = templates.LocaleFromHeader(c.GetHeader("Accept-Language"))
+	}
+	if raw := c.Query("entity_id"); raw != "" {
+		entityID, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid entity ID"})
+			return
+		}
+		req.EntityID = entityID
+	}
+	if raw := c.Query("limit"); raw != "" {
+		req.Limit, _ = strconv.Atoi(raw)
+	}
+
+	decision, err := h.rules.Decide(tenant.ID, h.visitor(c, req.EntityID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to evaluate display rules"})
+		return
+	}
+	req.ProofTypes = decision.ProofTypes
+	if !decision.Show || !decision.Allows(widgets.ProofType(req.Type)) {
+		// Visitor is not targeted: return an empty widget rather than an error
+		c.Header("Cache-Control", "private, no-store")
+		c.JSON(http.StatusOK, widgets.Widget{Type: req.Type})
+		return
+	}
+
+	visitorID := c.Query("visitor_id")
+	if visitorID == "" {
+		visitorID = c.Query("session_id")
+	}
+
+	// Holdout visitors are never shown proof so reports can measure its lift
+	held, err := h.attribution.Holdout(tenant, visitorID)
+	if err != nil {
+		log.Printf("Failed to record holdout visitor: %v", err)
+	}
+	if held {
+		c.Header("Cache-Control", "private, no-store")
+		c.JSON(http.StatusOK, widgets.Widget{Type: req.Type})
+		return
+	}
+
+	// Visitors in a running experiment see their variant of the widget
+	experiment, err := h.experiments.Running(tenant.ID, widgets.ProofType(req.Type))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load experiments"})
+		return
+	}
+	if experiment != nil && visitorID != "" {
+		if variant, ok := experiments.Assign(*experiment, visitorID); ok {
+			req.Variant = &variant
+		}
+	}
+
+	widget, err := h.renderer.Render(tenant, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Variant != nil {
+		if err := h.experiments.RecordExposure(experiment.ID, req.Variant.ID, visitorID, widget.ProofIDs); err != nil {
+			log.Printf("Failed to record experiment exposure: %v", err)
+		}
+	}
+
+	body, err := json.Marshal(widget)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render widget"})
+		return
+	}
+
+	// Responses depend on the visitor's targeting context, so only the browser may cache them
+	c.Header("Cache-Control", "private, max-age=60")
+	writeCached(c, "application/json; charset=utf-8", body)
+}
+
+// Convert records a conversion, e.g. a completed checkout, for the visitor's
+// running experiments. The storefront calls it with the loader's visitor ID.
+func (h *WidgetHandler) Convert(c *gin.Context) {
+	tenant := c.MustGet("tenant").(models.Tenant)
+
+	var input struct {
+		VisitorID string `json:"visitor_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	count, err := h.experiments.RecordConversion(tenant.ID, input.VisitorID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record conversion"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"experiments": count})
+}
+
+// visitor builds the targeting context from the loader's query parameters and request headers
+func (h *WidgetHandler) visitor(c *gin.Context, entityID uuid.UUID) rules.Visitor {
+	visitor := rules.Visitor{
+		SessionID:  c.Query("session_id"),
+		URL:        c.Query("url"),
+		EntityType: c.Query("entity_type"),
+		Device:     rules.DeviceFromUserAgent(c.GetHeader("User-Agent")),
+		Returning:  c.Query("returning") == "1" || c.Query("returning") == "true",
+	}
+	if visitor.URL == "" {
+		visitor.URL = c.GetHeader("Referer")
+	}
+	if h.geoHeader != "" {
+		visitor.Country = c.GetHeader(h.geoHeader)
+	}
+	if raw := c.Query("cart_value"); raw != "" {
+		if value, err := strconv.ParseFloat(raw, 64); err == nil {
+			visitor.CartValue = &value
+		}
+	}
+	if visitor.EntityType == "" && entityID != uuid.Nil {
+		var entity models.Entity
+		if err := h.db.WithContext(c.Request.Context()).Select("type").First(&entity, "id = ?", entityID).Error; err == nil {
+			visitor.EntityType = entity.Type
+		}
+	}
+
+	return visitor
+}
+
+// writeCached writes body with an ETag and answers conditional requests with 304
+func writeCached(c *gin.Context, contentType string, body []byte) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	c.Header("ETag", etag)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, contentType, body)
+}
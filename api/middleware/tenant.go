@@ -3,11 +3,15 @@ package middleware
 import (
 	"net/http"
 	"nyasah-backend/models"
+	"nyasah-backend/services/tracing"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
+// TenantMiddleware resolves the tenant from the X-API-Key header. It runs
+// after AuthMiddleware and only admits users that belong to the tenant, so a
+// key alone does not grant access to its tenant's data.
 func TenantMiddleware(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		apiKey := c.GetHeader("X-API-Key")
@@ -17,15 +21,30 @@ func TenantMiddleware(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		userID, ok := c.Get("user_id")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			c.Abort()
+			return
+		}
+
 		var tenant models.Tenant
-		if err := db.Where("api_key = ? AND active = ?", apiKey, true).First(&tenant).Error; err != nil {
+		if err := db.WithContext(c.Request.Context()).Where("api_key = ? AND active = ?", apiKey, true).First(&tenant).Error; err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or inactive API key"})
 			c.Abort()
 			return
 		}
 
+		var user models.User
+		if err := db.WithContext(c.Request.Context()).Where("id = ?", userID).First(&user).Error; err != nil || user.TenantID != tenant.ID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "User does not belong to this tenant"})
+			c.Abort()
+			return
+		}
+
 		c.Set("tenant_id", tenant.ID)
 		c.Set("tenant_type", tenant.Type)
+		c.Request = c.Request.WithContext(tracing.WithTenant(c.Request.Context(), tenant.ID))
 		c.Next()
 	}
 }
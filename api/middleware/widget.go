@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"nyasah-backend/models"
+	"nyasah-backend/services/tracing"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// WidgetMiddleware authenticates public widget requests by the tenant's
+// publishable widget key, passed as the "key" query parameter since script
+// tags cannot set headers, and only allows cross-origin calls from the
+// tenant's own domain. The secret API key is not accepted here, since widget
+// keys are published in storefront pages.
+func WidgetMiddleware(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		widgetKey := c.Query("key")
+		if widgetKey == "" {
+			widgetKey = c.GetHeader("X-Widget-Key")
+		}
+		if widgetKey == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Widget key required"})
+			c.Abort()
+			return
+		}
+
+		var tenant models.Tenant
+		if err := db.WithContext(c.Request.Context()).Where("widget_key = ? AND active = ?", widgetKey, true).First(&tenant).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or inactive widget key"})
+			c.Abort()
+			return
+		}
+
+		if origin := c.GetHeader("Origin"); origin != "" {
+			if !OriginAllowed(origin, tenant.Domain) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Origin not allowed"})
+				c.Abort()
+				return
+			}
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Header("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			c.Header("Access-Control-Allow-Headers", "Content-Type, X-Widget-Key")
+			c.Header("Vary", "Origin")
+		}
+
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Set("tenant", tenant)
+		c.Set("tenant_id", tenant.ID)
+		c.Request = c.Request.WithContext(tracing.WithTenant(c.Request.Context(), tenant.ID))
+		c.Next()
+	}
+}
+
+// OriginAllowed reports whether origin is the tenant domain or one of its subdomains
+func OriginAllowed(origin, domain string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Hostname() == "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if d, err := url.Parse(domain); err == nil && d.Hostname() != "" {
+		domain = d.Hostname()
+	}
+	domain = strings.TrimPrefix(domain, "www.")
+
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
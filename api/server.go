@@ -1,10 +1,24 @@
 package api
 
 import (
+	"context"
+	"log"
+	"net/http"
 	"nyasah-backend/api/handlers"
 	"nyasah-backend/api/middleware"
 	"nyasah-backend/config"
 	"nyasah-backend/services"
+	"nyasah-backend/services/alerts"
+	"nyasah-backend/services/events"
+	"nyasah-backend/services/exports"
+	"nyasah-backend/services/jobs"
+	"nyasah-backend/services/mail"
+	"nyasah-backend/services/metrics"
+	"nyasah-backend/services/presence"
+	"nyasah-backend/services/proofs"
+	"nyasah-backend/services/reports"
+	"nyasah-backend/services/rules"
+	"nyasah-backend/services/stream"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -15,6 +29,15 @@ type Server struct {
 	db        *gorm.DB
 	config    *config.Config
 	aiService *services.Service
+	hub       *stream.Hub
+	rules     *rules.Engine
+	events    *events.Ingester
+	presence  *presence.Tracker
+	jobs      *jobs.Queue
+	mailer    mail.Mailer
+	alerts    *alerts.Service
+	reports   *reports.Service
+	exports   *exports.Service
 }
 
 func NewServer(cfg *config.Config, db *gorm.DB) *Server {
@@ -23,6 +46,47 @@ func NewServer(cfg *config.Config, db *gorm.DB) *Server {
 		db:        db,
 		config:    cfg,
 		aiService: services.NewAIService(db, cfg),
+		hub:       stream.NewHub(stream.Options{MaxConnectionsPerTenant: cfg.StreamMaxConnections}),
+		rules:     rules.NewEngine(db),
+		events: events.NewIngester(db, events.Options{
+			BufferSize:        cfg.EventBufferSize,
+			FlushInterval:     cfg.EventFlushInterval,
+			AggregateInterval: cfg.EventAggregateInterval,
+			AttributionWindow: cfg.AttributionWindow,
+		}),
+	}
+	server.presence = presence.NewTracker(db, server.hub, presence.Options{Window: cfg.PresenceWindow})
+	server.jobs = jobs.NewQueue(db, jobs.Options{
+		Workers:           cfg.JobWorkers,
+		MaxAttempts:       cfg.JobMaxAttempts,
+		TenantConcurrency: cfg.JobTenantConcurrency,
+	})
+	server.aiService.RegisterJobs(server.jobs)
+
+	server.mailer = mail.LogMailer{}
+	if cfg.SMTPHost != "" {
+		server.mailer = mail.NewSMTPMailer(mail.SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.SMTPFrom,
+		})
+	}
+	server.alerts = alerts.NewService(db, server.mailer, alerts.Options{})
+	server.alerts.RegisterJobs(server.jobs)
+	server.reports = reports.NewService(db, server.mailer)
+	server.reports.RegisterJobs(server.jobs)
+	server.exports = exports.NewService(db, exports.Options{
+		Dir:            cfg.ExportDir,
+		DestinationDir: cfg.ExportDestinationDir,
+		SigningKey:     []byte(cfg.ExportSigningKey),
+		URLTTL:         cfg.ExportURLTTL,
+		Retention:      cfg.ExportRetention,
+	})
+	server.exports.RegisterJobs(server.jobs)
+	if err := metrics.Register(metrics.NewQueueCollector(server.jobs)); err != nil {
+		log.Printf("Failed to register job queue metrics: %v", err)
 	}
 	server.setupRoutes()
 	return server
@@ -31,15 +95,59 @@ func NewServer(cfg *config.Config, db *gorm.DB) *Server {
 func (s *Server) setupRoutes() {
 	// Create handlers
 	authHandler := handlers.NewAuthHandler(s.db, s.config)
-	reviewHandler := handlers.NewReviewHandler(s.db)
-	socialProofHandler := handlers.NewSocialProofHandler(s.db)
+	reviewHandler := handlers.NewReviewHandler(s.db, s.jobs)
+	reviewImportHandler := handlers.NewReviewImportHandler(s.db, s.jobs)
+	socialProofHandler := handlers.NewSocialProofHandler(s.db, s.hub, s.jobs)
 	aiQueryHandler := handlers.NewAIQueryHandler(s.db, s.aiService)
 	insightsHandler := handlers.NewInsightsHandler(s.db, s.aiService)
 	tenantHandler := handlers.NewTenantHandler(s.db)
+	syndicationHandler := handlers.NewSyndicationHandler(s.db)
+	widgetHandler := handlers.NewWidgetHandler(s.db, s.rules, s.presence, s.config.GeoCountryHeader, s.config.PublicBaseURL)
+	displayRuleHandler := handlers.NewDisplayRuleHandler(s.db, s.rules)
+	proofTemplateHandler := handlers.NewProofTemplateHandler(s.db)
+	streamHandler := handlers.NewStreamHandler(s.hub)
+	experimentHandler := handlers.NewExperimentHandler(s.db)
+	eventHandler := handlers.NewEventHandler(s.events)
+	presenceHandler := handlers.NewPresenceHandler(s.presence)
+	proofPolicyHandler := handlers.NewProofPolicyHandler(s.db)
+	jobHandler := handlers.NewJobHandler(s.db, s.jobs)
+	reportHandler := handlers.NewReportHandler(s.db, s.config.AttributionWindow)
+	alertHandler := handlers.NewAlertHandler(s.db, s.alerts)
+	scheduledReportHandler := handlers.NewScheduledReportHandler(s.db, s.reports)
+	exportHandler := handlers.NewExportHandler(s.db, s.exports)
+	healthHandler := handlers.NewHealthHandler(s.db, s.aiService)
+
+	s.router.Use(middleware.TracingMiddleware(), middleware.MetricsMiddleware())
+
+	// Operations. Metrics are served on their own address, see serveMetrics.
+	s.router.GET("/healthz", healthHandler.Healthz)
+	s.router.GET("/readyz", healthHandler.Readyz)
 
 	// Public routes
 	s.router.POST("/api/auth/register", authHandler.Register)
 	s.router.POST("/api/auth/login", authHandler.Login)
+	// Export downloads are authorized by their signed URL
+	s.router.GET("/api/exports/:id/download", exportHandler.Download)
+
+	// Embeddable widgets - public, scoped by tenant API key
+	widget := s.router.Group("/widget")
+	widget.Use(middleware.WidgetMiddleware(s.db))
+	{
+		widget.GET("/loader.js", widgetHandler.Loader)
+		widget.GET("/render/:type", widgetHandler.Render)
+		widget.OPTIONS("/render/:type", widgetHandler.Render)
+		widget.GET("/stream/sse", streamHandler.SSE)
+		widget.GET("/stream/ws", streamHandler.WebSocket)
+		widget.POST("/experiments/convert", widgetHandler.Convert)
+		widget.OPTIONS("/experiments/convert", widgetHandler.Convert)
+		widget.POST("/events", eventHandler.Ingest)
+		widget.OPTIONS("/events", eventHandler.Ingest)
+		widget.POST("/presence/ping", presenceHandler.Ping)
+		widget.OPTIONS("/presence/ping", presenceHandler.Ping)
+		widget.POST("/presence/leave", presenceHandler.Leave)
+		widget.OPTIONS("/presence/leave", presenceHandler.Leave)
+		widget.GET("/presence/:entity_id", presenceHandler.Get)
+	}
 
 	// Tenants API - for admin use
 	// TODO : need to find a way to secure this
@@ -50,25 +158,141 @@ func (s *Server) setupRoutes() {
 	// Protected routes
 	protected := s.router.Group("/api")
 	protected.Use(middleware.AuthMiddleware(s.config.JWTSecret))
+	protected.Use(middleware.TenantMiddleware(s.db))
 	{
 		// Reviews
 		protected.POST("/reviews", reviewHandler.Create)
 		protected.GET("/reviews", reviewHandler.List)
 		protected.GET("/reviews/:id", reviewHandler.Get)
+		protected.POST("/reviews/import", reviewImportHandler.Import)
+
+		// Entities
+		protected.GET("/entities/:id/reviews", syndicationHandler.EntityReviews)
+		protected.GET("/entities/:id/rating", syndicationHandler.EntityRating)
+		protected.GET("/entities/:id/presence", presenceHandler.EntityPresence)
+
+		// Review Syndication
+		protected.POST("/syndication/groups", syndicationHandler.CreateGroup)
+		protected.GET("/syndication/groups", syndicationHandler.ListGroups)
+		protected.PUT("/syndication/groups/:id", syndicationHandler.UpdateGroup)
+		protected.DELETE("/syndication/groups/:id", syndicationHandler.DeleteGroup)
+		protected.POST("/syndication/groups/:id/entities", syndicationHandler.AddEntity)
+		protected.DELETE("/syndication/groups/:id/entities/:entity_id", syndicationHandler.RemoveEntity)
 
 		// Social Proof
 		protected.POST("/social-proof", socialProofHandler.Create)
 		protected.GET("/social-proof", socialProofHandler.List)
 		protected.GET("/social-proof/analytics", socialProofHandler.GetAnalytics)
 
+		// Funnel and Attribution Reports
+		protected.GET("/reports/funnel", reportHandler.Funnel)
+		protected.GET("/reports/lift", reportHandler.Lift)
+		protected.GET("/reports/cohorts", reportHandler.Cohorts)
+		protected.POST("/reports/scheduled", scheduledReportHandler.Create)
+		protected.GET("/reports/scheduled", scheduledReportHandler.List)
+		protected.GET("/reports/scheduled/:id", scheduledReportHandler.Get)
+		protected.PUT("/reports/scheduled/:id", scheduledReportHandler.Update)
+		protected.DELETE("/reports/scheduled/:id", scheduledReportHandler.Delete)
+		protected.POST("/reports/scheduled/:id/run", scheduledReportHandler.Run)
+		protected.GET("/reports/scheduled/:id/runs", scheduledReportHandler.ListRuns)
+		protected.GET("/reports/runs/:id/download", scheduledReportHandler.Download)
+
+		// Data Exports
+		protected.POST("/exports", exportHandler.Create)
+		protected.GET("/exports", exportHandler.List)
+		protected.GET("/exports/:id", exportHandler.Get)
+		protected.POST("/export-schedules", exportHandler.CreateSchedule)
+		protected.GET("/export-schedules", exportHandler.ListSchedules)
+		protected.GET("/export-schedules/:id", exportHandler.GetSchedule)
+		protected.PUT("/export-schedules/:id", exportHandler.UpdateSchedule)
+		protected.DELETE("/export-schedules/:id", exportHandler.DeleteSchedule)
+
+		// Social Proof Templates
+		protected.POST("/social-proof/templates", proofTemplateHandler.Create)
+		protected.GET("/social-proof/templates", proofTemplateHandler.List)
+		protected.POST("/social-proof/templates/preview", proofTemplateHandler.Preview)
+		protected.PUT("/social-proof/templates/:id", proofTemplateHandler.Update)
+		protected.DELETE("/social-proof/templates/:id", proofTemplateHandler.Delete)
+
+		// Social Proof Freshness and Rotation
+		protected.GET("/social-proof/policies", proofPolicyHandler.List)
+		protected.GET("/social-proof/policies/:type", proofPolicyHandler.Get)
+		protected.PUT("/social-proof/policies/:type", proofPolicyHandler.Put)
+		protected.DELETE("/social-proof/policies/:type", proofPolicyHandler.Delete)
+
+		// Display Rules
+		protected.POST("/display-rules", displayRuleHandler.Create)
+		protected.GET("/display-rules", displayRuleHandler.List)
+		protected.POST("/display-rules/evaluate", displayRuleHandler.Evaluate)
+		protected.PUT("/display-rules/:id", displayRuleHandler.Update)
+		protected.DELETE("/display-rules/:id", displayRuleHandler.Delete)
+
+		// Experiments
+		protected.POST("/experiments", experimentHandler.Create)
+		protected.GET("/experiments", experimentHandler.List)
+		protected.GET("/experiments/:id", experimentHandler.Get)
+		protected.POST("/experiments/:id/start", experimentHandler.Start)
+		protected.POST("/experiments/:id/stop", experimentHandler.Stop)
+		protected.GET("/experiments/:id/results", experimentHandler.Results)
+		protected.POST("/experiments/:id/promote", experimentHandler.Promote)
+
 		// AI Features
 		protected.POST("/ai/query", aiQueryHandler.Query)
 		protected.GET("/ai/insights/product/:id", insightsHandler.GetProductInsights)
 		protected.GET("/ai/insights/recommendations", insightsHandler.GetRecommendations)
 		protected.GET("/ai/insights/trends", insightsHandler.GetTrendAnalysis)
+
+		// Anomaly Alerts
+		protected.POST("/alerts/rules", alertHandler.CreateRule)
+		protected.GET("/alerts/rules", alertHandler.ListRules)
+		protected.PUT("/alerts/rules/:id", alertHandler.UpdateRule)
+		protected.DELETE("/alerts/rules/:id", alertHandler.DeleteRule)
+		protected.GET("/alerts/incidents", alertHandler.ListIncidents)
+		protected.GET("/alerts/incidents/:id", alertHandler.GetIncident)
+		protected.POST("/alerts/incidents/:id/acknowledge", alertHandler.Acknowledge)
+
+		// Background Jobs
+		protected.GET("/jobs", jobHandler.List)
+		protected.GET("/jobs/stats", jobHandler.Stats)
+		protected.GET("/jobs/:id", jobHandler.Get)
+		protected.POST("/jobs/:id/retry", jobHandler.Retry)
 	}
 }
 
 func (s *Server) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Flush and aggregate storefront events in the background
+	go s.events.Run(ctx)
+	// Publish live viewer counts and checkpoint them for restarts
+	go s.presence.Run(ctx)
+	// Archive proofs that outlived their type's TTL
+	go proofs.NewService(s.db).Run(ctx, s.config.ProofArchiveInterval)
+	// Process AI enrichment jobs and queue analysis for reviews that have none
+	go s.jobs.Run(ctx)
+	go s.aiService.RunEnrichment(ctx, s.config.EnrichmentInterval)
+	// Roll up reviews per entity and raise incidents for anomalies
+	go s.alerts.Run(ctx, s.config.AnomalyInterval)
+	// Queue scheduled reports that are due
+	go s.reports.Run(ctx, s.config.ReportInterval)
+	// Start scheduled exports and delete expired export files
+	go s.exports.Run(ctx, s.config.ExportInterval)
+	// Serve /metrics away from the public port
+	if s.config.MetricsAddr != "" {
+		go s.serveMetrics()
+	}
+
 	return s.router.Run(":" + s.config.Port)
 }
+
+// serveMetrics serves /metrics on the metrics address. Metrics cover every
+// tenant, so they are kept off the public router. A failure to listen is
+// logged rather than stopping the API.
+func (s *Server) serveMetrics() {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	if err := http.ListenAndServe(s.config.MetricsAddr, mux); err != nil {
+		log.Printf("Metrics server stopped: %v", err)
+	}
+}
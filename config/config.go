@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"log"
 	"nyasah-backend/services/ai/factory"
+	"nyasah-backend/services/ai/providers"
 	"os"
+	"path/filepath"
 	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -18,6 +21,45 @@ type Config struct {
 	Model       string
 	Temperature float64
 	MaxTokens   int
+
+	RetrievalTokenBudget int // estimated prompt tokens of tenant data given with an AI query
+
+	StreamMaxConnections int    // open SSE/WebSocket feeds allowed per tenant
+	GeoCountryHeader     string // request header with the visitor's country code
+	PublicBaseURL        string // URL storefronts reach the API at, written into the widget loader
+
+	EventBufferSize        int           // storefront events held in memory between flushes
+	EventFlushInterval     time.Duration // how often buffered events are written
+	EventAggregateInterval time.Duration // how often events are rolled up into proof performance
+	AttributionWindow      time.Duration // how far back a conversion looks for the last proof seen
+
+	PresenceWindow       time.Duration // a visitor counts as viewing until this long after their last heartbeat
+	ProofArchiveInterval time.Duration // how often expired proofs are archived
+
+	EnrichmentInterval   time.Duration // how often reviews without stored sentiment and keywords are queued for analysis
+	JobWorkers           int           // background jobs processed concurrently by this process
+	JobMaxAttempts       int           // attempts before a job is dead-lettered
+	JobTenantConcurrency int           // background jobs one tenant may have running at once
+
+	AnomalyInterval time.Duration // how often review rollups are refreshed and alert rules evaluated
+	ReportInterval  time.Duration // how often scheduled reports are checked for runs that are due
+
+	ExportDir            string        // where export files are kept until they expire
+	ExportDestinationDir string        // local export destinations write beneath this directory
+	ExportSigningKey     string        // signs export download URLs
+	ExportURLTTL         time.Duration // how long an export download URL stays valid
+	ExportRetention      time.Duration // how long export files are kept
+	ExportInterval       time.Duration // how often export schedules are checked and expired files deleted
+
+	MetricsAddr      string  // listen address of /metrics, apart from the public port; empty disables it
+	TraceExporter    string  // "otlp", "stdout", or empty to record no spans
+	TraceSampleRatio float64 // share of new traces recorded
+
+	SMTPHost     string // email is logged instead of sent when empty
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
 }
 
 func Load() (*Config, error) {
@@ -41,14 +83,165 @@ func Load() (*Config, error) {
 		return nil, err
 	}
 
+	// Claude has no llama3.2 model, so it gets a default of its own.
+	// CLAUDE_MODEL picks the Claude model without changing MODEL.
+	model := getEnv("MODEL", "llama3.2")
+	if provider == factory.Claude {
+		model = getEnv("CLAUDE_MODEL", getEnv("MODEL", providers.DefaultClaudeModel))
+	}
+
+	retrievalTokenBudget, err := getEnvAsInt("RETRIEVAL_TOKEN_BUDGET", 3000)
+	if err != nil {
+		return nil, err
+	}
+
+	streamMaxConnections, err := getEnvAsInt("STREAM_MAX_CONNECTIONS", 500)
+	if err != nil {
+		return nil, err
+	}
+
+	eventBufferSize, err := getEnvAsInt("EVENT_BUFFER_SIZE", 50000)
+	if err != nil {
+		return nil, err
+	}
+
+	eventFlushInterval, err := getEnvAsDuration("EVENT_FLUSH_INTERVAL", 2*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	eventAggregateInterval, err := getEnvAsDuration("EVENT_AGGREGATE_INTERVAL", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	attributionWindow, err := getEnvAsDuration("ATTRIBUTION_WINDOW", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	presenceWindow, err := getEnvAsDuration("PRESENCE_WINDOW", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	proofArchiveInterval, err := getEnvAsDuration("PROOF_ARCHIVE_INTERVAL", 10*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	enrichmentInterval, err := getEnvAsDuration("ENRICHMENT_INTERVAL", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	jobWorkers, err := getEnvAsInt("JOB_WORKERS", 4)
+	if err != nil {
+		return nil, err
+	}
+
+	jobMaxAttempts, err := getEnvAsInt("JOB_MAX_ATTEMPTS", 5)
+	if err != nil {
+		return nil, err
+	}
+
+	jobTenantConcurrency, err := getEnvAsInt("JOB_TENANT_CONCURRENCY", 2)
+	if err != nil {
+		return nil, err
+	}
+
+	anomalyInterval, err := getEnvAsDuration("ANOMALY_INTERVAL", 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	reportInterval, err := getEnvAsDuration("REPORT_INTERVAL", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	exportURLTTL, err := getEnvAsDuration("EXPORT_URL_TTL", 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	exportRetention, err := getEnvAsDuration("EXPORT_RETENTION", 7*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	exportInterval, err := getEnvAsDuration("EXPORT_INTERVAL", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	traceSampleRatio, err := getEnvAsFloat64("TRACE_SAMPLE_RATIO", 1)
+	if err != nil {
+		return nil, err
+	}
+
+	smtpPort, err := getEnvAsInt("SMTP_PORT", 587)
+	if err != nil {
+		return nil, err
+	}
+
+	jwtSecret := getEnv("JWT_SECRET", "your-secret-key")
+	exportDir := getEnv("EXPORT_DIR", "./exports")
+
+	// Export download URLs carry no other credentials, so their key is kept
+	// apart from the JWT secret. Without one, downloads are disabled.
+	exportSigningKey := getEnv("EXPORT_SIGNING_KEY", "")
+	if exportSigningKey != "" && exportSigningKey == jwtSecret {
+		return nil, fmt.Errorf("EXPORT_SIGNING_KEY must differ from JWT_SECRET")
+	}
+
 	return &Config{
 		Port:        getEnv("PORT", "8080"),
-		JWTSecret:   getEnv("JWT_SECRET", "your-secret-key"),
+		JWTSecret:   jwtSecret,
 		DatabaseURL: getEnv("DATABASE_URL", "nyasah.db"),
 		Provider:    provider,
-		Model:       getEnv("MODEL", "llama3.2"),
+		Model:       model,
 		Temperature: temperature,
 		MaxTokens:   maxTokens,
+
+		RetrievalTokenBudget: retrievalTokenBudget,
+
+		StreamMaxConnections: streamMaxConnections,
+		GeoCountryHeader:     getEnv("GEO_COUNTRY_HEADER", "CF-IPCountry"),
+		PublicBaseURL:        getEnv("PUBLIC_BASE_URL", ""),
+
+		EventBufferSize:        eventBufferSize,
+		EventFlushInterval:     eventFlushInterval,
+		EventAggregateInterval: eventAggregateInterval,
+		AttributionWindow:      attributionWindow,
+
+		PresenceWindow:       presenceWindow,
+		ProofArchiveInterval: proofArchiveInterval,
+
+		EnrichmentInterval:   enrichmentInterval,
+		JobWorkers:           jobWorkers,
+		JobMaxAttempts:       jobMaxAttempts,
+		JobTenantConcurrency: jobTenantConcurrency,
+
+		AnomalyInterval: anomalyInterval,
+		ReportInterval:  reportInterval,
+
+		ExportDir:            exportDir,
+		ExportDestinationDir: getEnv("EXPORT_DESTINATION_DIR", filepath.Join(exportDir, "destinations")),
+		ExportSigningKey:     exportSigningKey,
+		ExportURLTTL:         exportURLTTL,
+		ExportRetention:      exportRetention,
+		ExportInterval:       exportInterval,
+
+		MetricsAddr:      getEnv("METRICS_ADDR", "127.0.0.1:9090"),
+		TraceExporter:    getEnv("TRACE_EXPORTER", ""),
+		TraceSampleRatio: traceSampleRatio,
+
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     smtpPort,
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:     getEnv("SMTP_FROM", "alerts@nyasah.local"),
 	}, nil
 }
 
@@ -83,6 +276,19 @@ func getEnvAsFloat64(key string, fallback float64) (float64, error) {
 	return value, nil
 }
 
+// getEnvAsDuration parses values such as "90s" or "24h"
+func getEnvAsDuration(key string, fallback time.Duration) (time.Duration, error) {
+	valueStr := getEnv(key, "")
+	if valueStr == "" {
+		return fallback, nil
+	}
+	value, err := time.ParseDuration(valueStr)
+	if err != nil {
+		return 0, err
+	}
+	return value, nil
+}
+
 func getProvider(key, fallback string) (factory.ProviderType, error) {
 	value := getEnv(key, fallback)
 	switch value {
@@ -90,6 +296,8 @@ func getProvider(key, fallback string) (factory.ProviderType, error) {
 		return factory.Llama, nil
 	case "openai":
 		return factory.OpenAI, nil
+	case "claude":
+		return factory.Claude, nil
 	case "huggingface":
 		return factory.HuggingFace, nil
 	default:
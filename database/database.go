@@ -3,6 +3,8 @@ package database
 import (
 	"nyasah-backend/config"
 	"nyasah-backend/models"
+	"nyasah-backend/services/metrics"
+	"nyasah-backend/services/tracing"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -14,6 +16,14 @@ func Initialize(cfg *config.Config) (*gorm.DB, error) {
 		return nil, err
 	}
 
+	// Time every statement for /metrics and trace those made for a request
+	if err := db.Use(metrics.GormPlugin{}); err != nil {
+		return nil, err
+	}
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		return nil, err
+	}
+
 	// Auto migrate models
 	err = db.AutoMigrate(
 		&models.Tenant{},
@@ -21,10 +31,57 @@ func Initialize(cfg *config.Config) (*gorm.DB, error) {
 		&models.Entity{},
 		&models.Review{},
 		&models.SocialProof{},
+		&models.SyndicationGroup{},
+		&models.SyndicationMember{},
+		&models.ProofTemplate{},
+		&models.DisplayRule{},
+		&models.ProofPerformance{},
+		&models.ProofEvent{},
+		&models.ProofRollup{},
+		&models.PresenceCheckpoint{},
+		&models.ProofPolicy{},
+		&models.Experiment{},
+		&models.ExperimentVariant{},
+		&models.ExperimentAssignment{},
+		&models.HoldoutVisitor{},
+		&models.ProductInsights{},
+		&models.AIQuery{},
+		&models.AIRecommendation{},
+		&models.ReviewEmbedding{},
+		&models.Job{},
+		&models.ReviewRollup{},
+		&models.AlertRule{},
+		&models.Incident{},
+		&models.ReportDefinition{},
+		&models.ReportRun{},
+		&models.Export{},
+		&models.ExportSchedule{},
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := backfillWidgetKeys(db); err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
+
+// backfillWidgetKeys gives tenants created before widget keys existed one
+func backfillWidgetKeys(db *gorm.DB) error {
+	var tenants []models.Tenant
+	if err := db.Where("widget_key IS NULL OR widget_key = ?", "").Find(&tenants).Error; err != nil {
+		return err
+	}
+	for _, tenant := range tenants {
+		key, err := models.NewWidgetKey()
+		if err != nil {
+			return err
+		}
+		if err := db.Model(&tenant).Update("widget_key", key).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"log"
 	"nyasah-backend/api"
 	"nyasah-backend/config"
 	"nyasah-backend/database"
+	"nyasah-backend/services/tracing"
 )
 
 func main() {
@@ -14,6 +16,16 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// Set up tracing before anything makes calls worth tracing
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:    cfg.TraceExporter,
+		SampleRatio: cfg.TraceSampleRatio,
+	})
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	// Initialize database
 	db, err := database.Initialize(cfg)
 	if err != nil {
@@ -1,6 +1,12 @@
 package models
 
 import (
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,6 +21,7 @@ type Tenant struct {
 	Domain    string          `gorm:"unique;not null"`
 	Type      string          `gorm:"not null"` // e.g., "ecommerce", "education", "healthcare"
 	ApiKey    string          `gorm:"unique;not null"`
+	WidgetKey string          `gorm:"uniqueIndex"` // publishable key for storefront widgets, grants no API access
 	Active    bool            `gorm:"default:true"`
 	Settings  json.RawMessage `gorm:"type:json"`
 	CreatedAt time.Time
@@ -46,22 +53,25 @@ type Entity struct {
 }
 
 type Review struct {
-	ID         uuid.UUID `gorm:"type:uuid;primary_key"`
-	TenantID   uuid.UUID `gorm:"type:uuid;not null"`
-	UserID     uuid.UUID `gorm:"type:uuid"`
-	EntityID   uuid.UUID `gorm:"type:uuid"`
-	Rating     int
-	Content    string
-	Verified   bool
-	Metadata   JSON `gorm:"type:json"`
-	CreatedAt  time.Time
-	UpdatedAt  time.Time
-	Tenant     Tenant           `gorm:"foreignKey:TenantID"`
-	User       User             `gorm:"foreignKey:UserID"`
-	Entity     Entity           `gorm:"foreignKey:EntityID"`
-	Engagement ReviewEngagement `gorm:"foreignKey:ReviewID"`
-	Sentiment  float64          // AI-analyzed sentiment score
-	Keywords   []string         `gorm:"type:json"`
+	ID          uuid.UUID `gorm:"type:uuid;primary_key"`
+	TenantID    uuid.UUID `gorm:"type:uuid;not null"`
+	UserID      uuid.UUID `gorm:"type:uuid"`
+	EntityID    uuid.UUID `gorm:"type:uuid"`
+	Rating      int
+	Content     string
+	Verified    bool
+	Status      string `gorm:"default:'approved'"` // 'pending', 'approved', 'rejected'
+	Metadata    JSON   `gorm:"type:json"`
+	ContentHash string `gorm:"index"` // used to de-duplicate imported reviews
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Tenant      Tenant           `gorm:"foreignKey:TenantID"`
+	User        User             `gorm:"foreignKey:UserID"`
+	Entity      Entity           `gorm:"foreignKey:EntityID"`
+	Engagement  ReviewEngagement `gorm:"foreignKey:ReviewID"`
+	Sentiment   float64          // AI-analyzed sentiment score
+	Keywords    []string         `gorm:"type:json;serializer:json"`
+	EnrichedAt  *time.Time       `gorm:"index"` // set once sentiment and keywords are stored
 }
 
 type ReviewEngagement struct {
@@ -85,11 +95,11 @@ type Product struct {
 
 type ProductInsights struct {
 	ID                 uuid.UUID `gorm:"type:uuid;primary_key"`
-	ProductID          uuid.UUID `gorm:"type:uuid"`
-	SentimentTrend     []float64 `gorm:"type:json"`
-	TopKeywords        []string  `gorm:"type:json"`
+	ProductID          uuid.UUID `gorm:"type:uuid;uniqueIndex"`
+	SentimentTrend     []float64 `gorm:"type:json;serializer:json"`
+	TopKeywords        []string  `gorm:"type:json;serializer:json"`
 	EngagementScore    float64
-	RecommendedActions []string `gorm:"type:json"`
+	RecommendedActions []string `gorm:"type:json;serializer:json"`
 	AverageRating      float64
 	EngagementRate     float64
 	SentimentScore     float64
@@ -97,26 +107,57 @@ type ProductInsights struct {
 }
 
 type ProofPerformance struct {
-	ID             uuid.UUID `gorm:"type:uuid;primary_key"`
-	ProofID        uuid.UUID `gorm:"type:uuid"`
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key"`
+	ProofID        uuid.UUID  `gorm:"type:uuid;index;uniqueIndex:idx_proof_performance_variant;uniqueIndex:idx_proof_performance_overall,where:variant_id IS NULL"`
+	VariantID      *uuid.UUID `gorm:"type:uuid;index;uniqueIndex:idx_proof_performance_variant"` // set when the proof was shown as part of an experiment
 	Views          int
+	Clicks         int
 	Conversions    int
 	EngagementRate float64
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
 }
 
+// ProofEvent is a raw impression, click or conversion reported by a storefront.
+// Events are aggregated into ProofPerformance and then kept for reporting.
+type ProofEvent struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key"`
+	TenantID   uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_proof_event"`
+	EventID    string     `gorm:"not null;uniqueIndex:idx_proof_event"` // client-generated idempotency ID
+	Type       string     `gorm:"not null;index"`                       // 'impression', 'click', 'conversion'
+	ProofID    *uuid.UUID `gorm:"type:uuid;index"`                      // for conversions, set by attribution
+	EntityID   *uuid.UUID `gorm:"type:uuid"`
+	VisitorID  string     `gorm:"index"`
+	UserID     *uuid.UUID `gorm:"type:uuid;index"` // signed-in customer, linking events to their reviews
+	Value      float64    // order value for conversions
+	OccurredAt time.Time  `gorm:"index"`
+	Aggregated bool       `gorm:"index"`
+	CreatedAt  time.Time
+}
+
 type AIQuery struct {
+	ID              uuid.UUID `gorm:"type:uuid;primary_key"`
+	TenantID        uuid.UUID `gorm:"type:uuid"`
+	Query           string
+	Response        string
+	SourceReviewIDs []uuid.UUID `gorm:"type:json;serializer:json"` // reviews the response cites
+	CreatedAt       time.Time
+}
+
+// ReviewEmbedding is a review's vector for semantic search. Vectors are only
+// compared with query vectors from the same model.
+type ReviewEmbedding struct {
 	ID        uuid.UUID `gorm:"type:uuid;primary_key"`
-	TenantID  uuid.UUID `gorm:"type:uuid"`
-	Query     string
-	Response  string
+	ReviewID  uuid.UUID `gorm:"type:uuid;uniqueIndex"`
+	TenantID  uuid.UUID `gorm:"type:uuid;index"`
+	Model     string
+	Vector    Vector `gorm:"type:blob"`
 	CreatedAt time.Time
 }
 
 type AIRecommendation struct {
 	ID         uuid.UUID `gorm:"type:uuid;primary_key"`
-	TenantID   uuid.UUID `gorm:"type:uuid"`
+	TenantID   uuid.UUID `gorm:"type:uuid;index"`
 	Type       string    // "content", "timing", "placement"
 	Suggestion string
 	Confidence float64
@@ -137,16 +178,431 @@ type SocialProof struct {
 	Entity      Entity           `gorm:"foreignKey:EntityID"`
 	Performance ProofPerformance `gorm:"foreignKey:ProofID"`
 	MediaType   string           // "image", "video", "text"
+	ArchivedAt  *time.Time       `gorm:"index"` // set once the proof outlives its type's TTL
+}
+
+// ProofPolicy controls freshness and rotation of one proof type for a tenant
+type ProofPolicy struct {
+	ID            uuid.UUID `gorm:"type:uuid;primary_key"`
+	TenantID      uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_proof_policy"`
+	Type          string    `gorm:"not null;uniqueIndex:idx_proof_policy"`
+	TTLMinutes    int       // proofs older than this are archived; 0 keeps them forever
+	Rotation      string    `gorm:"default:'recent'"` // 'recent', 'weighted_random', 'round_robin', 'best_performing'
+	DedupeMinutes int       // show one proof per user and entity within this window; 0 disables
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// SyndicationGroup links sibling entities (regional listings, bundles) so
+// reviews posted on one are shown on the others
+type SyndicationGroup struct {
+	ID                uuid.UUID `gorm:"type:uuid;primary_key"`
+	TenantID          uuid.UUID `gorm:"type:uuid;not null;index"`
+	Name              string    `gorm:"not null"`
+	Enabled           bool      `gorm:"default:true"`
+	CountInAggregates bool      // include syndicated reviews in rating counts and averages
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Members           []SyndicationMember `gorm:"foreignKey:GroupID"`
+}
+
+type SyndicationMember struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key"`
+	GroupID   uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_syndication_member"`
+	EntityID  uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_syndication_member"`
+	CreatedAt time.Time
+}
+
+// ProofTemplate renders the display text of a social proof type for a locale.
+// Placeholders are filled from the proof's Metadata, e.g.
+// "{name} from {city} just purchased {entity_name} {time_ago}".
+type ProofTemplate struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key"`
+	TenantID  uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_proof_template"`
+	Type      string    `gorm:"not null;uniqueIndex:idx_proof_template"` // proof type, e.g. "purchase"
+	Locale    string    `gorm:"not null;uniqueIndex:idx_proof_template"` // e.g. "en", "fr-CA"
+	Body      string    `gorm:"not null"`
+	NameStyle string    `gorm:"default:'first_initial'"` // 'full', 'first', 'first_initial', 'anonymous'
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// DisplayRule decides which social proofs a widget may show to a visitor.
+// Rules are evaluated by descending priority and the first match wins.
+type DisplayRule struct {
+	ID           uuid.UUID `gorm:"type:uuid;primary_key"`
+	TenantID     uuid.UUID `gorm:"type:uuid;not null;index"`
+	Name         string    `gorm:"not null"`
+	Priority     int       `gorm:"default:0"`
+	Enabled      bool
+	Action       string         `gorm:"default:'show'"`            // 'show', 'hide'
+	ProofTypes   []string       `gorm:"type:json;serializer:json"` // proof types the rule allows, empty for all
+	Conditions   RuleConditions `gorm:"type:json;serializer:json"`
+	FrequencyCap int            // max times per visitor session, 0 for unlimited
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// RuleConditions are ANDed together; empty conditions always match
+type RuleConditions struct {
+	URLPatterns  []string `json:"url_patterns,omitempty"` // path globs, e.g. "/products/*"
+	EntityTypes  []string `json:"entity_types,omitempty"`
+	Devices      []string `json:"devices,omitempty"`      // 'mobile', 'tablet', 'desktop'
+	Countries    []string `json:"countries,omitempty"`    // ISO 3166 alpha-2 codes
+	VisitorType  string   `json:"visitor_type,omitempty"` // 'new', 'returning'
+	MinCartValue *float64 `json:"min_cart_value,omitempty"`
+	MaxCartValue *float64 `json:"max_cart_value,omitempty"`
+}
+
+// Experiment compares social proof variants on randomly bucketed visitors
+type Experiment struct {
+	ID              uuid.UUID  `gorm:"type:uuid;primary_key"`
+	TenantID        uuid.UUID  `gorm:"type:uuid;not null;index"`
+	Name            string     `gorm:"not null"`
+	ProofType       string     // proof type the experiment applies to, e.g. "purchase"
+	Status          string     `gorm:"default:'draft'"` // 'draft', 'running', 'stopped', 'completed'
+	ConfidenceLevel float64    `gorm:"default:0.95"`
+	MinSampleSize   int        `gorm:"default:1000"` // exposures per variant before results are trusted
+	WinnerVariantID *uuid.UUID `gorm:"type:uuid"`
+	StartedAt       *time.Time
+	EndedAt         *time.Time
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Variants        []ExperimentVariant `gorm:"foreignKey:ExperimentID"`
+}
+
+type ExperimentVariant struct {
+	ID           uuid.UUID `gorm:"type:uuid;primary_key"`
+	ExperimentID uuid.UUID `gorm:"type:uuid;not null;index"`
+	Name         string    `gorm:"not null"`
+	IsControl    bool
+	Weight       int           `gorm:"default:1"`
+	Config       VariantConfig `gorm:"type:json;serializer:json"`
+	CreatedAt    time.Time
+}
+
+// VariantConfig is what a variant changes about the widget; empty fields keep the default
+type VariantConfig struct {
+	TemplateBody string `json:"template_body,omitempty"`
+	MediaType    string `json:"media_type,omitempty"`
+	Placement    string `json:"placement,omitempty"`     // toast position, e.g. "bottom-right"
+	DelaySeconds int    `json:"delay_seconds,omitempty"` // wait before showing the widget
+}
+
+// ExperimentAssignment records a visitor's exposure to an experiment and whether they converted
+type ExperimentAssignment struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primary_key"`
+	ExperimentID uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_experiment_visitor"`
+	VisitorID    string     `gorm:"not null;uniqueIndex:idx_experiment_visitor"`
+	VariantID    uuid.UUID  `gorm:"type:uuid;not null;index"`
+	LastProofID  *uuid.UUID `gorm:"type:uuid"`
+	Converted    bool
+	ConvertedAt  *time.Time
+	CreatedAt    time.Time
+}
+
+// PresenceCheckpoint is a periodic snapshot of an entity's live viewers so
+// presence counts survive restarts without storing every heartbeat
+type PresenceCheckpoint struct {
+	ID        uuid.UUID        `gorm:"type:uuid;primary_key"`
+	TenantID  uuid.UUID        `gorm:"type:uuid;not null;uniqueIndex:idx_presence_entity"`
+	EntityID  uuid.UUID        `gorm:"type:uuid;not null;uniqueIndex:idx_presence_entity"`
+	Visitors  map[string]int64 `gorm:"type:json;serializer:json"` // visitor ID -> last heartbeat (unix ms)
+	UpdatedAt time.Time
+}
+
+// ProofRollup holds hourly engagement totals for one proof type, media type
+// and entity. Analytics reads these instead of scanning raw events.
+type ProofRollup struct {
+	ID              uuid.UUID `gorm:"type:uuid;primary_key"`
+	TenantID        uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_proof_rollup"`
+	BucketStart     time.Time `gorm:"not null;uniqueIndex:idx_proof_rollup"` // start of the UTC hour
+	ProofType       string    `gorm:"not null;uniqueIndex:idx_proof_rollup"`
+	MediaType       string    `gorm:"not null;uniqueIndex:idx_proof_rollup"`
+	EntityID        uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_proof_rollup"`
+	Impressions     int64
+	Clicks          int64
+	Conversions     int64
+	ConversionValue float64
+	UpdatedAt       time.Time
+}
+
+// Job is a unit of background work. Failed jobs are retried with exponential
+// backoff and dead-lettered after their last attempt.
+type Job struct {
+	ID          uuid.UUID       `gorm:"type:uuid;primary_key"`
+	TenantID    uuid.UUID       `gorm:"type:uuid;not null;index"`
+	Type        string          `gorm:"not null;index"`
+	DedupeKey   string          `gorm:"index"` // queued or running jobs with the same type and key are not duplicated
+	Payload     json.RawMessage `gorm:"type:json"`
+	Status      string          `gorm:"not null;index"` // 'queued', 'running', 'succeeded', 'dead'
+	Attempts    int
+	MaxAttempts int
+	RunAt       time.Time `gorm:"index"` // not picked up before this time
+	LockedAt    *time.Time
+	LockedBy    string
+	LastError   string
+	CompletedAt *time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// HoldoutVisitor records which group a storefront visitor was bucketed into
+// the first time they could have been shown proof. Visitors in the holdout
+// are never shown proof, which lets reports measure incremental lift.
+type HoldoutVisitor struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key"`
+	TenantID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_holdout_visitor"`
+	VisitorID   string    `gorm:"not null;uniqueIndex:idx_holdout_visitor"`
+	InHoldout   bool      `gorm:"index"`
+	FirstSeenAt time.Time `gorm:"index"`
+}
+
+// ReviewRollup holds hourly review totals for one entity. Anomaly detection
+// compares recent windows of these against their history.
+type ReviewRollup struct {
+	ID           uuid.UUID `gorm:"type:uuid;primary_key"`
+	TenantID     uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_review_rollup"`
+	EntityID     uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_review_rollup"`
+	BucketStart  time.Time `gorm:"not null;uniqueIndex:idx_review_rollup"` // start of the UTC hour
+	Reviews      int64
+	RatingSum    int64
+	OneStar      int64
+	Analyzed     int64 // reviews with stored sentiment
+	SentimentSum float64
+	UpdatedAt    time.Time
+}
+
+// AlertRule watches a review metric of a tenant's entities and notifies the
+// rule's channels when it breaks from its baseline
+type AlertRule struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primary_key"`
+	TenantID      uuid.UUID  `gorm:"type:uuid;not null;index"`
+	Name          string     `gorm:"not null"`
+	Enabled       bool       `gorm:"index"`
+	Metric        string     `gorm:"not null"`  // 'rating', 'sentiment', 'volume', 'one_star'
+	EntityID      *uuid.UUID `gorm:"type:uuid"` // nil watches every entity
+	Method        string     // 'robust_z', 'seasonal'
+	Direction     string     // 'above', 'below', 'both'
+	Threshold     float64    // score at which an incident opens
+	WindowHours   int        // length of the window compared with the baseline
+	MinReviews    int        // reviews a window needs before rating or sentiment is judged
+	WebhookURL    string
+	WebhookSecret string   `json:"-"` // signs webhook bodies so receivers can verify them
+	Emails        []string `gorm:"type:json;serializer:json"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// Incident is an anomaly found by an alert rule for one entity. While it is
+// open or acknowledged, repeat detections update it instead of notifying again.
+type Incident struct {
+	ID              uuid.UUID `gorm:"type:uuid;primary_key"`
+	TenantID        uuid.UUID `gorm:"type:uuid;not null;index"`
+	RuleID          uuid.UUID `gorm:"type:uuid;not null;index"`
+	EntityID        uuid.UUID `gorm:"type:uuid;not null;index"`
+	Metric          string
+	Status          string  `gorm:"not null;index"` // 'open', 'acknowledged', 'resolved'
+	Value           float64 // metric in the latest window
+	Baseline        float64 // median of the baseline windows
+	Score           float64 // robust z-score of the latest window
+	Occurrences     int     // detector runs that found the anomaly
+	FirstDetectedAt time.Time
+	LastDetectedAt  time.Time
+	AcknowledgedAt  *time.Time
+	AcknowledgedBy  string
+	ResolvedAt      *time.Time
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// ReportDefinition is a tenant's scheduled analytics report. Schedules are
+// cron expressions evaluated in the tenant's time zone.
+type ReportDefinition struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key"`
+	TenantID   uuid.UUID  `gorm:"type:uuid;not null;index"`
+	Name       string     `gorm:"not null"`
+	Schedule   string     `gorm:"not null"` // e.g. "0 8 * * 1" for Mondays at 08:00
+	Sections   []string   `gorm:"type:json;serializer:json"`
+	Recipients []string   `gorm:"type:json;serializer:json"`
+	Enabled    bool       `gorm:"index"`
+	NextRunAt  *time.Time `gorm:"index"`
+	LastRunAt  *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// ReportRun is one generated report, kept so past runs can be downloaded
+type ReportRun struct {
+	ID           uuid.UUID `gorm:"type:uuid;primary_key"`
+	TenantID     uuid.UUID `gorm:"type:uuid;not null;index"`
+	DefinitionID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_report_run"`
+	PeriodStart  time.Time
+	PeriodEnd    time.Time `gorm:"uniqueIndex:idx_report_run"`
+	HTML         string    `json:"-" gorm:"type:text"`
+	CSV          string    `json:"-" gorm:"type:text"`
+	DeliveredAt  *time.Time
+	CreatedAt    time.Time
+}
+
+// Export is an asynchronous export of one dataset to a file. Incremental
+// exports pass the cursor of a previous export as Since and only include
+// rows added or changed after it.
+type Export struct {
+	ID          uuid.UUID     `gorm:"type:uuid;primary_key"`
+	TenantID    uuid.UUID     `gorm:"type:uuid;not null;index"`
+	ScheduleID  *uuid.UUID    `gorm:"type:uuid;index"` // set for exports made by an ExportSchedule
+	JobID       *uuid.UUID    `gorm:"type:uuid"`
+	Dataset     string        `gorm:"not null"` // 'reviews', 'proofs', 'events', 'insights'
+	Format      string        `gorm:"not null"` // 'csv', 'ndjson', 'parquet'
+	Filters     ExportFilters `gorm:"type:json;serializer:json"`
+	Since       string        // cursor the export starts after
+	NextCursor  string        // cursor of the last exported row, to pass as Since next time
+	Status      string        `gorm:"not null;index"` // 'queued', 'running', 'completed', 'failed', 'expired'
+	Rows        int64
+	Size        int64
+	Path        string `json:"-"` // file in the export directory
+	Error       string
+	DeliveredAt *time.Time // set once a scheduled export reached its destination
+	CompletedAt *time.Time
+	ExpiresAt   *time.Time `gorm:"index"` // the file is deleted after this time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// ExportFilters narrows the rows of an export
+type ExportFilters struct {
+	From      *time.Time `json:"from,omitempty"` // on when the row was created, or when an event occurred
+	To        *time.Time `json:"to,omitempty"`
+	EntityID  *uuid.UUID `json:"entity_id,omitempty"`
+	Type      string     `json:"type,omitempty"`       // proof, event or recommendation type
+	Status    string     `json:"status,omitempty"`     // review status
+	MinRating int        `json:"min_rating,omitempty"` // reviews only
+}
+
+// ExportSchedule repeatedly exports the rows added since its last run and
+// delivers them to a directory or an S3-compatible bucket
+type ExportSchedule struct {
+	ID                uuid.UUID         `gorm:"type:uuid;primary_key"`
+	TenantID          uuid.UUID         `gorm:"type:uuid;not null;index"`
+	Name              string            `gorm:"not null"`
+	Dataset           string            `gorm:"not null"`
+	Format            string            `gorm:"not null"`
+	Filters           ExportFilters     `gorm:"type:json;serializer:json"`
+	Schedule          string            `gorm:"not null"` // cron expression in the tenant's time zone
+	Destination       ExportDestination `gorm:"type:json;serializer:json"`
+	DestinationSecret string            `json:"-"` // S3 secret access key
+	Enabled           bool              `gorm:"index"`
+	Cursor            string            // where the next run starts
+	NextRunAt         *time.Time        `gorm:"index"`
+	LastRunAt         *time.Time
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+// ExportDestination is where scheduled exports are written
+type ExportDestination struct {
+	Type        string `json:"type"`               // 'local' or 's3'
+	Path        string `json:"path,omitempty"`     // directory or key prefix
+	Endpoint    string `json:"endpoint,omitempty"` // S3-compatible endpoint; AWS when empty
+	Region      string `json:"region,omitempty"`
+	Bucket      string `json:"bucket,omitempty"`
+	AccessKeyID string `json:"access_key_id,omitempty"`
+}
+
+// Vector is an embedding stored as little-endian float32s, four bytes per
+// dimension, so search can load thousands of them without parsing JSON
+type Vector []float32
+
+// Value encodes the vector so it can be stored in a blob column
+func (v Vector) Value() (driver.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	b := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(f))
+	}
+	return b, nil
+}
+
+// Scan decodes a blob column back into the vector
+func (v *Vector) Scan(value interface{}) error {
+	if value == nil {
+		*v = nil
+		return nil
+	}
+
+	b, ok := value.([]byte)
+	if !ok || len(b)%4 != 0 {
+		return errors.New("unsupported value for vector column")
+	}
+
+	vector := make(Vector, len(b)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	*v = vector
+	return nil
 }
 
 // JSON is a custom type for handling JSON data
 type JSON map[string]interface{}
 
+// Value marshals the map so it can be stored in a json column
+func (j JSON) Value() (driver.Value, error) {
+	if j == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(j)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan unmarshals a json column back into the map
+func (j *JSON) Scan(value interface{}) error {
+	if value == nil {
+		*j = nil
+		return nil
+	}
+
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("unsupported type for JSON column")
+	}
+
+	return json.Unmarshal(data, j)
+}
+
 func (t *Tenant) BeforeCreate(tx *gorm.DB) error {
 	t.ID = uuid.New()
+	if t.WidgetKey == "" {
+		key, err := NewWidgetKey()
+		if err != nil {
+			return err
+		}
+		t.WidgetKey = key
+	}
 	return nil
 }
 
+// NewWidgetKey generates a publishable widget key. It is prefixed so it
+// cannot be mistaken for the secret API key.
+func NewWidgetKey() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return "pk_" + hex.EncodeToString(bytes), nil
+}
+
 func (u *User) BeforeCreate(tx *gorm.DB) error {
 	u.ID = uuid.New()
 	return nil
@@ -166,3 +622,128 @@ func (s *SocialProof) BeforeCreate(tx *gorm.DB) error {
 	s.ID = uuid.New()
 	return nil
 }
+
+func (g *SyndicationGroup) BeforeCreate(tx *gorm.DB) error {
+	g.ID = uuid.New()
+	return nil
+}
+
+func (m *SyndicationMember) BeforeCreate(tx *gorm.DB) error {
+	m.ID = uuid.New()
+	return nil
+}
+
+func (t *ProofTemplate) BeforeCreate(tx *gorm.DB) error {
+	t.ID = uuid.New()
+	return nil
+}
+
+func (r *DisplayRule) BeforeCreate(tx *gorm.DB) error {
+	r.ID = uuid.New()
+	return nil
+}
+
+func (e *ProofEvent) BeforeCreate(tx *gorm.DB) error {
+	e.ID = uuid.New()
+	return nil
+}
+
+func (p *ProofPolicy) BeforeCreate(tx *gorm.DB) error {
+	p.ID = uuid.New()
+	return nil
+}
+
+func (p *PresenceCheckpoint) BeforeCreate(tx *gorm.DB) error {
+	p.ID = uuid.New()
+	return nil
+}
+
+func (i *ProductInsights) BeforeCreate(tx *gorm.DB) error {
+	i.ID = uuid.New()
+	return nil
+}
+
+func (q *AIQuery) BeforeCreate(tx *gorm.DB) error {
+	q.ID = uuid.New()
+	return nil
+}
+
+func (r *AIRecommendation) BeforeCreate(tx *gorm.DB) error {
+	r.ID = uuid.New()
+	return nil
+}
+
+func (e *ReviewEmbedding) BeforeCreate(tx *gorm.DB) error {
+	e.ID = uuid.New()
+	return nil
+}
+
+func (j *Job) BeforeCreate(tx *gorm.DB) error {
+	j.ID = uuid.New()
+	return nil
+}
+
+func (r *ReviewRollup) BeforeCreate(tx *gorm.DB) error {
+	r.ID = uuid.New()
+	return nil
+}
+
+func (r *AlertRule) BeforeCreate(tx *gorm.DB) error {
+	r.ID = uuid.New()
+	return nil
+}
+
+func (i *Incident) BeforeCreate(tx *gorm.DB) error {
+	i.ID = uuid.New()
+	return nil
+}
+
+func (d *ReportDefinition) BeforeCreate(tx *gorm.DB) error {
+	d.ID = uuid.New()
+	return nil
+}
+
+func (r *ReportRun) BeforeCreate(tx *gorm.DB) error {
+	r.ID = uuid.New()
+	return nil
+}
+
+func (e *Export) BeforeCreate(tx *gorm.DB) error {
+	e.ID = uuid.New()
+	return nil
+}
+
+func (s *ExportSchedule) BeforeCreate(tx *gorm.DB) error {
+	s.ID = uuid.New()
+	return nil
+}
+
+func (v *HoldoutVisitor) BeforeCreate(tx *gorm.DB) error {
+	v.ID = uuid.New()
+	return nil
+}
+
+func (r *ProofRollup) BeforeCreate(tx *gorm.DB) error {
+	r.ID = uuid.New()
+	return nil
+}
+
+func (p *ProofPerformance) BeforeCreate(tx *gorm.DB) error {
+	p.ID = uuid.New()
+	return nil
+}
+
+func (e *Experiment) BeforeCreate(tx *gorm.DB) error {
+	e.ID = uuid.New()
+	return nil
+}
+
+func (v *ExperimentVariant) BeforeCreate(tx *gorm.DB) error {
+	v.ID = uuid.New()
+	return nil
+}
+
+func (a *ExperimentAssignment) BeforeCreate(tx *gorm.DB) error {
+	a.ID = uuid.New()
+	return nil
+}
@@ -1,53 +1,98 @@
 package analyzers
 
 import (
+	"context"
 	"nyasah-backend/services/ai/providers"
+	"nyasah-backend/services/ai/utils"
+	"nyasah-backend/services/retrieval"
+	"nyasah-backend/services/timeframe"
+
+	"github.com/google/uuid"
 )
 
 type ContentAnalyzer struct {
-	provider providers.Provider
+	provider  providers.Provider
+	retriever *retrieval.Retriever
 }
 
-func NewContentAnalyzer(provider providers.Provider) *ContentAnalyzer {
+func NewContentAnalyzer(provider providers.Provider, retriever *retrieval.Retriever) *ContentAnalyzer {
 	return &ContentAnalyzer{
-		provider: provider,
+		provider:  provider,
+		retriever: retriever,
 	}
 }
 
-func (a *ContentAnalyzer) ProcessQuery(query, tenantID string) (string, error) {
-	prompt := `As an AI assistant for an e-commerce social proof platform, answer the following query:
+const querySystemPrompt = `You are an AI assistant for an e-commerce social proof platform, answering a merchant's questions about their store.
+Base your answer on the customer data provided. Cite the data you use by its label in square brackets, such as [R1] for a review.
+If the data does not answer the question, say so, then give a clear, concise and helpful answer based on best practices.`
+
+// queryRequest asks the provider to answer a merchant's question from the
+// tenant's data retrieved for it
+func (a *ContentAnalyzer) queryRequest(ctx context.Context, query string, tenantID uuid.UUID) (providers.Request, retrieval.Result, error) {
+	sources, err := a.retriever.Retrieve(ctx, tenantID, query)
+	if err != nil {
+		return providers.Request{}, sources, err
+	}
+
+	data := sources.Context()
+	if data == "" {
+		data = "No reviews, proofs or products found."
+	}
+	prompt := `Customer data:
 	
-	Query: """` + query + `"""
+	` + data + `
 	
-	Provide a clear, concise, and helpful response based on the available data and best practices.`
+	Query: """` + query + `"""`
 
-	return a.provider.ProcessQuery(prompt)
+	req := providers.Prompt(prompt)
+	req.System = querySystemPrompt
+	return req, sources, nil
 }
 
-func (a *ContentAnalyzer) AnalyzeTrends(tenantID string) (map[string]interface{}, error) {
-	// Delegate to specialized analyzers
-	sentimentAnalyzer := NewSentimentAnalyzer(a.provider)
-	engagementAnalyzer := NewEngagementAnalyzer(a.provider)
-	keywordAnalyzer := NewKeywordAnalyzer(a.provider)
+// ProcessQuery answers a query and returns the sources the answer was given
+func (a *ContentAnalyzer) ProcessQuery(ctx context.Context, query string, tenantID uuid.UUID) (string, retrieval.Result, error) {
+	req, sources, err := a.queryRequest(ctx, query, tenantID)
+	if err != nil {
+		return "", sources, err
+	}
 
-	sentimentTrends, err := sentimentAnalyzer.AnalyzeTrends(tenantID)
+	resp, err := a.provider.Complete(ctx, req)
 	if err != nil {
-		return nil, err
+		return "", sources, err
 	}
+	return resp.Text, sources, nil
+}
 
-	engagementTrends, err := engagementAnalyzer.AnalyzeTrends(tenantID)
+// StreamQuery answers a query as the provider generates the answer
+func (a *ContentAnalyzer) StreamQuery(ctx context.Context, query string, tenantID uuid.UUID) (providers.Stream, retrieval.Result, error) {
+	req, sources, err := a.queryRequest(ctx, query, tenantID)
 	if err != nil {
-		return nil, err
+		return nil, sources, err
 	}
 
-	keywordTrends, err := keywordAnalyzer.AnalyzeTrends(tenantID)
+	stream, err := a.provider.Stream(ctx, req)
+	return stream, sources, err
+}
+
+// AnalyzeTrends builds sentiment, engagement and keyword trends from stored
+// review analysis and proof rollups over the same calendar frames. It does
+// not call the provider.
+func (a *ContentAnalyzer) AnalyzeTrends(ctx context.Context, tenantID string, spec timeframe.Spec) (map[string]interface{}, error) {
+	timeFrames, err := utils.LoadTimeFrames(ctx, tenantID, spec)
 	if err != nil {
 		return nil, err
 	}
 
+	// Delegate to specialized analyzers
+	sentimentAnalyzer := NewSentimentAnalyzer(a.provider)
+	engagementAnalyzer := NewEngagementAnalyzer(a.provider)
+	keywordAnalyzer := NewKeywordAnalyzer(a.provider)
+
 	return map[string]interface{}{
-		"sentiment_trends":  sentimentTrends,
-		"engagement_trends": engagementTrends,
-		"keyword_trends":    keywordTrends,
+		"granularity":       spec.Granularity,
+		"time_zone":         spec.Location.String(),
+		"sentiment_trends":  sentimentAnalyzer.AnalyzeTrends(timeFrames),
+		"engagement_trends": engagementAnalyzer.AnalyzeTrends(timeFrames),
+		"keyword_trends":    keywordAnalyzer.AnalyzeTrends(timeFrames),
 	}, nil
 }
@@ -22,26 +22,28 @@ func (ea *EngagementAnalyzer) AnalyzeEngagement(review models.Review, proof mode
 	return (reviewScore + proofScore) / 2
 }
 
-func (ea *EngagementAnalyzer) AnalyzeTrends(tenantID string) (map[string]interface{}, error) {
-	timeFrames := utils.GetTimeFrames()
+// AnalyzeTrends reports each frame's proof conversion rate from the event
+// rollups alongside the average engagement of reviews written in it
+func (ea *EngagementAnalyzer) AnalyzeTrends(timeFrames []utils.TimeFrame) map[string]interface{} {
 	trends := make([]float64, len(timeFrames))
+	impressions := make([]int64, len(timeFrames))
+	conversions := make([]int64, len(timeFrames))
+	reviewEngagement := make([]float64, len(timeFrames))
 
 	for i, frame := range timeFrames {
-		reviews, err := utils.GetReviewsInTimeFrame(tenantID, frame.Start, frame.End)
-		if err != nil {
-			return nil, err
+		if frame.Impressions > 0 {
+			trends[i] = float64(frame.Conversions) / float64(frame.Impressions)
 		}
-
-		proofs, err := utils.GetProofsInTimeFrame(tenantID, frame.Start, frame.End)
-		if err != nil {
-			return nil, err
-		}
-
-		trends[i] = utils.CalculateAverageEngagement(reviews, proofs)
+		impressions[i] = frame.Impressions
+		conversions[i] = frame.Conversions
+		reviewEngagement[i] = utils.CalculateAverageEngagement(frame.Reviews, nil)
 	}
 
 	return map[string]interface{}{
-		"trends": trends,
-		"frames": timeFrames,
-	}, nil
+		"trends":            trends,
+		"impressions":       impressions,
+		"conversions":       conversions,
+		"review_engagement": reviewEngagement,
+		"frames":            timeFrames,
+	}
 }
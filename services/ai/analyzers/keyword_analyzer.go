@@ -1,6 +1,7 @@
 package analyzers
 
 import (
+	"context"
 	"nyasah-backend/services/ai/providers"
 	"nyasah-backend/services/ai/utils"
 )
@@ -15,39 +16,29 @@ func NewKeywordAnalyzer(provider providers.Provider) *KeywordAnalyzer {
 	}
 }
 
-func (ka *KeywordAnalyzer) ExtractKeywords(text string) ([]string, error) {
+func (ka *KeywordAnalyzer) ExtractKeywords(ctx context.Context, text string) ([]string, error) {
 	prompt := `Extract key phrases and topics from the following text:
 	
 	Text: """` + text + `"""
 	
 	Return only the key phrases, separated by commas:`
 
-	response, err := ka.provider.ProcessQuery(prompt)
+	resp, err := ka.provider.Complete(ctx, providers.Prompt(prompt))
 	if err != nil {
 		return nil, err
 	}
 
-	return utils.ParseKeywords(response), nil
+	return utils.ParseKeywords(resp.Text), nil
 }
 
-func (ka *KeywordAnalyzer) AnalyzeTrends(tenantID string) (map[string]interface{}, error) {
-	timeFrames := utils.GetTimeFrames()
+// AnalyzeTrends counts the stored keywords of each frame's reviews
+func (ka *KeywordAnalyzer) AnalyzeTrends(timeFrames []utils.TimeFrame) map[string]interface{} {
 	trends := make([]map[string]int, len(timeFrames))
 
 	for i, frame := range timeFrames {
-		reviews, err := utils.GetReviewsInTimeFrame(tenantID, frame.Start, frame.End)
-		if err != nil {
-			return nil, err
-		}
-
 		keywordFreq := make(map[string]int)
-		for _, review := range reviews {
-			keywords, err := ka.ExtractKeywords(review.Content)
-			if err != nil {
-				continue
-			}
-
-			for _, keyword := range keywords {
+		for _, review := range frame.Reviews {
+			for _, keyword := range review.Keywords {
 				keywordFreq[keyword]++
 			}
 		}
@@ -58,5 +49,5 @@ func (ka *KeywordAnalyzer) AnalyzeTrends(tenantID string) (map[string]interface{
 	return map[string]interface{}{
 		"trends": trends,
 		"frames": timeFrames,
-	}, nil
+	}
 }
@@ -1,6 +1,7 @@
 package analyzers
 
 import (
+	"context"
 	"nyasah-backend/models"
 	"nyasah-backend/services/ai/providers"
 	"nyasah-backend/services/ai/utils"
@@ -16,14 +17,14 @@ func NewSentimentAnalyzer(provider providers.Provider) *SentimentAnalyzer {
 	}
 }
 
-func (sa *SentimentAnalyzer) AnalyzeSentiment(text string) (float64, error) {
-	return sa.provider.AnalyzeSentiment(text)
+func (sa *SentimentAnalyzer) AnalyzeSentiment(ctx context.Context, text string) (float64, error) {
+	return sa.provider.AnalyzeSentiment(ctx, text)
 }
 
-func (sa *SentimentAnalyzer) BatchAnalyzeSentiment(reviews []models.Review) ([]float64, error) {
+func (sa *SentimentAnalyzer) BatchAnalyzeSentiment(ctx context.Context, reviews []models.Review) ([]float64, error) {
 	scores := make([]float64, len(reviews))
 	for i, review := range reviews {
-		score, err := sa.AnalyzeSentiment(review.Content)
+		score, err := sa.AnalyzeSentiment(ctx, review.Content)
 		if err != nil {
 			return nil, err
 		}
@@ -32,26 +33,23 @@ func (sa *SentimentAnalyzer) BatchAnalyzeSentiment(reviews []models.Review) ([]f
 	return scores, nil
 }
 
-func (sa *SentimentAnalyzer) AnalyzeTrends(tenantID string) (map[string]interface{}, error) {
-	timeFrames := utils.GetTimeFrames()
+// AnalyzeTrends averages the stored sentiment of each frame's enriched reviews
+func (sa *SentimentAnalyzer) AnalyzeTrends(timeFrames []utils.TimeFrame) map[string]interface{} {
 	trends := make([]float64, len(timeFrames))
+	analyzed := make([]int, len(timeFrames))
 
 	for i, frame := range timeFrames {
-		reviews, err := utils.GetReviewsInTimeFrame(tenantID, frame.Start, frame.End)
-		if err != nil {
-			return nil, err
-		}
-
-		scores, err := sa.BatchAnalyzeSentiment(reviews)
-		if err != nil {
-			return nil, err
+		trends[i] = utils.CalculateAverageSentiment(frame.Reviews)
+		for _, review := range frame.Reviews {
+			if review.EnrichedAt != nil {
+				analyzed[i]++
+			}
 		}
-
-		trends[i] = utils.CalculateAverageScore(scores)
 	}
 
 	return map[string]interface{}{
-		"trends": trends,
-		"frames": timeFrames,
-	}, nil
+		"trends":   trends,
+		"analyzed": analyzed,
+		"frames":   timeFrames,
+	}
 }
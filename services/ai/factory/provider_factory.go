@@ -3,19 +3,28 @@ package factory
 import (
 	"fmt"
 	"nyasah-backend/services/ai/providers"
+	"strconv"
 )
 
 type ProviderType string
 
 const (
-	OpenAI ProviderType = "openai"
-	// TODO : bring back Claude
-	//Claude      ProviderType = "claude"
+	OpenAI      ProviderType = "openai"
+	Claude      ProviderType = "claude"
 	HuggingFace ProviderType = "huggingface"
 	Llama       ProviderType = "llama"
 )
 
+// CreateProvider creates a provider whose calls are recorded in metrics
 func CreateProvider(providerType ProviderType, config map[string]string) (providers.Provider, error) {
+	provider, err := createProvider(providerType, config)
+	if err != nil {
+		return nil, err
+	}
+	return providers.Instrument(string(providerType), provider), nil
+}
+
+func createProvider(providerType ProviderType, config map[string]string) (providers.Provider, error) {
 	switch providerType {
 	case OpenAI:
 		apiKey, ok := config["api_key"]
@@ -24,12 +33,30 @@ func CreateProvider(providerType ProviderType, config map[string]string) (provid
 		}
 		return providers.NewOpenAIProvider(apiKey), nil
 
-	/*case Claude:
-	apiKey, ok := config["api_key"]
-	if !ok {
-		return nil, fmt.Errorf("Claude API key not provided")
-	}
-	return providers.NewClaudeProvider(apiKey), nil*/
+	case Claude:
+		apiKey, ok := config["api_key"]
+		if !ok || apiKey == "" {
+			return nil, fmt.Errorf("Claude API key not provided")
+		}
+		opts := providers.ClaudeOptions{
+			Model:   config["model"],
+			BaseURL: config["base_url"],
+		}
+		if value := config["max_tokens"]; value != "" {
+			maxTokens, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Claude max tokens %q: %w", value, err)
+			}
+			opts.MaxTokens = maxTokens
+		}
+		if value := config["temperature"]; value != "" {
+			temperature, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Claude temperature %q: %w", value, err)
+			}
+			opts.Temperature = temperature
+		}
+		return providers.NewClaudeProvider(apiKey, opts), nil
 
 	case HuggingFace:
 		apiKey, ok := config["api_key"]
@@ -0,0 +1,188 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"nyasah-backend/services/tracing"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/anthropics/anthropic-sdk-go/packages/ssestream"
+)
+
+const (
+	DefaultClaudeModel   = "claude-sonnet-4-5"
+	DefaultClaudeBaseURL = "https://api.anthropic.com/"
+)
+
+type ClaudeOptions struct {
+	Model       string  // defaults to DefaultClaudeModel
+	MaxTokens   int     // limit for requests that set none; defaults to 1000
+	Temperature float64 // sampling temperature for requests that set none
+	BaseURL     string  // defaults to DefaultClaudeBaseURL; point it at a proxy or a test server
+}
+
+type ClaudeProvider struct {
+	client *anthropic.Client
+	apiKey string
+	opts   ClaudeOptions
+}
+
+func NewClaudeProvider(apiKey string, opts ClaudeOptions) *ClaudeProvider {
+	if opts.Model == "" {
+		opts.Model = DefaultClaudeModel
+	}
+	if opts.MaxTokens <= 0 {
+		opts.MaxTokens = 1000
+	}
+	if opts.BaseURL == "" {
+		opts.BaseURL = DefaultClaudeBaseURL
+	}
+	if !strings.HasSuffix(opts.BaseURL, "/") {
+		opts.BaseURL += "/"
+	}
+
+	return &ClaudeProvider{
+		client: anthropic.NewClient(
+			option.WithAPIKey(apiKey),
+			option.WithBaseURL(opts.BaseURL),
+			option.WithHTTPClient(tracing.Client()),
+		),
+		apiKey: apiKey,
+		opts:   opts,
+	}
+}
+
+// params converts a request to the Messages API, filling in the provider's
+// defaults
+func (p *ClaudeProvider) params(req Request) anthropic.MessageNewParams {
+	maxTokens := req.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = p.opts.MaxTokens
+	}
+	temperature := p.opts.Temperature
+	if req.Temperature != nil {
+		temperature = *req.Temperature
+	}
+
+	messages := make([]anthropic.MessageParam, 0, len(req.Messages))
+	for _, message := range req.Messages {
+		block := anthropic.NewTextBlock(message.Content)
+		if message.Role == RoleAssistant {
+			messages = append(messages, anthropic.NewAssistantMessage(block))
+		} else {
+			messages = append(messages, anthropic.NewUserMessage(block))
+		}
+	}
+
+	params := anthropic.MessageNewParams{
+		Model:       anthropic.F(p.opts.Model),
+		MaxTokens:   anthropic.Int(int64(maxTokens)),
+		Temperature: anthropic.Float(temperature),
+		Messages:    anthropic.F(messages),
+	}
+	if req.System != "" {
+		params.System = anthropic.F([]anthropic.TextBlockParam{anthropic.NewTextBlock(req.System)})
+	}
+	if len(req.StopSequences) > 0 {
+		params.StopSequences = anthropic.F(req.StopSequences)
+	}
+	return params
+}
+
+// response collects the text blocks and usage of a message
+func response(message *anthropic.Message) Response {
+	var text strings.Builder
+	for _, block := range message.Content {
+		if block.Type == anthropic.ContentBlockTypeText {
+			text.WriteString(block.Text)
+		}
+	}
+	return Response{
+		Text:       text.String(),
+		StopReason: string(message.StopReason),
+		Usage: Usage{
+			InputTokens:  int(message.Usage.InputTokens),
+			OutputTokens: int(message.Usage.OutputTokens),
+		},
+	}
+}
+
+func (p *ClaudeProvider) Complete(ctx context.Context, req Request) (Response, error) {
+	message, err := p.client.Messages.New(ctx, p.params(req))
+	if err != nil {
+		return Response{}, err
+	}
+
+	resp := response(message)
+	if resp.Text == "" {
+		return resp, fmt.Errorf("no response generated")
+	}
+	return resp, nil
+}
+
+func (p *ClaudeProvider) Stream(ctx context.Context, req Request) (Stream, error) {
+	stream := p.client.Messages.NewStreaming(ctx, p.params(req))
+	if err := stream.Err(); err != nil {
+		stream.Close()
+		return nil, err
+	}
+	return &claudeStream{stream: stream}, nil
+}
+
+type claudeStream struct {
+	stream  *ssestream.Stream[anthropic.MessageStreamEvent]
+	message anthropic.Message
+}
+
+func (s *claudeStream) Recv() (Chunk, error) {
+	for s.stream.Next() {
+		event := s.stream.Current()
+		if err := s.message.Accumulate(event); err != nil {
+			return Chunk{}, err
+		}
+		if delta, ok := event.AsUnion().(anthropic.ContentBlockDeltaEvent); ok && delta.Delta.Text != "" {
+			return Chunk{Text: delta.Delta.Text}, nil
+		}
+	}
+	if err := s.stream.Err(); err != nil {
+		return Chunk{}, err
+	}
+	return Chunk{}, io.EOF
+}
+
+func (s *claudeStream) Response() Response {
+	return response(&s.message)
+}
+
+func (s *claudeStream) Close() error {
+	return s.stream.Close()
+}
+
+func (p *ClaudeProvider) AnalyzeSentiment(ctx context.Context, text string) (float64, error) {
+	req := Prompt(sentimentPrompt(text))
+	req.System = "Reply with the number only."
+	req.MaxTokens = 10
+	req.Temperature = Temperature(0)
+
+	resp, err := p.Complete(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+
+	var score float64
+	_, err = fmt.Sscanf(strings.TrimSpace(resp.Text), "%f", &score)
+	return score, err
+}
+
+// Ping checks that the Anthropic API can be reached
+func (p *ClaudeProvider) Ping(ctx context.Context) error {
+	header := http.Header{
+		"X-Api-Key":         {p.apiKey},
+		"Anthropic-Version": {"2023-06-01"},
+	}
+	return ping(ctx, p.opts.BaseURL+"v1/models", header)
+}
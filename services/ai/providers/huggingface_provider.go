@@ -2,91 +2,103 @@ package providers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"nyasah-backend/services/tracing"
 )
 
 type HuggingFaceProvider struct {
 	apiKey string
 	model  string
+	client *http.Client
 }
 
 func NewHuggingFaceProvider(apiKey string, model string) *HuggingFaceProvider {
 	return &HuggingFaceProvider{
 		apiKey: apiKey,
 		model:  model,
+		client: tracing.Client(),
 	}
 }
 
-func (p *HuggingFaceProvider) ProcessQuery(query string) (string, error) {
-	url := fmt.Sprintf("https://api-inference.huggingface.co/models/%s", p.model)
-
-	payload := map[string]string{
-		"inputs": query,
-	}
+// post sends a payload to a model on the inference API and decodes the answer
+func (p *HuggingFaceProvider) post(ctx context.Context, model string, payload interface{}, result interface{}) error {
+	url := fmt.Sprintf("https://api-inference.huggingface.co/models/%s", model)
 
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", err
+		return err
 	}
 
 	req.Header.Set("Authorization", "Bearer "+p.apiKey)
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := p.client.Do(req)
 	if err != nil {
-		return "", err
+		return err
 	}
 	defer resp.Body.Close()
 
-	var result []map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
-	}
-
-	if len(result) > 0 {
-		return result[0]["generated_text"].(string), nil
-	}
-
-	return "", fmt.Errorf("no response generated")
+	return json.NewDecoder(resp.Body).Decode(result)
 }
 
-func (p *HuggingFaceProvider) AnalyzeSentiment(text string) (float64, error) {
-	url := "https://api-inference.huggingface.co/models/finiteautomata/bertweet-base-sentiment-analysis"
+func (p *HuggingFaceProvider) Complete(ctx context.Context, req Request) (Response, error) {
+	parameters := map[string]interface{}{}
+	if req.MaxTokens > 0 {
+		parameters["max_length"] = req.MaxTokens
+	}
+	if req.Temperature != nil {
+		parameters["temperature"] = *req.Temperature
+	}
+	if len(req.StopSequences) > 0 {
+		parameters["stop"] = req.StopSequences
+	}
 
-	payload := map[string]string{
-		"inputs": text,
+	payload := map[string]interface{}{
+		"inputs": flatten(req),
+	}
+	if len(parameters) > 0 {
+		payload["parameters"] = parameters
 	}
 
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return 0, err
+	var result []map[string]interface{}
+	if err := p.post(ctx, p.model, payload, &result); err != nil {
+		return Response{}, err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return 0, err
+	if len(result) > 0 {
+		if text, ok := result[0]["generated_text"].(string); ok {
+			return Response{Text: text}, nil
+		}
 	}
 
-	req.Header.Set("Authorization", "Bearer "+p.apiKey)
-	req.Header.Set("Content-Type", "application/json")
+	return Response{}, fmt.Errorf("no response generated")
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// Stream returns the whole response as one chunk, since the inference API
+// does not stream for every model
+func (p *HuggingFaceProvider) Stream(ctx context.Context, req Request) (Stream, error) {
+	resp, err := p.Complete(ctx, req)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	return SingleChunk(resp), nil
+}
+
+func (p *HuggingFaceProvider) AnalyzeSentiment(ctx context.Context, text string) (float64, error) {
+	payload := map[string]string{
+		"inputs": text,
 	}
-	defer resp.Body.Close()
 
 	var result [][]map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err := p.post(ctx, "finiteautomata/bertweet-base-sentiment-analysis", payload, &result); err != nil {
 		return 0, err
 	}
 
@@ -107,45 +119,28 @@ func (p *HuggingFaceProvider) AnalyzeSentiment(text string) (float64, error) {
 	return 0, fmt.Errorf("no sentiment analysis result")
 }
 
-func (p *HuggingFaceProvider) GenerateText(prompt string, maxTokens int, temperature float64) (string, error) {
-	url := fmt.Sprintf("https://api-inference.huggingface.co/models/%s", p.model)
+// HuggingFaceEmbeddingModel is the sentence-transformers model used for
+// embeddings, whatever model generates text
+const HuggingFaceEmbeddingModel = "sentence-transformers/all-MiniLM-L6-v2"
 
+func (p *HuggingFaceProvider) Embed(ctx context.Context, texts []string) (Embeddings, error) {
 	payload := map[string]interface{}{
-		"inputs": prompt,
-		"parameters": map[string]interface{}{
-			"max_length":  maxTokens,
-			"temperature": temperature,
-		},
+		"inputs": texts,
 	}
 
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return "", err
+	var vectors [][]float32
+	if err := p.post(ctx, HuggingFaceEmbeddingModel, payload, &vectors); err != nil {
+		return Embeddings{}, err
 	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", err
+	if len(vectors) != len(texts) {
+		return Embeddings{}, fmt.Errorf("got %d embeddings for %d texts", len(vectors), len(texts))
 	}
 
-	req.Header.Set("Authorization", "Bearer "+p.apiKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	var result []map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
-	}
-
-	if len(result) > 0 {
-		return result[0]["generated_text"].(string), nil
-	}
+	return Embeddings{Model: HuggingFaceEmbeddingModel, Vectors: vectors}, nil
+}
 
-	return "", fmt.Errorf("no response generated")
+// Ping checks that the Hugging Face inference API can be reached
+func (p *HuggingFaceProvider) Ping(ctx context.Context) error {
+	header := http.Header{"Authorization": {"Bearer " + p.apiKey}}
+	return ping(ctx, fmt.Sprintf("https://api-inference.huggingface.co/models/%s", p.model), header)
 }
@@ -0,0 +1,173 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"nyasah-backend/services/metrics"
+	"nyasah-backend/services/tracing"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Pinger is implemented by providers that can check their API is reachable
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Ping checks that the provider's API is reachable. Providers that cannot
+// tell are assumed to be.
+func Ping(ctx context.Context, p Provider) error {
+	if p == nil {
+		return errors.New("no AI provider configured")
+	}
+	if pinger, ok := p.(Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// ping sends a GET to an HTTP API. Any answer below 500 counts, since the
+// check is whether the API can be reached, not whether a request would work.
+func ping(ctx context.Context, url string, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+	return nil
+}
+
+// instrumented records the latency, errors and token usage of every call to
+// a provider in metrics, and a span for each in the trace of the call's context
+type instrumented struct {
+	name string
+	next Provider
+}
+
+// Instrument wraps a provider so its calls show up in metrics and traces
+// under name. The wrapper is an Embedder only if p is.
+func Instrument(name string, p Provider) Provider {
+	wrapped := &instrumented{name: name, next: p}
+	if _, ok := p.(Embedder); ok {
+		return &instrumentedEmbedder{wrapped}
+	}
+	return wrapped
+}
+
+// start begins the span for one call. The provider is called with the
+// returned context, so its HTTP requests are recorded under the span.
+func (p *instrumented) start(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "ai."+operation,
+		tracing.ProviderKey.String(p.name),
+		tracing.ProviderOperationKey.String(operation),
+	)
+}
+
+// addUsage records the tokens a call used
+func (p *instrumented) addUsage(ctx context.Context, usage Usage) {
+	metrics.AddTokens(p.name, usage.InputTokens, usage.OutputTokens)
+	tracing.AddTokens(ctx, usage.InputTokens, usage.OutputTokens)
+}
+
+func (p *instrumented) Complete(ctx context.Context, req Request) (Response, error) {
+	start := time.Now()
+	ctx, span := p.start(ctx, "complete")
+	resp, err := p.next.Complete(ctx, req)
+	p.addUsage(ctx, resp.Usage)
+	metrics.ObserveProvider(p.name, "complete", time.Since(start), err)
+	tracing.End(span, err)
+	return resp, err
+}
+
+// Stream keeps the call's span open, and its duration running, until the
+// stream ends or is closed
+func (p *instrumented) Stream(ctx context.Context, req Request) (Stream, error) {
+	start := time.Now()
+	ctx, span := p.start(ctx, "stream")
+	stream, err := p.next.Stream(ctx, req)
+	if err != nil {
+		metrics.ObserveProvider(p.name, "stream", time.Since(start), err)
+		tracing.End(span, err)
+		return nil, err
+	}
+	return &instrumentedStream{Stream: stream, provider: p, ctx: ctx, span: span, start: start}, nil
+}
+
+type instrumentedStream struct {
+	Stream
+	provider *instrumented
+	ctx      context.Context
+	span     trace.Span
+	start    time.Time
+	once     sync.Once
+}
+
+func (s *instrumentedStream) Recv() (Chunk, error) {
+	chunk, err := s.Stream.Recv()
+	if errors.Is(err, io.EOF) {
+		s.finish(nil)
+	} else if err != nil {
+		s.finish(err)
+	}
+	return chunk, err
+}
+
+// Close ends the span of a stream that was not read to the end. Stopping
+// early, say because the client went away, is not counted as an error.
+func (s *instrumentedStream) Close() error {
+	err := s.Stream.Close()
+	s.finish(nil)
+	return err
+}
+
+func (s *instrumentedStream) finish(err error) {
+	s.once.Do(func() {
+		s.provider.addUsage(s.ctx, s.Stream.Response().Usage)
+		metrics.ObserveProvider(s.provider.name, "stream", time.Since(s.start), err)
+		tracing.End(s.span, err)
+	})
+}
+
+func (p *instrumented) AnalyzeSentiment(ctx context.Context, text string) (float64, error) {
+	start := time.Now()
+	ctx, span := p.start(ctx, "analyze_sentiment")
+	score, err := p.next.AnalyzeSentiment(ctx, text)
+	metrics.ObserveProvider(p.name, "analyze_sentiment", time.Since(start), err)
+	tracing.End(span, err)
+	return score, err
+}
+
+type instrumentedEmbedder struct {
+	*instrumented
+}
+
+func (p *instrumentedEmbedder) Embed(ctx context.Context, texts []string) (Embeddings, error) {
+	start := time.Now()
+	ctx, span := p.start(ctx, "embed")
+	embeddings, err := Embed(ctx, p.next, texts)
+	p.addUsage(ctx, embeddings.Usage)
+	metrics.ObserveProvider(p.name, "embed", time.Since(start), err)
+	tracing.End(span, err)
+	return embeddings, err
+}
+
+func (p *instrumented) Ping(ctx context.Context) error {
+	return Ping(ctx, p.next)
+}
@@ -2,71 +2,56 @@ package providers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"nyasah-backend/services/tracing"
 )
 
 type LlamaProvider struct {
 	serverURL string
+	client    *http.Client
 }
 
 func NewLlamaProvider(serverURL string) *LlamaProvider {
 	return &LlamaProvider{
 		serverURL: serverURL,
+		client:    tracing.Client(),
 	}
 }
 
-func (p *LlamaProvider) ProcessQuery(query string) (string, error) {
+func (p *LlamaProvider) Complete(ctx context.Context, req Request) (Response, error) {
 	payload := map[string]interface{}{
-		"prompt":      query,
+		"prompt":      flatten(req),
 		"max_tokens":  1000,
 		"temperature": 0.7,
 	}
-
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return "", err
-	}
-
-	resp, err := http.Post(p.serverURL+"/generate", "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", err
+	if req.MaxTokens > 0 {
+		payload["max_tokens"] = req.MaxTokens
 	}
-	defer resp.Body.Close()
-
-	var result struct {
-		Text string `json:"text"`
+	if req.Temperature != nil {
+		payload["temperature"] = *req.Temperature
 	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+	if len(req.StopSequences) > 0 {
+		payload["stop"] = req.StopSequences
 	}
 
-	return result.Text, nil
-}
-
-func (p *LlamaProvider) AnalyzeSentiment(text string) (float64, error) {
-	prompt := fmt.Sprintf(`Analyze the sentiment of the following text and return a score between -1 (very negative) and 1 (very positive):
-	
-	Text: """%s"""
-	
-	Score:`, text)
-
-	payload := map[string]interface{}{
-		"prompt":      prompt,
-		"max_tokens":  100,
-		"temperature": 0.3,
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return Response{}, err
 	}
 
-	jsonData, err := json.Marshal(payload)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.serverURL+"/generate", bytes.NewReader(jsonData))
 	if err != nil {
-		return 0, err
+		return Response{}, err
 	}
+	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.Post(p.serverURL+"/generate", "application/json", bytes.NewBuffer(jsonData))
+	resp, err := p.client.Do(httpReq)
 	if err != nil {
-		return 0, err
+		return Response{}, err
 	}
 	defer resp.Body.Close()
 
@@ -75,39 +60,41 @@ func (p *LlamaProvider) AnalyzeSentiment(text string) (float64, error) {
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return 0, err
+		return Response{}, err
 	}
 
-	var score float64
-	_, err = fmt.Sscanf(result.Text, "%f", &score)
-	return score, err
+	return Response{Text: result.Text}, nil
 }
 
-func (p *LlamaProvider) GenerateText(prompt string, maxTokens int, temperature float64) (string, error) {
-	payload := map[string]interface{}{
-		"prompt":      prompt,
-		"max_tokens":  maxTokens,
-		"temperature": temperature,
-	}
-
-	jsonData, err := json.Marshal(payload)
+// Stream returns the whole response as one chunk, since the Llama server's
+// /generate endpoint does not stream
+func (p *LlamaProvider) Stream(ctx context.Context, req Request) (Stream, error) {
+	resp, err := p.Complete(ctx, req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	return SingleChunk(resp), nil
+}
+
+func (p *LlamaProvider) AnalyzeSentiment(ctx context.Context, text string) (float64, error) {
+	req := Prompt(sentimentPrompt(text))
+	req.MaxTokens = 100
+	req.Temperature = Temperature(0.3)
 
-	resp, err := http.Post(p.serverURL+"/generate", "application/json", bytes.NewBuffer(jsonData))
+	resp, err := p.Complete(ctx, req)
 	if err != nil {
-		return "", err
+		return 0, err
 	}
-	defer resp.Body.Close()
 
-	var result struct {
-		Text string `json:"text"`
-	}
+	var score float64
+	_, err = fmt.Sscanf(resp.Text, "%f", &score)
+	return score, err
+}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+// Ping checks that the Llama server answers
+func (p *LlamaProvider) Ping(ctx context.Context) error {
+	if p.serverURL == "" {
+		return errors.New("Llama server URL not configured")
 	}
-
-	return result.Text, nil
+	return ping(ctx, p.serverURL, nil)
 }
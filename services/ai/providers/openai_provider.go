@@ -2,7 +2,11 @@ package providers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"nyasah-backend/services/tracing"
+	"strings"
 
 	"github.com/sashabaranov/go-openai"
 )
@@ -12,80 +16,156 @@ type OpenAIProvider struct {
 }
 
 func NewOpenAIProvider(apiKey string) *OpenAIProvider {
+	config := openai.DefaultConfig(apiKey)
+	config.HTTPClient = tracing.Client()
 	return &OpenAIProvider{
-		client: openai.NewClient(apiKey),
+		client: openai.NewClientWithConfig(config),
 	}
 }
 
-func (p *OpenAIProvider) ProcessQuery(query string) (string, error) {
-	resp, err := p.client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: openai.GPT3Dot5Turbo,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: query,
-				},
-			},
+// chatRequest converts a request to the chat completions API
+func (p *OpenAIProvider) chatRequest(req Request) openai.ChatCompletionRequest {
+	messages := make([]openai.ChatCompletionMessage, 0, len(req.Messages)+1)
+	if req.System != "" {
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: req.System,
+		})
+	}
+	for _, message := range req.Messages {
+		role := openai.ChatMessageRoleUser
+		if message.Role == RoleAssistant {
+			role = openai.ChatMessageRoleAssistant
+		}
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    role,
+			Content: message.Content,
+		})
+	}
+
+	chat := openai.ChatCompletionRequest{
+		Model:     openai.GPT3Dot5Turbo,
+		Messages:  messages,
+		MaxTokens: req.MaxTokens,
+		Stop:      req.StopSequences,
+	}
+	if req.Temperature != nil {
+		chat.Temperature = float32(*req.Temperature)
+	}
+	return chat
+}
+
+func (p *OpenAIProvider) Complete(ctx context.Context, req Request) (Response, error) {
+	resp, err := p.client.CreateChatCompletion(ctx, p.chatRequest(req))
+	if err != nil {
+		return Response{}, err
+	}
+	if len(resp.Choices) == 0 {
+		return Response{}, fmt.Errorf("no response generated")
+	}
+
+	return Response{
+		Text:       resp.Choices[0].Message.Content,
+		StopReason: string(resp.Choices[0].FinishReason),
+		Usage: Usage{
+			InputTokens:  resp.Usage.PromptTokens,
+			OutputTokens: resp.Usage.CompletionTokens,
 		},
-	)
+	}, nil
+}
+
+func (p *OpenAIProvider) Stream(ctx context.Context, req Request) (Stream, error) {
+	chat := p.chatRequest(req)
+	chat.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
 
+	stream, err := p.client.CreateChatCompletionStream(ctx, chat)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	return &openAIStream{stream: stream}, nil
+}
+
+type openAIStream struct {
+	stream *openai.ChatCompletionStream
+	text   strings.Builder
+	resp   Response
+}
+
+func (s *openAIStream) Recv() (Chunk, error) {
+	for {
+		event, err := s.stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return Chunk{}, io.EOF
+		}
+		if err != nil {
+			return Chunk{}, err
+		}
+
+		// The usage arrives in a final event without choices
+		if event.Usage != nil {
+			s.resp.Usage = Usage{
+				InputTokens:  event.Usage.PromptTokens,
+				OutputTokens: event.Usage.CompletionTokens,
+			}
+		}
+		if len(event.Choices) == 0 {
+			continue
+		}
+		if reason := event.Choices[0].FinishReason; reason != "" {
+			s.resp.StopReason = string(reason)
+		}
+		if text := event.Choices[0].Delta.Content; text != "" {
+			s.text.WriteString(text)
+			return Chunk{Text: text}, nil
+		}
 	}
+}
 
-	return resp.Choices[0].Message.Content, nil
+func (s *openAIStream) Response() Response {
+	resp := s.resp
+	resp.Text = s.text.String()
+	return resp
 }
 
-func (p *OpenAIProvider) AnalyzeSentiment(text string) (float64, error) {
-	prompt := `Analyze the sentiment of the following text and return a score between -1 (very negative) and 1 (very positive):
-	
-	Text: """` + text + `"""
-	
-	Score:`
-
-	resp, err := p.client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: openai.GPT3Dot5Turbo,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: prompt,
-				},
-			},
-		},
-	)
+func (s *openAIStream) Close() error {
+	return s.stream.Close()
+}
 
+func (p *OpenAIProvider) AnalyzeSentiment(ctx context.Context, text string) (float64, error) {
+	resp, err := p.Complete(ctx, Prompt(sentimentPrompt(text)))
 	if err != nil {
 		return 0, err
 	}
 
 	var score float64
-	_, err = fmt.Sscanf(resp.Choices[0].Message.Content, "%f", &score)
+	_, err = fmt.Sscanf(resp.Text, "%f", &score)
 	return score, err
 }
 
-func (p *OpenAIProvider) GenerateText(prompt string, maxTokens int, temperature float64) (string, error) {
-	resp, err := p.client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: openai.GPT3Dot5Turbo,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: prompt,
-				},
-			},
-			MaxTokens:   maxTokens,
-			Temperature: float32(temperature),
-		},
-	)
-
+func (p *OpenAIProvider) Embed(ctx context.Context, texts []string) (Embeddings, error) {
+	resp, err := p.client.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
+		Input: texts,
+		Model: openai.SmallEmbedding3,
+	})
 	if err != nil {
-		return "", err
+		return Embeddings{}, err
+	}
+	if len(resp.Data) != len(texts) {
+		return Embeddings{}, fmt.Errorf("got %d embeddings for %d texts", len(resp.Data), len(texts))
 	}
 
-	return resp.Choices[0].Message.Content, nil
+	vectors := make([][]float32, len(texts))
+	for _, embedding := range resp.Data {
+		vectors[embedding.Index] = embedding.Embedding
+	}
+	return Embeddings{
+		Model:   string(openai.SmallEmbedding3),
+		Vectors: vectors,
+		Usage:   Usage{InputTokens: resp.Usage.PromptTokens},
+	}, nil
+}
+
+// Ping checks that the OpenAI API can be reached
+func (p *OpenAIProvider) Ping(ctx context.Context) error {
+	return ping(ctx, "https://api.openai.com/v1/models", nil)
 }
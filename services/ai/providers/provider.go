@@ -1,7 +1,159 @@
 package providers
 
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Provider is a language model API. Every call takes the context of the
+// request or job it serves, so cancelling that context cancels the call.
 type Provider interface {
-	ProcessQuery(query string) (string, error)
-	AnalyzeSentiment(text string) (float64, error)
-	GenerateText(prompt string, maxTokens int, temperature float64) (string, error)
+	// Complete generates the whole response before returning it
+	Complete(ctx context.Context, req Request) (Response, error)
+	// Stream returns the response as it is generated. The caller must close
+	// the stream.
+	Stream(ctx context.Context, req Request) (Stream, error)
+	AnalyzeSentiment(ctx context.Context, text string) (float64, error)
+}
+
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+type Message struct {
+	Role    string
+	Content string
+}
+
+// Request is one generation request. Unset limits fall back to the
+// provider's own defaults.
+type Request struct {
+	System        string
+	Messages      []Message
+	MaxTokens     int
+	Temperature   *float64
+	StopSequences []string
+}
+
+// Prompt returns a request with a single user message
+func Prompt(text string) Request {
+	return Request{Messages: []Message{{Role: RoleUser, Content: text}}}
+}
+
+// Temperature returns a pointer to t for Request.Temperature
+func Temperature(t float64) *float64 {
+	return &t
+}
+
+// Usage is the number of tokens a provider reported for one call. Providers
+// that do not report usage leave it zero.
+type Usage struct {
+	InputTokens  int
+	OutputTokens int
+}
+
+type Response struct {
+	Text       string
+	StopReason string
+	Usage      Usage
+}
+
+// Chunk is a piece of a streamed response, usually a few tokens
+type Chunk struct {
+	Text string
+}
+
+// Stream reads a response as the provider generates it
+type Stream interface {
+	// Recv returns the next chunk, or io.EOF once the response is complete
+	Recv() (Chunk, error)
+	// Response returns the text, stop reason and usage received so far. It
+	// is complete once Recv has returned io.EOF.
+	Response() Response
+	Close() error
+}
+
+// Embeddings are vectors for a batch of texts, in the order given
+type Embeddings struct {
+	Model   string // vectors from different models cannot be compared
+	Vectors [][]float32
+	Usage   Usage
+}
+
+// Embedder is implemented by providers that can turn text into vectors for
+// semantic search
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) (Embeddings, error)
+}
+
+// ErrEmbeddingsUnsupported is returned by Embed for providers that cannot
+// embed text
+var ErrEmbeddingsUnsupported = errors.New("AI provider cannot embed text")
+
+// Embed embeds texts with p if it is an Embedder
+func Embed(ctx context.Context, p Provider, texts []string) (Embeddings, error) {
+	if embedder, ok := p.(Embedder); ok {
+		return embedder.Embed(ctx, texts)
+	}
+	return Embeddings{}, ErrEmbeddingsUnsupported
+}
+
+// SingleChunk streams a response that has already been generated, for
+// providers whose API cannot stream
+func SingleChunk(resp Response) Stream {
+	return &singleChunk{resp: resp}
+}
+
+type singleChunk struct {
+	resp Response
+	sent bool
+}
+
+func (s *singleChunk) Recv() (Chunk, error) {
+	if s.sent {
+		return Chunk{}, io.EOF
+	}
+	s.sent = true
+	return Chunk{Text: s.resp.Text}, nil
+}
+
+func (s *singleChunk) Response() Response {
+	return s.resp
+}
+
+func (s *singleChunk) Close() error {
+	return nil
+}
+
+// flatten renders a request as one prompt, for APIs that only take text
+func flatten(req Request) string {
+	if req.System == "" && len(req.Messages) == 1 && req.Messages[0].Role == RoleUser {
+		return req.Messages[0].Content
+	}
+
+	var prompt strings.Builder
+	if req.System != "" {
+		prompt.WriteString(req.System + "\n\n")
+	}
+	for _, message := range req.Messages {
+		role := "User"
+		if message.Role == RoleAssistant {
+			role = "Assistant"
+		}
+		prompt.WriteString(role + ": " + message.Content + "\n\n")
+	}
+	prompt.WriteString("Assistant:")
+	return prompt.String()
+}
+
+// sentimentPrompt asks a general model for a score between -1 and 1
+func sentimentPrompt(text string) string {
+	return `Analyze the sentiment of the following text and return a score between -1 (very negative) and 1 (very positive):
+
+	Text: """` + text + `"""
+
+	Score:`
 }
@@ -1,9 +1,11 @@
 package recommenders
 
 import (
+	"context"
 	"fmt"
 	"nyasah-backend/models"
 	"nyasah-backend/services/ai/utils"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -23,7 +25,7 @@ func NewRecommender(db *gorm.DB, provider providers.Provider) *Recommender {
 	}
 }
 
-func (r *Recommender) GenerateActions(productID uuid.UUID) []string {
+func (r *Recommender) GenerateActions(ctx context.Context, productID uuid.UUID) []string {
 	var product models.Product
 	var reviews []models.Review
 	var proofs []models.SocialProof
@@ -51,40 +53,42 @@ func (r *Recommender) GenerateActions(productID uuid.UUID) []string {
 		insights.EngagementRate,
 	)
 
-	// Call the ProcessQuery method of the provider
-	response, err := r.provider.ProcessQuery(prompt)
+	// Ask the provider for recommendations
+	resp, err := r.provider.Complete(ctx, providers.Prompt(prompt))
 	if err != nil {
 		// Return default recommendations in case of error
 		return []string{"Highlight positive reviews", "Add customer photos", "Display purchase notifications"}
 	}
 
 	// Parse and return recommendations using utility
-	return utils.ParseRecommendations(response)
+	return utils.ParseRecommendations(resp.Text)
 }
 
-// GenerateInsights fetches data for the specified product and analyzes it to produce insights.
+// GenerateInsights fetches data for the specified entity and analyzes it to produce insights.
 func (r *Recommender) GenerateInsights(productID uuid.UUID) (models.ProductInsights, error) {
-	var product models.Product
+	var entity models.Entity
 	var reviews []models.Review
 	var proofs []models.SocialProof
 
-	// Fetch product details
-	if err := r.db.First(&product, productID).Error; err != nil {
-		return models.ProductInsights{}, fmt.Errorf("failed to fetch product: %w", err)
+	// Fetch entity details
+	if err := r.db.First(&entity, "id = ?", productID).Error; err != nil {
+		return models.ProductInsights{}, fmt.Errorf("failed to fetch entity: %w", err)
 	}
 
 	// Fetch associated reviews
-	if err := r.db.Where("product_id = ?", productID).Find(&reviews).Error; err != nil {
+	if err := r.db.Preload("Engagement").Where("entity_id = ?", productID).Find(&reviews).Error; err != nil {
 		return models.ProductInsights{}, fmt.Errorf("failed to fetch reviews: %w", err)
 	}
 
 	// Fetch associated social proofs
-	if err := r.db.Where("product_id = ?", productID).Find(&proofs).Error; err != nil {
+	if err := r.db.Preload("Performance", "variant_id IS NULL").Where("entity_id = ?", productID).Find(&proofs).Error; err != nil {
 		return models.ProductInsights{}, fmt.Errorf("failed to fetch social proofs: %w", err)
 	}
 
 	// Calculate insights using the utility function
-	insights := utils.GenerateProductInsights(product, reviews, proofs)
+	insights := utils.GenerateProductInsights(models.Product{ID: entity.ID, Name: entity.Name}, reviews, proofs)
+	insights.ProductID = entity.ID
+	insights.LastUpdated = time.Now()
 
 	// Return the analyzed insights
 	return insights, nil
@@ -133,7 +137,8 @@ func (r *Recommender) analyzeSuccessPatterns(tenantID uuid.UUID) []utils.Pattern
 
 func (r *Recommender) analyzeContentPattern(tenantID uuid.UUID) utils.Pattern {
 	var proofs []models.SocialProof
-	r.db.Joins("JOIN proof_performances ON social_proofs.id = proof_performances.proof_id").
+	r.db.Preload("Performance", "variant_id IS NULL").
+		Joins("JOIN proof_performances ON social_proofs.id = proof_performances.proof_id AND proof_performances.variant_id IS NULL").
 		Where("tenant_id = ? AND proof_performances.engagement_rate > ?", tenantID, 0.7).
 		Find(&proofs)
 
@@ -142,7 +147,8 @@ func (r *Recommender) analyzeContentPattern(tenantID uuid.UUID) utils.Pattern {
 
 func (r *Recommender) analyzeTimingPattern(tenantID uuid.UUID) utils.Pattern {
 	var proofs []models.SocialProof
-	r.db.Where("tenant_id = ?", tenantID).
+	r.db.Preload("Performance", "variant_id IS NULL").
+		Where("tenant_id = ?", tenantID).
 		Order("created_at DESC").
 		Limit(1000).
 		Find(&proofs)
@@ -152,7 +158,8 @@ func (r *Recommender) analyzeTimingPattern(tenantID uuid.UUID) utils.Pattern {
 
 func (r *Recommender) analyzePlacementPattern(tenantID uuid.UUID) utils.Pattern {
 	var proofs []models.SocialProof
-	r.db.Joins("JOIN proof_performances ON social_proofs.id = proof_performances.proof_id").
+	r.db.Preload("Performance", "variant_id IS NULL").
+		Joins("JOIN proof_performances ON social_proofs.id = proof_performances.proof_id AND proof_performances.variant_id IS NULL").
 		Where("tenant_id = ?", tenantID).
 		Find(&proofs)
 
@@ -2,7 +2,7 @@ package utils
 
 import (
 	"nyasah-backend/models"
-	"time"
+	"nyasah-backend/services/timeframe"
 )
 
 func CalculateReviewEngagement(review models.Review) float64 {
@@ -22,16 +22,22 @@ func CalculateProofEngagement(proof models.SocialProof) float64 {
 	return float64(proof.Performance.Conversions) / float64(proof.Performance.Views)
 }
 
+// CalculateAverageSentiment averages the stored sentiment of enriched reviews
 func CalculateAverageSentiment(reviews []models.Review) float64 {
-	if len(reviews) == 0 {
-		return 0
-	}
-
 	var total float64
+	count := 0
 	for _, review := range reviews {
+		if review.EnrichedAt == nil {
+			continue
+		}
 		total += review.Sentiment
+		count++
 	}
-	return total / float64(len(reviews))
+
+	if count == 0 {
+		return 0
+	}
+	return total / float64(count)
 }
 
 func CalculateAverageEngagement(reviews []models.Review, proofs []models.SocialProof) float64 {
@@ -55,32 +61,23 @@ func CalculateAverageEngagement(reviews []models.Review, proofs []models.SocialP
 	return total / float64(count)
 }
 
-func GroupByTimeFrames(reviews []models.Review, proofs []models.SocialProof) []TimeFrame {
-	// Group data into weekly frames for the last 12 weeks
-	frames := make([]TimeFrame, 12)
-	now := time.Now()
-
-	for i := range frames {
-		frames[i].End = now.AddDate(0, 0, -7*i)
-		frames[i].Start = frames[i].End.AddDate(0, 0, -7)
+// GroupByTimeFrames distributes reviews and proofs into the frames they were
+// created in. Frames must be in order, as returned by GetTimeFrames.
+func GroupByTimeFrames(frames []TimeFrame, reviews []models.Review, proofs []models.SocialProof) []TimeFrame {
+	buckets := make([]timeframe.Frame, len(frames))
+	for i, frame := range frames {
+		buckets[i] = timeframe.Frame{Start: frame.Start, End: frame.End}
 	}
 
-	// Distribute reviews and proofs into frames
 	for _, review := range reviews {
-		for i, frame := range frames {
-			if review.CreatedAt.After(frame.Start) && review.CreatedAt.Before(frame.End) {
-				frames[i].Reviews = append(frames[i].Reviews, review)
-				break
-			}
+		if i := timeframe.Index(buckets, review.CreatedAt); i >= 0 {
+			frames[i].Reviews = append(frames[i].Reviews, review)
 		}
 	}
 
 	for _, proof := range proofs {
-		for i, frame := range frames {
-			if proof.CreatedAt.After(frame.Start) && proof.CreatedAt.Before(frame.End) {
-				frames[i].Proofs = append(frames[i].Proofs, proof)
-				break
-			}
+		if i := timeframe.Index(buckets, proof.CreatedAt); i >= 0 {
+			frames[i].Proofs = append(frames[i].Proofs, proof)
 		}
 	}
 
@@ -1,7 +1,9 @@
 package utils
 
 import (
+	"context"
 	"nyasah-backend/models"
+	"nyasah-backend/services/timeframe"
 	"time"
 
 	"gorm.io/gorm"
@@ -15,33 +17,94 @@ func InitializeDB(database *gorm.DB) {
 	db = database
 }
 
+// TimeFrame is one calendar bucket of a trend with the reviews and proofs
+// created in it and the proof engagement rolled up during it
 type TimeFrame struct {
-	Reviews []models.Review
-	Proofs  []models.SocialProof
-	Start   time.Time
-	End     time.Time
+	Reviews     []models.Review      `json:"-"`
+	Proofs      []models.SocialProof `json:"-"`
+	Impressions int64                `json:"-"`
+	Clicks      int64                `json:"-"`
+	Conversions int64                `json:"-"`
+	Start       time.Time            `json:"start"`
+	End         time.Time            `json:"end"`
 }
 
-func GetTimeFrames() []TimeFrame {
-	now := time.Now()
-	frames := make([]TimeFrame, 12) // Last 12 weeks
+// GetTimeFrames returns empty frames for a validated spec, oldest first
+func GetTimeFrames(spec timeframe.Spec) []TimeFrame {
+	buckets := spec.Frames()
+	frames := make([]TimeFrame, len(buckets))
+	for i, bucket := range buckets {
+		frames[i].Start = bucket.Start
+		frames[i].End = bucket.End
+	}
+	return frames
+}
+
+// LoadTimeFrames loads the tenant's reviews and proof rollups for the spec's
+// range once and groups them into frames. Only stored analysis is loaded, so
+// no provider calls are needed to build trends.
+func LoadTimeFrames(ctx context.Context, tenantID string, spec timeframe.Spec) ([]TimeFrame, error) {
+	tx := db.WithContext(ctx)
 
-	for i := range frames {
-		frames[i].End = now.AddDate(0, 0, -7*i)
-		frames[i].Start = frames[i].End.AddDate(0, 0, -7)
+	var reviews []models.Review
+	err := tx.Select("id", "created_at", "sentiment", "keywords", "enriched_at").
+		Preload("Engagement").
+		Where("tenant_id = ? AND created_at >= ? AND created_at < ?", tenantID, spec.From, spec.To).
+		Find(&reviews).Error
+	if err != nil {
+		return nil, err
 	}
 
-	return frames
+	frames := GroupByTimeFrames(GetTimeFrames(spec), reviews, nil)
+	if err := addRollups(tx, frames, tenantID, spec); err != nil {
+		return nil, err
+	}
+	return frames, nil
+}
+
+// addRollups adds hourly proof rollups to the frames their hour starts in
+func addRollups(tx *gorm.DB, frames []TimeFrame, tenantID string, spec timeframe.Spec) error {
+	var rollups []struct {
+		BucketStart time.Time
+		Impressions int64
+		Clicks      int64
+		Conversions int64
+	}
+	err := tx.Model(&models.ProofRollup{}).
+		Select("bucket_start, SUM(impressions) AS impressions, SUM(clicks) AS clicks, SUM(conversions) AS conversions").
+		Where("tenant_id = ? AND bucket_start >= ? AND bucket_start < ?", tenantID, spec.From.UTC(), spec.To.UTC()).
+		Group("bucket_start").
+		Scan(&rollups).Error
+	if err != nil {
+		return err
+	}
+
+	buckets := make([]timeframe.Frame, len(frames))
+	for i, frame := range frames {
+		buckets[i] = timeframe.Frame{Start: frame.Start, End: frame.End}
+	}
+	for _, rollup := range rollups {
+		if i := timeframe.Index(buckets, rollup.BucketStart); i >= 0 {
+			frames[i].Impressions += rollup.Impressions
+			frames[i].Clicks += rollup.Clicks
+			frames[i].Conversions += rollup.Conversions
+		}
+	}
+	return nil
 }
 
+// GetReviewsInTimeFrame returns reviews created in [start, end)
 func GetReviewsInTimeFrame(tenantID string, start, end time.Time) ([]models.Review, error) {
 	var reviews []models.Review
-	err := db.Where("tenant_id = ? AND created_at BETWEEN ? AND ?", tenantID, start, end).Find(&reviews).Error
+	err := db.Where("tenant_id = ? AND created_at >= ? AND created_at < ?", tenantID, start, end).Find(&reviews).Error
 	return reviews, err
 }
 
+// GetProofsInTimeFrame returns proofs created in [start, end) with their performance
 func GetProofsInTimeFrame(tenantID string, start, end time.Time) ([]models.SocialProof, error) {
 	var proofs []models.SocialProof
-	err := db.Where("tenant_id = ? AND created_at BETWEEN ? AND ?", tenantID, start, end).Find(&proofs).Error
+	err := db.Preload("Performance", "variant_id IS NULL").
+		Where("tenant_id = ? AND created_at >= ? AND created_at < ?", tenantID, start, end).
+		Find(&proofs).Error
 	return proofs, err
 }
@@ -0,0 +1,199 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"nyasah-backend/models"
+	"nyasah-backend/services/jobs"
+	"nyasah-backend/services/mail"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TypeDeliver delivers a new incident to one of its rule's channels. Each
+// channel is its own job so a failing webhook does not resend email.
+const TypeDeliver = "alert.deliver"
+
+const (
+	ChannelWebhook = "webhook"
+	ChannelEmail   = "email"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of a webhook body, keyed with
+// the rule's webhook secret
+const SignatureHeader = "X-Nyasah-Signature"
+
+type DeliveryPayload struct {
+	IncidentID uuid.UUID `json:"incident_id"`
+	Channel    string    `json:"channel"`
+}
+
+// RegisterJobs registers incident delivery with the queue
+func (s *Service) RegisterJobs(q *jobs.Queue) {
+	s.jobs = q
+	q.Register(TypeDeliver, s.deliverJob)
+}
+
+// notify queues delivery of a new incident to each of the rule's channels
+func (s *Service) notify(rule models.AlertRule, incident models.Incident) error {
+	if s.jobs == nil {
+		return nil
+	}
+
+	var channels []string
+	if rule.WebhookURL != "" {
+		channels = append(channels, ChannelWebhook)
+	}
+	if len(rule.Emails) > 0 {
+		channels = append(channels, ChannelEmail)
+	}
+	for _, channel := range channels {
+		payload := DeliveryPayload{IncidentID: incident.ID, Channel: channel}
+		if _, err := s.jobs.Enqueue(rule.TenantID, TypeDeliver, incident.ID.String()+":"+channel, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Notification is the body of incident webhooks
+type Notification struct {
+	Event    string          `json:"event"`
+	Incident models.Incident `json:"incident"`
+	Rule     struct {
+		ID   uuid.UUID `json:"id"`
+		Name string    `json:"name"`
+	} `json:"rule"`
+	Entity struct {
+		ID   uuid.UUID `json:"id"`
+		Name string    `json:"name"`
+	} `json:"entity"`
+}
+
+func (s *Service) deliverJob(ctx context.Context, job models.Job) error {
+	var payload DeliveryPayload
+	if err := jobs.Decode(job, &payload); err != nil {
+		return err
+	}
+
+	var incident models.Incident
+	if err := s.db.First(&incident, "id = ?", payload.IncidentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+	var rule models.AlertRule
+	if err := s.db.First(&rule, "id = ?", incident.RuleID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+
+	notification := Notification{Event: "incident.opened", Incident: incident}
+	notification.Rule.ID, notification.Rule.Name = rule.ID, rule.Name
+	notification.Entity.ID = incident.EntityID
+	var entity models.Entity
+	if err := s.db.Select("id", "name").First(&entity, "id = ?", incident.EntityID).Error; err == nil {
+		notification.Entity.Name = entity.Name
+	}
+
+	switch payload.Channel {
+	case ChannelWebhook:
+		return s.sendWebhook(ctx, rule, notification)
+	case ChannelEmail:
+		return s.sendEmail(ctx, rule, notification)
+	default:
+		return jobs.Permanent(fmt.Errorf("unknown alert channel %q", payload.Channel))
+	}
+}
+
+func (s *Service) sendWebhook(ctx context.Context, rule models.AlertRule, notification Notification) error {
+	if rule.WebhookURL == "" {
+		return nil // removed from the rule since the incident opened
+	}
+
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rule.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid webhook URL: %w", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if rule.WebhookSecret != "" {
+		req.Header.Set(SignatureHeader, Sign(rule.WebhookSecret, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests:
+		return jobs.Permanent(fmt.Errorf("webhook rejected the incident with status %d", resp.StatusCode))
+	default:
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+}
+
+// Sign returns the signature sent in SignatureHeader
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Service) sendEmail(ctx context.Context, rule models.AlertRule, notification Notification) error {
+	if len(rule.Emails) == 0 || s.mailer == nil {
+		return nil
+	}
+
+	incident := notification.Incident
+	subject := notification.Entity.Name
+	if subject == "" {
+		subject = incident.EntityID.String()
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "Alert rule %q found an anomaly in %s for %s.\n\n", rule.Name, strings.ToLower(metricLabel(incident.Metric)), subject)
+	fmt.Fprintf(&text, "Last %d hours: %.2f\n", rule.WindowHours, incident.Value)
+	fmt.Fprintf(&text, "Usual: %.2f\n", incident.Baseline)
+	fmt.Fprintf(&text, "Score: %.1f\n\n", incident.Score)
+	fmt.Fprintf(&text, "Acknowledge it with POST /api/alerts/incidents/%s/acknowledge\n", incident.ID)
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      rule.Emails,
+		Subject: fmt.Sprintf("[Nyasah] %s anomaly for %s", metricLabel(incident.Metric), subject),
+		Text:    text.String(),
+	})
+}
+
+func metricLabel(metric string) string {
+	switch metric {
+	case MetricRating:
+		return "Rating"
+	case MetricSentiment:
+		return "Sentiment"
+	case MetricVolume:
+		return "Review volume"
+	case MetricOneStar:
+		return "One-star reviews"
+	}
+	return metric
+}
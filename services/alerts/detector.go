@@ -0,0 +1,468 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"nyasah-backend/models"
+	"nyasah-backend/services/jobs"
+	"nyasah-backend/services/mail"
+	"nyasah-backend/services/safehttp"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Metrics an alert rule can watch, computed per entity over the rule's window
+const (
+	MetricRating    = "rating"    // average star rating
+	MetricSentiment = "sentiment" // average stored sentiment
+	MetricVolume    = "volume"    // number of reviews
+	MetricOneStar   = "one_star"  // number of one-star reviews
+)
+
+// Baselines a window is compared with
+const (
+	MethodRobustZ  = "robust_z" // the 28 windows immediately before
+	MethodSeasonal = "seasonal" // the same hours of the week over the 8 weeks before
+)
+
+const (
+	DirectionAbove = "above"
+	DirectionBelow = "below"
+	DirectionBoth  = "both"
+)
+
+const (
+	StatusOpen         = "open"
+	StatusAcknowledged = "acknowledged"
+	StatusResolved     = "resolved"
+)
+
+const (
+	DefaultThreshold   = 3.0
+	DefaultWindowHours = 24
+	DefaultMinReviews  = 5
+	MaxWindowHours     = 7 * 24
+
+	robustWindows   = 28
+	seasonalWeeks   = 8
+	minRobustPoints = 7
+	minSeasonal     = 4
+
+	// refreshSpan is how far back each run rebuilds rollups; older buckets no
+	// longer change
+	refreshSpan = 48 * time.Hour
+)
+
+var (
+	ErrInvalidMetric    = errors.New("metric must be rating, sentiment, volume or one_star")
+	ErrInvalidMethod    = errors.New("method must be robust_z or seasonal")
+	ErrInvalidDirection = errors.New("direction must be above, below or both")
+	ErrInvalidWindow    = fmt.Errorf("window_hours must be between 1 and %d", MaxWindowHours)
+)
+
+// minScale keeps scores finite when the baseline barely varies, e.g. an
+// entity that gets no reviews at all: one review is then not an anomaly
+var minScale = map[string]float64{
+	MetricRating:    0.25,
+	MetricSentiment: 0.05,
+	MetricVolume:    1,
+	MetricOneStar:   1,
+}
+
+// Service keeps review rollups up to date, evaluates alert rules against them
+// and delivers incidents
+type Service struct {
+	db     *gorm.DB
+	jobs   *jobs.Queue
+	mailer mail.Mailer
+	client *http.Client
+}
+
+type Options struct {
+	Client *http.Client // delivers webhooks; defaults to a client that only reaches public addresses
+}
+
+// NewService creates the alerts service. Incidents are only delivered once
+// RegisterJobs has been called.
+func NewService(db *gorm.DB, mailer mail.Mailer, opts Options) *Service {
+	if opts.Client == nil {
+		opts.Client = safehttp.NewClient(10 * time.Second)
+	}
+	return &Service{
+		db:     db,
+		mailer: mailer,
+		client: opts.Client,
+	}
+}
+
+// Normalize fills in a rule's defaults and validates it
+func Normalize(rule *models.AlertRule) error {
+	if _, ok := minScale[rule.Metric]; !ok {
+		return ErrInvalidMetric
+	}
+	if rule.Method == "" {
+		rule.Method = MethodRobustZ
+	}
+	if rule.Method != MethodRobustZ && rule.Method != MethodSeasonal {
+		return ErrInvalidMethod
+	}
+	if rule.Direction == "" {
+		rule.Direction = DirectionAbove
+		if rule.Metric == MetricRating || rule.Metric == MetricSentiment {
+			rule.Direction = DirectionBelow
+		}
+	}
+	if rule.Direction != DirectionAbove && rule.Direction != DirectionBelow && rule.Direction != DirectionBoth {
+		return ErrInvalidDirection
+	}
+	if rule.Threshold <= 0 {
+		rule.Threshold = DefaultThreshold
+	}
+	if rule.WindowHours == 0 {
+		rule.WindowHours = DefaultWindowHours
+	}
+	if rule.WindowHours < 1 || rule.WindowHours > MaxWindowHours {
+		return ErrInvalidWindow
+	}
+	if rule.MinReviews <= 0 {
+		rule.MinReviews = DefaultMinReviews
+	}
+	return nil
+}
+
+// windowEnds returns the end of the current window followed by the ends of
+// its baseline windows
+func windowEnds(rule models.AlertRule, end time.Time) []time.Time {
+	window := time.Duration(rule.WindowHours) * time.Hour
+	step, count := window, robustWindows
+	if rule.Method == MethodSeasonal {
+		step, count = 7*24*time.Hour, seasonalWeeks
+	}
+
+	ends := make([]time.Time, 0, count+1)
+	for i := 0; i <= count; i++ {
+		ends = append(ends, end.Add(-time.Duration(i)*step))
+	}
+	return ends
+}
+
+// historySpan is how much rollup history the longest rule can look at
+func historySpan() time.Duration {
+	robust := time.Duration(robustWindows+1) * MaxWindowHours * time.Hour
+	seasonal := time.Duration(seasonalWeeks)*7*24*time.Hour + MaxWindowHours*time.Hour
+	if robust > seasonal {
+		return robust
+	}
+	return seasonal
+}
+
+type totals struct {
+	reviews, ratingSum, oneStar, analyzed int64
+	sentimentSum                          float64
+}
+
+// value computes the metric for a window, or false when the window has too
+// few reviews to judge an average
+func (t totals) value(rule models.AlertRule) (float64, bool) {
+	switch rule.Metric {
+	case MetricVolume:
+		return float64(t.reviews), true
+	case MetricOneStar:
+		return float64(t.oneStar), true
+	case MetricRating:
+		if t.reviews < int64(rule.MinReviews) {
+			return 0, false
+		}
+		return float64(t.ratingSum) / float64(t.reviews), true
+	case MetricSentiment:
+		if t.analyzed < int64(rule.MinReviews) {
+			return 0, false
+		}
+		return t.sentimentSum / float64(t.analyzed), true
+	}
+	return 0, false
+}
+
+func sumWindow(rollups []models.ReviewRollup, start, end time.Time) totals {
+	var t totals
+	for _, rollup := range rollups {
+		if rollup.BucketStart.Before(start) || !rollup.BucketStart.Before(end) {
+			continue
+		}
+		t.reviews += rollup.Reviews
+		t.ratingSum += rollup.RatingSum
+		t.oneStar += rollup.OneStar
+		t.analyzed += rollup.Analyzed
+		t.sentimentSum += rollup.SentimentSum
+	}
+	return t
+}
+
+// Score is the outcome of comparing a window with its baseline
+type Score struct {
+	Value    float64
+	Baseline float64 // median of the baseline windows
+	Score    float64 // robust z-score: distance from the median in scaled MADs
+}
+
+// RobustScore compares value with the baseline's median, scaling by the
+// median absolute deviation so a few past outliers do not mask new ones
+func RobustScore(value float64, baseline []float64, floor float64) Score {
+	centre := median(baseline)
+	deviations := make([]float64, len(baseline))
+	for i, v := range baseline {
+		deviations[i] = math.Abs(v - centre)
+	}
+	scale := math.Max(1.4826*median(deviations), floor)
+	return Score{Value: value, Baseline: centre, Score: (value - centre) / scale}
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+func anomalous(rule models.AlertRule, score Score) bool {
+	switch rule.Direction {
+	case DirectionAbove:
+		return score.Score >= rule.Threshold
+	case DirectionBelow:
+		return score.Score <= -rule.Threshold
+	default:
+		return math.Abs(score.Score) >= rule.Threshold
+	}
+}
+
+// Detect evaluates every enabled rule at now and returns how many incidents
+// were opened
+func (s *Service) Detect(now time.Time) (int, error) {
+	var rules []models.AlertRule
+	if err := s.db.Where("enabled = ?", true).Find(&rules).Error; err != nil {
+		return 0, fmt.Errorf("failed to load alert rules: %w", err)
+	}
+
+	opened := 0
+	for _, rule := range rules {
+		n, err := s.Evaluate(rule, now)
+		if err != nil {
+			log.Printf("Failed to evaluate alert rule %s: %v", rule.ID, err)
+			continue
+		}
+		opened += n
+	}
+	return opened, nil
+}
+
+// Evaluate checks one rule against the window ending with the current hour.
+// Anomalies open an incident or update the one already open for the entity;
+// entities back within their baseline have their incident resolved.
+func (s *Service) Evaluate(rule models.AlertRule, now time.Time) (int, error) {
+	if err := Normalize(&rule); err != nil {
+		return 0, err
+	}
+
+	window := time.Duration(rule.WindowHours) * time.Hour
+	ends := windowEnds(rule, now.UTC().Truncate(time.Hour).Add(time.Hour))
+	earliest := ends[len(ends)-1].Add(-window)
+
+	query := s.db.Where("tenant_id = ? AND bucket_start >= ? AND bucket_start < ?", rule.TenantID, earliest, ends[0])
+	if rule.EntityID != nil {
+		query = query.Where("entity_id = ?", *rule.EntityID)
+	}
+	var rollups []models.ReviewRollup
+	if err := query.Find(&rollups).Error; err != nil {
+		return 0, fmt.Errorf("failed to load review rollups: %w", err)
+	}
+
+	byEntity := make(map[uuid.UUID][]models.ReviewRollup)
+	for _, rollup := range rollups {
+		byEntity[rollup.EntityID] = append(byEntity[rollup.EntityID], rollup)
+	}
+	// Entities with an incident are evaluated even without recent reviews so
+	// the incident can resolve
+	var incidentEntities []uuid.UUID
+	err := s.db.Model(&models.Incident{}).
+		Where("rule_id = ? AND status IN ?", rule.ID, []string{StatusOpen, StatusAcknowledged}).
+		Pluck("entity_id", &incidentEntities).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to load incidents: %w", err)
+	}
+	for _, entityID := range incidentEntities {
+		if _, ok := byEntity[entityID]; !ok {
+			byEntity[entityID] = nil
+		}
+	}
+
+	minPoints := minRobustPoints
+	if rule.Method == MethodSeasonal {
+		minPoints = minSeasonal
+	}
+
+	opened := 0
+	for entityID, entityRollups := range byEntity {
+		if len(entityRollups) == 0 {
+			// No reviews left in the whole history, e.g. they were deleted
+			if err := s.resolve(rule, entityID, now); err != nil {
+				return opened, err
+			}
+			continue
+		}
+
+		current, ok := sumWindow(entityRollups, ends[0].Add(-window), ends[0]).value(rule)
+		if !ok {
+			continue
+		}
+		// Windows before the entity's first review say nothing about its normal
+		firstSeen := ends[0]
+		for _, rollup := range entityRollups {
+			if rollup.BucketStart.Before(firstSeen) {
+				firstSeen = rollup.BucketStart
+			}
+		}
+
+		var baseline []float64
+		for _, end := range ends[1:] {
+			if !end.After(firstSeen) {
+				continue
+			}
+			if v, ok := sumWindow(entityRollups, end.Add(-window), end).value(rule); ok {
+				baseline = append(baseline, v)
+			}
+		}
+		if len(baseline) < minPoints {
+			continue // not enough history to know what normal looks like
+		}
+
+		score := RobustScore(current, baseline, minScale[rule.Metric])
+		if !anomalous(rule, score) {
+			if err := s.resolve(rule, entityID, now); err != nil {
+				return opened, err
+			}
+			continue
+		}
+
+		isNew, err := s.raise(rule, entityID, score, now)
+		if err != nil {
+			return opened, err
+		}
+		if isNew {
+			opened++
+		}
+	}
+	return opened, nil
+}
+
+// raise opens an incident for the entity, or records another detection on the
+// incident that is already open or acknowledged. Only new incidents notify.
+func (s *Service) raise(rule models.AlertRule, entityID uuid.UUID, score Score, now time.Time) (bool, error) {
+	var incident models.Incident
+	err := s.db.Where("rule_id = ? AND entity_id = ? AND status IN ?", rule.ID, entityID, []string{StatusOpen, StatusAcknowledged}).
+		First(&incident).Error
+	if err == nil {
+		return false, s.db.Model(&incident).Updates(map[string]interface{}{
+			"value":            score.Value,
+			"baseline":         score.Baseline,
+			"score":            score.Score,
+			"occurrences":      gorm.Expr("occurrences + 1"),
+			"last_detected_at": now,
+		}).Error
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, fmt.Errorf("failed to load incident: %w", err)
+	}
+
+	incident = models.Incident{
+		TenantID:        rule.TenantID,
+		RuleID:          rule.ID,
+		EntityID:        entityID,
+		Metric:          rule.Metric,
+		Status:          StatusOpen,
+		Value:           score.Value,
+		Baseline:        score.Baseline,
+		Score:           score.Score,
+		Occurrences:     1,
+		FirstDetectedAt: now,
+		LastDetectedAt:  now,
+	}
+	if err := s.db.Create(&incident).Error; err != nil {
+		return false, fmt.Errorf("failed to open incident: %w", err)
+	}
+
+	if err := s.notify(rule, incident); err != nil {
+		log.Printf("Failed to queue notifications for incident %s: %v", incident.ID, err)
+	}
+	return true, nil
+}
+
+func (s *Service) resolve(rule models.AlertRule, entityID uuid.UUID, now time.Time) error {
+	return s.db.Model(&models.Incident{}).
+		Where("rule_id = ? AND entity_id = ? AND status IN ?", rule.ID, entityID, []string{StatusOpen, StatusAcknowledged}).
+		Updates(map[string]interface{}{"status": StatusResolved, "resolved_at": now}).Error
+}
+
+// Acknowledge marks an open incident as being handled. It keeps absorbing
+// repeat detections until the metric recovers.
+func (s *Service) Acknowledge(tenantID, incidentID uuid.UUID, by string) (*models.Incident, error) {
+	var incident models.Incident
+	if err := s.db.Where("tenant_id = ?", tenantID).First(&incident, "id = ?", incidentID).Error; err != nil {
+		return nil, err
+	}
+	if incident.Status != StatusOpen {
+		return &incident, nil
+	}
+
+	now := time.Now()
+	err := s.db.Model(&incident).Updates(map[string]interface{}{
+		"status":          StatusAcknowledged,
+		"acknowledged_at": now,
+		"acknowledged_by": by,
+	}).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to acknowledge incident: %w", err)
+	}
+	incident.Status, incident.AcknowledgedAt, incident.AcknowledgedBy = StatusAcknowledged, &now, by
+	return &incident, nil
+}
+
+// Run refreshes rollups and evaluates rules on the given interval until ctx
+// is done. The first run backfills all the history rules can look at.
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	since := time.Now().Add(-historySpan())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		if err := s.Refresh(since); err != nil {
+			log.Printf("Failed to refresh review rollups: %v", err)
+		} else {
+			since = now.Add(-refreshSpan)
+			if n, err := s.Detect(now); err != nil {
+				log.Printf("Failed to detect anomalies: %v", err)
+			} else if n > 0 {
+				log.Printf("Opened %d incidents", n)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
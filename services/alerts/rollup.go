@@ -0,0 +1,70 @@
+package alerts
+
+import (
+	"fmt"
+	"nyasah-backend/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type rollupKey struct {
+	tenantID, entityID uuid.UUID
+	bucket             time.Time
+}
+
+// Refresh rebuilds the hourly review rollups from since onwards. Buckets are
+// rebuilt rather than incremented so sentiment stored after a review was
+// first counted, and deleted reviews, are picked up.
+func (s *Service) Refresh(since time.Time) error {
+	since = since.UTC().Truncate(time.Hour)
+
+	rollups := make(map[rollupKey]*models.ReviewRollup)
+	var batch []models.Review
+	err := s.db.Select("id", "tenant_id", "entity_id", "rating", "sentiment", "enriched_at", "created_at").
+		Where("created_at >= ?", since).
+		FindInBatches(&batch, 5000, func(tx *gorm.DB, _ int) error {
+			for _, review := range batch {
+				bucket := review.CreatedAt.UTC().Truncate(time.Hour)
+				key := rollupKey{review.TenantID, review.EntityID, bucket}
+				rollup, ok := rollups[key]
+				if !ok {
+					rollup = &models.ReviewRollup{TenantID: review.TenantID, EntityID: review.EntityID, BucketStart: bucket}
+					rollups[key] = rollup
+				}
+
+				rollup.Reviews++
+				rollup.RatingSum += int64(review.Rating)
+				if review.Rating <= 1 {
+					rollup.OneStar++
+				}
+				if review.EnrichedAt != nil {
+					rollup.Analyzed++
+					rollup.SentimentSum += review.Sentiment
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to load reviews: %w", err)
+	}
+
+	rows := make([]models.ReviewRollup, 0, len(rollups))
+	for _, rollup := range rollups {
+		rows = append(rows, *rollup)
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("bucket_start >= ?", since).Delete(&models.ReviewRollup{}).Error; err != nil {
+			return fmt.Errorf("failed to clear review rollups: %w", err)
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		if err := tx.CreateInBatches(rows, 500).Error; err != nil {
+			return fmt.Errorf("failed to store review rollups: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,265 @@
+package analytics
+
+import (
+	"errors"
+	"fmt"
+	"nyasah-backend/models"
+	"nyasah-backend/services/timeframe"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Dimensions a report can be grouped by
+const (
+	GroupType   = "type"
+	GroupMedia  = "media"
+	GroupEntity = "entity"
+)
+
+var ErrInvalidGroup = errors.New("group_by must be type, media or entity")
+
+var groupColumns = map[string]string{
+	GroupType:   "proof_type",
+	GroupMedia:  "media_type",
+	GroupEntity: "entity_id",
+}
+
+// Service answers analytics queries from the hourly ProofRollup table
+type Service struct {
+	db *gorm.DB
+}
+
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+type Query struct {
+	TenantID    uuid.UUID
+	From        time.Time
+	To          time.Time // exclusive
+	Granularity string
+	GroupBy     []string
+	Limit       int // maximum number of series, largest by impressions first
+}
+
+type Metrics struct {
+	Impressions      int64   `json:"impressions"`
+	Clicks           int64   `json:"clicks"`
+	Conversions      int64   `json:"conversions"`
+	Revenue          float64 `json:"revenue"`
+	ClickThroughRate float64 `json:"click_through_rate"`
+	ConversionRate   float64 `json:"conversion_rate"`
+}
+
+func (m *Metrics) add(o Metrics) {
+	m.Impressions += o.Impressions
+	m.Clicks += o.Clicks
+	m.Conversions += o.Conversions
+	m.Revenue += o.Revenue
+}
+
+func (m *Metrics) computeRates() {
+	if m.Impressions > 0 {
+		m.ClickThroughRate = float64(m.Clicks) / float64(m.Impressions)
+		m.ConversionRate = float64(m.Conversions) / float64(m.Impressions)
+	}
+}
+
+type Bucket struct {
+	Start time.Time `json:"start"`
+	Metrics
+}
+
+// Series is one group's metrics over time. Buckets without activity are
+// included with zero values so every series has the same length.
+type Series struct {
+	Group   map[string]string `json:"group,omitempty"`
+	Totals  Metrics           `json:"totals"`
+	Buckets []Bucket          `json:"buckets"`
+}
+
+type Report struct {
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Granularity string    `json:"granularity"`
+	GroupBy     []string  `json:"group_by"`
+	Totals      Metrics   `json:"totals"`
+	Series      []Series  `json:"series"`
+}
+
+type rollupRow struct {
+	BucketStart     time.Time
+	ProofType       string
+	MediaType       string
+	EntityID        uuid.UUID
+	Impressions     int64
+	Clicks          int64
+	Conversions     int64
+	ConversionValue float64
+}
+
+// Validate checks the query and aligns its range to UTC bucket boundaries.
+// Rollups are hourly in UTC, so reports are bucketed in UTC as well.
+func (q *Query) Validate() error {
+	for _, group := range q.GroupBy {
+		if _, ok := groupColumns[group]; !ok {
+			return ErrInvalidGroup
+		}
+	}
+	if q.Limit <= 0 {
+		q.Limit = 50
+	}
+
+	spec := q.spec()
+	if err := spec.Validate(); err != nil {
+		return err
+	}
+	q.From, q.To, q.Granularity = spec.From, spec.To, spec.Granularity
+	return nil
+}
+
+func (q Query) spec() timeframe.Spec {
+	return timeframe.Spec{From: q.From, To: q.To, Granularity: q.Granularity, Location: time.UTC}
+}
+
+// Report returns the tenant's metrics for the query's range, bucketed and grouped
+func (s *Service) Report(q Query) (*Report, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	columns := []string{"bucket_start"}
+	for _, group := range q.GroupBy {
+		columns = append(columns, groupColumns[group])
+	}
+	selects := append(append([]string{}, columns...),
+		"SUM(impressions) AS impressions",
+		"SUM(clicks) AS clicks",
+		"SUM(conversions) AS conversions",
+		"SUM(conversion_value) AS conversion_value")
+
+	var rows []rollupRow
+	err := s.db.Model(&models.ProofRollup{}).
+		Select(strings.Join(selects, ", ")).
+		Where("tenant_id = ? AND bucket_start >= ? AND bucket_start < ?", q.TenantID, q.From.UTC(), q.To.UTC()).
+		Group(strings.Join(columns, ", ")).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rollups: %w", err)
+	}
+
+	frames := q.spec().Frames()
+
+	report := &Report{From: q.From, To: q.To, Granularity: q.Granularity, GroupBy: q.GroupBy}
+	if report.GroupBy == nil {
+		report.GroupBy = []string{}
+	}
+	series := make(map[string]*Series)
+	var entityIDs []uuid.UUID
+
+	for _, row := range rows {
+		group := groupOf(row, q.GroupBy)
+		key := groupKey(group, q.GroupBy)
+		current, ok := series[key]
+		if !ok {
+			current = &Series{Group: group, Buckets: make([]Bucket, len(frames))}
+			for i, frame := range frames {
+				current.Buckets[i].Start = frame.Start
+			}
+			series[key] = current
+			if _, byEntity := group[GroupEntity]; byEntity {
+				entityIDs = append(entityIDs, row.EntityID)
+			}
+		}
+
+		metrics := Metrics{
+			Impressions: row.Impressions,
+			Clicks:      row.Clicks,
+			Conversions: row.Conversions,
+			Revenue:     row.ConversionValue,
+		}
+		i := timeframe.Index(frames, row.BucketStart)
+		if i < 0 {
+			continue
+		}
+		current.Buckets[i].add(metrics)
+		current.Totals.add(metrics)
+		report.Totals.add(metrics)
+	}
+	report.Totals.computeRates()
+
+	report.Series = make([]Series, 0, len(series))
+	for _, current := range series {
+		current.Totals.computeRates()
+		for i := range current.Buckets {
+			current.Buckets[i].computeRates()
+		}
+		report.Series = append(report.Series, *current)
+	}
+	sort.Slice(report.Series, func(i, j int) bool {
+		a, b := report.Series[i], report.Series[j]
+		if a.Totals.Impressions != b.Totals.Impressions {
+			return a.Totals.Impressions > b.Totals.Impressions
+		}
+		return groupKey(a.Group, q.GroupBy) < groupKey(b.Group, q.GroupBy)
+	})
+	if len(report.Series) > q.Limit {
+		report.Series = report.Series[:q.Limit]
+	}
+
+	if len(entityIDs) > 0 {
+		if err := s.nameEntities(q.TenantID, report.Series, entityIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+func groupOf(row rollupRow, groupBy []string) map[string]string {
+	if len(groupBy) == 0 {
+		return nil
+	}
+	group := make(map[string]string, len(groupBy))
+	for _, dimension := range groupBy {
+		switch dimension {
+		case GroupType:
+			group[GroupType] = row.ProofType
+		case GroupMedia:
+			group[GroupMedia] = row.MediaType
+		case GroupEntity:
+			group[GroupEntity] = row.EntityID.String()
+		}
+	}
+	return group
+}
+
+func groupKey(group map[string]string, groupBy []string) string {
+	parts := make([]string, len(groupBy))
+	for i, dimension := range groupBy {
+		parts[i] = group[dimension]
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// nameEntities adds the names of the tenant's entities to series grouped by entity
+func (s *Service) nameEntities(tenantID uuid.UUID, series []Series, ids []uuid.UUID) error {
+	var entities []models.Entity
+	if err := s.db.Select("id", "name").Where("tenant_id = ? AND id IN ?", tenantID, ids).Find(&entities).Error; err != nil {
+		return fmt.Errorf("failed to load entities: %w", err)
+	}
+	names := make(map[string]string, len(entities))
+	for _, entity := range entities {
+		names[entity.ID.String()] = entity.Name
+	}
+	for _, current := range series {
+		if name, ok := names[current.Group[GroupEntity]]; ok {
+			current.Group["entity_name"] = name
+		}
+	}
+	return nil
+}
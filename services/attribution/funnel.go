@@ -0,0 +1,336 @@
+package attribution
+
+import (
+	"errors"
+	"fmt"
+	"nyasah-backend/models"
+	"nyasah-backend/services/events"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Attribution models. Every report credits conversions under all three so
+// they can be compared side by side.
+const (
+	ModelFirstTouch = "first_touch" // all credit to the first proof the visitor saw
+	ModelLastTouch  = "last_touch"  // all credit to the last proof the visitor saw
+	ModelLinear     = "linear"      // credit split evenly across every touch
+)
+
+var Models = []string{ModelFirstTouch, ModelLastTouch, ModelLinear}
+
+// Dimensions a funnel can be grouped by
+const (
+	GroupType   = "type"
+	GroupEntity = "entity"
+)
+
+// MaxRange bounds reports, which read raw events
+const MaxRange = 366 * 24 * time.Hour
+
+var (
+	ErrInvalidGroup = errors.New("group_by must be type or entity")
+	ErrInvalidRange = errors.New("from must be before to and at most 366 days apart")
+)
+
+// Service builds funnel, attribution and holdout reports from raw proof events
+type Service struct {
+	db *gorm.DB
+}
+
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+type FunnelQuery struct {
+	TenantID uuid.UUID
+	From     time.Time
+	To       time.Time // exclusive
+	GroupBy  string
+	Window   time.Duration // how far back a conversion looks for touches
+}
+
+func (q *FunnelQuery) Validate() error {
+	if q.GroupBy == "" {
+		q.GroupBy = GroupType
+	}
+	if q.GroupBy != GroupType && q.GroupBy != GroupEntity {
+		return ErrInvalidGroup
+	}
+	if !q.From.Before(q.To) || q.To.Sub(q.From) > MaxRange {
+		return ErrInvalidRange
+	}
+	if q.Window <= 0 {
+		q.Window = 24 * time.Hour
+	}
+	return nil
+}
+
+// Credit is the share of conversions and revenue a model gives a group
+type Credit struct {
+	Conversions float64 `json:"conversions"`
+	Revenue     float64 `json:"revenue"`
+}
+
+// Funnel follows visitors of one proof type or entity from seeing proof to
+// clicking it and converting afterwards
+type Funnel struct {
+	Key            string            `json:"key"`
+	Name           string            `json:"name,omitempty"`
+	Impressions    int64             `json:"impressions"`
+	Clicks         int64             `json:"clicks"`
+	Reached        int64             `json:"reached"`   // visitors who saw proof
+	Engaged        int64             `json:"engaged"`   // visitors who clicked proof
+	Converted      int64             `json:"converted"` // visitors who converted within the window after a touch
+	ClickRate      float64           `json:"click_rate"`
+	ConversionRate float64           `json:"conversion_rate"`
+	Attribution    map[string]Credit `json:"attribution"`
+}
+
+type FunnelReport struct {
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	GroupBy     string    `json:"group_by"`
+	Window      string    `json:"attribution_window"`
+	Conversions int64     `json:"conversions"`
+	Revenue     float64   `json:"revenue"`
+	Attributed  int64     `json:"attributed"` // conversions with at least one touch in the window
+	Funnels     []Funnel  `json:"funnels"`
+}
+
+type touch struct {
+	Type       string
+	ProofID    uuid.UUID
+	VisitorID  string
+	OccurredAt time.Time
+	key        string
+}
+
+type conversion struct {
+	ProofID    *uuid.UUID
+	VisitorID  string
+	Value      float64
+	OccurredAt time.Time
+}
+
+// Funnel reports the tenant's proof funnels for the query's range. Touches
+// before From still count towards attribution of conversions inside the range.
+func (s *Service) Funnel(q FunnelQuery) (*FunnelReport, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	var touches []touch
+	err := s.db.Model(&models.ProofEvent{}).
+		Select("type, proof_id, visitor_id, occurred_at").
+		Where("tenant_id = ? AND type IN ? AND proof_id IS NOT NULL", q.TenantID, []string{events.TypeImpression, events.TypeClick}).
+		Where("occurred_at >= ? AND occurred_at < ?", q.From.Add(-q.Window), q.To).
+		Order("occurred_at").
+		Scan(&touches).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load touches: %w", err)
+	}
+
+	var conversions []conversion
+	err = s.db.Model(&models.ProofEvent{}).
+		Select("proof_id, visitor_id, value, occurred_at").
+		Where("tenant_id = ? AND type = ?", q.TenantID, events.TypeConversion).
+		Where("occurred_at >= ? AND occurred_at < ?", q.From, q.To).
+		Scan(&conversions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load conversions: %w", err)
+	}
+
+	keys, err := s.proofKeys(q.TenantID, q.GroupBy, touches, conversions)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &FunnelReport{From: q.From, To: q.To, GroupBy: q.GroupBy, Window: q.Window.String()}
+	funnels := make(map[string]*Funnel)
+	funnel := func(key string) *Funnel {
+		f, ok := funnels[key]
+		if !ok {
+			f = &Funnel{Key: key, Attribution: make(map[string]Credit, len(Models))}
+			for _, model := range Models {
+				f.Attribution[model] = Credit{}
+			}
+			funnels[key] = f
+		}
+		return f
+	}
+
+	reached := make(map[string]map[string]bool)
+	engaged := make(map[string]map[string]bool)
+	converted := make(map[string]map[string]bool)
+	byVisitor := make(map[string][]touch)
+
+	for _, t := range touches {
+		key, ok := keys[t.ProofID]
+		if !ok {
+			continue // the proof has been deleted
+		}
+		t.key = key
+		if t.VisitorID != "" {
+			byVisitor[t.VisitorID] = append(byVisitor[t.VisitorID], t)
+		}
+		if t.OccurredAt.Before(q.From) {
+			continue
+		}
+
+		f := funnel(key)
+		switch t.Type {
+		case events.TypeImpression:
+			f.Impressions++
+			addVisitor(reached, key, t.VisitorID)
+		case events.TypeClick:
+			f.Clicks++
+			addVisitor(engaged, key, t.VisitorID)
+		}
+	}
+
+	for _, c := range conversions {
+		report.Conversions++
+		report.Revenue += c.Value
+
+		path := touchesBefore(byVisitor[c.VisitorID], c.OccurredAt, q.Window)
+		if len(path) == 0 && c.ProofID != nil {
+			// Conversions reported with a proof ID are credited to it directly
+			if key, ok := keys[*c.ProofID]; ok {
+				path = []touch{{ProofID: *c.ProofID, key: key}}
+			}
+		}
+		if len(path) == 0 {
+			continue
+		}
+		report.Attributed++
+
+		credit(funnel(path[0].key), ModelFirstTouch, 1, c.Value)
+		credit(funnel(path[len(path)-1].key), ModelLastTouch, 1, c.Value)
+		share := 1 / float64(len(path))
+		for _, t := range path {
+			credit(funnel(t.key), ModelLinear, share, c.Value*share)
+			addVisitor(converted, t.key, c.VisitorID)
+		}
+	}
+
+	report.Funnels = make([]Funnel, 0, len(funnels))
+	for key, f := range funnels {
+		f.Reached = int64(len(reached[key]))
+		f.Engaged = int64(len(engaged[key]))
+		f.Converted = int64(len(converted[key]))
+		if f.Reached > 0 {
+			f.ClickRate = float64(f.Engaged) / float64(f.Reached)
+			f.ConversionRate = float64(f.Converted) / float64(f.Reached)
+		}
+		report.Funnels = append(report.Funnels, *f)
+	}
+	sort.Slice(report.Funnels, func(i, j int) bool {
+		a, b := report.Funnels[i], report.Funnels[j]
+		if a.Impressions != b.Impressions {
+			return a.Impressions > b.Impressions
+		}
+		return a.Key < b.Key
+	})
+
+	if q.GroupBy == GroupEntity {
+		if err := s.nameEntities(report.Funnels); err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// touchesBefore returns the touches in the window ending at t. touches are
+// sorted by time.
+func touchesBefore(touches []touch, t time.Time, window time.Duration) []touch {
+	start := sort.Search(len(touches), func(i int) bool { return !touches[i].OccurredAt.Before(t.Add(-window)) })
+	end := sort.Search(len(touches), func(i int) bool { return touches[i].OccurredAt.After(t) })
+	return touches[start:end]
+}
+
+func credit(f *Funnel, model string, conversions, revenue float64) {
+	current := f.Attribution[model]
+	current.Conversions += conversions
+	current.Revenue += revenue
+	f.Attribution[model] = current
+}
+
+func addVisitor(sets map[string]map[string]bool, key, visitorID string) {
+	if visitorID == "" {
+		return
+	}
+	if sets[key] == nil {
+		sets[key] = make(map[string]bool)
+	}
+	sets[key][visitorID] = true
+}
+
+// proofKeys maps every proof in the events to its group key
+func (s *Service) proofKeys(tenantID uuid.UUID, groupBy string, touches []touch, conversions []conversion) (map[uuid.UUID]string, error) {
+	seen := make(map[uuid.UUID]bool)
+	var ids []uuid.UUID
+	add := func(id uuid.UUID) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, t := range touches {
+		add(t.ProofID)
+	}
+	for _, c := range conversions {
+		if c.ProofID != nil {
+			add(*c.ProofID)
+		}
+	}
+
+	keys := make(map[uuid.UUID]string, len(ids))
+	for start := 0; start < len(ids); start += 500 {
+		end := start + 500
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		var proofs []models.SocialProof
+		err := s.db.Select("id", "type", "entity_id").
+			Where("tenant_id = ? AND id IN ?", tenantID, ids[start:end]).
+			Find(&proofs).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to load proofs: %w", err)
+		}
+		for _, proof := range proofs {
+			if groupBy == GroupEntity {
+				keys[proof.ID] = proof.EntityID.String()
+			} else {
+				keys[proof.ID] = proof.Type
+			}
+		}
+	}
+	return keys, nil
+}
+
+// nameEntities adds entity names to funnels grouped by entity
+func (s *Service) nameEntities(funnels []Funnel) error {
+	ids := make([]string, len(funnels))
+	for i, f := range funnels {
+		ids[i] = f.Key
+	}
+
+	var entities []models.Entity
+	if err := s.db.Select("id", "name").Where("id IN ?", ids).Find(&entities).Error; err != nil {
+		return fmt.Errorf("failed to load entities: %w", err)
+	}
+	names := make(map[string]string, len(entities))
+	for _, entity := range entities {
+		names[entity.ID.String()] = entity.Name
+	}
+	for i := range funnels {
+		funnels[i].Name = names[funnels[i].Key]
+	}
+	return nil
+}
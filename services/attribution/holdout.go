@@ -0,0 +1,211 @@
+package attribution
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nyasah-backend/models"
+	"nyasah-backend/services/events"
+	"nyasah-backend/services/experiments"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+)
+
+// MaxHoldoutPercent caps the share of visitors who are never shown proof
+const MaxHoldoutPercent = 50
+
+// HoldoutPercent returns the "holdout_percent" from tenant settings, or 0
+// (no holdout) when it is missing
+func HoldoutPercent(settings json.RawMessage) float64 {
+	var parsed struct {
+		HoldoutPercent float64 `json:"holdout_percent"`
+	}
+	if len(settings) == 0 || json.Unmarshal(settings, &parsed) != nil || parsed.HoldoutPercent <= 0 {
+		return 0
+	}
+	if parsed.HoldoutPercent > MaxHoldoutPercent {
+		return MaxHoldoutPercent
+	}
+	return parsed.HoldoutPercent
+}
+
+// InHoldout deterministically buckets a visitor into the tenant's holdout
+func InHoldout(tenantID uuid.UUID, visitorID string, percent float64) bool {
+	if percent <= 0 || visitorID == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte("holdout:" + tenantID.String() + ":" + visitorID))
+	return float64(binary.BigEndian.Uint64(sum[:8])%10000) < percent*100
+}
+
+// Holdout reports whether a visitor is held out from seeing proof. A
+// visitor's group is stored the first time they are seen and kept, so
+// changing the holdout percentage only affects new visitors.
+func (s *Service) Holdout(tenant models.Tenant, visitorID string) (bool, error) {
+	percent := HoldoutPercent(tenant.Settings)
+	if percent <= 0 || visitorID == "" {
+		return false, nil
+	}
+
+	visitor := models.HoldoutVisitor{
+		TenantID:    tenant.ID,
+		VisitorID:   visitorID,
+		InHoldout:   InHoldout(tenant.ID, visitorID, percent),
+		FirstSeenAt: time.Now().UTC(),
+	}
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&visitor)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to record holdout visitor: %w", result.Error)
+	}
+	if result.RowsAffected == 1 {
+		return visitor.InHoldout, nil
+	}
+
+	var existing models.HoldoutVisitor
+	if err := s.db.Where("tenant_id = ? AND visitor_id = ?", tenant.ID, visitorID).First(&existing).Error; err != nil {
+		return false, fmt.Errorf("failed to load holdout visitor: %w", err)
+	}
+	return existing.InHoldout, nil
+}
+
+type LiftQuery struct {
+	TenantID   uuid.UUID
+	From       time.Time
+	To         time.Time // exclusive
+	Confidence float64
+}
+
+// LiftGroup is the outcome for the visitors of one group first seen in the range
+type LiftGroup struct {
+	Visitors          int64                `json:"visitors"`
+	Converted         int64                `json:"converted"`
+	ConversionRate    float64              `json:"conversion_rate"`
+	RateInterval      experiments.Interval `json:"rate_interval"`
+	Revenue           float64              `json:"revenue"`
+	RevenuePerVisitor float64              `json:"revenue_per_visitor"`
+}
+
+// Lift compares visitors who were shown proof with the holdout. Intervals are
+// at the query's confidence level.
+type Lift struct {
+	From                   time.Time            `json:"from"`
+	To                     time.Time            `json:"to"`
+	Confidence             float64              `json:"confidence"`
+	Exposed                LiftGroup            `json:"exposed"`
+	Holdout                LiftGroup            `json:"holdout"`
+	Difference             float64              `json:"difference"` // absolute change in conversion rate
+	DifferenceInterval     experiments.Interval `json:"difference_interval"`
+	Lift                   float64              `json:"lift"` // relative change in conversion rate
+	LiftInterval           experiments.Interval `json:"lift_interval"`
+	IncrementalConversions float64              `json:"incremental_conversions"`
+	IncrementalInterval    experiments.Interval `json:"incremental_interval"`
+	PValue                 float64              `json:"p_value"`
+	Significant            bool                 `json:"significant"`
+}
+
+var ErrInvalidConfidence = errors.New("confidence must be between 0 and 1")
+
+type holdoutRow struct {
+	VisitorID   string
+	InHoldout   bool
+	FirstSeenAt time.Time
+}
+
+// Lift measures the incremental conversions social proof drove. Visitors
+// first seen in the range count as converted when they converted after being
+// seen and before To, whether or not they were shown any proof.
+func (s *Service) Lift(q LiftQuery) (*Lift, error) {
+	if q.Confidence == 0 {
+		q.Confidence = 0.95
+	}
+	if q.Confidence <= 0 || q.Confidence >= 1 {
+		return nil, ErrInvalidConfidence
+	}
+	if !q.From.Before(q.To) || q.To.Sub(q.From) > MaxRange {
+		return nil, ErrInvalidRange
+	}
+
+	var visitors []holdoutRow
+	err := s.db.Model(&models.HoldoutVisitor{}).
+		Select("visitor_id, in_holdout, first_seen_at").
+		Where("tenant_id = ? AND first_seen_at >= ? AND first_seen_at < ?", q.TenantID, q.From.UTC(), q.To.UTC()).
+		Scan(&visitors).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load holdout visitors: %w", err)
+	}
+
+	var conversions []conversion
+	err = s.db.Model(&models.ProofEvent{}).
+		Select("visitor_id, value, occurred_at").
+		Where("tenant_id = ? AND type = ? AND visitor_id <> ''", q.TenantID, events.TypeConversion).
+		Where("occurred_at >= ? AND occurred_at < ?", q.From, q.To).
+		Scan(&conversions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load conversions: %w", err)
+	}
+	byVisitor := make(map[string][]conversion)
+	for _, c := range conversions {
+		byVisitor[c.VisitorID] = append(byVisitor[c.VisitorID], c)
+	}
+
+	lift := &Lift{From: q.From, To: q.To, Confidence: q.Confidence}
+	for _, visitor := range visitors {
+		group := &lift.Exposed
+		if visitor.InHoldout {
+			group = &lift.Holdout
+		}
+		group.Visitors++
+
+		didConvert := false
+		for _, c := range byVisitor[visitor.VisitorID] {
+			if c.OccurredAt.Before(visitor.FirstSeenAt) {
+				continue
+			}
+			didConvert = true
+			group.Revenue += c.Value
+		}
+		if didConvert {
+			group.Converted++
+		}
+	}
+
+	results := experiments.Analyze([]experiments.VariantStats{
+		{Name: "holdout", IsControl: true, Exposures: lift.Holdout.Visitors, Conversions: lift.Holdout.Converted},
+		{Name: "exposed", Exposures: lift.Exposed.Visitors, Conversions: lift.Exposed.Converted},
+	}, q.Confidence, 0)
+	holdout, exposed := results.Variants[0], results.Variants[1]
+
+	fill(&lift.Holdout, holdout)
+	fill(&lift.Exposed, exposed)
+	lift.Difference = exposed.ConversionRate - holdout.ConversionRate
+	lift.DifferenceInterval = exposed.DiffInterval
+	lift.PValue = exposed.PValue
+	lift.Significant = exposed.Significant
+	if holdout.ConversionRate > 0 {
+		lift.Lift = exposed.Lift
+		lift.LiftInterval = scale(exposed.DiffInterval, 1/holdout.ConversionRate)
+	}
+
+	// Conversions among exposed visitors that would not have happened without proof
+	n := float64(lift.Exposed.Visitors)
+	lift.IncrementalConversions = lift.Difference * n
+	lift.IncrementalInterval = scale(exposed.DiffInterval, n)
+
+	return lift, nil
+}
+
+func fill(group *LiftGroup, stats experiments.VariantStats) {
+	group.ConversionRate = stats.ConversionRate
+	group.RateInterval = stats.RateInterval
+	if group.Visitors > 0 {
+		group.RevenuePerVisitor = group.Revenue / float64(group.Visitors)
+	}
+}
+
+func scale(interval experiments.Interval, factor float64) experiments.Interval {
+	return experiments.Interval{Low: interval.Low * factor, High: interval.High * factor}
+}
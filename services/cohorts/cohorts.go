@@ -0,0 +1,373 @@
+package cohorts
+
+import (
+	"errors"
+	"fmt"
+	"nyasah-backend/models"
+	"nyasah-backend/services/events"
+	"nyasah-backend/services/timeframe"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// What places a customer in a cohort
+const (
+	ByFirstReview   = "first_review"
+	ByFirstPurchase = "first_purchase"
+)
+
+const (
+	DefaultPeriods = 12
+	MaxPeriods     = 52 // periods followed after each cohort's own
+	MaxCohorts     = 52
+)
+
+var (
+	ErrInvalidCohort      = errors.New("cohort must be first_review or first_purchase")
+	ErrInvalidGranularity = errors.New("granularity must be week or month")
+	ErrInvalidPeriods     = fmt.Errorf("periods must be between 1 and %d", MaxPeriods)
+	ErrInvalidRange       = fmt.Errorf("from must be before to and span at most %d cohorts", MaxCohorts)
+)
+
+// Service builds cohort retention reports of a tenant's customers from their
+// reviews, purchases and proof engagement
+type Service struct {
+	db *gorm.DB
+}
+
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+type Query struct {
+	TenantID    uuid.UUID
+	By          string
+	Granularity string    // week or month
+	From        time.Time // cohorts whose first review or purchase falls in From..To
+	To          time.Time // exclusive
+	Periods     int       // periods followed after the cohort's own
+}
+
+func (q *Query) Validate() error {
+	if q.By == "" {
+		q.By = ByFirstReview
+	}
+	if q.By != ByFirstReview && q.By != ByFirstPurchase {
+		return ErrInvalidCohort
+	}
+	if q.Granularity == "" {
+		q.Granularity = timeframe.Week
+	}
+	if q.Granularity != timeframe.Week && q.Granularity != timeframe.Month {
+		return ErrInvalidGranularity
+	}
+	if q.Periods == 0 {
+		q.Periods = DefaultPeriods
+	}
+	if q.Periods < 1 || q.Periods > MaxPeriods {
+		return ErrInvalidPeriods
+	}
+	if !q.From.Before(q.To) {
+		return ErrInvalidRange
+	}
+	return nil
+}
+
+// Cell is what a cohort did in one period. Period 0 is the cohort's own, so
+// it counts only activity besides the review or purchase that placed each
+// customer in the cohort.
+type Cell struct {
+	Period     int       `json:"period"`
+	Start      time.Time `json:"start"`
+	Active     int64     `json:"active"`    // customers who reviewed, purchased or engaged again
+	Retention  float64   `json:"retention"` // active customers as a share of the cohort
+	Reviewers  int64     `json:"reviewers"`
+	Reviews    int64     `json:"reviews"`
+	Purchasers int64     `json:"purchasers"`
+	Purchases  int64     `json:"purchases"`
+	Revenue    float64   `json:"revenue"`
+	Engaged    int64     `json:"engaged"` // customers who saw or clicked proof
+}
+
+// Cohort is the customers whose first review or purchase fell in one period.
+// Periods that have not started yet are left out.
+type Cohort struct {
+	Start   time.Time `json:"start"`
+	Size    int64     `json:"size"`
+	Periods []Cell    `json:"periods"`
+}
+
+type Report struct {
+	By          string    `json:"cohort"`
+	Granularity string    `json:"granularity"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	TimeZone    string    `json:"time_zone"`
+	Periods     int       `json:"periods"`
+	Cohorts     []Cohort  `json:"cohorts"`
+	// Retention is each period's retention across the cohorts that reached
+	// it, weighted by cohort size
+	Retention []float64 `json:"retention"`
+}
+
+// activity kinds, as bits of what a customer did in a period
+const (
+	kindReview uint8 = 1 << iota
+	kindPurchase
+	kindEngagement
+)
+
+// activity is one thing a customer did. key identifies the customer: a user,
+// or a visitor for purchases and engagement without a signed-in user.
+type activity struct {
+	id    uuid.UUID
+	key   string
+	kind  uint8
+	value float64
+	at    time.Time
+}
+
+type reviewRow struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+type eventRow struct {
+	ID         uuid.UUID
+	Type       string
+	UserID     *uuid.UUID
+	VisitorID  string
+	Value      float64
+	OccurredAt time.Time
+}
+
+func customerKey(userID *uuid.UUID, visitorID string) string {
+	if userID != nil && *userID != uuid.Nil {
+		return "user:" + userID.String()
+	}
+	if visitorID != "" {
+		return "visitor:" + visitorID
+	}
+	return ""
+}
+
+// Report builds the retention matrix: one row per cohort, one cell per
+// period after it. Cohort boundaries follow the tenant's time zone; weeks
+// start on Monday.
+func (s *Service) Report(q Query) (*Report, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	var tenant models.Tenant
+	if err := s.db.Select("id", "settings").First(&tenant, "id = ?", q.TenantID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load tenant: %w", err)
+	}
+	loc := timeframe.TenantLocation(tenant.Settings)
+
+	spec := timeframe.Spec{From: q.From, To: q.To, Granularity: q.Granularity, Location: loc}
+	if err := spec.Validate(); err != nil {
+		return nil, ErrInvalidRange
+	}
+	cohortFrames := spec.Frames()
+	if len(cohortFrames) > MaxCohorts {
+		return nil, ErrInvalidRange
+	}
+
+	// Every period any cohort reaches, with cohort i's period k at frames[i+k]
+	horizon := spec.To
+	for i := 0; i < q.Periods; i++ {
+		horizon = timeframe.Next(horizon, q.Granularity)
+	}
+	frames := timeframe.Spec{From: spec.From, To: horizon, Granularity: q.Granularity, Location: loc}.Frames()
+
+	now := time.Now()
+	from, to := spec.From.UTC(), horizon.UTC()
+	if now.Before(horizon) {
+		to = now.UTC()
+	}
+
+	// First reviews and purchases can lie before the range, so the activity
+	// that defines cohorts is loaded from the start
+	reviewsFrom, purchasesFrom := from, from
+	if q.By == ByFirstReview {
+		reviewsFrom = time.Time{}
+	} else {
+		purchasesFrom = time.Time{}
+	}
+
+	reviews, err := s.reviews(q.TenantID, reviewsFrom, to)
+	if err != nil {
+		return nil, err
+	}
+	purchases, err := s.events(q.TenantID, []string{events.TypeConversion}, kindPurchase, purchasesFrom, to)
+	if err != nil {
+		return nil, err
+	}
+	engagement, err := s.events(q.TenantID, []string{events.TypeImpression, events.TypeClick}, kindEngagement, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	// The first review or purchase of every customer places them in a cohort
+	defining := reviews
+	if q.By == ByFirstPurchase {
+		defining = purchases
+	}
+	first := make(map[string]activity)
+	for _, a := range defining {
+		if f, ok := first[a.key]; !ok || a.at.Before(f.at) {
+			first[a.key] = a
+		}
+	}
+
+	report := &Report{
+		By:          q.By,
+		Granularity: q.Granularity,
+		From:        spec.From,
+		To:          spec.To,
+		TimeZone:    loc.String(),
+		Periods:     q.Periods,
+		Cohorts:     make([]Cohort, len(cohortFrames)),
+		Retention:   []float64{},
+	}
+	members := make(map[string]int) // customer key to cohort index
+	for key, a := range first {
+		i := timeframe.Index(cohortFrames, a.at)
+		if i < 0 {
+			continue
+		}
+		members[key] = i
+		report.Cohorts[i].Size++
+	}
+	for i, frame := range cohortFrames {
+		cohort := &report.Cohorts[i]
+		cohort.Start = frame.Start
+		cohort.Periods = []Cell{}
+		for k := 0; k <= q.Periods && i+k < len(frames) && !frames[i+k].Start.After(now); k++ {
+			cohort.Periods = append(cohort.Periods, Cell{Period: k, Start: frames[i+k].Start})
+		}
+	}
+
+	// What each customer did per period, to count them once per cell
+	done := make(map[string]map[int]uint8)
+	for _, list := range [][]activity{reviews, purchases, engagement} {
+		for _, a := range list {
+			i, ok := members[a.key]
+			if !ok || a.id == first[a.key].id {
+				continue
+			}
+			k := timeframe.Index(frames, a.at) - i
+			cohort := &report.Cohorts[i]
+			if k < 0 || k >= len(cohort.Periods) {
+				continue
+			}
+
+			cell := &cohort.Periods[k]
+			switch a.kind {
+			case kindReview:
+				cell.Reviews++
+			case kindPurchase:
+				cell.Purchases++
+				cell.Revenue += a.value
+			}
+
+			if done[a.key] == nil {
+				done[a.key] = make(map[int]uint8)
+			}
+			before := done[a.key][k]
+			if before&a.kind != 0 {
+				continue
+			}
+			done[a.key][k] = before | a.kind
+			if before == 0 {
+				cell.Active++
+			}
+			switch a.kind {
+			case kindReview:
+				cell.Reviewers++
+			case kindPurchase:
+				cell.Purchasers++
+			case kindEngagement:
+				cell.Engaged++
+			}
+		}
+	}
+
+	var active, size []int64
+	for _, cohort := range report.Cohorts {
+		for k := range cohort.Periods {
+			cell := &cohort.Periods[k]
+			if cohort.Size > 0 {
+				cell.Retention = float64(cell.Active) / float64(cohort.Size)
+			}
+			if k == len(active) {
+				active, size = append(active, 0), append(size, 0)
+			}
+			active[k] += cell.Active
+			size[k] += cohort.Size
+		}
+	}
+	for k := range active {
+		retention := 0.0
+		if size[k] > 0 {
+			retention = float64(active[k]) / float64(size[k])
+		}
+		report.Retention = append(report.Retention, retention)
+	}
+
+	return report, nil
+}
+
+// reviews loads reviews by known users from from (when set) until to.
+// Rejected reviews do not count.
+func (s *Service) reviews(tenantID uuid.UUID, from, to time.Time) ([]activity, error) {
+	query := s.db.Model(&models.Review{}).
+		Select("id, user_id, created_at").
+		Where("tenant_id = ? AND user_id <> ? AND status <> ?", tenantID, uuid.Nil, "rejected").
+		Where("created_at < ?", to)
+	if !from.IsZero() {
+		query = query.Where("created_at >= ?", from)
+	}
+
+	var rows []reviewRow
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load reviews: %w", err)
+	}
+
+	list := make([]activity, len(rows))
+	for i, r := range rows {
+		list[i] = activity{id: r.ID, key: customerKey(&r.UserID, ""), kind: kindReview, at: r.CreatedAt}
+	}
+	return list, nil
+}
+
+// events loads storefront events of the given types from from (when set)
+// until to. Events of visitors who were not signed in count for the visitor.
+func (s *Service) events(tenantID uuid.UUID, types []string, kind uint8, from, to time.Time) ([]activity, error) {
+	query := s.db.Model(&models.ProofEvent{}).
+		Select("id, type, user_id, visitor_id, value, occurred_at").
+		Where("tenant_id = ? AND type IN ?", tenantID, types).
+		Where("occurred_at < ?", to)
+	if !from.IsZero() {
+		query = query.Where("occurred_at >= ?", from)
+	}
+
+	var rows []eventRow
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load events: %w", err)
+	}
+
+	list := make([]activity, 0, len(rows))
+	for _, e := range rows {
+		key := customerKey(e.UserID, e.VisitorID)
+		if key == "" {
+			continue
+		}
+		list = append(list, activity{id: e.ID, key: key, kind: kind, value: e.Value, at: e.OccurredAt})
+	}
+	return list, nil
+}
@@ -0,0 +1,202 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"nyasah-backend/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// aggregateBatch bounds how many events one aggregation pass reads
+const aggregateBatch = 5000
+
+// Aggregator attributes conversions and rolls events up into the per-proof
+// ProofPerformance rows (the rows without an experiment variant)
+type Aggregator struct {
+	db     *gorm.DB
+	window time.Duration
+}
+
+func NewAggregator(db *gorm.DB, attributionWindow time.Duration) *Aggregator {
+	return &Aggregator{db: db, window: attributionWindow}
+}
+
+type counts struct {
+	views, clicks, conversions int
+}
+
+// Aggregate processes events not yet aggregated and returns how many it handled
+func (a *Aggregator) Aggregate() (int, error) {
+	total := 0
+	for {
+		n, err := a.aggregateBatch()
+		total += n
+		if err != nil || n < aggregateBatch {
+			return total, err
+		}
+	}
+}
+
+func (a *Aggregator) aggregateBatch() (int, error) {
+	var events []models.ProofEvent
+	err := a.db.Where("aggregated = ?", false).
+		Order("occurred_at").
+		Limit(aggregateBatch).
+		Find(&events).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to load events: %w", err)
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	err = a.db.Transaction(func(tx *gorm.DB) error {
+		ids := make([]uuid.UUID, 0, len(events))
+		credited := make([]creditedEvent, 0, len(events))
+
+		for _, event := range events {
+			ids = append(ids, event.ID)
+
+			proofID := event.ProofID
+			if event.Type == TypeConversion && proofID == nil {
+				attributed, err := a.attribute(tx, event)
+				if err != nil {
+					return err
+				}
+				proofID = attributed
+			}
+			if proofID == nil {
+				continue
+			}
+			credited = append(credited, creditedEvent{event: event, proofID: *proofID})
+		}
+
+		credited, err := owned(tx, credited)
+		if err != nil {
+			return err
+		}
+
+		deltas := make(map[uuid.UUID]*counts)
+		for _, c := range credited {
+			delta, ok := deltas[c.proofID]
+			if !ok {
+				delta = &counts{}
+				deltas[c.proofID] = delta
+			}
+			switch c.event.Type {
+			case TypeImpression:
+				delta.views++
+			case TypeClick:
+				delta.clicks++
+			case TypeConversion:
+				delta.conversions++
+			}
+		}
+
+		for proofID, delta := range deltas {
+			if err := addCounts(tx, proofID, *delta); err != nil {
+				return err
+			}
+		}
+		if err := addRollups(tx, credited); err != nil {
+			return err
+		}
+
+		return tx.Model(&models.ProofEvent{}).Where("id IN ?", ids).Update("aggregated", true).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(events), nil
+}
+
+// attribute credits a conversion to the last proof the visitor saw or clicked
+// within the attribution window, and stores the result on the event
+func (a *Aggregator) attribute(tx *gorm.DB, conversion models.ProofEvent) (*uuid.UUID, error) {
+	if conversion.VisitorID == "" {
+		return nil, nil
+	}
+
+	var touch models.ProofEvent
+	err := tx.Where("tenant_id = ? AND visitor_id = ? AND type IN ? AND proof_id IS NOT NULL",
+		conversion.TenantID, conversion.VisitorID, []string{TypeImpression, TypeClick}).
+		Where("occurred_at BETWEEN ? AND ?", conversion.OccurredAt.Add(-a.window), conversion.OccurredAt).
+		Order("occurred_at DESC").
+		First(&touch).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to attribute conversion: %w", err)
+	}
+
+	if err := tx.Model(&models.ProofEvent{}).Where("id = ?", conversion.ID).Update("proof_id", touch.ProofID).Error; err != nil {
+		return nil, fmt.Errorf("failed to store attribution: %w", err)
+	}
+	return touch.ProofID, nil
+}
+
+// owned drops events crediting a proof of another tenant. Proof IDs are
+// public in the widget markup, so any storefront can report them.
+func owned(tx *gorm.DB, credited []creditedEvent) ([]creditedEvent, error) {
+	if len(credited) == 0 {
+		return credited, nil
+	}
+
+	proofIDs := make([]uuid.UUID, 0, len(credited))
+	seen := make(map[uuid.UUID]bool)
+	for _, c := range credited {
+		if !seen[c.proofID] {
+			seen[c.proofID] = true
+			proofIDs = append(proofIDs, c.proofID)
+		}
+	}
+
+	var proofs []models.SocialProof
+	if err := tx.Select("id", "tenant_id").Where("id IN ?", proofIDs).Find(&proofs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load proofs: %w", err)
+	}
+	tenants := make(map[uuid.UUID]uuid.UUID, len(proofs))
+	for _, proof := range proofs {
+		tenants[proof.ID] = proof.TenantID
+	}
+
+	kept := credited[:0]
+	for _, c := range credited {
+		if tenant, ok := tenants[c.proofID]; ok && tenant == c.event.TenantID {
+			kept = append(kept, c)
+		}
+	}
+	return kept, nil
+}
+
+// addCounts adds a batch's counts to a proof's performance row in one upsert,
+// so concurrent aggregations cannot overwrite each other's increments
+func addCounts(tx *gorm.DB, proofID uuid.UUID, delta counts) error {
+	perf := models.ProofPerformance{ProofID: proofID, Views: delta.views, Clicks: delta.clicks, Conversions: delta.conversions}
+	if perf.Views > 0 {
+		perf.EngagementRate = float64(perf.Conversions) / float64(perf.Views)
+	}
+
+	err := tx.Clauses(clause.OnConflict{
+		Columns:     []clause.Column{{Name: "proof_id"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "variant_id IS NULL"}}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"views":       gorm.Expr("proof_performances.views + excluded.views"),
+			"clicks":      gorm.Expr("proof_performances.clicks + excluded.clicks"),
+			"conversions": gorm.Expr("proof_performances.conversions + excluded.conversions"),
+			"engagement_rate": gorm.Expr("CASE WHEN proof_performances.views + excluded.views > 0 " +
+				"THEN (proof_performances.conversions + excluded.conversions) * 1.0 / (proof_performances.views + excluded.views) ELSE 0 END"),
+			"updated_at": gorm.Expr("excluded.updated_at"),
+		}),
+	}).Create(&perf).Error
+	if err != nil {
+		return fmt.Errorf("failed to save proof performance: %w", err)
+	}
+	return nil
+}
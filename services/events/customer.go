@@ -0,0 +1,26 @@
+package events
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/google/uuid"
+)
+
+// CustomerToken signs a customer's user ID with the tenant's API key. The
+// storefront's server computes it and the page sends it along with user_id,
+// so a client holding only the publishable widget key cannot pose as a customer.
+func CustomerToken(apiKey string, userID uuid.UUID) string {
+	mac := hmac.New(sha256.New, []byte(apiKey))
+	mac.Write([]byte(userID.String()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyCustomer reports whether token is the tenant's signature of userID
+func VerifyCustomer(apiKey string, userID uuid.UUID, token string) bool {
+	if apiKey == "" || token == "" {
+		return false
+	}
+	return hmac.Equal([]byte(CustomerToken(apiKey, userID)), []byte(token))
+}
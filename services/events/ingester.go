@@ -0,0 +1,212 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"nyasah-backend/models"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	TypeImpression = "impression"
+	TypeClick      = "click"
+	TypeConversion = "conversion"
+
+	maxEventIDLength = 64
+)
+
+// ErrBufferFull is returned when the in-memory buffer cannot take more events
+// until the next flush; clients should retry later
+var ErrBufferFull = errors.New("event buffer is full")
+
+type Options struct {
+	BufferSize        int           // events held in memory before new ones are rejected
+	BatchSize         int           // rows per bulk insert; reaching it triggers an early flush
+	FlushInterval     time.Duration // how often buffered events are written
+	AggregateInterval time.Duration // how often events are rolled up into ProofPerformance
+	AttributionWindow time.Duration // how far back a conversion looks for the last proof seen
+}
+
+// Ingester buffers storefront events in memory, writes them in bulk and
+// periodically aggregates them into ProofPerformance
+type Ingester struct {
+	db         *gorm.DB
+	opts       Options
+	aggregator *Aggregator
+
+	mu      sync.Mutex
+	buffer  []models.ProofEvent
+	pending map[string]struct{} // idempotency keys of buffered events
+	flushCh chan struct{}
+}
+
+func NewIngester(db *gorm.DB, opts Options) *Ingester {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 50000
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 2 * time.Second
+	}
+	if opts.AggregateInterval <= 0 {
+		opts.AggregateInterval = time.Minute
+	}
+	if opts.AttributionWindow <= 0 {
+		opts.AttributionWindow = 24 * time.Hour
+	}
+
+	return &Ingester{
+		db:         db,
+		opts:       opts,
+		aggregator: NewAggregator(db, opts.AttributionWindow),
+		pending:    make(map[string]struct{}),
+		flushCh:    make(chan struct{}, 1),
+	}
+}
+
+// Validate checks an event before it is buffered
+func Validate(event models.ProofEvent) error {
+	if event.EventID == "" || len(event.EventID) > maxEventIDLength {
+		return fmt.Errorf("event id must be 1-%d characters", maxEventIDLength)
+	}
+
+	switch event.Type {
+	case TypeImpression, TypeClick:
+		if event.ProofID == nil {
+			return fmt.Errorf("%s events require a proof_id", event.Type)
+		}
+	case TypeConversion:
+		if event.ProofID == nil && event.VisitorID == "" {
+			return fmt.Errorf("conversion events require a proof_id or visitor_id")
+		}
+	default:
+		return fmt.Errorf("unknown event type: %s", event.Type)
+	}
+
+	return nil
+}
+
+// Add buffers events and returns how many were new. Events whose idempotency
+// ID is already buffered are skipped; IDs already stored are skipped on flush.
+func (i *Ingester) Add(events []models.ProofEvent) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if len(i.buffer)+len(events) > i.opts.BufferSize {
+		return 0, ErrBufferFull
+	}
+
+	added := 0
+	for _, event := range events {
+		key := event.TenantID.String() + ":" + event.EventID
+		if _, ok := i.pending[key]; ok {
+			continue
+		}
+		i.pending[key] = struct{}{}
+		i.buffer = append(i.buffer, event)
+		added++
+	}
+
+	if len(i.buffer) >= i.opts.BatchSize {
+		select {
+		case i.flushCh <- struct{}{}:
+		default:
+		}
+	}
+
+	return added, nil
+}
+
+// Len returns the number of buffered events
+func (i *Ingester) Len() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return len(i.buffer)
+}
+
+// Flush writes buffered events in bulk. Events that fail to write are put
+// back in the buffer for the next attempt.
+func (i *Ingester) Flush() error {
+	i.mu.Lock()
+	batch := i.buffer
+	i.buffer = nil
+	i.pending = make(map[string]struct{})
+	i.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	err := i.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "tenant_id"}, {Name: "event_id"}},
+		DoNothing: true,
+	}).CreateInBatches(&batch, i.opts.BatchSize).Error
+	if err != nil {
+		i.requeue(batch)
+		return fmt.Errorf("failed to write events: %w", err)
+	}
+
+	return nil
+}
+
+func (i *Ingester) requeue(batch []models.ProofEvent) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	room := i.opts.BufferSize - len(i.buffer)
+	if room < len(batch) {
+		log.Printf("Dropping %d events: buffer full", len(batch)-room)
+		batch = batch[:room]
+	}
+	for _, event := range batch {
+		i.pending[event.TenantID.String()+":"+event.EventID] = struct{}{}
+	}
+	i.buffer = append(batch, i.buffer...)
+}
+
+// Aggregate flushes the buffer and rolls stored events up into ProofPerformance
+func (i *Ingester) Aggregate() (int, error) {
+	if err := i.Flush(); err != nil {
+		return 0, err
+	}
+	return i.aggregator.Aggregate()
+}
+
+// Run flushes and aggregates on the configured intervals until ctx is done,
+// then writes whatever is still buffered
+func (i *Ingester) Run(ctx context.Context) {
+	flushTicker := time.NewTicker(i.opts.FlushInterval)
+	defer flushTicker.Stop()
+	aggregateTicker := time.NewTicker(i.opts.AggregateInterval)
+	defer aggregateTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := i.Flush(); err != nil {
+				log.Printf("Failed to flush events on shutdown: %v", err)
+			}
+			return
+		case <-flushTicker.C:
+			if err := i.Flush(); err != nil {
+				log.Printf("Failed to flush events: %v", err)
+			}
+		case <-i.flushCh:
+			if err := i.Flush(); err != nil {
+				log.Printf("Failed to flush events: %v", err)
+			}
+		case <-aggregateTicker.C:
+			if _, err := i.Aggregate(); err != nil {
+				log.Printf("Failed to aggregate events: %v", err)
+			}
+		}
+	}
+}
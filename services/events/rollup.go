@@ -0,0 +1,106 @@
+package events
+
+import (
+	"fmt"
+	"nyasah-backend/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// creditedEvent is an event together with the proof it counts towards
+type creditedEvent struct {
+	event   models.ProofEvent
+	proofID uuid.UUID
+}
+
+type rollupKey struct {
+	tenantID    uuid.UUID
+	bucketStart time.Time
+	proofType   string
+	mediaType   string
+	entityID    uuid.UUID
+}
+
+// addRollups adds credited events to the hourly ProofRollup rows. Conversions
+// that could not be attributed to a proof are left out of the rollups.
+func addRollups(tx *gorm.DB, credited []creditedEvent) error {
+	if len(credited) == 0 {
+		return nil
+	}
+
+	proofIDs := make([]uuid.UUID, 0, len(credited))
+	seen := make(map[uuid.UUID]bool)
+	for _, c := range credited {
+		if !seen[c.proofID] {
+			seen[c.proofID] = true
+			proofIDs = append(proofIDs, c.proofID)
+		}
+	}
+
+	var proofs []models.SocialProof
+	if err := tx.Select("id", "tenant_id", "type", "media_type", "entity_id").Where("id IN ?", proofIDs).Find(&proofs).Error; err != nil {
+		return fmt.Errorf("failed to load proofs for rollup: %w", err)
+	}
+	byID := make(map[uuid.UUID]models.SocialProof, len(proofs))
+	for _, proof := range proofs {
+		byID[proof.ID] = proof
+	}
+
+	rows := make(map[rollupKey]*models.ProofRollup)
+	for _, c := range credited {
+		proof, ok := byID[c.proofID]
+		if !ok || proof.TenantID != c.event.TenantID {
+			continue
+		}
+		key := rollupKey{
+			tenantID:    c.event.TenantID,
+			bucketStart: c.event.OccurredAt.UTC().Truncate(time.Hour),
+			proofType:   proof.Type,
+			mediaType:   proof.MediaType,
+			entityID:    proof.EntityID,
+		}
+		row, ok := rows[key]
+		if !ok {
+			row = &models.ProofRollup{
+				TenantID:    key.tenantID,
+				BucketStart: key.bucketStart,
+				ProofType:   key.proofType,
+				MediaType:   key.mediaType,
+				EntityID:    key.entityID,
+			}
+			rows[key] = row
+		}
+		switch c.event.Type {
+		case TypeImpression:
+			row.Impressions++
+		case TypeClick:
+			row.Clicks++
+		case TypeConversion:
+			row.Conversions++
+			row.ConversionValue += c.event.Value
+		}
+	}
+
+	batch := make([]models.ProofRollup, 0, len(rows))
+	for _, row := range rows {
+		batch = append(batch, *row)
+	}
+
+	err := tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "tenant_id"}, {Name: "bucket_start"}, {Name: "proof_type"}, {Name: "media_type"}, {Name: "entity_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"impressions":      gorm.Expr("proof_rollups.impressions + excluded.impressions"),
+			"clicks":           gorm.Expr("proof_rollups.clicks + excluded.clicks"),
+			"conversions":      gorm.Expr("proof_rollups.conversions + excluded.conversions"),
+			"conversion_value": gorm.Expr("proof_rollups.conversion_value + excluded.conversion_value"),
+			"updated_at":       gorm.Expr("excluded.updated_at"),
+		}),
+	}).CreateInBatches(&batch, 200).Error
+	if err != nil {
+		return fmt.Errorf("failed to write proof rollups: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+package experiments
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nyasah-backend/models"
+	"nyasah-backend/services/templates"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	StatusDraft     = "draft"
+	StatusRunning   = "running"
+	StatusStopped   = "stopped"
+	StatusCompleted = "completed"
+)
+
+type Service struct {
+	db        *gorm.DB
+	templates *templates.Service
+}
+
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db, templates: templates.NewService(db)}
+}
+
+// Assign deterministically buckets a visitor into one of the experiment's
+// variants in proportion to their weights. The same visitor always gets the
+// same variant as long as the variants don't change.
+func Assign(experiment models.Experiment, visitorID string) (models.ExperimentVariant, bool) {
+	variants := make([]models.ExperimentVariant, 0, len(experiment.Variants))
+	total := 0
+	for _, variant := range experiment.Variants {
+		if variant.Weight <= 0 {
+			continue
+		}
+		variants = append(variants, variant)
+		total += variant.Weight
+	}
+	if total == 0 {
+		return models.ExperimentVariant{}, false
+	}
+	sort.Slice(variants, func(i, j int) bool { return variants[i].ID.String() < variants[j].ID.String() })
+
+	sum := sha256.Sum256([]byte(experiment.ID.String() + ":" + visitorID))
+	bucket := int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+
+	for _, variant := range variants {
+		if bucket < variant.Weight {
+			return variant, true
+		}
+		bucket -= variant.Weight
+	}
+	return variants[len(variants)-1], true
+}
+
+// Running returns the tenant's running experiment for a proof type, if any
+func (s *Service) Running(tenantID uuid.UUID, proofType string) (*models.Experiment, error) {
+	var experiment models.Experiment
+	err := s.db.Preload("Variants").
+		Where("tenant_id = ? AND proof_type = ? AND status = ?", tenantID, proofType, StatusRunning).
+		Order("started_at").
+		First(&experiment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load experiment: %w", err)
+	}
+	return &experiment, nil
+}
+
+// RecordExposure stores the visitor's assignment on first exposure and counts
+// a view for each proof shown under the variant
+func (s *Service) RecordExposure(experimentID, variantID uuid.UUID, visitorID string, proofIDs []uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		assignment := models.ExperimentAssignment{ExperimentID: experimentID, VisitorID: visitorID, VariantID: variantID}
+		if len(proofIDs) > 0 {
+			assignment.LastProofID = &proofIDs[0]
+		}
+
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "experiment_id"}, {Name: "visitor_id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"last_proof_id": assignment.LastProofID}),
+		}).Create(&assignment).Error
+		if err != nil {
+			return fmt.Errorf("failed to record assignment: %w", err)
+		}
+
+		for _, proofID := range proofIDs {
+			if err := addPerformance(tx, proofID, variantID, 1, 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RecordConversion marks the visitor as converted in every running experiment
+// of the tenant they were exposed to, crediting the last proof they saw.
+// It returns the number of experiments the conversion counted towards.
+func (s *Service) RecordConversion(tenantID uuid.UUID, visitorID string) (int, error) {
+	var assignments []models.ExperimentAssignment
+	err := s.db.Joins("JOIN experiments ON experiments.id = experiment_assignments.experiment_id").
+		Where("experiments.tenant_id = ? AND experiments.status = ?", tenantID, StatusRunning).
+		Where("experiment_assignments.visitor_id = ? AND experiment_assignments.converted = ?", visitorID, false).
+		Find(&assignments).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to load assignments: %w", err)
+	}
+
+	now := time.Now()
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for _, assignment := range assignments {
+			err := tx.Model(&models.ExperimentAssignment{}).
+				Where("id = ?", assignment.ID).
+				Updates(map[string]interface{}{"converted": true, "converted_at": now}).Error
+			if err != nil {
+				return fmt.Errorf("failed to record conversion: %w", err)
+			}
+			if assignment.LastProofID != nil {
+				if err := addPerformance(tx, *assignment.LastProofID, assignment.VariantID, 0, 1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(assignments), nil
+}
+
+// addPerformance increments a proof's view and conversion counts for a
+// variant. It runs on every exposure, so the counts are added in one upsert
+// rather than read and written back, which would lose concurrent increments.
+func addPerformance(tx *gorm.DB, proofID, variantID uuid.UUID, views, conversions int) error {
+	perf := models.ProofPerformance{ProofID: proofID, VariantID: &variantID, Views: views, Conversions: conversions}
+	if views > 0 {
+		perf.EngagementRate = float64(conversions) / float64(views)
+	}
+
+	err := tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "proof_id"}, {Name: "variant_id"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "views"}, Value: gorm.Expr("proof_performances.views + ?", views)},
+			{Column: clause.Column{Name: "conversions"}, Value: gorm.Expr("proof_performances.conversions + ?", conversions)},
+			{Column: clause.Column{Name: "engagement_rate"}, Value: gorm.Expr(
+				"CASE WHEN proof_performances.views + ? > 0 THEN (proof_performances.conversions + ?) * 1.0 / (proof_performances.views + ?) ELSE 0 END",
+				views, conversions, views)},
+			{Column: clause.Column{Name: "updated_at"}, Value: time.Now()},
+		},
+	}).Create(&perf).Error
+	if err != nil {
+		return fmt.Errorf("failed to save proof performance: %w", err)
+	}
+	return nil
+}
+
+// Results computes per-variant statistics. Visitors are the unit of analysis:
+// exposures are assigned visitors and conversions are converted visitors.
+func (s *Service) Results(experiment models.Experiment) (Results, error) {
+	var rows []struct {
+		VariantID   uuid.UUID
+		Exposures   int64
+		Conversions int64
+	}
+	err := s.db.Model(&models.ExperimentAssignment{}).
+		Select("variant_id, COUNT(*) AS exposures, SUM(CASE WHEN converted THEN 1 ELSE 0 END) AS conversions").
+		Where("experiment_id = ?", experiment.ID).
+		Group("variant_id").
+		Scan(&rows).Error
+	if err != nil {
+		return Results{}, fmt.Errorf("failed to count assignments: %w", err)
+	}
+
+	counts := make(map[uuid.UUID]int)
+	for i, row := range rows {
+		counts[row.VariantID] = i
+	}
+
+	stats := make([]VariantStats, 0, len(experiment.Variants))
+	for _, variant := range experiment.Variants {
+		vs := VariantStats{VariantID: variant.ID.String(), Name: variant.Name, IsControl: variant.IsControl}
+		if i, ok := counts[variant.ID]; ok {
+			vs.Exposures = rows[i].Exposures
+			vs.Conversions = rows[i].Conversions
+		}
+		stats = append(stats, vs)
+	}
+
+	return Analyze(stats, experiment.ConfidenceLevel, experiment.MinSampleSize), nil
+}
+
+// Promote makes a variant the tenant's default: its template body becomes the
+// proof type's template in the tenant's default locale, and its placement,
+// delay and media type are written to the "widget" settings. The experiment
+// is then completed with the variant as winner.
+func (s *Service) Promote(experiment models.Experiment, variantID uuid.UUID) error {
+	var winner *models.ExperimentVariant
+	for i := range experiment.Variants {
+		if experiment.Variants[i].ID == variantID {
+			winner = &experiment.Variants[i]
+		}
+	}
+	if winner == nil {
+		return fmt.Errorf("variant %s does not belong to experiment", variantID)
+	}
+
+	locale := s.templates.DefaultLocale(experiment.TenantID)
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if winner.Config.TemplateBody != "" {
+			tmpl := models.ProofTemplate{
+				TenantID:  experiment.TenantID,
+				Type:      experiment.ProofType,
+				Locale:    locale,
+				Body:      winner.Config.TemplateBody,
+				NameStyle: templates.NameFirstInitial,
+			}
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "tenant_id"}, {Name: "type"}, {Name: "locale"}},
+				DoUpdates: clause.AssignmentColumns([]string{"body", "updated_at"}),
+			}).Create(&tmpl).Error
+			if err != nil {
+				return fmt.Errorf("failed to save winning template: %w", err)
+			}
+		}
+
+		if err := promoteSettings(tx, experiment.TenantID, winner.Config); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		return tx.Model(&models.Experiment{}).Where("id = ?", experiment.ID).Updates(map[string]interface{}{
+			"status":            StatusCompleted,
+			"winner_variant_id": variantID,
+			"ended_at":          now,
+		}).Error
+	})
+}
+
+// promoteSettings merges a variant's widget overrides into the tenant's settings
+func promoteSettings(tx *gorm.DB, tenantID uuid.UUID, config models.VariantConfig) error {
+	if config.Placement == "" && config.DelaySeconds == 0 && config.MediaType == "" {
+		return nil
+	}
+
+	var tenant models.Tenant
+	if err := tx.Select("id", "settings").First(&tenant, "id = ?", tenantID).Error; err != nil {
+		return fmt.Errorf("failed to load tenant: %w", err)
+	}
+
+	settings := make(map[string]interface{})
+	if len(tenant.Settings) > 0 {
+		if err := json.Unmarshal(tenant.Settings, &settings); err != nil {
+			return fmt.Errorf("failed to parse tenant settings: %w", err)
+		}
+	}
+	widget, _ := settings["widget"].(map[string]interface{})
+	if widget == nil {
+		widget = make(map[string]interface{})
+	}
+
+	if config.Placement != "" {
+		widget["position"] = config.Placement
+	}
+	if config.DelaySeconds > 0 {
+		widget["delay_seconds"] = config.DelaySeconds
+	}
+	if config.MediaType != "" {
+		widget["media_type"] = config.MediaType
+	}
+	settings["widget"] = widget
+
+	raw, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("failed to encode tenant settings: %w", err)
+	}
+	if err := tx.Model(&models.Tenant{}).Where("id = ?", tenantID).Update("settings", json.RawMessage(raw)).Error; err != nil {
+		return fmt.Errorf("failed to update tenant settings: %w", err)
+	}
+	return nil
+}
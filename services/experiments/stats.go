@@ -0,0 +1,183 @@
+package experiments
+
+import (
+	"math"
+)
+
+const (
+	RecommendContinue     = "continue"
+	RecommendStopWinner   = "stop_winner"
+	RecommendStopNoEffect = "stop_no_effect"
+)
+
+// Interval is a two-sided confidence interval
+type Interval struct {
+	Low  float64 `json:"low"`
+	High float64 `json:"high"`
+}
+
+// VariantStats are the results of one variant compared with the control
+type VariantStats struct {
+	VariantID      string   `json:"variant_id"`
+	Name           string   `json:"name"`
+	IsControl      bool     `json:"is_control"`
+	Exposures      int64    `json:"exposures"`
+	Conversions    int64    `json:"conversions"`
+	ConversionRate float64  `json:"conversion_rate"`
+	RateInterval   Interval `json:"rate_interval"`
+	Lift           float64  `json:"lift,omitempty"`          // relative change vs control
+	DiffInterval   Interval `json:"diff_interval,omitempty"` // absolute rate difference vs control
+	PValue         float64  `json:"p_value,omitempty"`
+	Significant    bool     `json:"significant"`
+}
+
+// Results summarise an experiment and recommend whether to stop it
+type Results struct {
+	Variants       []VariantStats `json:"variants"`
+	Alpha          float64        `json:"alpha"` // per-comparison significance after Bonferroni correction
+	Recommendation string         `json:"recommendation"`
+	BestVariantID  string         `json:"best_variant_id,omitempty"`
+}
+
+// zScore returns the two-sided critical value for a confidence level
+func zScore(confidence float64) float64 {
+	return normalQuantile(1 - (1-confidence)/2)
+}
+
+// wilson computes the Wilson score interval for a proportion
+func wilson(successes, trials int64, z float64) Interval {
+	if trials == 0 {
+		return Interval{}
+	}
+	n := float64(trials)
+	p := float64(successes) / n
+	denom := 1 + z*z/n
+	centre := (p + z*z/(2*n)) / denom
+	margin := z * math.Sqrt(p*(1-p)/n+z*z/(4*n*n)) / denom
+	return Interval{Low: math.Max(0, centre-margin), High: math.Min(1, centre+margin)}
+}
+
+// compare runs a two-proportion z-test of variant against control and returns
+// the two-sided p-value and the interval of the rate difference
+func compare(control, variant VariantStats, z float64) (float64, Interval) {
+	if control.Exposures == 0 || variant.Exposures == 0 {
+		return 1, Interval{}
+	}
+
+	n1, n2 := float64(control.Exposures), float64(variant.Exposures)
+	p1, p2 := control.ConversionRate, variant.ConversionRate
+	diff := p2 - p1
+
+	pooled := float64(control.Conversions+variant.Conversions) / (n1 + n2)
+	pooledSE := math.Sqrt(pooled * (1 - pooled) * (1/n1 + 1/n2))
+	pValue := 1.0
+	if pooledSE > 0 {
+		pValue = math.Erfc(math.Abs(diff/pooledSE) / math.Sqrt2)
+	}
+
+	se := math.Sqrt(p1*(1-p1)/n1 + p2*(1-p2)/n2)
+	return pValue, Interval{Low: diff - z*se, High: diff + z*se}
+}
+
+// Analyze fills in rates, intervals and significance for each variant and
+// applies the stopping rule: once every variant has reached minSample
+// exposures, stop with a winner if a variant beats control significantly,
+// or stop with no effect if none does.
+func Analyze(variants []VariantStats, confidence float64, minSample int) Results {
+	if confidence <= 0 || confidence >= 1 {
+		confidence = 0.95
+	}
+
+	comparisons := len(variants) - 1
+	if comparisons < 1 {
+		comparisons = 1
+	}
+	alpha := (1 - confidence) / float64(comparisons)
+	z := zScore(1 - alpha)
+
+	results := Results{Alpha: alpha, Recommendation: RecommendContinue}
+
+	controlIdx := -1
+	for i := range variants {
+		v := &variants[i]
+		if v.Exposures > 0 {
+			v.ConversionRate = float64(v.Conversions) / float64(v.Exposures)
+		}
+		v.RateInterval = wilson(v.Conversions, v.Exposures, z)
+		if v.IsControl && controlIdx < 0 {
+			controlIdx = i
+		}
+	}
+	if controlIdx < 0 && len(variants) > 0 {
+		controlIdx = 0
+		variants[0].IsControl = true
+	}
+
+	enoughData := len(variants) > 1
+	best := -1
+	for i := range variants {
+		v := &variants[i]
+		if v.Exposures < int64(minSample) {
+			enoughData = false
+		}
+		if i == controlIdx {
+			continue
+		}
+
+		control := variants[controlIdx]
+		v.PValue, v.DiffInterval = compare(control, *v, z)
+		if control.ConversionRate > 0 {
+			v.Lift = (v.ConversionRate - control.ConversionRate) / control.ConversionRate
+		}
+		v.Significant = v.PValue < alpha
+
+		if v.Significant && v.ConversionRate > control.ConversionRate &&
+			(best < 0 || v.ConversionRate > variants[best].ConversionRate) {
+			best = i
+		}
+	}
+
+	results.Variants = variants
+	if enoughData {
+		if best >= 0 {
+			results.Recommendation = RecommendStopWinner
+			results.BestVariantID = variants[best].VariantID
+		} else {
+			results.Recommendation = RecommendStopNoEffect
+		}
+	}
+
+	return results
+}
+
+// normalQuantile is the inverse standard normal CDF (Acklam's approximation)
+func normalQuantile(p float64) float64 {
+	if p <= 0 {
+		return math.Inf(-1)
+	}
+	if p >= 1 {
+		return math.Inf(1)
+	}
+
+	a := []float64{-3.969683028665376e+01, 2.209460984245205e+02, -2.759285104469687e+02, 1.383577518672690e+02, -3.066479806614716e+01, 2.506628277459239e+00}
+	b := []float64{-5.447609879822406e+01, 1.615858368580409e+02, -1.556989798598866e+02, 6.680131188771972e+01, -1.328068155288572e+01}
+	c := []float64{-7.784894002430293e-03, -3.223964580411365e-01, -2.400758277161838e+00, -2.549732539343734e+00, 4.374664141464968e+00, 2.938163982698783e+00}
+	d := []float64{7.784695709041462e-03, 3.224671290700398e-01, 2.445134137142996e+00, 3.754408661907416e+00}
+
+	const low = 0.02425
+	switch {
+	case p < low:
+		q := math.Sqrt(-2 * math.Log(p))
+		return (((((c[0]*q+c[1])*q+c[2])*q+c[3])*q+c[4])*q + c[5]) /
+			((((d[0]*q+d[1])*q+d[2])*q+d[3])*q + 1)
+	case p > 1-low:
+		q := math.Sqrt(-2 * math.Log(1-p))
+		return -(((((c[0]*q+c[1])*q+c[2])*q+c[3])*q+c[4])*q + c[5]) /
+			((((d[0]*q+d[1])*q+d[2])*q+d[3])*q + 1)
+	default:
+		q := p - 0.5
+		r := q * q
+		return (((((a[0]*r+a[1])*r+a[2])*r+a[3])*r+a[4])*r + a[5]) * q /
+			(((((b[0]*r+b[1])*r+b[2])*r+b[3])*r+b[4])*r + 1)
+	}
+}
@@ -0,0 +1,62 @@
+package exports
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// cursor is the position of the last exported row: its cursor column and ID
+type cursor struct {
+	At time.Time
+	ID uuid.UUID
+}
+
+func (c cursor) String() string {
+	if c.At.IsZero() {
+		return ""
+	}
+	raw := c.At.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+var ErrInvalidCursor = errors.New("since must be a cursor from an earlier export or an RFC 3339 time")
+
+// parseCursor reads the cursor of an earlier export. A plain RFC 3339 time is
+// accepted too and starts after every row up to that time.
+func parseCursor(s string) (cursor, error) {
+	if s == "" {
+		return cursor{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		// uuid.Max sorts after every ID, so rows at exactly t are skipped
+		return cursor{At: t.UTC(), ID: uuid.Max}, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	at, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return cursor{}, ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, at)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	return cursor{At: t.UTC(), ID: parsed}, nil
+}
+
+// ValidateSince checks a since cursor without using it
+func ValidateSince(s string) error {
+	_, err := parseCursor(s)
+	return err
+}
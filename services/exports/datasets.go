@@ -0,0 +1,284 @@
+package exports
+
+import (
+	"errors"
+	"fmt"
+	"nyasah-backend/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Datasets that can be exported
+const (
+	DatasetReviews  = "reviews"
+	DatasetProofs   = "proofs"
+	DatasetEvents   = "events"
+	DatasetInsights = "insights"
+)
+
+var (
+	ErrInvalidDataset = errors.New("dataset must be reviews, proofs, events or insights")
+	ErrInvalidFilter  = errors.New("filter does not apply to this dataset")
+)
+
+// ReviewRecord is one exported review, including its stored AI analysis
+type ReviewRecord struct {
+	ID         string     `json:"id" parquet:"id"`
+	EntityID   string     `json:"entity_id" parquet:"entity_id"`
+	UserID     string     `json:"user_id" parquet:"user_id"`
+	Rating     int64      `json:"rating" parquet:"rating"`
+	Content    string     `json:"content" parquet:"content"`
+	Verified   bool       `json:"verified" parquet:"verified"`
+	Status     string     `json:"status" parquet:"status"`
+	Sentiment  float64    `json:"sentiment" parquet:"sentiment"`
+	Keywords   []string   `json:"keywords" parquet:"keywords,list"`
+	EnrichedAt *time.Time `json:"enriched_at" parquet:"enriched_at,optional"`
+	CreatedAt  time.Time  `json:"created_at" parquet:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" parquet:"updated_at"`
+}
+
+type ProofRecord struct {
+	ID         string     `json:"id" parquet:"id"`
+	Type       string     `json:"type" parquet:"type"`
+	EntityID   string     `json:"entity_id" parquet:"entity_id"`
+	UserID     string     `json:"user_id" parquet:"user_id"`
+	Content    string     `json:"content" parquet:"content"`
+	MediaType  string     `json:"media_type" parquet:"media_type"`
+	ArchivedAt *time.Time `json:"archived_at" parquet:"archived_at,optional"`
+	CreatedAt  time.Time  `json:"created_at" parquet:"created_at"`
+}
+
+// EventRecord is one storefront engagement event. ProofID, EntityID and
+// UserID are empty when the event did not carry them.
+type EventRecord struct {
+	ID         string    `json:"id" parquet:"id"`
+	EventID    string    `json:"event_id" parquet:"event_id"`
+	Type       string    `json:"type" parquet:"type"`
+	ProofID    string    `json:"proof_id" parquet:"proof_id"`
+	EntityID   string    `json:"entity_id" parquet:"entity_id"`
+	VisitorID  string    `json:"visitor_id" parquet:"visitor_id"`
+	UserID     string    `json:"user_id" parquet:"user_id"`
+	Value      float64   `json:"value" parquet:"value"`
+	OccurredAt time.Time `json:"occurred_at" parquet:"occurred_at"`
+	CreatedAt  time.Time `json:"created_at" parquet:"created_at"`
+}
+
+// InsightRecord is one stored AI recommendation
+type InsightRecord struct {
+	ID         string    `json:"id" parquet:"id"`
+	Type       string    `json:"type" parquet:"type"`
+	Suggestion string    `json:"suggestion" parquet:"suggestion"`
+	Confidence float64   `json:"confidence" parquet:"confidence"`
+	CreatedAt  time.Time `json:"created_at" parquet:"created_at"`
+}
+
+// row is an exported record with the position it leaves the cursor at
+type row struct {
+	record interface{}
+	at     time.Time
+	id     uuid.UUID
+}
+
+type dataset struct {
+	table      string
+	cursor     string      // column incremental exports follow; rows changed later sort later
+	timeColumn string      // column the from and to filters apply to
+	filters    []string    // filters besides from and to that apply
+	record     interface{} // an empty record, describing the columns
+	fetch      func(q *gorm.DB) ([]row, error)
+}
+
+var datasets = map[string]dataset{
+	DatasetReviews: {
+		table:      "reviews",
+		cursor:     "updated_at",
+		timeColumn: "created_at",
+		filters:    []string{"entity_id", "status", "min_rating"},
+		record:     ReviewRecord{},
+		fetch: func(q *gorm.DB) ([]row, error) {
+			var list []models.Review
+			if err := q.Find(&list).Error; err != nil {
+				return nil, err
+			}
+			rows := make([]row, len(list))
+			for i, r := range list {
+				keywords := r.Keywords
+				if keywords == nil {
+					keywords = []string{}
+				}
+				rows[i] = row{at: r.UpdatedAt, id: r.ID, record: ReviewRecord{
+					ID:         r.ID.String(),
+					EntityID:   r.EntityID.String(),
+					UserID:     r.UserID.String(),
+					Rating:     int64(r.Rating),
+					Content:    r.Content,
+					Verified:   r.Verified,
+					Status:     r.Status,
+					Sentiment:  r.Sentiment,
+					Keywords:   keywords,
+					EnrichedAt: utc(r.EnrichedAt),
+					CreatedAt:  r.CreatedAt.UTC(),
+					UpdatedAt:  r.UpdatedAt.UTC(),
+				}}
+			}
+			return rows, nil
+		},
+	},
+	DatasetProofs: {
+		table:      "social_proofs",
+		cursor:     "created_at",
+		timeColumn: "created_at",
+		filters:    []string{"entity_id", "type"},
+		record:     ProofRecord{},
+		fetch: func(q *gorm.DB) ([]row, error) {
+			var list []models.SocialProof
+			if err := q.Find(&list).Error; err != nil {
+				return nil, err
+			}
+			rows := make([]row, len(list))
+			for i, p := range list {
+				rows[i] = row{at: p.CreatedAt, id: p.ID, record: ProofRecord{
+					ID:         p.ID.String(),
+					Type:       p.Type,
+					EntityID:   p.EntityID.String(),
+					UserID:     p.UserID.String(),
+					Content:    p.Content,
+					MediaType:  p.MediaType,
+					ArchivedAt: utc(p.ArchivedAt),
+					CreatedAt:  p.CreatedAt.UTC(),
+				}}
+			}
+			return rows, nil
+		},
+	},
+	DatasetEvents: {
+		table: "proof_events",
+		// Events can arrive long after they occurred, so incremental exports
+		// follow when they were received
+		cursor:     "created_at",
+		timeColumn: "occurred_at",
+		filters:    []string{"entity_id", "type"},
+		record:     EventRecord{},
+		fetch: func(q *gorm.DB) ([]row, error) {
+			var list []models.ProofEvent
+			if err := q.Find(&list).Error; err != nil {
+				return nil, err
+			}
+			rows := make([]row, len(list))
+			for i, e := range list {
+				record := EventRecord{
+					ID:         e.ID.String(),
+					EventID:    e.EventID,
+					Type:       e.Type,
+					VisitorID:  e.VisitorID,
+					Value:      e.Value,
+					OccurredAt: e.OccurredAt.UTC(),
+					CreatedAt:  e.CreatedAt.UTC(),
+				}
+				if e.ProofID != nil {
+					record.ProofID = e.ProofID.String()
+				}
+				if e.EntityID != nil {
+					record.EntityID = e.EntityID.String()
+				}
+				if e.UserID != nil {
+					record.UserID = e.UserID.String()
+				}
+				rows[i] = row{at: e.CreatedAt, id: e.ID, record: record}
+			}
+			return rows, nil
+		},
+	},
+	DatasetInsights: {
+		table:      "ai_recommendations",
+		cursor:     "created_at",
+		timeColumn: "created_at",
+		filters:    []string{"type"},
+		record:     InsightRecord{},
+		fetch: func(q *gorm.DB) ([]row, error) {
+			var list []models.AIRecommendation
+			if err := q.Find(&list).Error; err != nil {
+				return nil, err
+			}
+			rows := make([]row, len(list))
+			for i, r := range list {
+				rows[i] = row{at: r.CreatedAt, id: r.ID, record: InsightRecord{
+					ID:         r.ID.String(),
+					Type:       r.Type,
+					Suggestion: r.Suggestion,
+					Confidence: r.Confidence,
+					CreatedAt:  r.CreatedAt.UTC(),
+				}}
+			}
+			return rows, nil
+		},
+	},
+}
+
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// validateFilters checks that every filter given applies to the dataset
+func (d dataset) validateFilters(f models.ExportFilters) error {
+	given := []struct {
+		name string
+		set  bool
+	}{
+		{"entity_id", f.EntityID != nil},
+		{"type", f.Type != ""},
+		{"status", f.Status != ""},
+		{"min_rating", f.MinRating != 0},
+	}
+	for _, filter := range given {
+		if filter.set && !contains(d.filters, filter.name) {
+			return fmt.Errorf("%w: %s", ErrInvalidFilter, filter.name)
+		}
+	}
+	if f.From != nil && f.To != nil && !f.From.Before(*f.To) {
+		return errors.New("from must be before to")
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// query returns the tenant's rows matching the filters, after the cursor
+func (d dataset) query(db *gorm.DB, tenantID uuid.UUID, f models.ExportFilters, after cursor) *gorm.DB {
+	q := db.Table(d.table).Where("tenant_id = ?", tenantID)
+	if f.From != nil {
+		q = q.Where(d.timeColumn+" >= ?", f.From.UTC())
+	}
+	if f.To != nil {
+		q = q.Where(d.timeColumn+" < ?", f.To.UTC())
+	}
+	if f.EntityID != nil {
+		q = q.Where("entity_id = ?", *f.EntityID)
+	}
+	if f.Type != "" {
+		q = q.Where("type = ?", f.Type)
+	}
+	if f.Status != "" {
+		q = q.Where("status = ?", f.Status)
+	}
+	if f.MinRating != 0 {
+		q = q.Where("rating >= ?", f.MinRating)
+	}
+	if !after.At.IsZero() {
+		q = q.Where("("+d.cursor+" > ? OR ("+d.cursor+" = ? AND id > ?))", after.At, after.At, after.ID)
+	}
+	return q.Order(d.cursor).Order("id")
+}
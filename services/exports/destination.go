@@ -0,0 +1,191 @@
+package exports
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Destinations scheduled exports can be delivered to
+const (
+	DestinationLocal = "local"
+	DestinationS3    = "s3"
+)
+
+var ErrInvalidDestination = errors.New("destination type must be local or s3")
+
+// Destination receives the files of scheduled exports
+type Destination interface {
+	Put(ctx context.Context, name string, body io.ReadSeeker, size int64, contentType string) error
+}
+
+// LocalDestination writes files into a directory, e.g. one a warehouse
+// loader watches
+type LocalDestination struct {
+	Dir string
+}
+
+func (d LocalDestination) Put(ctx context.Context, name string, body io.ReadSeeker, size int64, contentType string) error {
+	target := filepath.Join(d.Dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+
+	// Write under a temporary name so readers never see a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".export-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// S3Destination uploads files to an S3-compatible bucket, addressing it by
+// path so it works with MinIO, R2 and other compatible stores as well as AWS
+type S3Destination struct {
+	Endpoint        string // e.g. https://minio.example.com; AWS when empty
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Client          *http.Client
+}
+
+func (d S3Destination) endpoint() string {
+	if d.Endpoint != "" {
+		return strings.TrimSuffix(d.Endpoint, "/")
+	}
+	return "https://s3." + d.Region + ".amazonaws.com"
+}
+
+// Put uploads the file with a single PutObject request signed with AWS
+// Signature Version 4
+func (d S3Destination) Put(ctx context.Context, name string, body io.ReadSeeker, size int64, contentType string) error {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, body); err != nil {
+		return err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	payloadHash := hex.EncodeToString(hash.Sum(nil))
+
+	u, err := url.Parse(d.endpoint())
+	if err != nil {
+		return fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+	objectPath := "/" + escapePath(d.Bucket) + "/" + escapePath(name)
+	u.RawPath = strings.TrimSuffix(u.Path, "/") + objectPath
+	u.Path, _ = url.PathUnescape(u.RawPath)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), io.NopCloser(body))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	d.sign(req, u.EscapedPath(), payloadHash, time.Now().UTC())
+
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("S3 upload failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("S3 upload returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// sign adds the Signature Version 4 headers for a request without a query
+func (d S3Destination) sign(req *http.Request, escapedPath, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	signed := []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+	var headers strings.Builder
+	for _, name := range signed {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(signed, ";")
+
+	canonical := strings.Join([]string{req.Method, escapedPath, "", headers.String(), signedHeaders, payloadHash}, "\n")
+	scope := date + "/" + d.Region + "/s3/aws4_request"
+	digest := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(digest[:])
+
+	key := hmacSHA256([]byte("AWS4"+d.SecretAccessKey), date)
+	key = hmacSHA256(key, d.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		d.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// escapePath percent-encodes everything but unreserved characters and
+// slashes, as Signature Version 4 expects
+func escapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// cleanPrefix turns a destination path into a relative slash-separated
+// prefix, rejecting anything that would leave the destination's root
+func cleanPrefix(p string) (string, error) {
+	if p == "" {
+		return "", nil
+	}
+	cleaned := path.Clean("/" + strings.ReplaceAll(p, "\\", "/"))
+	if cleaned != "/"+strings.Trim(strings.ReplaceAll(p, "\\", "/"), "/") {
+		return "", errors.New("destination path must be a relative path without . or .. segments")
+	}
+	return strings.TrimPrefix(cleaned, "/"), nil
+}
@@ -0,0 +1,124 @@
+package exports
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Formats an export can be written in
+const (
+	FormatCSV     = "csv"
+	FormatNDJSON  = "ndjson"
+	FormatParquet = "parquet"
+)
+
+var ErrInvalidFormat = errors.New("format must be csv, ndjson or parquet")
+
+// ContentType returns the media type of a format
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatParquet:
+		return "application/vnd.apache.parquet"
+	}
+	return "application/octet-stream"
+}
+
+// encoder writes records of one type to a file
+type encoder interface {
+	Write(record interface{}) error
+	Close() error
+}
+
+func newEncoder(format string, w io.Writer, record interface{}) (encoder, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVEncoder(w, record)
+	case FormatNDJSON:
+		return &ndjsonEncoder{enc: json.NewEncoder(w)}, nil
+	case FormatParquet:
+		return parquet.NewWriter(w, parquet.SchemaOf(record)), nil
+	}
+	return nil, ErrInvalidFormat
+}
+
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonEncoder) Write(record interface{}) error {
+	return e.enc.Encode(record)
+}
+
+func (e *ndjsonEncoder) Close() error {
+	return nil
+}
+
+// csvEncoder writes a header of the records' JSON field names, then one line
+// per record. Times are RFC 3339 in UTC and lists are JSON arrays.
+type csvEncoder struct {
+	w      *csv.Writer
+	fields int
+}
+
+func newCSVEncoder(w io.Writer, record interface{}) (*csvEncoder, error) {
+	t := reflect.TypeOf(record)
+	header := make([]string, t.NumField())
+	for i := range header {
+		header[i] = strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+	}
+
+	e := &csvEncoder{w: csv.NewWriter(w), fields: len(header)}
+	if err := e.w.Write(header); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *csvEncoder) Write(record interface{}) error {
+	v := reflect.ValueOf(record)
+	line := make([]string, e.fields)
+	for i := range line {
+		line[i] = csvValue(v.Field(i).Interface())
+	}
+	return e.w.Write(line)
+}
+
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		return v.UTC().Format(time.RFC3339Nano)
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
+
+func (e *csvEncoder) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
@@ -0,0 +1,546 @@
+package exports
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"nyasah-backend/models"
+	"nyasah-backend/services/jobs"
+	"nyasah-backend/services/reports"
+	"nyasah-backend/services/safehttp"
+	"nyasah-backend/services/timeframe"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TypeRun writes one export's file and, for scheduled exports, delivers it
+const TypeRun = "export.run"
+
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusExpired   = "expired"
+)
+
+const batchSize = 1000
+
+var (
+	ErrLinkExpired       = errors.New("download link expired")
+	ErrInvalidSignature  = errors.New("invalid download signature")
+	ErrDownloadsDisabled = errors.New("export downloads are disabled")
+)
+
+type Options struct {
+	Dir            string        // where export files are kept for download
+	DestinationDir string        // local destinations write beneath this directory
+	SigningKey     []byte        // signs download URLs; downloads are disabled without one
+	URLTTL         time.Duration // how long a download URL stays valid
+	Retention      time.Duration // how long export files are kept
+}
+
+type RunPayload struct {
+	ExportID uuid.UUID `json:"export_id"`
+}
+
+// Service writes exports in the background, serves them through signed URLs
+// and runs export schedules
+type Service struct {
+	db     *gorm.DB
+	jobs   *jobs.Queue
+	opts   Options
+	client *http.Client
+}
+
+// NewService creates the export service. Exports are only written once
+// RegisterJobs has been called.
+func NewService(db *gorm.DB, opts Options) *Service {
+	if opts.Dir == "" {
+		opts.Dir = "exports"
+	}
+	if opts.DestinationDir == "" {
+		opts.DestinationDir = filepath.Join(opts.Dir, "destinations")
+	}
+	if opts.URLTTL <= 0 {
+		opts.URLTTL = 15 * time.Minute
+	}
+	if opts.Retention <= 0 {
+		opts.Retention = 7 * 24 * time.Hour
+	}
+	// S3 endpoints are tenant supplied, so uploads only reach public addresses
+	return &Service{db: db, opts: opts, client: safehttp.NewClient(5 * time.Minute)}
+}
+
+// RegisterJobs registers export writing with the queue
+func (s *Service) RegisterJobs(q *jobs.Queue) {
+	s.jobs = q
+	q.Register(TypeRun, s.runJob)
+}
+
+// Validate checks an export's dataset, format, filters and since cursor
+func Validate(dataset, format string, filters models.ExportFilters, since string) error {
+	d, ok := datasets[dataset]
+	if !ok {
+		return ErrInvalidDataset
+	}
+	if format != FormatCSV && format != FormatNDJSON && format != FormatParquet {
+		return ErrInvalidFormat
+	}
+	if err := d.validateFilters(filters); err != nil {
+		return err
+	}
+	return ValidateSince(since)
+}
+
+// Create validates the export, stores it and queues it to be written
+func (s *Service) Create(export *models.Export) error {
+	if err := Validate(export.Dataset, export.Format, export.Filters, export.Since); err != nil {
+		return err
+	}
+	if s.jobs == nil {
+		return errors.New("export jobs are not registered")
+	}
+
+	export.Status = StatusQueued
+	if err := s.db.Create(export).Error; err != nil {
+		return fmt.Errorf("failed to create export: %w", err)
+	}
+
+	job, err := s.jobs.Enqueue(export.TenantID, TypeRun, export.ID.String(), RunPayload{ExportID: export.ID})
+	if err != nil {
+		s.db.Model(export).Updates(map[string]interface{}{"status": StatusFailed, "error": err.Error()})
+		return err
+	}
+	export.JobID = &job.ID
+	return s.db.Model(export).Update("job_id", job.ID).Error
+}
+
+// File returns where a completed export is stored
+func (s *Service) File(export models.Export) string {
+	return filepath.Join(s.opts.Dir, filepath.FromSlash(export.Path))
+}
+
+// Filename names a downloaded or delivered export file
+func Filename(export models.Export) string {
+	at := export.CreatedAt
+	if export.CompletedAt != nil {
+		at = *export.CompletedAt
+	}
+	return export.Dataset + "-" + at.UTC().Format("20060102T150405Z") + "." + export.Format
+}
+
+func (s *Service) signature(id uuid.UUID, expires int64) string {
+	mac := hmac.New(sha256.New, s.opts.SigningKey)
+	fmt.Fprintf(mac, "%s:%d", id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Signed reports whether download URLs can be signed
+func (s *Service) Signed() bool {
+	return len(s.opts.SigningKey) > 0
+}
+
+// DownloadURL returns a path and query that download the export without
+// credentials until the URL expires
+func (s *Service) DownloadURL(id uuid.UUID, now time.Time) (string, time.Time) {
+	expires := now.Add(s.opts.URLTTL).Truncate(time.Second)
+	query := url.Values{
+		"expires":   {strconv.FormatInt(expires.Unix(), 10)},
+		"signature": {s.signature(id, expires.Unix())},
+	}
+	return "/api/exports/" + id.String() + "/download?" + query.Encode(), expires
+}
+
+// Verify checks the expiry and signature of a download URL
+func (s *Service) Verify(id uuid.UUID, expires, signature string, now time.Time) error {
+	if !s.Signed() {
+		return ErrDownloadsDisabled
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.signature(id, unix))) {
+		return ErrInvalidSignature
+	}
+	if now.Unix() > unix {
+		return ErrLinkExpired
+	}
+	return nil
+}
+
+func (s *Service) runJob(ctx context.Context, job models.Job) error {
+	var payload RunPayload
+	if err := jobs.Decode(job, &payload); err != nil {
+		return err
+	}
+
+	var export models.Export
+	if err := s.db.First(&export, "id = ?", payload.ExportID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+
+	var err error
+	switch export.Status {
+	case StatusExpired, StatusFailed:
+		return nil
+	case StatusCompleted:
+	default:
+		err = s.write(ctx, &export)
+	}
+	if err == nil && export.ScheduleID != nil && export.DeliveredAt == nil {
+		err = s.deliver(ctx, &export)
+	}
+	if err == nil {
+		return nil
+	}
+
+	// Record the error, and fail the export once the job will not retry
+	updates := map[string]interface{}{"error": err.Error()}
+	if jobs.IsPermanent(err) || job.Attempts >= job.MaxAttempts {
+		updates["status"] = StatusFailed
+	}
+	if dbErr := s.db.Model(&export).Updates(updates).Error; dbErr != nil {
+		log.Printf("Failed to record error of export %s: %v", export.ID, dbErr)
+	}
+	return err
+}
+
+// write streams the export's rows to its file in batches
+func (s *Service) write(ctx context.Context, export *models.Export) error {
+	d, ok := datasets[export.Dataset]
+	if !ok {
+		return jobs.Permanent(ErrInvalidDataset)
+	}
+	after, err := parseCursor(export.Since)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	if err := s.db.Model(export).Update("status", StatusRunning).Error; err != nil {
+		return err
+	}
+
+	rel := path.Join(export.TenantID.String(), export.ID.String()+"."+export.Format)
+	target := filepath.Join(s.opts.Dir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+	file, err := os.CreateTemp(filepath.Dir(target), ".export-*")
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	enc, err := newEncoder(export.Format, file, d.record)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+
+	var count int64
+	last := after
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rows, err := d.fetch(d.query(s.db, export.TenantID, export.Filters, last).Limit(batchSize))
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %w", export.Dataset, err)
+		}
+		for _, r := range rows {
+			if err := enc.Write(r.record); err != nil {
+				return fmt.Errorf("failed to write export: %w", err)
+			}
+		}
+		count += int64(len(rows))
+		if len(rows) > 0 {
+			tail := rows[len(rows)-1]
+			last = cursor{At: tail.at.UTC(), ID: tail.id}
+		}
+		if len(rows) < batchSize {
+			break
+		}
+	}
+
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(file.Name(), target); err != nil {
+		return fmt.Errorf("failed to store export file: %w", err)
+	}
+
+	next := export.Since
+	if count > 0 {
+		next = last.String()
+	}
+	now := time.Now().UTC()
+	expires := now.Add(s.opts.Retention)
+	export.Status = StatusCompleted
+	export.Rows = count
+	export.Size = info.Size()
+	export.Path = rel
+	export.NextCursor = next
+	export.Error = ""
+	export.CompletedAt = &now
+	export.ExpiresAt = &expires
+	return s.db.Model(export).Updates(map[string]interface{}{
+		"status":       export.Status,
+		"rows":         export.Rows,
+		"size":         export.Size,
+		"path":         export.Path,
+		"next_cursor":  export.NextCursor,
+		"error":        "",
+		"completed_at": now,
+		"expires_at":   expires,
+	}).Error
+}
+
+// Destination returns where a schedule delivers its exports
+func (s *Service) Destination(schedule models.ExportSchedule) (Destination, string, error) {
+	prefix, err := cleanPrefix(schedule.Destination.Path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch schedule.Destination.Type {
+	case DestinationLocal:
+		return LocalDestination{Dir: filepath.Join(s.opts.DestinationDir, schedule.TenantID.String())}, prefix, nil
+	case DestinationS3:
+		return S3Destination{
+			Endpoint:        schedule.Destination.Endpoint,
+			Region:          schedule.Destination.Region,
+			Bucket:          schedule.Destination.Bucket,
+			AccessKeyID:     schedule.Destination.AccessKeyID,
+			SecretAccessKey: schedule.DestinationSecret,
+			Client:          s.client,
+		}, prefix, nil
+	}
+	return nil, "", ErrInvalidDestination
+}
+
+// deliver copies a scheduled export to the schedule's destination and moves
+// the schedule's cursor past it
+func (s *Service) deliver(ctx context.Context, export *models.Export) error {
+	var schedule models.ExportSchedule
+	if err := s.db.First(&schedule, "id = ?", *export.ScheduleID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil // deleted since; the export can still be downloaded
+		}
+		return err
+	}
+
+	dest, prefix, err := s.Destination(schedule)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	file, err := os.Open(s.File(*export))
+	if err != nil {
+		return fmt.Errorf("failed to open export file: %w", err)
+	}
+	defer file.Close()
+
+	if err := dest.Put(ctx, path.Join(prefix, Filename(*export)), file, export.Size, ContentType(export.Format)); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	export.DeliveredAt = &now
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(export).Updates(map[string]interface{}{"delivered_at": now, "error": ""}).Error; err != nil {
+			return err
+		}
+		// Only move the cursor on if nobody changed it while this export ran
+		return tx.Model(&models.ExportSchedule{}).
+			Where("id = ? AND cursor = ?", schedule.ID, export.Since).
+			Update("cursor", export.NextCursor).Error
+	})
+}
+
+// ValidateSchedule checks a schedule's export settings, cron expression and
+// destination
+func ValidateSchedule(schedule *models.ExportSchedule) error {
+	if err := Validate(schedule.Dataset, schedule.Format, schedule.Filters, schedule.Cursor); err != nil {
+		return err
+	}
+	if _, err := reports.ParseSchedule(schedule.Schedule); err != nil {
+		return err
+	}
+	if _, err := cleanPrefix(schedule.Destination.Path); err != nil {
+		return err
+	}
+
+	dest := &schedule.Destination
+	switch dest.Type {
+	case DestinationLocal:
+		dest.Endpoint, dest.Region, dest.Bucket, dest.AccessKeyID = "", "", "", ""
+		schedule.DestinationSecret = ""
+	case DestinationS3:
+		if dest.Bucket == "" || dest.AccessKeyID == "" || schedule.DestinationSecret == "" {
+			return errors.New("s3 destinations need a bucket, access_key_id and secret_access_key")
+		}
+		if dest.Region == "" {
+			dest.Region = "us-east-1"
+		}
+		if dest.Endpoint != "" {
+			u, err := url.Parse(dest.Endpoint)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return errors.New("endpoint must be an http or https URL")
+			}
+			if err := safehttp.CheckURL(context.Background(), dest.Endpoint); err != nil {
+				return errors.New("endpoint must point to a public address")
+			}
+		}
+	default:
+		return ErrInvalidDestination
+	}
+	return nil
+}
+
+// Reschedule sets when an enabled schedule next runs after now
+func (s *Service) Reschedule(schedule *models.ExportSchedule, now time.Time) error {
+	if !schedule.Enabled {
+		schedule.NextRunAt = nil
+		return nil
+	}
+
+	cron, err := reports.ParseSchedule(schedule.Schedule)
+	if err != nil {
+		return err
+	}
+	var tenant models.Tenant
+	if err := s.db.Select("id", "settings").First(&tenant, "id = ?", schedule.TenantID).Error; err != nil {
+		return fmt.Errorf("failed to load tenant: %w", err)
+	}
+	next := cron.Next(now, timeframe.TenantLocation(tenant.Settings))
+	if next.IsZero() {
+		return reports.ErrNeverRuns
+	}
+	next = next.UTC()
+	schedule.NextRunAt = &next
+	return nil
+}
+
+// Dispatch starts an export for every schedule that is due. A schedule whose
+// previous export has not finished skips a run, so two exports never start
+// from the same cursor.
+func (s *Service) Dispatch(now time.Time) (int, error) {
+	var due []models.ExportSchedule
+	if err := s.db.Where("enabled = ? AND next_run_at <= ?", true, now.UTC()).Find(&due).Error; err != nil {
+		return 0, fmt.Errorf("failed to load due export schedules: %w", err)
+	}
+
+	started := 0
+	for _, schedule := range due {
+		var pending int64
+		if err := s.db.Model(&models.Export{}).
+			Where("schedule_id = ? AND (status IN ? OR (status = ? AND delivered_at IS NULL))",
+				schedule.ID, []string{StatusQueued, StatusRunning}, StatusCompleted).
+			Count(&pending).Error; err != nil {
+			return started, fmt.Errorf("failed to check export schedule %s: %w", schedule.ID, err)
+		}
+
+		if pending > 0 {
+			log.Printf("Skipping export schedule %s: its previous export has not been delivered", schedule.ID)
+		} else {
+			export := models.Export{
+				TenantID:   schedule.TenantID,
+				ScheduleID: &schedule.ID,
+				Dataset:    schedule.Dataset,
+				Format:     schedule.Format,
+				Filters:    schedule.Filters,
+				Since:      schedule.Cursor,
+			}
+			if err := s.Create(&export); err != nil {
+				log.Printf("Failed to start export for schedule %s: %v", schedule.ID, err)
+				continue
+			}
+			started++
+		}
+
+		lastRun := now.UTC()
+		schedule.LastRunAt = &lastRun
+		if err := s.Reschedule(&schedule, now); err != nil {
+			log.Printf("Failed to schedule exports for %s: %v", schedule.ID, err)
+			schedule.NextRunAt = nil
+		}
+		if err := s.db.Model(&schedule).Updates(map[string]interface{}{
+			"last_run_at": schedule.LastRunAt,
+			"next_run_at": schedule.NextRunAt,
+		}).Error; err != nil {
+			return started, fmt.Errorf("failed to schedule exports for %s: %w", schedule.ID, err)
+		}
+	}
+	return started, nil
+}
+
+// Cleanup deletes the files of exports past their expiry
+func (s *Service) Cleanup(now time.Time) (int, error) {
+	var expired []models.Export
+	if err := s.db.Where("path <> '' AND expires_at <= ?", now.UTC()).Find(&expired).Error; err != nil {
+		return 0, fmt.Errorf("failed to load expired exports: %w", err)
+	}
+
+	for i, export := range expired {
+		if err := os.Remove(s.File(export)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return i, fmt.Errorf("failed to delete export %s: %w", export.ID, err)
+		}
+		updates := map[string]interface{}{"path": ""}
+		if export.Status == StatusCompleted {
+			updates["status"] = StatusExpired
+		}
+		if err := s.db.Model(&export).Updates(updates).Error; err != nil {
+			return i, fmt.Errorf("failed to expire export %s: %w", export.ID, err)
+		}
+	}
+	return len(expired), nil
+}
+
+// Run starts scheduled exports and deletes expired files every interval
+// until ctx is cancelled
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		if n, err := s.Dispatch(now); err != nil {
+			log.Printf("Failed to dispatch scheduled exports: %v", err)
+		} else if n > 0 {
+			log.Printf("Started %d scheduled exports", n)
+		}
+		if n, err := s.Cleanup(now); err != nil {
+			log.Printf("Failed to clean up exports: %v", err)
+		} else if n > 0 {
+			log.Printf("Deleted %d expired exports", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
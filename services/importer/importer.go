@@ -0,0 +1,348 @@
+package importer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"nyasah-backend/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const batchSize = 100
+
+type Importer struct {
+	db *gorm.DB
+}
+
+func NewImporter(db *gorm.DB) *Importer {
+	return &Importer{db: db}
+}
+
+// Options controls a single import run
+type Options struct {
+	TenantID        uuid.UUID
+	Format          string
+	Mapping         FieldMapping
+	DefaultEntityID uuid.UUID // used when the mapping has no entity column
+	Source          string    // name of the platform the data came from
+}
+
+// RowError reports a source row that could not be imported
+type RowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// Result summarises an import run
+type Result struct {
+	Total      int         `json:"total"`
+	Imported   int         `json:"imported"`
+	Duplicates int         `json:"duplicates"`
+	Failed     int         `json:"failed"`
+	Errors     []RowError  `json:"errors,omitempty"`
+	ReviewIDs  []uuid.UUID `json:"-"`
+}
+
+// Import reads all records from r, maps them to reviews and stores the ones
+// that are not already present for the tenant.
+func (i *Importer) Import(r io.Reader, opts Options) (*Result, error) {
+	records, err := readRecords(r, opts.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Total: len(records)}
+	resolver := newResolver(i.db, opts.TenantID)
+	seen := make(map[string]bool)
+	var batch []models.Review
+
+	for idx, record := range records {
+		row := idx + 1
+
+		review, err := i.buildReview(record, opts, resolver)
+		if err != nil {
+			result.Failed++
+			result.Errors = append(result.Errors, RowError{Row: row, Error: err.Error()})
+			continue
+		}
+
+		if seen[review.ContentHash] {
+			result.Duplicates++
+			continue
+		}
+		seen[review.ContentHash] = true
+
+		batch = append(batch, review)
+		if len(batch) >= batchSize {
+			if err := i.flush(opts.TenantID, batch, result); err != nil {
+				return nil, err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if err := i.flush(opts.TenantID, batch, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// flush stores the reviews of a batch that the tenant does not have yet,
+// checking the whole batch for duplicates with one query
+func (i *Importer) flush(tenantID uuid.UUID, batch []models.Review, result *Result) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	hashes := make([]string, len(batch))
+	for idx, review := range batch {
+		hashes[idx] = review.ContentHash
+	}
+	var existing []string
+	if err := i.db.Model(&models.Review{}).
+		Where("tenant_id = ? AND content_hash IN ?", tenantID, hashes).
+		Pluck("content_hash", &existing).Error; err != nil {
+		return fmt.Errorf("failed to check duplicates: %w", err)
+	}
+	stored := make(map[string]bool, len(existing))
+	for _, hash := range existing {
+		stored[hash] = true
+	}
+
+	var fresh []models.Review
+	for _, review := range batch {
+		if stored[review.ContentHash] {
+			result.Duplicates++
+			continue
+		}
+		fresh = append(fresh, review)
+	}
+	if len(fresh) == 0 {
+		return nil
+	}
+
+	if err := i.db.Create(&fresh).Error; err != nil {
+		return fmt.Errorf("failed to store reviews: %w", err)
+	}
+
+	for _, review := range fresh {
+		result.ReviewIDs = append(result.ReviewIDs, review.ID)
+	}
+	result.Imported += len(fresh)
+
+	return nil
+}
+
+func (i *Importer) buildReview(record Record, opts Options, resolver *resolver) (models.Review, error) {
+	m := opts.Mapping
+
+	content := strings.TrimSpace(record[m.Content])
+	if content == "" {
+		return models.Review{}, fmt.Errorf("missing review content")
+	}
+
+	review := models.Review{
+		TenantID: opts.TenantID,
+		Content:  content,
+		Metadata: models.JSON{"imported": true},
+	}
+	if opts.Source != "" {
+		review.Metadata["source"] = opts.Source
+	}
+
+	if m.Rating != "" && record[m.Rating] != "" {
+		rating, err := parseRating(record[m.Rating], m.RatingScale)
+		if err != nil {
+			return models.Review{}, err
+		}
+		review.Rating = rating
+	}
+
+	entityID := opts.DefaultEntityID
+	if m.Entity != "" && record[m.Entity] != "" {
+		id, err := resolver.entity(record[m.Entity])
+		if err != nil {
+			return models.Review{}, err
+		}
+		entityID = id
+	}
+	if entityID == uuid.Nil {
+		return models.Review{}, fmt.Errorf("no entity for review")
+	}
+	review.EntityID = entityID
+
+	author := strings.TrimSpace(record[m.AuthorName])
+	email := strings.ToLower(strings.TrimSpace(record[m.AuthorEmail]))
+	if email != "" {
+		userID, err := resolver.user(email)
+		if err != nil {
+			return models.Review{}, err
+		}
+		review.UserID = userID
+	}
+	if review.UserID == uuid.Nil {
+		// Reviewer has no account with the tenant, keep them as an anonymous author
+		review.Metadata["anonymous"] = true
+	}
+	if author != "" {
+		review.Metadata["author_name"] = author
+	}
+
+	if m.CreatedAt != "" && record[m.CreatedAt] != "" {
+		createdAt, err := parseTime(record[m.CreatedAt], m.TimeLayout)
+		if err != nil {
+			return models.Review{}, err
+		}
+		review.CreatedAt = createdAt
+		review.UpdatedAt = createdAt
+	}
+
+	if m.Verified != "" {
+		review.Verified = parseBool(record[m.Verified])
+	}
+	if m.Title != "" && record[m.Title] != "" {
+		review.Metadata["title"] = record[m.Title]
+	}
+	if m.ExternalID != "" && record[m.ExternalID] != "" {
+		review.Metadata["external_id"] = record[m.ExternalID]
+	}
+
+	review.ContentHash = ContentHash(entityID, AuthorKey(author, email), content)
+
+	return review, nil
+}
+
+// AuthorKey picks the author identity reviews are fingerprinted by: the
+// email when there is one, so imports and reviews created through the API
+// agree, otherwise the display name
+func AuthorKey(name, email string) string {
+	if email != "" {
+		return email
+	}
+	return name
+}
+
+// ContentHash fingerprints a review by entity, author key and normalised body
+func ContentHash(entityID uuid.UUID, author, content string) string {
+	normalised := strings.Join(strings.Fields(strings.ToLower(content)), " ")
+	sum := sha256.Sum256([]byte(entityID.String() + "|" + strings.ToLower(author) + "|" + normalised))
+	return hex.EncodeToString(sum[:])
+}
+
+// wordRatings covers exports that spell the star rating out, e.g. "FIVE"
+var wordRatings = map[string]int{"one": 1, "two": 2, "three": 3, "four": 4, "five": 5}
+
+func parseRating(value string, scale int) (int, error) {
+	value = strings.TrimSpace(value)
+	if rating, ok := wordRatings[strings.ToLower(value)]; ok {
+		return rating, nil
+	}
+
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rating: %s", value)
+	}
+
+	if scale > 0 && scale != 5 {
+		v = v / float64(scale) * 5
+	}
+
+	rating := int(math.Round(v))
+	if rating < 1 {
+		rating = 1
+	}
+	if rating > 5 {
+		rating = 5
+	}
+	return rating, nil
+}
+
+func parseTime(value, layout string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	if t, err := time.Parse(layout, value); err == nil {
+		return t, nil
+	}
+	for _, fallback := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02", "01/02/2006"} {
+		if t, err := time.Parse(fallback, value); err == nil {
+			return t, nil
+		}
+	}
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(unix, 0).UTC(), nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid timestamp: %s", value)
+}
+
+func parseBool(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "true", "yes", "y", "verified", "verified buyer":
+		return true
+	default:
+		return false
+	}
+}
+
+// resolver caches entity and user lookups for the duration of an import
+type resolver struct {
+	db       *gorm.DB
+	tenantID uuid.UUID
+	entities map[string]uuid.UUID
+	users    map[string]uuid.UUID
+}
+
+func newResolver(db *gorm.DB, tenantID uuid.UUID) *resolver {
+	return &resolver{
+		db:       db,
+		tenantID: tenantID,
+		entities: make(map[string]uuid.UUID),
+		users:    make(map[string]uuid.UUID),
+	}
+}
+
+func (r *resolver) entity(value string) (uuid.UUID, error) {
+	value = strings.TrimSpace(value)
+	if id, ok := r.entities[value]; ok {
+		return id, nil
+	}
+
+	var entity models.Entity
+	query := r.db.Where("tenant_id = ?", r.tenantID)
+	if id, err := uuid.Parse(value); err == nil {
+		query = query.Where("id = ?", id)
+	} else {
+		query = query.Where("name = ?", value)
+	}
+	if err := query.First(&entity).Error; err != nil {
+		return uuid.Nil, fmt.Errorf("unknown entity: %s", value)
+	}
+
+	r.entities[value] = entity.ID
+	return entity.ID, nil
+}
+
+func (r *resolver) user(email string) (uuid.UUID, error) {
+	if id, ok := r.users[email]; ok {
+		return id, nil
+	}
+
+	var user models.User
+	err := r.db.Where("tenant_id = ? AND email = ?", r.tenantID, email).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return uuid.Nil, err
+	}
+
+	// Unknown emails map to uuid.Nil so the review is stored as anonymous
+	r.users[email] = user.ID
+	return user.ID, nil
+}
@@ -0,0 +1,121 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldMapping describes which source column or key holds each review field.
+// Empty fields are simply not imported.
+type FieldMapping struct {
+	Content     string `json:"content"`
+	Rating      string `json:"rating"`
+	Title       string `json:"title"`
+	AuthorName  string `json:"author_name"`
+	AuthorEmail string `json:"author_email"`
+	Entity      string `json:"entity"` // entity UUID or entity name
+	CreatedAt   string `json:"created_at"`
+	Verified    string `json:"verified"`
+	ExternalID  string `json:"external_id"`
+	TimeLayout  string `json:"time_layout"`  // Go time layout, defaults to RFC3339
+	RatingScale int    `json:"rating_scale"` // source max rating, normalised to 5
+}
+
+// Presets holds the mappings for the export layouts of common review platforms
+var Presets = map[string]FieldMapping{
+	"yotpo": {
+		Content:     "review_content",
+		Rating:      "review_score",
+		Title:       "review_title",
+		AuthorName:  "display_name",
+		AuthorEmail: "email",
+		Entity:      "product_title",
+		CreatedAt:   "date",
+		Verified:    "verified_buyer",
+		ExternalID:  "review_id",
+	},
+	"judgeme": {
+		Content:     "body",
+		Rating:      "rating",
+		Title:       "title",
+		AuthorName:  "reviewer_name",
+		AuthorEmail: "reviewer_email",
+		Entity:      "product_handle",
+		CreatedAt:   "review_date",
+		Verified:    "verified",
+		ExternalID:  "id",
+	},
+	"trustpilot": {
+		Content:     "Review Content",
+		Rating:      "Review Stars",
+		Title:       "Review Title",
+		AuthorName:  "Reviewer Name",
+		AuthorEmail: "Email",
+		Entity:      "Product Name",
+		CreatedAt:   "Review Created (UTC)",
+		Verified:    "Verified",
+		ExternalID:  "Review ID",
+		TimeLayout:  "2006-01-02 15:04:05",
+	},
+	"google": {
+		Content:    "comment",
+		Rating:     "starRating",
+		AuthorName: "reviewer.displayName",
+		Entity:     "location",
+		CreatedAt:  "createTime",
+		ExternalID: "reviewId",
+	},
+}
+
+// ResolveMapping merges a preset with caller supplied overrides
+func ResolveMapping(preset string, overrides *FieldMapping) (FieldMapping, error) {
+	var mapping FieldMapping
+	if preset != "" {
+		p, ok := Presets[strings.ToLower(preset)]
+		if !ok {
+			return mapping, fmt.Errorf("unknown import preset: %s", preset)
+		}
+		mapping = p
+	}
+
+	if overrides != nil {
+		mapping = mergeMapping(mapping, *overrides)
+	}
+
+	if mapping.Content == "" {
+		return mapping, fmt.Errorf("mapping must specify a content field")
+	}
+	if mapping.TimeLayout == "" {
+		mapping.TimeLayout = "2006-01-02T15:04:05Z07:00"
+	}
+	if mapping.RatingScale == 0 {
+		mapping.RatingScale = 5
+	}
+
+	return mapping, nil
+}
+
+func mergeMapping(base, overrides FieldMapping) FieldMapping {
+	pick := func(override, fallback string) string {
+		if override != "" {
+			return override
+		}
+		return fallback
+	}
+
+	base.Content = pick(overrides.Content, base.Content)
+	base.Rating = pick(overrides.Rating, base.Rating)
+	base.Title = pick(overrides.Title, base.Title)
+	base.AuthorName = pick(overrides.AuthorName, base.AuthorName)
+	base.AuthorEmail = pick(overrides.AuthorEmail, base.AuthorEmail)
+	base.Entity = pick(overrides.Entity, base.Entity)
+	base.CreatedAt = pick(overrides.CreatedAt, base.CreatedAt)
+	base.Verified = pick(overrides.Verified, base.Verified)
+	base.ExternalID = pick(overrides.ExternalID, base.ExternalID)
+	base.TimeLayout = pick(overrides.TimeLayout, base.TimeLayout)
+	if overrides.RatingScale != 0 {
+		base.RatingScale = overrides.RatingScale
+	}
+
+	return base
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"nyasah-backend/models"
+	"nyasah-backend/services/ai/analyzers"
+	"nyasah-backend/services/ai/providers"
+	"nyasah-backend/services/jobs"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// pendingBatch bounds how many unanalyzed reviews one backfill pass queues
+const pendingBatch = 500
+
+// RegisterJobs sets the handlers for AI enrichment jobs and lets the service
+// queue follow-up work
+func (s *Service) RegisterJobs(q *jobs.Queue) {
+	s.jobs = q
+	q.Register(jobs.TypeSentiment, s.sentimentJob)
+	q.Register(jobs.TypeKeywords, s.keywordsJob)
+	q.Register(jobs.TypeEmbedding, s.embeddingJob)
+	q.Register(jobs.TypeInsights, s.insightsJob)
+	q.Register(jobs.TypeRecommendations, s.recommendationsJob)
+}
+
+func (s *Service) loadReview(ctx context.Context, job models.Job) (models.Review, error) {
+	var payload jobs.ReviewPayload
+	if err := jobs.Decode(job, &payload); err != nil {
+		return models.Review{}, err
+	}
+
+	var review models.Review
+	err := s.db.WithContext(ctx).Where("tenant_id = ?", job.TenantID).First(&review, "id = ?", payload.ReviewID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return review, jobs.Permanent(fmt.Errorf("review %s not found", payload.ReviewID))
+	}
+	return review, err
+}
+
+// sentimentJob scores a review's sentiment and queues keyword extraction
+func (s *Service) sentimentJob(ctx context.Context, job models.Job) error {
+	review, err := s.loadReview(ctx, job)
+	if err != nil {
+		return err
+	}
+
+	sentiment, err := analyzers.NewSentimentAnalyzer(s.provider).AnalyzeSentiment(ctx, review.Content)
+	if err != nil {
+		return fmt.Errorf("sentiment failed for review %s: %w", review.ID, err)
+	}
+	if err := s.db.WithContext(ctx).Model(&review).Update("sentiment", sentiment).Error; err != nil {
+		return fmt.Errorf("failed to save sentiment for review %s: %w", review.ID, err)
+	}
+
+	_, err = s.jobs.Enqueue(review.TenantID, jobs.TypeKeywords, review.ID.String(), jobs.ReviewPayload{ReviewID: review.ID})
+	return err
+}
+
+// keywordsJob extracts a review's keywords, marks it analyzed and queues
+// regeneration of its entity's insights
+func (s *Service) keywordsJob(ctx context.Context, job models.Job) error {
+	review, err := s.loadReview(ctx, job)
+	if err != nil {
+		return err
+	}
+
+	keywords, err := analyzers.NewKeywordAnalyzer(s.provider).ExtractKeywords(ctx, review.Content)
+	if err != nil {
+		return fmt.Errorf("keyword extraction failed for review %s: %w", review.ID, err)
+	}
+
+	now := time.Now()
+	review.Keywords = keywords
+	review.EnrichedAt = &now
+	if err := s.db.WithContext(ctx).Model(&review).Select("keywords", "enriched_at").Updates(&review).Error; err != nil {
+		return fmt.Errorf("failed to save keywords for review %s: %w", review.ID, err)
+	}
+
+	if s.canEmbed() {
+		if _, err := s.jobs.Enqueue(review.TenantID, jobs.TypeEmbedding, review.ID.String(), jobs.ReviewPayload{ReviewID: review.ID}); err != nil {
+			return err
+		}
+	}
+	return s.jobs.EntityChanged(review.TenantID, review.EntityID)
+}
+
+// canEmbed reports whether the provider can embed reviews for semantic search
+func (s *Service) canEmbed() bool {
+	_, ok := s.provider.(providers.Embedder)
+	return ok
+}
+
+// embeddingJob stores a review's vector for semantic search, replacing any
+// earlier one
+func (s *Service) embeddingJob(ctx context.Context, job models.Job) error {
+	review, err := s.loadReview(ctx, job)
+	if err != nil {
+		return err
+	}
+
+	embeddings, err := providers.Embed(ctx, s.provider, []string{review.Content})
+	if errors.Is(err, providers.ErrEmbeddingsUnsupported) {
+		return jobs.Permanent(err)
+	}
+	if err != nil {
+		return fmt.Errorf("embedding failed for review %s: %w", review.ID, err)
+	}
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "review_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"model", "vector", "created_at"}),
+	}).Create(&models.ReviewEmbedding{
+		ReviewID: review.ID,
+		TenantID: review.TenantID,
+		Model:    embeddings.Model,
+		Vector:   embeddings.Vectors[0],
+	}).Error
+}
+
+// insightsJob regenerates and stores an entity's insights
+func (s *Service) insightsJob(ctx context.Context, job models.Job) error {
+	var payload jobs.EntityPayload
+	if err := jobs.Decode(job, &payload); err != nil {
+		return err
+	}
+
+	insights, err := s.recommenderFor(ctx).GenerateInsights(payload.EntityID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return jobs.Permanent(err)
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "product_id"}},
+		UpdateAll: true,
+	}).Create(&insights).Error
+}
+
+// recommendationsJob replaces the tenant's stored recommendations
+func (s *Service) recommendationsJob(ctx context.Context, job models.Job) error {
+	recommendations, err := s.recommenderFor(ctx).GenerateRecommendations(job.TenantID)
+	if err != nil {
+		return err
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("tenant_id = ?", job.TenantID).Delete(&models.AIRecommendation{}).Error; err != nil {
+			return err
+		}
+		if len(recommendations) == 0 {
+			return nil
+		}
+		return tx.Create(&recommendations).Error
+	})
+}
+
+// RunEnrichment queues analysis for reviews without stored sentiment and
+// keywords on the given interval until ctx is done
+func (s *Service) RunEnrichment(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := s.jobs.QueuePendingReviews(pendingBatch); err != nil {
+				log.Printf("Failed to queue review analysis: %v", err)
+			} else if n > 0 {
+				log.Printf("Queued analysis for %d reviews", n)
+			}
+			if !s.canEmbed() {
+				continue
+			}
+			if n, err := s.jobs.QueueMissingEmbeddings(pendingBatch); err != nil {
+				log.Printf("Failed to queue review embeddings: %v", err)
+			} else if n > 0 {
+				log.Printf("Queued embeddings for %d reviews", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,407 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"nyasah-backend/models"
+	"nyasah-backend/services/tracing"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+)
+
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusDead      = "dead"
+)
+
+// ErrNotDead is returned when retrying a job that has not been dead-lettered
+var ErrNotDead = errors.New("only dead jobs can be retried")
+
+// Handler processes one job. Returning an error schedules a retry unless the
+// error is wrapped with Permanent.
+type Handler func(ctx context.Context, job models.Job) error
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error as not worth retrying, e.g. when the job's
+// subject no longer exists. The job is dead-lettered straight away.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var permanent permanentError
+	return errors.As(err, &permanent)
+}
+
+type Options struct {
+	Workers           int           // jobs processed concurrently by this process
+	PollInterval      time.Duration // how long an idle worker waits before looking for work
+	MaxAttempts       int           // attempts before a job is dead-lettered
+	BaseBackoff       time.Duration // delay before the first retry; doubles with every attempt
+	MaxBackoff        time.Duration
+	TenantConcurrency int           // running jobs allowed per tenant across all workers
+	Timeout           time.Duration // a job is cancelled after this long, and reclaimed if its worker disappears
+}
+
+// Queue is a durable job queue stored in the jobs table. Any number of
+// processes may run workers against the same database.
+type Queue struct {
+	db       *gorm.DB
+	opts     Options
+	workerID string
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+
+	claimMu sync.Mutex // serializes claims so per-tenant limits hold within this process
+}
+
+func NewQueue(db *gorm.DB, opts Options) *Queue {
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.BaseBackoff <= 0 {
+		opts.BaseBackoff = 10 * time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = time.Hour
+	}
+	if opts.TenantConcurrency <= 0 {
+		opts.TenantConcurrency = 2
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 2 * time.Minute
+	}
+
+	hostname, _ := os.Hostname()
+	return &Queue{
+		db:       db,
+		opts:     opts,
+		workerID: fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.NewString()[:8]),
+		handlers: make(map[string]Handler),
+	}
+}
+
+// Register sets the handler for a job type
+func (q *Queue) Register(jobType string, handler Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[jobType] = handler
+}
+
+func (q *Queue) handler(jobType string) (Handler, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	handler, ok := q.handlers[jobType]
+	return handler, ok
+}
+
+// Enqueue adds a job. When key is set and a queued or running job of the same
+// type and key exists for the tenant, that job is returned instead.
+func (q *Queue) Enqueue(tenantID uuid.UUID, jobType, key string, payload interface{}) (*models.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job payload: %w", err)
+	}
+
+	if key != "" {
+		var existing models.Job
+		err := q.db.Where("tenant_id = ? AND type = ? AND dedupe_key = ? AND status IN ?",
+			tenantID, jobType, key, []string{StatusQueued, StatusRunning}).
+			First(&existing).Error
+		if err == nil {
+			return &existing, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("failed to check for queued job: %w", err)
+		}
+	}
+
+	job := models.Job{
+		TenantID:    tenantID,
+		Type:        jobType,
+		DedupeKey:   key,
+		Payload:     data,
+		Status:      StatusQueued,
+		MaxAttempts: q.opts.MaxAttempts,
+		RunAt:       time.Now(),
+	}
+	if err := q.db.Create(&job).Error; err != nil {
+		return nil, fmt.Errorf("failed to enqueue job: %w", err)
+	}
+	return &job, nil
+}
+
+// Decode unmarshals a job's payload
+func Decode(job models.Job, v interface{}) error {
+	if err := json.Unmarshal(job.Payload, v); err != nil {
+		return Permanent(fmt.Errorf("invalid job payload: %w", err))
+	}
+	return nil
+}
+
+// Work claims and processes a single due job. It reports whether a job was found.
+func (q *Queue) Work(ctx context.Context) (bool, error) {
+	job, err := q.claim()
+	if err != nil || job == nil {
+		return false, err
+	}
+
+	q.process(ctx, *job)
+	return true, nil
+}
+
+// claim marks the oldest due job of a tenant below its concurrency limit as
+// running. The conditional update makes sure only one worker wins a job.
+func (q *Queue) claim() (*models.Job, error) {
+	q.claimMu.Lock()
+	defer q.claimMu.Unlock()
+
+	now := time.Now()
+	var candidates []models.Job
+	err := q.db.Where("status = ? AND run_at <= ?", StatusQueued, now).
+		Order("run_at").
+		Limit(50).
+		Find(&candidates).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load queued jobs: %w", err)
+	}
+
+	running := make(map[uuid.UUID]int64)
+	for _, job := range candidates {
+		if _, ok := q.handler(job.Type); !ok {
+			continue
+		}
+
+		count, ok := running[job.TenantID]
+		if !ok {
+			if err := q.db.Model(&models.Job{}).
+				Where("tenant_id = ? AND status = ?", job.TenantID, StatusRunning).
+				Count(&count).Error; err != nil {
+				return nil, fmt.Errorf("failed to count running jobs: %w", err)
+			}
+		}
+		if count >= int64(q.opts.TenantConcurrency) {
+			running[job.TenantID] = count
+			continue
+		}
+
+		result := q.db.Model(&models.Job{}).
+			Where("id = ? AND status = ?", job.ID, StatusQueued).
+			Updates(map[string]interface{}{
+				"status":    StatusRunning,
+				"attempts":  gorm.Expr("attempts + 1"),
+				"locked_at": now,
+				"locked_by": q.workerID,
+			})
+		if result.Error != nil {
+			return nil, fmt.Errorf("failed to claim job: %w", result.Error)
+		}
+		if result.RowsAffected == 1 {
+			job.Status = StatusRunning
+			job.Attempts++
+			job.LockedAt = &now
+			job.LockedBy = q.workerID
+			return &job, nil
+		}
+		running[job.TenantID] = count
+	}
+
+	return nil, nil
+}
+
+func (q *Queue) process(ctx context.Context, job models.Job) {
+	handler, _ := q.handler(job.Type)
+
+	ctx, cancel := context.WithTimeout(ctx, q.opts.Timeout)
+	defer cancel()
+
+	// Each job is its own trace, so its queries and provider calls can be
+	// followed like a request's
+	ctx, span := tracing.Start(tracing.WithTenant(ctx, job.TenantID), "job "+job.Type,
+		attribute.String("job.id", job.ID.String()),
+		attribute.Int("job.attempt", job.Attempts),
+	)
+	err := run(ctx, handler, job)
+	tracing.End(span, err)
+	if err := q.finish(job, err); err != nil {
+		log.Printf("Failed to record result of job %s: %v", job.ID, err)
+	}
+}
+
+// run calls the handler, turning a panic into an error so one bad job cannot
+// take down a worker
+func run(ctx context.Context, handler Handler, job models.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+func (q *Queue) finish(job models.Job, jobErr error) error {
+	now := time.Now()
+	updates := map[string]interface{}{"locked_at": nil, "locked_by": ""}
+
+	switch {
+	case jobErr == nil:
+		updates["status"] = StatusSucceeded
+		updates["completed_at"] = now
+		updates["last_error"] = ""
+	case IsPermanent(jobErr) || job.Attempts >= job.MaxAttempts:
+		updates["status"] = StatusDead
+		updates["completed_at"] = now
+		updates["last_error"] = jobErr.Error()
+		log.Printf("Job %s (%s) dead-lettered after %d attempts: %v", job.ID, job.Type, job.Attempts, jobErr)
+	default:
+		updates["status"] = StatusQueued
+		updates["run_at"] = now.Add(q.backoff(job.Attempts))
+		updates["last_error"] = jobErr.Error()
+	}
+
+	return q.db.Model(&models.Job{}).Where("id = ?", job.ID).Updates(updates).Error
+}
+
+// backoff doubles the delay with each attempt, capped at MaxBackoff, with up
+// to 20% jitter so failing jobs do not retry in lockstep
+func (q *Queue) backoff(attempts int) time.Duration {
+	delay := q.opts.BaseBackoff
+	for i := 1; i < attempts && delay < q.opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > q.opts.MaxBackoff {
+		delay = q.opts.MaxBackoff
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+// Reclaim requeues running jobs whose worker stopped without finishing them,
+// counting the lost run as a failed attempt
+func (q *Queue) Reclaim() (int, error) {
+	var stale []models.Job
+	err := q.db.Where("status = ? AND locked_at < ?", StatusRunning, time.Now().Add(-2*q.opts.Timeout)).
+		Find(&stale).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to load stale jobs: %w", err)
+	}
+
+	for _, job := range stale {
+		if err := q.finish(job, errors.New("worker stopped before the job finished")); err != nil {
+			return 0, err
+		}
+	}
+	return len(stale), nil
+}
+
+// Retry requeues a dead-lettered job with a fresh set of attempts
+func (q *Queue) Retry(tenantID, jobID uuid.UUID) (*models.Job, error) {
+	var job models.Job
+	if err := q.db.Where("tenant_id = ?", tenantID).First(&job, "id = ?", jobID).Error; err != nil {
+		return nil, err
+	}
+	if job.Status != StatusDead {
+		return nil, ErrNotDead
+	}
+
+	err := q.db.Model(&job).Updates(map[string]interface{}{
+		"status":       StatusQueued,
+		"attempts":     0,
+		"run_at":       time.Now(),
+		"completed_at": nil,
+	}).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to retry job: %w", err)
+	}
+	return &job, nil
+}
+
+// Count is the number of jobs of one type in one status
+type Count struct {
+	Type   string
+	Status string
+	Count  int64
+}
+
+// Depth counts the queued, running and dead jobs of every tenant by type.
+// Succeeded jobs are left out; they only ever grow.
+func (q *Queue) Depth() ([]Count, error) {
+	var counts []Count
+	err := q.db.Model(&models.Job{}).
+		Select("type, status, COUNT(*) AS count").
+		Where("status IN ?", []string{StatusQueued, StatusRunning, StatusDead}).
+		Group("type, status").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count jobs: %w", err)
+	}
+	return counts, nil
+}
+
+// Run starts the workers and blocks until ctx is done and running jobs have
+// finished. Stale jobs are reclaimed once a minute.
+func (q *Queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < q.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-ticker.C:
+			if n, err := q.Reclaim(); err != nil {
+				log.Printf("Failed to reclaim jobs: %v", err)
+			} else if n > 0 {
+				log.Printf("Reclaimed %d stale jobs", n)
+			}
+		}
+	}
+}
+
+func (q *Queue) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		found, err := q.Work(ctx)
+		if err != nil {
+			log.Printf("Job worker error: %v", err)
+		}
+		if found {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(q.opts.PollInterval):
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package jobs
+
+import (
+	"fmt"
+	"nyasah-backend/models"
+
+	"github.com/google/uuid"
+)
+
+// Job types. Review analysis runs as a chain: sentiment, then keywords, then
+// the entity's insights, so insights always see the review's stored analysis.
+// Reviews are embedded for semantic search after their keywords, when the
+// provider can embed.
+const (
+	TypeSentiment       = "review.sentiment"
+	TypeKeywords        = "review.keywords"
+	TypeEmbedding       = "review.embed"
+	TypeInsights        = "insights.regenerate"
+	TypeRecommendations = "recommendations.refresh"
+)
+
+type ReviewPayload struct {
+	ReviewID uuid.UUID `json:"review_id"`
+}
+
+type EntityPayload struct {
+	EntityID uuid.UUID `json:"entity_id"`
+}
+
+// ReviewCreated queues analysis of a new review
+func (q *Queue) ReviewCreated(review models.Review) error {
+	_, err := q.Enqueue(review.TenantID, TypeSentiment, review.ID.String(), ReviewPayload{ReviewID: review.ID})
+	return err
+}
+
+// ProofCreated queues regeneration of the proof entity's insights and the
+// tenant's recommendations
+func (q *Queue) ProofCreated(proof models.SocialProof) error {
+	if proof.EntityID != uuid.Nil {
+		if err := q.EntityChanged(proof.TenantID, proof.EntityID); err != nil {
+			return err
+		}
+	}
+	_, err := q.Enqueue(proof.TenantID, TypeRecommendations, TypeRecommendations, struct{}{})
+	return err
+}
+
+// EntityChanged queues regeneration of an entity's insights
+func (q *Queue) EntityChanged(tenantID, entityID uuid.UUID) error {
+	_, err := q.Enqueue(tenantID, TypeInsights, entityID.String(), EntityPayload{EntityID: entityID})
+	return err
+}
+
+// QueuePendingReviews queues analysis for reviews that have none stored and
+// no analysis job waiting, running or dead-lettered, e.g. reviews written
+// before the queue existed. It returns how many were queued.
+func (q *Queue) QueuePendingReviews(limit int) (int, error) {
+	tracked := q.db.Model(&models.Job{}).Select("dedupe_key").
+		Where("type IN ? AND status IN ?", []string{TypeSentiment, TypeKeywords}, []string{StatusQueued, StatusRunning, StatusDead})
+
+	var reviews []models.Review
+	err := q.db.Select("id", "tenant_id").
+		Where("enriched_at IS NULL").
+		Where("CAST(id AS TEXT) NOT IN (?)", tracked).
+		Order("created_at").
+		Limit(limit).
+		Find(&reviews).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to load pending reviews: %w", err)
+	}
+
+	for _, review := range reviews {
+		if _, err := q.Enqueue(review.TenantID, TypeSentiment, review.ID.String(), ReviewPayload{ReviewID: review.ID}); err != nil {
+			return 0, err
+		}
+	}
+	return len(reviews), nil
+}
+
+// QueueMissingEmbeddings queues embedding of analyzed reviews that have no
+// stored vector and no embedding job waiting, running or dead-lettered. It
+// returns how many were queued.
+func (q *Queue) QueueMissingEmbeddings(limit int) (int, error) {
+	tracked := q.db.Model(&models.Job{}).Select("dedupe_key").
+		Where("type = ? AND status IN ?", TypeEmbedding, []string{StatusQueued, StatusRunning, StatusDead})
+	embedded := q.db.Model(&models.ReviewEmbedding{}).Select("review_id")
+
+	var reviews []models.Review
+	err := q.db.Select("id", "tenant_id").
+		Where("enriched_at IS NOT NULL").
+		Where("id NOT IN (?)", embedded).
+		Where("CAST(id AS TEXT) NOT IN (?)", tracked).
+		Order("created_at").
+		Limit(limit).
+		Find(&reviews).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to load reviews without embeddings: %w", err)
+	}
+
+	for _, review := range reviews {
+		if _, err := q.Enqueue(review.TenantID, TypeEmbedding, review.ID.String(), ReviewPayload{ReviewID: review.ID}); err != nil {
+			return 0, err
+		}
+	}
+	return len(reviews), nil
+}
@@ -0,0 +1,178 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Attachment is a file sent along with a message
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Message is an email with a plain text body and an optional HTML body
+type Message struct {
+	To          []string
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []Attachment
+}
+
+// Mailer delivers email. Deployments choose an implementation in
+// configuration; tests can substitute their own.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+var ErrNoRecipients = errors.New("message has no recipients")
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPMailer sends messages through an SMTP server, using STARTTLS when the
+// server offers it
+type SMTPMailer struct {
+	config SMTPConfig
+}
+
+func NewSMTPMailer(config SMTPConfig) *SMTPMailer {
+	if config.Port == 0 {
+		config.Port = 587
+	}
+	return &SMTPMailer{config: config}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if len(msg.To) == 0 {
+		return ErrNoRecipients
+	}
+
+	body, err := Encode(m.config.From, msg)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.config.Username != "" {
+		auth = smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+	}
+
+	addr := net.JoinHostPort(m.config.Host, fmt.Sprint(m.config.Port))
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, m.config.From, msg.To, body)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("failed to send email: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LogMailer writes messages to the log instead of sending them. It is used
+// when no SMTP server is configured.
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	if len(msg.To) == 0 {
+		return ErrNoRecipients
+	}
+	log.Printf("Email to %s: %s (no SMTP server configured, not sent)", strings.Join(msg.To, ", "), msg.Subject)
+	return nil
+}
+
+// Encode renders a message as RFC 5322 with MIME parts for the HTML body and
+// attachments
+func Encode(from string, msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+	header := func(key, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+
+	header("From", from)
+	header("To", strings.Join(msg.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%s@nyasah>", randomID()))
+	header("MIME-Version", "1.0")
+
+	if msg.HTML == "" && len(msg.Attachments) == 0 {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "base64")
+		buf.WriteString("\r\n")
+		writeBase64(&buf, []byte(msg.Text))
+		return buf.Bytes(), nil
+	}
+
+	writer := multipart.NewWriter(&buf)
+	header("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+	buf.WriteString("\r\n")
+
+	parts := []Attachment{{ContentType: "text/plain; charset=utf-8", Data: []byte(msg.Text)}}
+	if msg.HTML != "" {
+		parts = append(parts, Attachment{ContentType: "text/html; charset=utf-8", Data: []byte(msg.HTML)})
+	}
+	parts = append(parts, msg.Attachments...)
+
+	for _, part := range parts {
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Type", part.ContentType)
+		h.Set("Content-Transfer-Encoding", "base64")
+		if part.Filename != "" {
+			h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": part.Filename}))
+		}
+		w, err := writer.CreatePart(h)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode email: %w", err)
+		}
+		var encoded bytes.Buffer
+		writeBase64(&encoded, part.Data)
+		w.Write(encoded.Bytes())
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode email: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// writeBase64 writes data as base64 in 76 character lines
+func writeBase64(buf *bytes.Buffer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+}
+
+func randomID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"log"
+	"nyasah-backend/services/jobs"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var jobsDesc = prometheus.NewDesc(
+	"nyasah_jobs",
+	"Background jobs waiting, running or dead-lettered, by type and status.",
+	[]string{"type", "status"}, nil,
+)
+
+// queueCollector counts jobs when metrics are scraped, so the numbers cover
+// every process working the queue
+type queueCollector struct {
+	queue *jobs.Queue
+}
+
+// NewQueueCollector reports the depth of a job queue
+func NewQueueCollector(q *jobs.Queue) prometheus.Collector {
+	return queueCollector{queue: q}
+}
+
+func (c queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- jobsDesc
+}
+
+func (c queueCollector) Collect(ch chan<- prometheus.Metric) {
+	counts, err := c.queue.Depth()
+	if err != nil {
+		log.Printf("Failed to count jobs for metrics: %v", err)
+		ch <- prometheus.NewInvalidMetric(jobsDesc, err)
+		return
+	}
+	for _, count := range counts {
+		ch <- prometheus.MustNewConstMetric(jobsDesc, prometheus.GaugeValue, float64(count.Count), count.Type, count.Status)
+	}
+}
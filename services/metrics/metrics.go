@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every metric the server exposes on /metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "nyasah_http_request_duration_seconds",
+		Help:    "Time taken to serve HTTP requests, by route and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	dbDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "nyasah_db_query_duration_seconds",
+		Help:    "Time taken by database statements, by operation and table.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"operation", "table"})
+
+	dbErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nyasah_db_query_errors_total",
+		Help: "Database statements that failed, by operation and table. Missing records do not count.",
+	}, []string{"operation", "table"})
+
+	aiDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "nyasah_ai_provider_request_duration_seconds",
+		Help:    "Time taken by AI provider calls, by provider and operation.",
+		Buckets: []float64{.1, .25, .5, 1, 2.5, 5, 10, 20, 30, 60, 120},
+	}, []string{"provider", "operation"})
+
+	aiRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nyasah_ai_provider_requests_total",
+		Help: "AI provider calls, by provider, operation and result (ok or error).",
+	}, []string{"provider", "operation", "result"})
+
+	aiTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nyasah_ai_provider_tokens_total",
+		Help: "Tokens AI providers reported using, by provider and type (prompt or completion).",
+	}, []string{"provider", "type"})
+
+	streamConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nyasah_stream_connections",
+		Help: "Open live stream connections, by transport (sse or websocket).",
+	}, []string{"transport"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpDuration, dbDuration, dbErrors, aiDuration, aiRequests, aiTokens, streamConnections,
+	)
+}
+
+// Handler serves the registry in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Register adds a collector, replacing one registered earlier with the same
+// metrics, e.g. by a previous server in the same process
+func Register(c prometheus.Collector) error {
+	err := Registry.Register(c)
+	var exists prometheus.AlreadyRegisteredError
+	if errors.As(err, &exists) {
+		Registry.Unregister(exists.ExistingCollector)
+		err = Registry.Register(c)
+	}
+	return err
+}
+
+// ObserveHTTP records a served request. route is the route's pattern, e.g.
+// /api/reviews/:id, so IDs do not each become a series.
+func ObserveHTTP(method, route string, status int, elapsed time.Duration) {
+	httpDuration.WithLabelValues(method, route, strconv.Itoa(status)).Observe(elapsed.Seconds())
+}
+
+// ObserveProvider records one AI provider call
+func ObserveProvider(provider, operation string, elapsed time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	aiDuration.WithLabelValues(provider, operation).Observe(elapsed.Seconds())
+	aiRequests.WithLabelValues(provider, operation, result).Inc()
+}
+
+// AddTokens records the tokens a provider reported for one call
+func AddTokens(provider string, prompt, completion int) {
+	if prompt > 0 {
+		aiTokens.WithLabelValues(provider, "prompt").Add(float64(prompt))
+	}
+	if completion > 0 {
+		aiTokens.WithLabelValues(provider, "completion").Add(float64(completion))
+	}
+}
+
+// StreamOpened counts a live stream connection until the returned function
+// is called
+func StreamOpened(transport string) func() {
+	gauge := streamConnections.WithLabelValues(transport)
+	gauge.Inc()
+	return gauge.Dec
+}
@@ -0,0 +1,62 @@
+package presence
+
+import (
+	"encoding/json"
+)
+
+// Rules control how live viewer counts are shown. Tenants configure them
+// under the "presence" key of Tenant.Settings. Rules can only hide or lower
+// a count, never raise it: Floor hides small counts instead of padding them,
+// and RoundTo always rounds down.
+type Rules struct {
+	Floor   int `json:"floor"`    // hide counts below this, e.g. 3 hides "1 person is viewing"
+	RoundTo int `json:"round_to"` // round down to a multiple of this and show "N+"
+}
+
+// Count is a viewer count safe to show on a storefront
+type Count struct {
+	Count   int  `json:"count"`
+	Rounded bool `json:"rounded"` // the real count may be higher, show as "N+"
+	Visible bool `json:"visible"`
+}
+
+// minFloor keeps a lone visitor from being told someone else is watching
+const minFloor = 2
+
+// RulesFromSettings reads presence rules from tenant settings
+func RulesFromSettings(settings json.RawMessage) Rules {
+	var parsed struct {
+		Presence Rules `json:"presence"`
+	}
+	if len(settings) > 0 {
+		json.Unmarshal(settings, &parsed)
+	}
+	return parsed.Presence
+}
+
+// Apply turns a real count into the count to display
+func (r Rules) Apply(actual int) Count {
+	floor := r.Floor
+	if floor < minFloor {
+		floor = minFloor
+	}
+	if actual < floor {
+		return Count{}
+	}
+
+	shown := actual
+	if r.RoundTo > 1 {
+		shown = actual / r.RoundTo * r.RoundTo
+	}
+	if shown < floor {
+		// Rounding below the floor would hide a legitimate count; show the real one
+		shown = actual
+	}
+
+	// Honesty safeguard: never display more than the real count
+	if shown > actual {
+		shown = actual
+	}
+
+	return Count{Count: shown, Rounded: shown < actual, Visible: true}
+}
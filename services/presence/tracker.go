@@ -0,0 +1,347 @@
+package presence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"nyasah-backend/models"
+	"nyasah-backend/services/stream"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// EventType is the stream event type carrying presence updates
+const EventType = "presence"
+
+// entityCacheTTL is how long an entity stays confirmed as the tenant's
+const entityCacheTTL = 5 * time.Minute
+
+// ErrUnknownEntity is returned for heartbeats about entities the tenant does not have
+var ErrUnknownEntity = errors.New("unknown entity")
+
+type Options struct {
+	Window               time.Duration // a visitor counts until this long after their last heartbeat
+	CheckpointInterval   time.Duration // how often live visitors are snapshotted to the database
+	MaxVisitorsPerEntity int           // bounds memory per entity; further visitors are not tracked
+}
+
+type entityKey struct {
+	tenantID uuid.UUID
+	entityID uuid.UUID
+}
+
+type cachedRules struct {
+	rules   Rules
+	expires time.Time
+}
+
+// Tracker keeps live viewers per entity in memory, publishes changes to the
+// stream hub and periodically checkpoints itself to the database
+type Tracker struct {
+	db   *gorm.DB
+	hub  *stream.Hub
+	opts Options
+
+	mu        sync.Mutex
+	visitors  map[entityKey]map[string]time.Time
+	dirty     map[entityKey]struct{} // entities whose count may have changed since the last publish
+	published map[entityKey]Count
+	rules     map[uuid.UUID]cachedRules
+	known     map[entityKey]time.Time // entities confirmed to belong to their tenant, until the time given
+}
+
+func NewTracker(db *gorm.DB, hub *stream.Hub, opts Options) *Tracker {
+	if opts.Window <= 0 {
+		opts.Window = time.Minute
+	}
+	if opts.CheckpointInterval <= 0 {
+		opts.CheckpointInterval = 30 * time.Second
+	}
+	if opts.MaxVisitorsPerEntity <= 0 {
+		opts.MaxVisitorsPerEntity = 10000
+	}
+
+	return &Tracker{
+		db:        db,
+		hub:       hub,
+		opts:      opts,
+		visitors:  make(map[entityKey]map[string]time.Time),
+		dirty:     make(map[entityKey]struct{}),
+		published: make(map[entityKey]Count),
+		rules:     make(map[uuid.UUID]cachedRules),
+		known:     make(map[entityKey]time.Time),
+	}
+}
+
+// Ping records a heartbeat from a visitor viewing an entity. Heartbeats for
+// entities the tenant does not have return ErrUnknownEntity.
+func (t *Tracker) Ping(tenantID, entityID uuid.UUID, visitorID string) error {
+	if err := t.checkEntity(tenantID, entityID); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := entityKey{tenantID, entityID}
+	visitors, ok := t.visitors[key]
+	if !ok {
+		visitors = make(map[string]time.Time)
+		t.visitors[key] = visitors
+	}
+	if _, seen := visitors[visitorID]; !seen {
+		if len(visitors) >= t.opts.MaxVisitorsPerEntity {
+			return nil
+		}
+		t.dirty[key] = struct{}{}
+	}
+	visitors[visitorID] = time.Now()
+	return nil
+}
+
+// checkEntity confirms the entity belongs to the tenant, so storefronts
+// cannot make the tracker hold visitors and checkpoints for any ID they send.
+// Only confirmed entities are cached, which keeps the cache bounded by the
+// tenants' real entities.
+func (t *Tracker) checkEntity(tenantID, entityID uuid.UUID) error {
+	key := entityKey{tenantID, entityID}
+	t.mu.Lock()
+	expires, ok := t.known[key]
+	t.mu.Unlock()
+	if ok && time.Now().Before(expires) {
+		return nil
+	}
+
+	var count int64
+	if err := t.db.Model(&models.Entity{}).Where("id = ? AND tenant_id = ?", entityID, tenantID).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check entity: %w", err)
+	}
+	if count == 0 {
+		return ErrUnknownEntity
+	}
+
+	t.mu.Lock()
+	t.known[key] = time.Now().Add(entityCacheTTL)
+	t.mu.Unlock()
+	return nil
+}
+
+// Leave removes a visitor immediately, e.g. when the page is closed
+func (t *Tracker) Leave(tenantID, entityID uuid.UUID, visitorID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := entityKey{tenantID, entityID}
+	if visitors, ok := t.visitors[key]; ok {
+		if _, seen := visitors[visitorID]; seen {
+			delete(visitors, visitorID)
+			t.dirty[key] = struct{}{}
+		}
+	}
+}
+
+// Actual returns the real number of visitors seen within the window
+func (t *Tracker) Actual(tenantID, entityID uuid.UUID) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.countLocked(entityKey{tenantID, entityID}, time.Now())
+}
+
+// Display returns the count to show after applying the tenant's rules
+func (t *Tracker) Display(tenantID, entityID uuid.UUID) Count {
+	return t.Rules(tenantID).Apply(t.Actual(tenantID, entityID))
+}
+
+// Rules returns the tenant's presence rules, cached for a minute
+func (t *Tracker) Rules(tenantID uuid.UUID) Rules {
+	t.mu.Lock()
+	cached, ok := t.rules[tenantID]
+	t.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.rules
+	}
+
+	var tenant models.Tenant
+	var rules Rules
+	if err := t.db.Select("settings").First(&tenant, "id = ?", tenantID).Error; err == nil {
+		rules = RulesFromSettings(tenant.Settings)
+	}
+
+	t.mu.Lock()
+	t.rules[tenantID] = cachedRules{rules: rules, expires: time.Now().Add(time.Minute)}
+	t.mu.Unlock()
+
+	return rules
+}
+
+func (t *Tracker) countLocked(key entityKey, now time.Time) int {
+	cutoff := now.Add(-t.opts.Window)
+	count := 0
+	for _, seen := range t.visitors[key] {
+		if seen.After(cutoff) {
+			count++
+		}
+	}
+	return count
+}
+
+// sweep drops expired visitors and marks their entities as changed
+func (t *Tracker) sweep(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cutoff := now.Add(-t.opts.Window)
+	for key, visitors := range t.visitors {
+		for visitorID, seen := range visitors {
+			if !seen.After(cutoff) {
+				delete(visitors, visitorID)
+				t.dirty[key] = struct{}{}
+			}
+		}
+		if len(visitors) == 0 {
+			delete(t.visitors, key)
+		}
+	}
+}
+
+// publish sends a presence event for each changed entity whose displayed count differs
+func (t *Tracker) publish() {
+	t.mu.Lock()
+	keys := make([]entityKey, 0, len(t.dirty))
+	for key := range t.dirty {
+		keys = append(keys, key)
+	}
+	t.dirty = make(map[entityKey]struct{})
+	t.mu.Unlock()
+
+	for _, key := range keys {
+		count := t.Display(key.tenantID, key.entityID)
+
+		t.mu.Lock()
+		previous, had := t.published[key]
+		if count.Visible {
+			t.published[key] = count
+		} else {
+			delete(t.published, key)
+		}
+		t.mu.Unlock()
+
+		if previous == count || (!had && !count.Visible) {
+			continue
+		}
+		if t.hub != nil {
+			t.hub.Publish(stream.Event{
+				TenantID:  key.tenantID,
+				EntityID:  key.entityID,
+				Type:      EventType,
+				Data:      count,
+				Transient: true,
+			})
+		}
+	}
+}
+
+// Checkpoint snapshots live visitors so a restart can pick up where it left off
+func (t *Tracker) Checkpoint() error {
+	now := time.Now()
+	t.sweep(now)
+
+	t.mu.Lock()
+	snapshots := make([]models.PresenceCheckpoint, 0, len(t.visitors))
+	for key, visitors := range t.visitors {
+		snapshot := models.PresenceCheckpoint{
+			TenantID: key.tenantID,
+			EntityID: key.entityID,
+			Visitors: make(map[string]int64, len(visitors)),
+		}
+		for visitorID, seen := range visitors {
+			snapshot.Visitors[visitorID] = seen.UnixMilli()
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	t.mu.Unlock()
+
+	return t.db.Transaction(func(tx *gorm.DB) error {
+		// Entities without live visitors are removed rather than stored empty
+		if err := tx.Where("updated_at < ?", now).Delete(&models.PresenceCheckpoint{}).Error; err != nil {
+			return fmt.Errorf("failed to clear presence checkpoints: %w", err)
+		}
+		if len(snapshots) == 0 {
+			return nil
+		}
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "tenant_id"}, {Name: "entity_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"visitors", "updated_at"}),
+		}).CreateInBatches(&snapshots, 200).Error
+		if err != nil {
+			return fmt.Errorf("failed to write presence checkpoints: %w", err)
+		}
+		return nil
+	})
+}
+
+// Restore loads the last checkpoint, keeping only visitors still inside the window
+func (t *Tracker) Restore() error {
+	var snapshots []models.PresenceCheckpoint
+	if err := t.db.Find(&snapshots).Error; err != nil {
+		return fmt.Errorf("failed to load presence checkpoints: %w", err)
+	}
+
+	cutoff := time.Now().Add(-t.opts.Window)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, snapshot := range snapshots {
+		key := entityKey{snapshot.TenantID, snapshot.EntityID}
+		for visitorID, ms := range snapshot.Visitors {
+			seen := time.UnixMilli(ms)
+			if !seen.After(cutoff) {
+				continue
+			}
+			if t.visitors[key] == nil {
+				t.visitors[key] = make(map[string]time.Time)
+			}
+			if seen.After(t.visitors[key][visitorID]) {
+				t.visitors[key][visitorID] = seen
+			}
+			t.dirty[key] = struct{}{}
+		}
+	}
+
+	return nil
+}
+
+// Run publishes changes every second and checkpoints on the configured
+// interval until ctx is done, then writes a final checkpoint
+func (t *Tracker) Run(ctx context.Context) {
+	if err := t.Restore(); err != nil {
+		log.Printf("Failed to restore presence: %v", err)
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	checkpoint := time.NewTicker(t.opts.CheckpointInterval)
+	defer checkpoint.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := t.Checkpoint(); err != nil {
+				log.Printf("Failed to checkpoint presence on shutdown: %v", err)
+			}
+			return
+		case now := <-ticker.C:
+			t.sweep(now)
+			t.publish()
+		case <-checkpoint.C:
+			if err := t.Checkpoint(); err != nil {
+				log.Printf("Failed to checkpoint presence: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package proofs
+
+import (
+	"fmt"
+	"nyasah-backend/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	RotationRecent         = "recent"
+	RotationWeightedRandom = "weighted_random"
+	RotationRoundRobin     = "round_robin"
+	RotationBestPerforming = "best_performing"
+)
+
+// defaultPolicies apply to proof types a tenant has not configured. Purchase
+// notifications go stale quickly; other types are kept until a policy says otherwise.
+var defaultPolicies = map[string]models.ProofPolicy{
+	"purchase": {Type: "purchase", TTLMinutes: 48 * 60, Rotation: RotationRecent},
+}
+
+// ValidRotation reports whether a rotation strategy is supported
+func ValidRotation(rotation string) bool {
+	switch rotation {
+	case RotationRecent, RotationWeightedRandom, RotationRoundRobin, RotationBestPerforming:
+		return true
+	}
+	return false
+}
+
+// DefaultPolicy returns the built-in policy for a proof type
+func DefaultPolicy(proofType string) models.ProofPolicy {
+	if policy, ok := defaultPolicies[proofType]; ok {
+		return policy
+	}
+	return models.ProofPolicy{Type: proofType, Rotation: RotationRecent}
+}
+
+// TTL returns how long a proof stays fresh, or 0 when it never expires
+func TTL(policy models.ProofPolicy) time.Duration {
+	return time.Duration(policy.TTLMinutes) * time.Minute
+}
+
+// policySet resolves policies for one tenant, falling back to defaults
+type policySet map[string]models.ProofPolicy
+
+func (p policySet) get(proofType string) models.ProofPolicy {
+	if policy, ok := p[proofType]; ok {
+		return policy
+	}
+	return DefaultPolicy(proofType)
+}
+
+func (s *Service) policies(tenantID uuid.UUID) (policySet, error) {
+	var list []models.ProofPolicy
+	if err := s.db.Where("tenant_id = ?", tenantID).Find(&list).Error; err != nil {
+		return nil, fmt.Errorf("failed to load proof policies: %w", err)
+	}
+
+	set := make(policySet, len(list))
+	for _, policy := range list {
+		set[policy.Type] = policy
+	}
+	return set, nil
+}
+
+// Policy returns the effective policy for a tenant's proof type
+func (s *Service) Policy(tenantID uuid.UUID, proofType string) (models.ProofPolicy, error) {
+	set, err := s.policies(tenantID)
+	if err != nil {
+		return models.ProofPolicy{}, err
+	}
+	return set.get(proofType), nil
+}
+
+// Rotates reports whether any of the proof types is rotated per request, so
+// that selections must not be reused across visitors
+func (s *Service) Rotates(tenantID uuid.UUID, proofTypes []string) (bool, error) {
+	set, err := s.policies(tenantID)
+	if err != nil {
+		return false, err
+	}
+	for _, proofType := range proofTypes {
+		switch set.get(proofType).Rotation {
+		case RotationWeightedRandom, RotationRoundRobin:
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Refresh re-evaluates archival after a policy change: proofs that are fresh
+// under the new TTL are restored, and the rest are archived
+func (s *Service) Refresh(tenantID uuid.UUID, proofType string) error {
+	policy, err := s.Policy(tenantID, proofType)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	restore := s.db.Model(&models.SocialProof{}).
+		Where("tenant_id = ? AND type = ? AND archived_at IS NOT NULL", tenantID, proofType)
+	if ttl := TTL(policy); ttl > 0 {
+		restore = restore.Where("created_at >= ?", now.Add(-ttl))
+	}
+	if err := restore.Update("archived_at", nil).Error; err != nil {
+		return fmt.Errorf("failed to restore proofs: %w", err)
+	}
+
+	if ttl := TTL(policy); ttl > 0 {
+		err := s.db.Model(&models.SocialProof{}).
+			Where("tenant_id = ? AND type = ? AND archived_at IS NULL AND created_at < ?", tenantID, proofType, now.Add(-ttl)).
+			Update("archived_at", now).Error
+		if err != nil {
+			return fmt.Errorf("failed to archive proofs: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Archive marks every proof that has outlived its type's TTL as archived and
+// returns how many were archived
+func (s *Service) Archive() (int64, error) {
+	now := time.Now()
+	var total int64
+
+	var policies []models.ProofPolicy
+	if err := s.db.Where("ttl_minutes > 0").Find(&policies).Error; err != nil {
+		return 0, fmt.Errorf("failed to load proof policies: %w", err)
+	}
+	for _, policy := range policies {
+		result := s.db.Model(&models.SocialProof{}).
+			Where("tenant_id = ? AND type = ? AND archived_at IS NULL AND created_at < ?", policy.TenantID, policy.Type, now.Add(-TTL(policy))).
+			Update("archived_at", now)
+		if result.Error != nil {
+			return total, fmt.Errorf("failed to archive proofs: %w", result.Error)
+		}
+		total += result.RowsAffected
+	}
+
+	// Tenants without their own policy for a type use the default
+	for proofType, policy := range defaultPolicies {
+		if policy.TTLMinutes <= 0 {
+			continue
+		}
+		configured := s.db.Model(&models.ProofPolicy{}).Select("tenant_id").Where("type = ?", proofType)
+		result := s.db.Model(&models.SocialProof{}).
+			Where("type = ? AND archived_at IS NULL AND created_at < ?", proofType, now.Add(-TTL(policy))).
+			Where("tenant_id NOT IN (?)", configured).
+			Update("archived_at", now)
+		if result.Error != nil {
+			return total, fmt.Errorf("failed to archive proofs: %w", result.Error)
+		}
+		total += result.RowsAffected
+	}
+
+	return total, nil
+}
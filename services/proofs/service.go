@@ -0,0 +1,250 @@
+package proofs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"nyasah-backend/models"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	candidateLimit = 500       // bounds how many recent proofs are considered per selection
+	cursorIdle     = time.Hour // how long an unused round-robin position is kept
+)
+
+// Service selects which proofs to show, applying each type's freshness,
+// de-duplication and rotation policy
+type Service struct {
+	db *gorm.DB
+
+	mu      sync.Mutex
+	rand    *rand.Rand
+	cursors map[string]cursor // round-robin position per tenant, type and entity
+	pruned  time.Time
+}
+
+type cursor struct {
+	next int
+	used time.Time
+}
+
+func NewService(db *gorm.DB) *Service {
+	return &Service{
+		db:      db,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		cursors: make(map[string]cursor),
+		pruned:  time.Now(),
+	}
+}
+
+// Query describes which proofs a caller wants
+type Query struct {
+	TenantID  uuid.UUID
+	Types     []string // empty means every type
+	EntityID  uuid.UUID
+	MediaType string
+	Limit     int
+}
+
+// Select returns up to q.Limit fresh proofs with Entity, User and Performance
+// loaded. When several types are selected their rotated lists are interleaved.
+func (s *Service) Select(q Query) ([]models.SocialProof, error) {
+	if q.Limit <= 0 {
+		q.Limit = 20
+	}
+
+	policies, err := s.policies(q.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := s.db.Preload("Entity").Preload("User").Preload("Performance", "variant_id IS NULL").
+		Where("tenant_id = ? AND archived_at IS NULL", q.TenantID)
+	if len(q.Types) > 0 {
+		query = query.Where("type IN ?", q.Types)
+	}
+	if q.EntityID != uuid.Nil {
+		query = query.Where("entity_id = ?", q.EntityID)
+	}
+	if q.MediaType != "" {
+		query = query.Where("media_type = ?", q.MediaType)
+	}
+
+	var candidates []models.SocialProof
+	if err := query.Order("created_at DESC").Limit(candidateLimit).Find(&candidates).Error; err != nil {
+		return nil, fmt.Errorf("failed to load social proofs: %w", err)
+	}
+
+	now := time.Now()
+	groups := make(map[string][]models.SocialProof)
+	var order []string
+	for _, proof := range candidates {
+		if ttl := TTL(policies.get(proof.Type)); ttl > 0 && proof.CreatedAt.Before(now.Add(-ttl)) {
+			continue
+		}
+		if _, ok := groups[proof.Type]; !ok {
+			order = append(order, proof.Type)
+		}
+		groups[proof.Type] = append(groups[proof.Type], proof)
+	}
+
+	for proofType, group := range groups {
+		policy := policies.get(proofType)
+		group = dedupe(group, time.Duration(policy.DedupeMinutes)*time.Minute)
+		groups[proofType] = s.rotate(q, policy, group, now)
+	}
+
+	return interleave(order, groups, q.Limit), nil
+}
+
+// dedupe keeps one proof per user and entity within the window. Proofs are
+// newest first, so the latest proof of a burst is the one kept.
+func dedupe(proofs []models.SocialProof, window time.Duration) []models.SocialProof {
+	if window <= 0 {
+		return proofs
+	}
+
+	kept := make([]models.SocialProof, 0, len(proofs))
+	last := make(map[string]time.Time)
+	for _, proof := range proofs {
+		if proof.UserID == uuid.Nil {
+			kept = append(kept, proof)
+			continue
+		}
+		key := proof.UserID.String() + ":" + proof.EntityID.String()
+		if seen, ok := last[key]; ok && seen.Sub(proof.CreatedAt) < window {
+			continue
+		}
+		last[key] = proof.CreatedAt
+		kept = append(kept, proof)
+	}
+	return kept
+}
+
+func (s *Service) rotate(q Query, policy models.ProofPolicy, proofs []models.SocialProof, now time.Time) []models.SocialProof {
+	switch policy.Rotation {
+	case RotationWeightedRandom:
+		return s.weightedRandom(policy, proofs, now)
+	case RotationRoundRobin:
+		return s.roundRobin(q, policy.Type, proofs)
+	case RotationBestPerforming:
+		sort.SliceStable(proofs, func(i, j int) bool {
+			a, b := proofs[i].Performance, proofs[j].Performance
+			if a.EngagementRate != b.EngagementRate {
+				return a.EngagementRate > b.EngagementRate
+			}
+			return a.Views > b.Views
+		})
+		return proofs
+	default:
+		return proofs
+	}
+}
+
+// weightedRandom shuffles proofs favouring fresh and engaging ones. A proof's
+// weight halves every half-life (half the TTL, or a day without one).
+func (s *Service) weightedRandom(policy models.ProofPolicy, proofs []models.SocialProof, now time.Time) []models.SocialProof {
+	halfLife := TTL(policy) / 2
+	if halfLife <= 0 {
+		halfLife = 24 * time.Hour
+	}
+
+	keys := make(map[uuid.UUID]float64, len(proofs))
+	s.mu.Lock()
+	for _, proof := range proofs {
+		age := now.Sub(proof.CreatedAt)
+		weight := math.Exp2(-age.Hours()/halfLife.Hours()) * (1 + proof.Performance.EngagementRate)
+		// Efraimidis-Spirakis: sorting by u^(1/w) samples without replacement by weight
+		keys[proof.ID] = math.Pow(s.rand.Float64(), 1/math.Max(weight, 1e-9))
+	}
+	s.mu.Unlock()
+
+	sort.SliceStable(proofs, func(i, j int) bool { return keys[proofs[i].ID] > keys[proofs[j].ID] })
+	return proofs
+}
+
+// roundRobin starts each call where the previous one stopped, so repeated
+// requests cycle through every fresh proof
+func (s *Service) roundRobin(q Query, proofType string, proofs []models.SocialProof) []models.SocialProof {
+	if len(proofs) == 0 {
+		return proofs
+	}
+
+	key := q.TenantID.String() + ":" + proofType + ":" + q.EntityID.String()
+
+	now := time.Now()
+	s.mu.Lock()
+	start := s.cursors[key].next % len(proofs)
+	step := q.Limit
+	if step > len(proofs) {
+		step = len(proofs)
+	}
+	s.cursors[key] = cursor{next: start + step, used: now}
+	s.pruneCursors(now)
+	s.mu.Unlock()
+
+	rotated := make([]models.SocialProof, 0, len(proofs))
+	rotated = append(rotated, proofs[start:]...)
+	return append(rotated, proofs[:start]...)
+}
+
+// pruneCursors forgets positions unused for cursorIdle, so entities that stop
+// being viewed do not keep their entry. Callers hold s.mu.
+func (s *Service) pruneCursors(now time.Time) {
+	if now.Sub(s.pruned) < cursorIdle {
+		return
+	}
+	for key, c := range s.cursors {
+		if now.Sub(c.used) >= cursorIdle {
+			delete(s.cursors, key)
+		}
+	}
+	s.pruned = now
+}
+
+func interleave(order []string, groups map[string][]models.SocialProof, limit int) []models.SocialProof {
+	result := make([]models.SocialProof, 0, limit)
+	for i := 0; len(result) < limit; i++ {
+		added := false
+		for _, proofType := range order {
+			if group := groups[proofType]; i < len(group) {
+				result = append(result, group[i])
+				added = true
+				if len(result) == limit {
+					break
+				}
+			}
+		}
+		if !added {
+			break
+		}
+	}
+	return result
+}
+
+// Run archives expired proofs on the given interval until ctx is done
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := s.Archive(); err != nil {
+				log.Printf("Failed to archive expired proofs: %v", err)
+			} else if n > 0 {
+				log.Printf("Archived %d expired proofs", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package reports
+
+import (
+	"bytes"
+	"encoding/csv"
+	"html/template"
+	"strings"
+	"time"
+)
+
+var page = template.Must(template.New("report").Funcs(template.FuncMap{
+	"date": formatDate,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}}</title>
+</head>
+<body style="font-family: Helvetica, Arial, sans-serif; color: #222; max-width: 720px;">
+<h1 style="font-size: 22px;">{{.Name}}</h1>
+<p style="color: #666;">{{.Tenant}} &middot; {{date .PeriodStart .Location}} to {{date .PeriodEnd .Location}}</p>
+{{range .Sections}}
+<h2 style="font-size: 18px; border-bottom: 1px solid #ddd; padding-bottom: 4px;">{{.Title}}</h2>
+{{if .Stats}}<p>{{range $i, $stat := .Stats}}{{if $i}} &middot; {{end}}<strong>{{$stat.Value}}</strong> {{$stat.Label}}{{end}}</p>{{end}}
+{{if .Rows}}
+<table style="border-collapse: collapse; width: 100%; font-size: 14px;">
+<tr>{{range .Columns}}<th style="text-align: left; padding: 4px 8px; background: #f4f4f4;">{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}<td style="padding: 4px 8px; border-top: 1px solid #eee;">{{.}}</td>{{end}}</tr>
+{{end}}</table>
+{{else if not .Stats}}<p style="color: #666;">Nothing to report for this period.</p>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+func formatDate(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("Mon 2 Jan 2006 15:04 MST")
+}
+
+// HTML renders the report as a standalone page suitable for an email body
+func (r *Report) HTML() (string, error) {
+	var buf bytes.Buffer
+	if err := page.Execute(&buf, r); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// CSV renders the report as one file. Every row starts with its section's
+// key; a section's headline figures come first as label, value pairs,
+// followed by its table's header and rows.
+func (r *Report) CSV() (string, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	for _, section := range r.Sections {
+		for _, stat := range section.Stats {
+			if err := w.Write([]string{section.Key, stat.Label, stat.Value}); err != nil {
+				return "", err
+			}
+		}
+		if len(section.Rows) == 0 {
+			continue
+		}
+		if err := w.Write(append([]string{section.Key}, section.Columns...)); err != nil {
+			return "", err
+		}
+		for _, row := range section.Rows {
+			if err := w.Write(append([]string{section.Key}, row...)); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	w.Flush()
+	return buf.String(), w.Error()
+}
+
+// Filename names a downloaded or attached report, e.g.
+// "weekly-digest-2024-03-04.csv". Only ASCII letters and digits are kept so
+// the name is safe in a Content-Disposition header.
+func Filename(name string, periodEnd time.Time, ext string) string {
+	var slug strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			slug.WriteRune(r)
+			dash = false
+		} else if !dash && slug.Len() > 0 {
+			slug.WriteByte('-')
+			dash = true
+		}
+	}
+	base := strings.TrimSuffix(slug.String(), "-")
+	if base == "" {
+		base = "report"
+	}
+	return base + "-" + periodEnd.Format("2006-01-02") + "." + ext
+}
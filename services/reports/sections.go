@@ -0,0 +1,384 @@
+package reports
+
+import (
+	"errors"
+	"fmt"
+	"nyasah-backend/models"
+	"nyasah-backend/services/analytics"
+	"nyasah-backend/services/timeframe"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Sections a report definition can include
+const (
+	SectionTopEntities     = "top_entities"
+	SectionNewReviews      = "new_reviews"
+	SectionSentimentChange = "sentiment_change"
+	SectionProofConversion = "proof_conversion"
+	SectionRecommendations = "recommendations"
+)
+
+// Sections lists every section in the order reports show them
+var Sections = []string{
+	SectionTopEntities,
+	SectionNewReviews,
+	SectionSentimentChange,
+	SectionProofConversion,
+	SectionRecommendations,
+}
+
+var ErrInvalidSection = errors.New("sections must be top_entities, new_reviews, sentiment_change, proof_conversion or recommendations")
+
+const (
+	topEntities      = 10
+	latestReviews    = 5
+	sentimentChanges = 10
+	recommendations  = 5
+	excerptLength    = 140
+)
+
+// Stat is a single headline figure of a section
+type Stat struct {
+	Label string
+	Value string
+}
+
+// Section is one part of a report: headline figures followed by a table
+type Section struct {
+	Key     string
+	Title   string
+	Stats   []Stat
+	Columns []string
+	Rows    [][]string
+}
+
+// Report is a generated report, ready to be rendered
+type Report struct {
+	Name        string
+	Tenant      string
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+	Location    *time.Location
+	Sections    []Section
+}
+
+type builder func(s *Service, tenantID uuid.UUID, start, end time.Time) (Section, error)
+
+var builders = map[string]builder{
+	SectionTopEntities:     (*Service).topEntities,
+	SectionNewReviews:      (*Service).newReviews,
+	SectionSentimentChange: (*Service).sentimentChange,
+	SectionProofConversion: (*Service).proofConversion,
+	SectionRecommendations: (*Service).recommendations,
+}
+
+// Build generates the definition's sections for the period [start, end)
+func (s *Service) Build(def models.ReportDefinition, start, end time.Time) (*Report, error) {
+	var tenant models.Tenant
+	if err := s.db.Select("id", "name", "settings").First(&tenant, "id = ?", def.TenantID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load tenant: %w", err)
+	}
+
+	report := &Report{
+		Name:        def.Name,
+		Tenant:      tenant.Name,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Location:    timeframe.TenantLocation(tenant.Settings),
+	}
+	for _, key := range def.Sections {
+		build, ok := builders[key]
+		if !ok {
+			return nil, ErrInvalidSection
+		}
+		section, err := build(s, def.TenantID, start, end)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build %s: %w", key, err)
+		}
+		section.Key = key
+		report.Sections = append(report.Sections, section)
+	}
+	return report, nil
+}
+
+type entityReviews struct {
+	EntityID uuid.UUID
+	Name     string
+	Reviews  int64
+	Rating   float64
+}
+
+func (s *Service) topEntities(tenantID uuid.UUID, start, end time.Time) (Section, error) {
+	var rows []entityReviews
+	err := s.db.Table("reviews").
+		Select("reviews.entity_id, entities.name, COUNT(*) AS reviews, AVG(reviews.rating) AS rating").
+		Joins("LEFT JOIN entities ON entities.id = reviews.entity_id").
+		Where("reviews.tenant_id = ? AND reviews.created_at >= ? AND reviews.created_at < ?", tenantID, start, end).
+		Group("reviews.entity_id, entities.name").
+		Order("reviews DESC, rating DESC").
+		Limit(topEntities).
+		Scan(&rows).Error
+	if err != nil {
+		return Section{}, err
+	}
+
+	section := Section{
+		Title:   "Top entities",
+		Columns: []string{"Entity", "Reviews", "Average rating"},
+	}
+	for _, row := range rows {
+		section.Rows = append(section.Rows, []string{
+			entityName(row.Name, row.EntityID),
+			strconv.FormatInt(row.Reviews, 10),
+			fmt.Sprintf("%.2f", row.Rating),
+		})
+	}
+	return section, nil
+}
+
+func (s *Service) newReviews(tenantID uuid.UUID, start, end time.Time) (Section, error) {
+	var counts []struct {
+		Rating  int
+		Reviews int64
+	}
+	err := s.db.Model(&models.Review{}).
+		Select("rating, COUNT(*) AS reviews").
+		Where("tenant_id = ? AND created_at >= ? AND created_at < ?", tenantID, start, end).
+		Group("rating").
+		Scan(&counts).Error
+	if err != nil {
+		return Section{}, err
+	}
+
+	var total, ratingSum int64
+	distribution := make(map[int]int64)
+	for _, c := range counts {
+		total += c.Reviews
+		ratingSum += int64(c.Rating) * c.Reviews
+		distribution[c.Rating] += c.Reviews
+	}
+
+	section := Section{
+		Title: "New reviews",
+		Stats: []Stat{{"Reviews", strconv.FormatInt(total, 10)}},
+	}
+	if total == 0 {
+		return section, nil
+	}
+	section.Stats = append(section.Stats, Stat{"Average rating", fmt.Sprintf("%.2f", float64(ratingSum)/float64(total))})
+	for rating := 5; rating >= 1; rating-- {
+		section.Stats = append(section.Stats, Stat{fmt.Sprintf("%d stars", rating), strconv.FormatInt(distribution[rating], 10)})
+	}
+
+	var latest []models.Review
+	err = s.db.Preload("Entity").
+		Where("tenant_id = ? AND created_at >= ? AND created_at < ?", tenantID, start, end).
+		Order("created_at DESC").
+		Limit(latestReviews).
+		Find(&latest).Error
+	if err != nil {
+		return Section{}, err
+	}
+
+	section.Columns = []string{"Entity", "Rating", "Review"}
+	for _, review := range latest {
+		section.Rows = append(section.Rows, []string{
+			entityName(review.Entity.Name, review.EntityID),
+			strconv.Itoa(review.Rating),
+			excerpt(review.Content),
+		})
+	}
+	return section, nil
+}
+
+type entitySentiment struct {
+	EntityID  uuid.UUID
+	Name      string
+	Reviews   int64
+	Sentiment float64
+}
+
+func (s *Service) averageSentiment(tenantID uuid.UUID, start, end time.Time) (map[uuid.UUID]entitySentiment, error) {
+	var rows []entitySentiment
+	err := s.db.Table("reviews").
+		Select("reviews.entity_id, entities.name, COUNT(*) AS reviews, AVG(reviews.sentiment) AS sentiment").
+		Joins("LEFT JOIN entities ON entities.id = reviews.entity_id").
+		Where("reviews.tenant_id = ? AND reviews.enriched_at IS NOT NULL AND reviews.created_at >= ? AND reviews.created_at < ?", tenantID, start, end).
+		Group("reviews.entity_id, entities.name").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	byEntity := make(map[uuid.UUID]entitySentiment, len(rows))
+	for _, row := range rows {
+		byEntity[row.EntityID] = row
+	}
+	return byEntity, nil
+}
+
+// overall weights each entity's average by its number of reviews
+func overall(byEntity map[uuid.UUID]entitySentiment) (float64, int64) {
+	var sum float64
+	var reviews int64
+	for _, row := range byEntity {
+		sum += row.Sentiment * float64(row.Reviews)
+		reviews += row.Reviews
+	}
+	if reviews == 0 {
+		return 0, 0
+	}
+	return sum / float64(reviews), reviews
+}
+
+// sentimentChange compares average sentiment with the period of the same
+// length immediately before, listing the entities that fell furthest first
+func (s *Service) sentimentChange(tenantID uuid.UUID, start, end time.Time) (Section, error) {
+	current, err := s.averageSentiment(tenantID, start, end)
+	if err != nil {
+		return Section{}, err
+	}
+	previous, err := s.averageSentiment(tenantID, start.Add(-end.Sub(start)), start)
+	if err != nil {
+		return Section{}, err
+	}
+
+	section := Section{Title: "Sentiment change"}
+	now, analyzed := overall(current)
+	before, analyzedBefore := overall(previous)
+	if analyzed == 0 {
+		section.Stats = []Stat{{"Analyzed reviews", "0"}}
+		return section, nil
+	}
+	section.Stats = []Stat{
+		{"Sentiment", fmt.Sprintf("%.2f", now)},
+		{"Analyzed reviews", strconv.FormatInt(analyzed, 10)},
+	}
+	if analyzedBefore > 0 {
+		section.Stats = append(section.Stats,
+			Stat{"Previous period", fmt.Sprintf("%.2f", before)},
+			Stat{"Change", fmt.Sprintf("%+.2f", now-before)},
+		)
+	}
+
+	type change struct {
+		entitySentiment
+		previous float64
+	}
+	var changes []change
+	for id, row := range current {
+		if prev, ok := previous[id]; ok {
+			changes = append(changes, change{row, prev.Sentiment})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		di := changes[i].Sentiment - changes[i].previous
+		dj := changes[j].Sentiment - changes[j].previous
+		if di != dj {
+			return di < dj
+		}
+		return changes[i].EntityID.String() < changes[j].EntityID.String()
+	})
+	if len(changes) > sentimentChanges {
+		changes = changes[:sentimentChanges]
+	}
+
+	section.Columns = []string{"Entity", "Sentiment", "Previous", "Change", "Reviews"}
+	for _, c := range changes {
+		section.Rows = append(section.Rows, []string{
+			entityName(c.Name, c.EntityID),
+			fmt.Sprintf("%.2f", c.Sentiment),
+			fmt.Sprintf("%.2f", c.previous),
+			fmt.Sprintf("%+.2f", c.Sentiment-c.previous),
+			strconv.FormatInt(c.Reviews, 10),
+		})
+	}
+	return section, nil
+}
+
+func (s *Service) proofConversion(tenantID uuid.UUID, start, end time.Time) (Section, error) {
+	granularity := "hour"
+	if end.Sub(start) > 31*24*time.Hour {
+		granularity = "day"
+	}
+	result, err := s.analytics.Report(analytics.Query{
+		TenantID:    tenantID,
+		From:        start,
+		To:          end,
+		Granularity: granularity,
+		GroupBy:     []string{analytics.GroupType},
+	})
+	if err != nil {
+		return Section{}, err
+	}
+
+	totals := result.Totals
+	section := Section{
+		Title: "Proof conversion",
+		Stats: []Stat{
+			{"Impressions", strconv.FormatInt(totals.Impressions, 10)},
+			{"Clicks", strconv.FormatInt(totals.Clicks, 10)},
+			{"Conversions", strconv.FormatInt(totals.Conversions, 10)},
+			{"Click-through rate", percent(totals.ClickThroughRate)},
+			{"Conversion rate", percent(totals.ConversionRate)},
+		},
+		Columns: []string{"Proof type", "Impressions", "Clicks", "Conversions", "Conversion rate", "Revenue"},
+	}
+	for _, series := range result.Series {
+		m := series.Totals
+		section.Rows = append(section.Rows, []string{
+			series.Group[analytics.GroupType],
+			strconv.FormatInt(m.Impressions, 10),
+			strconv.FormatInt(m.Clicks, 10),
+			strconv.FormatInt(m.Conversions, 10),
+			percent(m.ConversionRate),
+			fmt.Sprintf("%.2f", m.Revenue),
+		})
+	}
+	return section, nil
+}
+
+// recommendations lists the latest stored AI recommendations, whenever they
+// were made
+func (s *Service) recommendations(tenantID uuid.UUID, _, end time.Time) (Section, error) {
+	var list []models.AIRecommendation
+	err := s.db.Where("tenant_id = ? AND created_at < ?", tenantID, end).
+		Order("created_at DESC").
+		Limit(recommendations).
+		Find(&list).Error
+	if err != nil {
+		return Section{}, err
+	}
+
+	section := Section{
+		Title:   "AI recommendations",
+		Columns: []string{"Type", "Suggestion", "Confidence"},
+	}
+	for _, rec := range list {
+		section.Rows = append(section.Rows, []string{rec.Type, rec.Suggestion, percent(rec.Confidence)})
+	}
+	return section, nil
+}
+
+func entityName(name string, id uuid.UUID) string {
+	if name == "" {
+		return id.String()
+	}
+	return name
+}
+
+func excerpt(content string) string {
+	runes := []rune(content)
+	if len(runes) <= excerptLength {
+		return content
+	}
+	return string(runes[:excerptLength]) + "…"
+}
+
+func percent(rate float64) string {
+	return fmt.Sprintf("%.1f%%", rate*100)
+}
@@ -0,0 +1,310 @@
+package reports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"nyasah-backend/models"
+	"nyasah-backend/services/analytics"
+	"nyasah-backend/services/jobs"
+	"nyasah-backend/services/mail"
+	"nyasah-backend/services/timeframe"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TypeRun generates one report run and emails it to the definition's
+// recipients
+const TypeRun = "report.run"
+
+// MaxPeriod bounds how far back a single run looks
+const MaxPeriod = 31 * 24 * time.Hour
+
+var (
+	ErrNeverRuns = errors.New("schedule never fires")
+	ErrNoQueue   = errors.New("report jobs are not registered")
+)
+
+type RunPayload struct {
+	DefinitionID uuid.UUID `json:"definition_id"`
+	PeriodStart  time.Time `json:"period_start"`
+	PeriodEnd    time.Time `json:"period_end"`
+}
+
+// Service schedules report definitions, generates their runs and emails them
+type Service struct {
+	db        *gorm.DB
+	analytics *analytics.Service
+	mailer    mail.Mailer
+	jobs      *jobs.Queue
+}
+
+// NewService creates the reports service. Runs are only generated once
+// RegisterJobs has been called.
+func NewService(db *gorm.DB, mailer mail.Mailer) *Service {
+	return &Service{db: db, analytics: analytics.NewService(db), mailer: mailer}
+}
+
+// RegisterJobs registers report generation with the queue
+func (s *Service) RegisterJobs(q *jobs.Queue) {
+	s.jobs = q
+	q.Register(TypeRun, s.runJob)
+}
+
+// Normalize validates a definition's schedule and sections, defaulting to
+// every section
+func Normalize(def *models.ReportDefinition) error {
+	if _, err := ParseSchedule(def.Schedule); err != nil {
+		return err
+	}
+	if len(def.Sections) == 0 {
+		def.Sections = append([]string(nil), Sections...)
+	}
+
+	seen := make(map[string]bool, len(def.Sections))
+	sections := def.Sections[:0]
+	for _, key := range def.Sections {
+		if _, ok := builders[key]; !ok {
+			return ErrInvalidSection
+		}
+		if !seen[key] {
+			seen[key] = true
+			sections = append(sections, key)
+		}
+	}
+	def.Sections = sections
+	return nil
+}
+
+// Location returns the time zone the tenant's schedules are read in
+func (s *Service) Location(tenantID uuid.UUID) (*time.Location, error) {
+	var tenant models.Tenant
+	if err := s.db.Select("id", "settings").First(&tenant, "id = ?", tenantID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load tenant: %w", err)
+	}
+	return timeframe.TenantLocation(tenant.Settings), nil
+}
+
+// Reschedule sets when an enabled definition next runs after now. Disabled
+// definitions are not scheduled.
+func (s *Service) Reschedule(def *models.ReportDefinition, now time.Time) error {
+	if !def.Enabled {
+		def.NextRunAt = nil
+		return nil
+	}
+
+	schedule, err := ParseSchedule(def.Schedule)
+	if err != nil {
+		return err
+	}
+	loc, err := s.Location(def.TenantID)
+	if err != nil {
+		return err
+	}
+	next := schedule.Next(now, loc)
+	if next.IsZero() {
+		return ErrNeverRuns
+	}
+	next = next.UTC()
+	def.NextRunAt = &next
+	return nil
+}
+
+// periodStart returns where a run ending at end starts: the end of the last
+// scheduled run, or when there is none, as far back as the gap to the
+// following scheduled run. Either way no more than MaxPeriod.
+func periodStart(def models.ReportDefinition, schedule *Schedule, loc *time.Location, end time.Time) time.Time {
+	start := end.Add(-MaxPeriod)
+	if def.LastRunAt != nil && def.LastRunAt.Before(end) {
+		if def.LastRunAt.After(start) {
+			start = *def.LastRunAt
+		}
+	} else if next := schedule.Next(end, loc); !next.IsZero() && next.Sub(end) < MaxPeriod {
+		start = end.Add(-next.Sub(end))
+	}
+	return start.UTC()
+}
+
+// Trigger queues a run of the definition for the period ending at end
+func (s *Service) Trigger(def models.ReportDefinition, end time.Time) (*models.Job, error) {
+	if s.jobs == nil {
+		return nil, ErrNoQueue
+	}
+
+	schedule, err := ParseSchedule(def.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := s.Location(def.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	end = end.UTC().Truncate(time.Second)
+	payload := RunPayload{
+		DefinitionID: def.ID,
+		PeriodStart:  periodStart(def, schedule, loc, end),
+		PeriodEnd:    end,
+	}
+	key := def.ID.String() + ":" + strconv.FormatInt(end.Unix(), 10)
+	return s.jobs.Enqueue(def.TenantID, TypeRun, key, payload)
+}
+
+// Dispatch queues a run for every definition that is due and schedules its
+// next run. Runs missed while nothing was dispatching are collapsed into one.
+func (s *Service) Dispatch(now time.Time) (int, error) {
+	var due []models.ReportDefinition
+	if err := s.db.Where("enabled = ? AND next_run_at <= ?", true, now.UTC()).Find(&due).Error; err != nil {
+		return 0, fmt.Errorf("failed to load due reports: %w", err)
+	}
+
+	queued := 0
+	for _, def := range due {
+		end := *def.NextRunAt
+		if _, err := s.Trigger(def, end); err != nil {
+			log.Printf("Failed to queue report %s: %v", def.ID, err)
+			continue
+		}
+		queued++
+
+		lastRun := end.UTC()
+		def.LastRunAt = &lastRun
+		if err := s.Reschedule(&def, now); err != nil {
+			log.Printf("Failed to schedule report %s: %v", def.ID, err)
+			def.NextRunAt = nil
+		}
+		if err := s.db.Model(&def).Updates(map[string]interface{}{
+			"last_run_at": def.LastRunAt,
+			"next_run_at": def.NextRunAt,
+		}).Error; err != nil {
+			return queued, fmt.Errorf("failed to schedule report %s: %w", def.ID, err)
+		}
+	}
+	return queued, nil
+}
+
+// Run dispatches due reports every interval until ctx is cancelled
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := s.Dispatch(time.Now()); err != nil {
+			log.Printf("Failed to dispatch reports: %v", err)
+		} else if n > 0 {
+			log.Printf("Queued %d reports", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Generate returns the definition's run for the period, building and storing
+// it the first time
+func (s *Service) Generate(def models.ReportDefinition, start, end time.Time) (*models.ReportRun, error) {
+	start, end = start.UTC(), end.UTC()
+
+	var run models.ReportRun
+	err := s.db.Where("definition_id = ? AND period_end = ?", def.ID, end).First(&run).Error
+	if err == nil {
+		return &run, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to load report run: %w", err)
+	}
+
+	report, err := s.Build(def, start, end)
+	if err != nil {
+		return nil, err
+	}
+	html, err := report.HTML()
+	if err != nil {
+		return nil, fmt.Errorf("failed to render report: %w", err)
+	}
+	csv, err := report.CSV()
+	if err != nil {
+		return nil, fmt.Errorf("failed to render report: %w", err)
+	}
+
+	run = models.ReportRun{
+		TenantID:     def.TenantID,
+		DefinitionID: def.ID,
+		PeriodStart:  start,
+		PeriodEnd:    end,
+		HTML:         html,
+		CSV:          csv,
+	}
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&run)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to store report run: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		// generated concurrently by another worker
+		if err := s.db.Where("definition_id = ? AND period_end = ?", def.ID, end).First(&run).Error; err != nil {
+			return nil, fmt.Errorf("failed to load report run: %w", err)
+		}
+	}
+	return &run, nil
+}
+
+func (s *Service) runJob(ctx context.Context, job models.Job) error {
+	var payload RunPayload
+	if err := jobs.Decode(job, &payload); err != nil {
+		return err
+	}
+
+	var def models.ReportDefinition
+	if err := s.db.First(&def, "id = ?", payload.DefinitionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+
+	run, err := s.Generate(def, payload.PeriodStart, payload.PeriodEnd)
+	if err != nil {
+		return err
+	}
+	if run.DeliveredAt != nil || len(def.Recipients) == 0 || s.mailer == nil {
+		return nil
+	}
+
+	if err := s.deliver(ctx, def, *run); err != nil {
+		return err
+	}
+	now := time.Now()
+	return s.db.Model(run).Update("delivered_at", now).Error
+}
+
+// deliver emails a run with the HTML report as the body and the CSV attached
+func (s *Service) deliver(ctx context.Context, def models.ReportDefinition, run models.ReportRun) error {
+	loc, err := s.Location(def.TenantID)
+	if err != nil {
+		return err
+	}
+	end := run.PeriodEnd.In(loc)
+
+	text := fmt.Sprintf("%s for %s to %s.\n\nThe full report is attached as CSV and can be downloaded with GET /api/reports/runs/%s/download\n",
+		def.Name, formatDate(run.PeriodStart, loc), formatDate(run.PeriodEnd, loc), run.ID)
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      def.Recipients,
+		Subject: fmt.Sprintf("[Nyasah] %s, %s", def.Name, end.Format("2 Jan 2006")),
+		Text:    text,
+		HTML:    run.HTML,
+		Attachments: []mail.Attachment{{
+			Filename:    Filename(def.Name, end, "csv"),
+			ContentType: "text/csv",
+			Data:        []byte(run.CSV),
+		}},
+	})
+}
@@ -0,0 +1,273 @@
+package retrieval
+
+import (
+	"context"
+	"fmt"
+	"nyasah-backend/models"
+	"nyasah-backend/services/ai/providers"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultMaxReviews  = 20
+	DefaultTokenBudget = 3000
+
+	maxEntities    = 5
+	maxProofs      = 5
+	maxSourceChars = 1200 // longer texts are cut, so one review cannot take the whole budget
+)
+
+// Source types
+const (
+	SourceReview = "review"
+	SourceEntity = "entity"
+	SourceProof  = "proof"
+)
+
+type Options struct {
+	MaxReviews  int // reviews kept from the searches; defaults to DefaultMaxReviews
+	TokenBudget int // estimated prompt tokens the sources may use; defaults to DefaultTokenBudget
+}
+
+// Retriever selects the reviews, proofs and entities of a tenant that are
+// relevant to a question, for the provider to answer from
+type Retriever struct {
+	db       *gorm.DB
+	provider providers.Provider
+	opts     Options
+}
+
+func NewRetriever(db *gorm.DB, provider providers.Provider, opts Options) *Retriever {
+	if opts.MaxReviews <= 0 {
+		opts.MaxReviews = DefaultMaxReviews
+	}
+	if opts.TokenBudget <= 0 {
+		opts.TokenBudget = DefaultTokenBudget
+	}
+	return &Retriever{db: db, provider: provider, opts: opts}
+}
+
+// Source is one piece of tenant data given to the provider. The provider
+// cites it by its label, such as R1 for the first review.
+type Source struct {
+	Label  string    `json:"label"`
+	Type   string    `json:"type"`
+	ID     uuid.UUID `json:"id"`
+	Entity string    `json:"entity,omitempty"` // name of the reviewed or proven entity
+	Rating int       `json:"rating,omitempty"`
+	Text   string    `json:"text"`
+}
+
+// line renders the source for the prompt
+func (s Source) line() string {
+	var details []string
+	details = append(details, s.Type)
+	if s.Rating > 0 {
+		details = append(details, fmt.Sprintf("%d/5 stars", s.Rating))
+	}
+	if s.Entity != "" {
+		details = append(details, s.Entity)
+	}
+	return fmt.Sprintf("[%s] (%s) %s", s.Label, strings.Join(details, ", "), s.Text)
+}
+
+type Result struct {
+	Sources []Source
+	Tokens  int // estimated prompt tokens of the sources
+	Omitted int // relevant sources left out to stay within the token budget
+}
+
+// Context renders the sources for the prompt, one per line
+func (r Result) Context() string {
+	lines := make([]string, len(r.Sources))
+	for i, source := range r.Sources {
+		lines[i] = source.line()
+	}
+	return strings.Join(lines, "\n")
+}
+
+var citation = regexp.MustCompile(`\[([^\]]+)\]`)
+
+// Cited returns the sources an answer cites, in the order given to the
+// provider. Both [R1][R2] and [R1, R2] are understood.
+func (r Result) Cited(answer string) []Source {
+	labels := make(map[string]bool)
+	for _, match := range citation.FindAllStringSubmatch(answer, -1) {
+		for _, label := range strings.FieldsFunc(match[1], func(r rune) bool { return r == ',' || r == ' ' }) {
+			labels[label] = true
+		}
+	}
+
+	var cited []Source
+	for _, source := range r.Sources {
+		if labels[source.Label] {
+			cited = append(cited, source)
+		}
+	}
+	return cited
+}
+
+// ReviewIDs returns the IDs of the review sources
+func ReviewIDs(sources []Source) []uuid.UUID {
+	var ids []uuid.UUID
+	for _, source := range sources {
+		if source.Type == SourceReview {
+			ids = append(ids, source.ID)
+		}
+	}
+	return ids
+}
+
+// estimateTokens approximates the tokens of English text at four characters
+// each, close enough across providers to keep a prompt within budget
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+func truncate(text string, limit int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if len(text) <= limit {
+		return text
+	}
+	cut := strings.LastIndex(text[:limit], " ")
+	if cut <= 0 {
+		// No space to cut at, so cut at the start of the rune at the limit
+		cut = limit
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+	}
+	return text[:cut] + "…"
+}
+
+// Retrieve finds the reviews most relevant to the query by keyword and, if
+// the provider can embed, by meaning, along with the entities they are about
+// and matching proofs. When nothing matches, the newest reviews are used so
+// the answer is still grounded in the tenant's data. Sources are added in
+// order of relevance until the token budget is spent.
+func (r *Retriever) Retrieve(ctx context.Context, tenantID uuid.UUID, query string) (Result, error) {
+	db := r.db.WithContext(ctx)
+	terms := Terms(query)
+
+	ranked, err := r.search(ctx, tenantID, query, terms)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to search reviews: %w", err)
+	}
+
+	var reviews []models.Review
+	if len(ranked) > 0 {
+		var found []models.Review
+		err = db.Preload("Entity").
+			Where("tenant_id = ? AND status <> ? AND id IN ?", tenantID, "rejected", ranked).
+			Find(&found).Error
+		byID := make(map[uuid.UUID]models.Review, len(found))
+		for _, review := range found {
+			byID[review.ID] = review
+		}
+		for _, id := range ranked {
+			if review, ok := byID[id]; ok {
+				reviews = append(reviews, review)
+			}
+		}
+	} else {
+		err = db.Preload("Entity").
+			Where("tenant_id = ? AND status <> ?", tenantID, "rejected").
+			Order("created_at DESC").
+			Limit(r.opts.MaxReviews).
+			Find(&reviews).Error
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to load reviews: %w", err)
+	}
+
+	// Entities the question names, then those the reviews are about
+	var entities []models.Entity
+	if len(terms) > 0 {
+		condition, args := likeAny("name", terms)
+		if err := db.Where("tenant_id = ?", tenantID).Where(condition, args...).
+			Limit(maxEntities).Find(&entities).Error; err != nil {
+			return Result{}, fmt.Errorf("failed to load entities: %w", err)
+		}
+	}
+	seen := make(map[uuid.UUID]bool)
+	for _, entity := range entities {
+		seen[entity.ID] = true
+	}
+	for _, review := range reviews {
+		if len(entities) == maxEntities {
+			break
+		}
+		if review.Entity.ID != uuid.Nil && !seen[review.Entity.ID] {
+			seen[review.Entity.ID] = true
+			entities = append(entities, review.Entity)
+		}
+	}
+
+	var proofs []models.SocialProof
+	if len(terms) > 0 {
+		condition, args := likeAny("social_proofs.content", terms)
+		if err := db.Preload("Entity").
+			Where("social_proofs.tenant_id = ? AND social_proofs.archived_at IS NULL", tenantID).
+			Where(condition, args...).
+			Order("social_proofs.created_at DESC").
+			Limit(maxProofs).
+			Find(&proofs).Error; err != nil {
+			return Result{}, fmt.Errorf("failed to load proofs: %w", err)
+		}
+	}
+
+	return r.budget(reviews, entities, proofs), nil
+}
+
+// budget labels the sources and keeps as many as fit in the token budget,
+// reviews first since they carry what customers said
+func (r *Retriever) budget(reviews []models.Review, entities []models.Entity, proofs []models.SocialProof) Result {
+	var result Result
+	counts := make(map[string]int)
+	add := func(prefix string, source Source) {
+		source.Label = fmt.Sprintf("%s%d", prefix, counts[prefix]+1)
+		tokens := estimateTokens(source.line())
+		if result.Tokens+tokens > r.opts.TokenBudget {
+			result.Omitted++
+			return
+		}
+		counts[prefix]++
+		result.Tokens += tokens
+		result.Sources = append(result.Sources, source)
+	}
+
+	for _, review := range reviews {
+		add("R", Source{
+			Type:   SourceReview,
+			ID:     review.ID,
+			Entity: review.Entity.Name,
+			Rating: review.Rating,
+			Text:   truncate(review.Content, maxSourceChars),
+		})
+	}
+	for _, entity := range entities {
+		text := entity.Name + " (" + entity.Type + ")"
+		if entity.Description != "" {
+			text += ": " + entity.Description
+		}
+		add("E", Source{
+			Type: SourceEntity,
+			ID:   entity.ID,
+			Text: truncate(text, maxSourceChars),
+		})
+	}
+	for _, proof := range proofs {
+		add("P", Source{
+			Type:   SourceProof,
+			ID:     proof.ID,
+			Entity: proof.Entity.Name,
+			Text:   truncate(proof.Type+": "+proof.Content, maxSourceChars),
+		})
+	}
+	return result
+}
@@ -0,0 +1,226 @@
+package retrieval
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"nyasah-backend/models"
+	"nyasah-backend/services/ai/providers"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+const (
+	candidateLimit  = 200  // keyword matches loaded for ranking, newest first
+	vectorScanLimit = 5000 // newest review vectors compared with the query; older reviews are found by keyword only
+	rrfK            = 60   // damps the weight of top ranks when fusing searches
+)
+
+var stopWords = map[string]bool{
+	"a": true, "about": true, "all": true, "an": true, "and": true, "any": true, "are": true, "as": true,
+	"at": true, "be": true, "but": true, "by": true, "can": true, "do": true, "does": true, "for": true,
+	"from": true, "get": true, "has": true, "have": true, "how": true, "i": true, "in": true, "is": true,
+	"it": true, "its": true, "me": true, "most": true, "my": true, "of": true, "on": true, "or": true,
+	"our": true, "should": true, "so": true, "than": true, "that": true, "the": true, "their": true,
+	"them": true, "there": true, "they": true, "this": true, "to": true, "us": true, "was": true,
+	"we": true, "what": true, "when": true, "which": true, "who": true, "why": true, "with": true,
+	"you": true, "your": true,
+}
+
+var suffixes = []string{"ing", "ed", "es", "ly", "s"}
+
+// Terms returns the stems of a query's words, without stop words and
+// duplicates. Stems are matched as substrings, so "complaining" finds
+// "complained" and "complaints".
+func Terms(query string) []string {
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var terms []string
+	seen := make(map[string]bool)
+	for _, word := range words {
+		if len(word) < 3 || stopWords[word] {
+			continue
+		}
+		for _, suffix := range suffixes {
+			if strings.HasSuffix(word, suffix) && len(word)-len(suffix) >= 4 {
+				word = strings.TrimSuffix(word, suffix)
+				break
+			}
+		}
+		if !seen[word] {
+			seen[word] = true
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// likeAny builds a condition matching column against any of the terms
+func likeAny(column string, terms []string) (string, []interface{}) {
+	conditions := make([]string, len(terms))
+	args := make([]interface{}, len(terms))
+	for i, term := range terms {
+		conditions[i] = "LOWER(" + column + ") LIKE ?"
+		args[i] = "%" + term + "%"
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+// keywordSearch ranks the tenant's reviews that mention the terms. Terms
+// found in fewer reviews weigh more, and stored keywords count as mentions.
+func (r *Retriever) keywordSearch(ctx context.Context, tenantID uuid.UUID, terms []string) ([]uuid.UUID, error) {
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	condition, args := likeAny("content", terms)
+	var candidates []models.Review
+	err := r.db.WithContext(ctx).Select("id", "content", "keywords", "created_at").
+		Where("tenant_id = ? AND status <> ?", tenantID, "rejected").
+		Where(condition, args...).
+		Order("created_at DESC").
+		Limit(candidateLimit).
+		Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	mentions := make([]map[string]int, len(candidates))
+	frequency := make(map[string]int)
+	for i, review := range candidates {
+		text := strings.ToLower(review.Content + " " + strings.Join(review.Keywords, " "))
+		mentions[i] = make(map[string]int)
+		for _, term := range terms {
+			if n := strings.Count(text, term); n > 0 {
+				mentions[i][term] = n
+				frequency[term]++
+			}
+		}
+	}
+
+	scores := make([]float64, len(candidates))
+	for i := range candidates {
+		for term, n := range mentions[i] {
+			idf := math.Log(1 + float64(len(candidates))/float64(frequency[term]))
+			scores[i] += math.Min(float64(n), 3) * idf
+		}
+	}
+
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+	// Candidates are newest first, so ties keep recent reviews ahead
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+
+	ranked := make([]uuid.UUID, 0, r.opts.MaxReviews)
+	for _, i := range order {
+		if len(ranked) == r.opts.MaxReviews {
+			break
+		}
+		ranked = append(ranked, candidates[i].ID)
+	}
+	return ranked, nil
+}
+
+// vectorSearch ranks the tenant's embedded reviews by similarity to the
+// query. It finds nothing when the provider cannot embed.
+func (r *Retriever) vectorSearch(ctx context.Context, tenantID uuid.UUID, query string) ([]uuid.UUID, error) {
+	embeddings, err := providers.Embed(ctx, r.provider, []string{query})
+	if errors.Is(err, providers.ErrEmbeddingsUnsupported) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	target := embeddings.Vectors[0]
+
+	var stored []models.ReviewEmbedding
+	err = r.db.WithContext(ctx).Select("review_id", "vector").
+		Where("tenant_id = ? AND model = ?", tenantID, embeddings.Model).
+		Order("created_at DESC").
+		Limit(vectorScanLimit).
+		Find(&stored).Error
+	if err != nil {
+		return nil, err
+	}
+
+	similarity := make(map[uuid.UUID]float64, len(stored))
+	for _, embedding := range stored {
+		similarity[embedding.ReviewID] = cosine(target, embedding.Vector)
+	}
+	sort.SliceStable(stored, func(a, b int) bool {
+		return similarity[stored[a].ReviewID] > similarity[stored[b].ReviewID]
+	})
+
+	ranked := make([]uuid.UUID, 0, r.opts.MaxReviews)
+	for _, embedding := range stored {
+		if len(ranked) == r.opts.MaxReviews || similarity[embedding.ReviewID] <= 0 {
+			break
+		}
+		ranked = append(ranked, embedding.ReviewID)
+	}
+	return ranked, nil
+}
+
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// fuse merges rankings by reciprocal rank, so a review near the top of
+// either search, or fairly high in both, comes first
+func fuse(limit int, rankings ...[]uuid.UUID) []uuid.UUID {
+	scores := make(map[uuid.UUID]float64)
+	var order []uuid.UUID
+	for _, ranking := range rankings {
+		for rank, id := range ranking {
+			if _, ok := scores[id]; !ok {
+				order = append(order, id)
+			}
+			scores[id] += 1 / float64(rrfK+rank+1)
+		}
+	}
+
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+	if len(order) > limit {
+		order = order[:limit]
+	}
+	return order
+}
+
+// search finds the reviews most relevant to the query. Vector search
+// failures are logged and the keyword results used alone.
+func (r *Retriever) search(ctx context.Context, tenantID uuid.UUID, query string, terms []string) ([]uuid.UUID, error) {
+	keyword, err := r.keywordSearch(ctx, tenantID, terms)
+	if err != nil {
+		return nil, err
+	}
+
+	vector, err := r.vectorSearch(ctx, tenantID, query)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Printf("Vector search failed for tenant %s: %v", tenantID, err)
+	}
+
+	return fuse(r.opts.MaxReviews, keyword, vector), nil
+}
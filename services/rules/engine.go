@@ -0,0 +1,157 @@
+package rules
+
+import (
+	"fmt"
+	"nyasah-backend/models"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// sessionTTL is how long a visitor session's frequency counters are kept
+const sessionTTL = 30 * time.Minute
+
+// Decision is the outcome of evaluating a tenant's rules for a visitor
+type Decision struct {
+	Show       bool       `json:"show"`
+	ProofTypes []string   `json:"proof_types,omitempty"` // empty means any type
+	RuleID     *uuid.UUID `json:"rule_id,omitempty"`
+	RuleName   string     `json:"rule_name,omitempty"`
+	Reason     string     `json:"reason"`
+}
+
+// Allows reports whether the decision permits showing a proof type
+func (d Decision) Allows(proofType string) bool {
+	if !d.Show {
+		return false
+	}
+	return len(d.ProofTypes) == 0 || containsFold(d.ProofTypes, proofType)
+}
+
+// TraceEntry explains why a rule did or did not apply, for debugging
+type TraceEntry struct {
+	RuleID   uuid.UUID `json:"rule_id"`
+	Name     string    `json:"name"`
+	Priority int       `json:"priority"`
+	Matched  bool      `json:"matched"`
+	Failed   string    `json:"failed_condition,omitempty"`
+}
+
+type Engine struct {
+	db       *gorm.DB
+	mu       sync.Mutex
+	sessions map[string]*sessionCounts
+}
+
+type sessionCounts struct {
+	shown   map[uuid.UUID]int
+	expires time.Time
+}
+
+func NewEngine(db *gorm.DB) *Engine {
+	return &Engine{db: db, sessions: make(map[string]*sessionCounts)}
+}
+
+// Decide evaluates the rules for a visitor and, when a capped rule matches,
+// counts the impression against the visitor's session
+func (e *Engine) Decide(tenantID uuid.UUID, visitor Visitor) (Decision, error) {
+	decision, _, err := e.evaluate(tenantID, visitor, true)
+	return decision, err
+}
+
+// Evaluate is a dry run of Decide that also returns a per-rule trace
+func (e *Engine) Evaluate(tenantID uuid.UUID, visitor Visitor) (Decision, []TraceEntry, error) {
+	return e.evaluate(tenantID, visitor, false)
+}
+
+func (e *Engine) evaluate(tenantID uuid.UUID, visitor Visitor, record bool) (Decision, []TraceEntry, error) {
+	if visitor.Device == "" && visitor.UserAgent != "" {
+		visitor.Device = DeviceFromUserAgent(visitor.UserAgent)
+	}
+
+	var rules []models.DisplayRule
+	if err := e.db.Where("tenant_id = ? AND enabled = ?", tenantID, true).Find(&rules).Error; err != nil {
+		return Decision{}, nil, fmt.Errorf("failed to load display rules: %w", err)
+	}
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].Priority > rules[j].Priority })
+
+	trace := make([]TraceEntry, 0, len(rules))
+	decision := Decision{Show: true, Reason: "no rule matched"}
+	decided := false
+
+	for _, rule := range rules {
+		entry := TraceEntry{RuleID: rule.ID, Name: rule.Name, Priority: rule.Priority}
+
+		if decided {
+			entry.Failed = "lower priority"
+			trace = append(trace, entry)
+			continue
+		}
+
+		if failed := mismatch(rule.Conditions, visitor); failed != "" {
+			entry.Failed = failed
+			trace = append(trace, entry)
+			continue
+		}
+
+		if rule.FrequencyCap > 0 && visitor.SessionID != "" && !e.underCap(visitor.SessionID, rule, record) {
+			entry.Failed = "frequency_cap"
+			trace = append(trace, entry)
+			continue
+		}
+
+		entry.Matched = true
+		trace = append(trace, entry)
+
+		ruleID := rule.ID
+		decision = Decision{
+			Show:       rule.Action != ActionHide,
+			ProofTypes: rule.ProofTypes,
+			RuleID:     &ruleID,
+			RuleName:   rule.Name,
+			Reason:     "matched rule",
+		}
+		decided = true
+	}
+
+	return decision, trace, nil
+}
+
+// underCap checks the session's impression count for a rule and increments it when record is set
+func (e *Engine) underCap(sessionID string, rule models.DisplayRule, record bool) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	key := rule.TenantID.String() + ":" + sessionID
+	counts, ok := e.sessions[key]
+	if !ok || now.After(counts.expires) {
+		counts = &sessionCounts{shown: make(map[uuid.UUID]int)}
+		e.sessions[key] = counts
+	}
+	counts.expires = now.Add(sessionTTL)
+
+	if counts.shown[rule.ID] >= rule.FrequencyCap {
+		return false
+	}
+	if record {
+		counts.shown[rule.ID]++
+		e.sweepLocked(now)
+	}
+	return true
+}
+
+func (e *Engine) sweepLocked(now time.Time) {
+	// Only sweep occasionally; sessions are small and the map is bounded by traffic
+	if len(e.sessions) < 10000 {
+		return
+	}
+	for key, counts := range e.sessions {
+		if now.After(counts.expires) {
+			delete(e.sessions, key)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package rules
+
+import (
+	"net/url"
+	"nyasah-backend/models"
+	"path"
+	"strings"
+)
+
+const (
+	ActionShow = "show"
+	ActionHide = "hide"
+
+	VisitorNew       = "new"
+	VisitorReturning = "returning"
+)
+
+// Visitor describes who is looking at a widget and where
+type Visitor struct {
+	SessionID  string   `json:"session_id"`
+	URL        string   `json:"url"`
+	EntityType string   `json:"entity_type"`
+	Device     string   `json:"device"`
+	UserAgent  string   `json:"user_agent,omitempty"`
+	Country    string   `json:"country"`
+	Returning  bool     `json:"returning"`
+	CartValue  *float64 `json:"cart_value,omitempty"`
+}
+
+// mismatch returns the first condition the visitor fails, or "" when all match
+func mismatch(c models.RuleConditions, v Visitor) string {
+	if len(c.URLPatterns) > 0 && !matchURL(c.URLPatterns, v.URL) {
+		return "url_patterns"
+	}
+	if len(c.EntityTypes) > 0 && !containsFold(c.EntityTypes, v.EntityType) {
+		return "entity_types"
+	}
+	if len(c.Devices) > 0 && !containsFold(c.Devices, v.Device) {
+		return "devices"
+	}
+	if len(c.Countries) > 0 && !containsFold(c.Countries, v.Country) {
+		return "countries"
+	}
+	if c.VisitorType == VisitorNew && v.Returning {
+		return "visitor_type"
+	}
+	if c.VisitorType == VisitorReturning && !v.Returning {
+		return "visitor_type"
+	}
+	if c.MinCartValue != nil && (v.CartValue == nil || *v.CartValue < *c.MinCartValue) {
+		return "min_cart_value"
+	}
+	if c.MaxCartValue != nil && (v.CartValue == nil || *v.CartValue > *c.MaxCartValue) {
+		return "max_cart_value"
+	}
+	return ""
+}
+
+// matchURL matches the page path against glob patterns. A trailing "/*" also
+// matches everything below that path, e.g. "/products/*" matches "/products/a/b".
+func matchURL(patterns []string, raw string) bool {
+	p := raw
+	if u, err := url.Parse(raw); err == nil && u.Path != "" {
+		p = u.Path
+	}
+
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+		if prefix, found := strings.CutSuffix(pattern, "/*"); found && strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, v string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// DeviceFromUserAgent classifies a User-Agent as mobile, tablet or desktop
+func DeviceFromUserAgent(ua string) string {
+	ua = strings.ToLower(ua)
+	switch {
+	case strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet") ||
+		(strings.Contains(ua, "android") && !strings.Contains(ua, "mobile")):
+		return "tablet"
+	case strings.Contains(ua, "mobi") || strings.Contains(ua, "iphone") || strings.Contains(ua, "android"):
+		return "mobile"
+	default:
+		return "desktop"
+	}
+}
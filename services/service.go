@@ -1,77 +1,163 @@
 package services
 
 import (
+	"context"
+	"fmt"
 	"nyasah-backend/config"
 	"nyasah-backend/models"
 	"nyasah-backend/services/ai/analyzers"
 	"nyasah-backend/services/ai/factory"
+	"nyasah-backend/services/ai/providers"
 	"nyasah-backend/services/ai/recommenders"
+	"nyasah-backend/services/ai/utils"
+	"nyasah-backend/services/jobs"
+	"nyasah-backend/services/retrieval"
+	"nyasah-backend/services/timeframe"
 	"os"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// trendCacheTTL is how long computed trends are reused. Trends only change
+// as reviews are enriched and events aggregated, so a short TTL is enough.
+const trendCacheTTL = 5 * time.Minute
+
+type cachedTrends struct {
+	trends  map[string]interface{}
+	expires time.Time
+}
+
 type Service struct {
-	db          *gorm.DB
-	analyzer    *analyzers.ContentAnalyzer
-	recommender *recommenders.Recommender
-	config      *config.Config
+	db       *gorm.DB
+	provider providers.Provider
+	config   *config.Config
+
+	jobs *jobs.Queue
+
+	mu     sync.Mutex
+	trends map[string]cachedTrends
 }
 
 func NewAIService(db *gorm.DB, config *config.Config) *Service {
-	providerConfig := map[string]string{
-		"api_key":    os.Getenv("OPENAI_API_KEY"),
-		"model":      config.Model,
-		"server_url": os.Getenv("LLAMA_SERVER_URL"),
-	}
+	utils.InitializeDB(db)
 
-	provider, err := factory.CreateProvider(config.Provider, providerConfig)
+	provider, err := factory.CreateProvider(config.Provider, providerConfig(config))
 	if err != nil {
 		// Fallback to OpenAI if specified provider fails
 		config.Provider = factory.OpenAI
-		provider, _ = factory.CreateProvider(factory.OpenAI, providerConfig)
+		provider, _ = factory.CreateProvider(factory.OpenAI, providerConfig(config))
 	}
 
 	return &Service{
-		db:          db,
-		analyzer:    analyzers.NewContentAnalyzer(provider),
-		recommender: recommenders.NewRecommender(db, provider),
-		config:      config,
+		db:       db,
+		provider: provider,
+		config:   config,
+		trends:   make(map[string]cachedTrends),
 	}
 }
 
-func (s *Service) UpdateConfig(config *config.Config) error {
-	providerConfig := map[string]string{
-		"api_key":    os.Getenv("OPENAI_API_KEY"),
-		"model":      config.Model,
-		"server_url": os.Getenv("LLAMA_SERVER_URL"),
+// providerConfig collects the settings and credentials of the configured
+// provider for the factory
+func providerConfig(config *config.Config) map[string]string {
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if config.Provider == factory.Claude {
+		apiKey = os.Getenv("CLAUDE_API_KEY")
 	}
 
-	provider, err := factory.CreateProvider(config.Provider, providerConfig)
+	return map[string]string{
+		"api_key":     apiKey,
+		"model":       config.Model,
+		"max_tokens":  strconv.Itoa(config.MaxTokens),
+		"temperature": strconv.FormatFloat(config.Temperature, 'f', -1, 64),
+		"base_url":    os.Getenv("CLAUDE_BASE_URL"),
+		"server_url":  os.Getenv("LLAMA_SERVER_URL"),
+	}
+}
+
+func (s *Service) UpdateConfig(config *config.Config) error {
+	provider, err := factory.CreateProvider(config.Provider, providerConfig(config))
 	if err != nil {
 		return err
 	}
 
-	s.analyzer = analyzers.NewContentAnalyzer(provider)
-	s.recommender = recommenders.NewRecommender(s.db, provider)
+	s.provider = provider
 	s.config = config
 
 	return nil
 }
 
-func (s *Service) ProcessQuery(query string, tenantID string) (string, error) {
-	return s.analyzer.ProcessQuery(query, tenantID)
+// PingProvider checks that the configured AI provider can be reached
+func (s *Service) PingProvider(ctx context.Context) error {
+	return providers.Ping(ctx, s.provider)
+}
+
+func (s *Service) analyzer() *analyzers.ContentAnalyzer {
+	retriever := retrieval.NewRetriever(s.db, s.provider, retrieval.Options{TokenBudget: s.config.RetrievalTokenBudget})
+	return analyzers.NewContentAnalyzer(s.provider, retriever)
+}
+
+// recommenderFor returns a recommender whose queries run as part of the
+// request or job ctx belongs to
+func (s *Service) recommenderFor(ctx context.Context) *recommenders.Recommender {
+	return recommenders.NewRecommender(s.db.WithContext(ctx), s.provider)
 }
 
-func (s *Service) GenerateProductInsights(productID uuid.UUID) (models.ProductInsights, error) {
-	return s.recommender.GenerateInsights(productID)
+// ProcessQuery answers a query from the tenant's reviews, proofs and
+// entities, and returns the sources the answer was given
+func (s *Service) ProcessQuery(ctx context.Context, query string, tenantID uuid.UUID) (string, retrieval.Result, error) {
+	return s.analyzer().ProcessQuery(ctx, query, tenantID)
 }
 
-func (s *Service) GenerateRecommendations(tenantID uuid.UUID) ([]models.AIRecommendation, error) {
-	return s.recommender.GenerateRecommendations(tenantID)
+// StreamQuery answers a query chunk by chunk. Cancelling ctx aborts the
+// provider call.
+// Streams reports whether the provider sends answers as they are generated.
+// Llama and Hugging Face cannot stream, so their answer arrives as one chunk.
+func (s *Service) Streams() bool {
+	return s.config.Provider == factory.OpenAI || s.config.Provider == factory.Claude
 }
 
-func (s *Service) AnalyzeTrends(tenantID uuid.UUID) (map[string]interface{}, error) {
-	return s.analyzer.AnalyzeTrends(tenantID.String())
+func (s *Service) StreamQuery(ctx context.Context, query string, tenantID uuid.UUID) (providers.Stream, retrieval.Result, error) {
+	return s.analyzer().StreamQuery(ctx, query, tenantID)
+}
+
+func (s *Service) GenerateProductInsights(ctx context.Context, productID uuid.UUID) (models.ProductInsights, error) {
+	return s.recommenderFor(ctx).GenerateInsights(productID)
+}
+
+func (s *Service) GenerateRecommendations(ctx context.Context, tenantID uuid.UUID) ([]models.AIRecommendation, error) {
+	return s.recommenderFor(ctx).GenerateRecommendations(tenantID)
+}
+
+// AnalyzeTrends returns trends for a validated spec, reusing results computed
+// within the last few minutes
+func (s *Service) AnalyzeTrends(ctx context.Context, tenantID uuid.UUID, spec timeframe.Spec) (map[string]interface{}, error) {
+	key := fmt.Sprintf("%s|%d|%d|%s|%s", tenantID, spec.From.Unix(), spec.To.Unix(), spec.Granularity, spec.Location)
+
+	s.mu.Lock()
+	cached, ok := s.trends[key]
+	s.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.trends, nil
+	}
+
+	trends, err := s.analyzer().AnalyzeTrends(ctx, tenantID.String(), spec)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	now := time.Now()
+	for k, entry := range s.trends {
+		if now.After(entry.expires) {
+			delete(s.trends, k)
+		}
+	}
+	s.trends[key] = cachedTrends{trends: trends, expires: now.Add(trendCacheTTL)}
+	s.mu.Unlock()
+
+	return trends, nil
 }
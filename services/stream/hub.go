@@ -0,0 +1,160 @@
+package stream
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrTooManyConnections is returned when a tenant has reached its connection cap
+var ErrTooManyConnections = errors.New("too many stream connections for tenant")
+
+// Event is a single message pushed to storefront feeds
+type Event struct {
+	ID        uint64      `json:"id"`
+	TenantID  uuid.UUID   `json:"-"`
+	EntityID  uuid.UUID   `json:"entity_id"`
+	Type      string      `json:"type"`
+	Data      interface{} `json:"data"`
+	CreatedAt time.Time   `json:"created_at"`
+	Transient bool        `json:"-"` // not kept for replay, e.g. state updates where only the latest matters
+}
+
+// Subscription receives events for one tenant, optionally narrowed to an entity.
+// Events is closed when the subscriber falls too far behind or the hub drops it;
+// clients are expected to reconnect with the last event ID they saw.
+type Subscription struct {
+	Events   <-chan Event
+	events   chan Event
+	tenantID uuid.UUID
+	entityID uuid.UUID
+	once     sync.Once
+}
+
+type Options struct {
+	MaxConnectionsPerTenant int
+	BufferSize              int // per subscriber channel size
+	ReplaySize              int // events kept per tenant for last-event-id replay
+}
+
+// Hub is an in-process pub/sub for social proof events
+type Hub struct {
+	mu          sync.Mutex
+	opts        Options
+	nextID      uint64
+	subscribers map[uuid.UUID]map[*Subscription]struct{}
+	history     map[uuid.UUID][]Event
+}
+
+func NewHub(opts Options) *Hub {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 64
+	}
+	if opts.ReplaySize <= 0 {
+		opts.ReplaySize = 256
+	}
+
+	return &Hub{
+		opts: opts,
+		// Seed IDs from the clock so they keep increasing across restarts and a
+		// stale last-event-id never hides new events
+		nextID:      uint64(time.Now().UnixMilli()) * 1000,
+		subscribers: make(map[uuid.UUID]map[*Subscription]struct{}),
+		history:     make(map[uuid.UUID][]Event),
+	}
+}
+
+// Publish stores the event for replay and fans it out to matching subscribers
+func (h *Hub) Publish(event Event) Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nextID++
+	event.ID = h.nextID
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	if !event.Transient {
+		history := append(h.history[event.TenantID], event)
+		if len(history) > h.opts.ReplaySize {
+			history = history[len(history)-h.opts.ReplaySize:]
+		}
+		h.history[event.TenantID] = history
+	}
+
+	for sub := range h.subscribers[event.TenantID] {
+		if !sub.matches(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			// Backpressure: a full buffer means the client is not keeping up.
+			// Drop it so it reconnects and replays from its last event ID.
+			h.removeLocked(sub)
+		}
+	}
+
+	return event
+}
+
+// Subscribe registers a new subscriber and returns the events published after
+// lastEventID that are still held for replay
+func (h *Hub) Subscribe(tenantID, entityID uuid.UUID, lastEventID uint64) (*Subscription, []Event, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.opts.MaxConnectionsPerTenant > 0 && len(h.subscribers[tenantID]) >= h.opts.MaxConnectionsPerTenant {
+		return nil, nil, ErrTooManyConnections
+	}
+
+	events := make(chan Event, h.opts.BufferSize)
+	sub := &Subscription{Events: events, events: events, tenantID: tenantID, entityID: entityID}
+
+	if h.subscribers[tenantID] == nil {
+		h.subscribers[tenantID] = make(map[*Subscription]struct{})
+	}
+	h.subscribers[tenantID][sub] = struct{}{}
+
+	var replay []Event
+	if lastEventID > 0 {
+		for _, event := range h.history[tenantID] {
+			if event.ID > lastEventID && sub.matches(event) {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	return sub, replay, nil
+}
+
+// Unsubscribe removes the subscriber and closes its channel
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(sub)
+}
+
+// Connections returns the number of open subscribers for a tenant
+func (h *Hub) Connections(tenantID uuid.UUID) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers[tenantID])
+}
+
+func (h *Hub) removeLocked(sub *Subscription) {
+	if subs, ok := h.subscribers[sub.tenantID]; ok {
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(h.subscribers, sub.tenantID)
+		}
+	}
+	sub.once.Do(func() { close(sub.events) })
+}
+
+func (s *Subscription) matches(event Event) bool {
+	return s.entityID == uuid.Nil || s.entityID == event.EntityID
+}
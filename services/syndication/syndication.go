@@ -0,0 +1,148 @@
+package syndication
+
+import (
+	"fmt"
+	"nyasah-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ReviewStatusApproved is the only moderation state that is shown or syndicated
+const ReviewStatusApproved = "approved"
+
+type Service struct {
+	db *gorm.DB
+}
+
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// SyndicatedReview is a review as displayed on an entity, marked with where it was posted
+type SyndicatedReview struct {
+	models.Review
+	OriginEntityID uuid.UUID  `json:"origin_entity_id"`
+	Syndicated     bool       `json:"syndicated"`
+	GroupID        *uuid.UUID `json:"syndication_group_id,omitempty"`
+}
+
+// RatingSummary is the aggregate rating shown for an entity
+type RatingSummary struct {
+	EntityID         uuid.UUID `json:"entity_id"`
+	ReviewCount      int64     `json:"review_count"`
+	AverageRating    float64   `json:"average_rating"`
+	SyndicatedCount  int64     `json:"syndicated_count"`
+	CountsSyndicated bool      `json:"counts_syndicated"`
+}
+
+// siblings maps each sibling entity to the enabled group that links it to entityID
+func (s *Service) siblings(tenantID, entityID uuid.UUID) (map[uuid.UUID]models.SyndicationGroup, error) {
+	var groups []models.SyndicationGroup
+	err := s.db.
+		Joins("JOIN syndication_members ON syndication_members.group_id = syndication_groups.id").
+		Where("syndication_groups.tenant_id = ? AND syndication_groups.enabled = ? AND syndication_members.entity_id = ?", tenantID, true, entityID).
+		Preload("Members").
+		Find(&groups).Error
+	if err != nil {
+		return nil, err
+	}
+
+	siblings := make(map[uuid.UUID]models.SyndicationGroup)
+	for _, group := range groups {
+		for _, member := range group.Members {
+			if member.EntityID == entityID {
+				continue
+			}
+			// An entity can sit in several groups; aggregate counting wins if any group allows it
+			if existing, ok := siblings[member.EntityID]; ok && existing.CountInAggregates {
+				continue
+			}
+			siblings[member.EntityID] = group
+		}
+	}
+
+	return siblings, nil
+}
+
+// ListReviews returns the approved reviews of the entity plus those syndicated
+// from its siblings, newest first.
+func (s *Service) ListReviews(tenantID, entityID uuid.UUID) ([]SyndicatedReview, error) {
+	siblings, err := s.siblings(tenantID, entityID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load syndication groups: %w", err)
+	}
+
+	entityIDs := []uuid.UUID{entityID}
+	for id := range siblings {
+		entityIDs = append(entityIDs, id)
+	}
+
+	var reviews []models.Review
+	err = s.db.Where("tenant_id = ? AND entity_id IN ? AND status = ?", tenantID, entityIDs, ReviewStatusApproved).
+		Order("created_at DESC").
+		Find(&reviews).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch reviews: %w", err)
+	}
+
+	result := make([]SyndicatedReview, 0, len(reviews))
+	for _, review := range reviews {
+		item := SyndicatedReview{Review: review, OriginEntityID: review.EntityID}
+		if group, ok := siblings[review.EntityID]; ok {
+			groupID := group.ID
+			item.Syndicated = true
+			item.GroupID = &groupID
+		}
+		result = append(result, item)
+	}
+
+	return result, nil
+}
+
+// Summarize computes the rating aggregate for an entity, including syndicated
+// reviews only from groups configured to count them.
+func (s *Service) Summarize(tenantID, entityID uuid.UUID) (RatingSummary, error) {
+	summary := RatingSummary{EntityID: entityID}
+
+	siblings, err := s.siblings(tenantID, entityID)
+	if err != nil {
+		return summary, fmt.Errorf("failed to load syndication groups: %w", err)
+	}
+
+	entityIDs := []uuid.UUID{entityID}
+	for id, group := range siblings {
+		if group.CountInAggregates {
+			entityIDs = append(entityIDs, id)
+		}
+	}
+	summary.CountsSyndicated = len(entityIDs) > 1
+
+	var rows []struct {
+		EntityID uuid.UUID
+		Count    int64
+		Total    float64
+	}
+	err = s.db.Model(&models.Review{}).
+		Select("entity_id, COUNT(*) AS count, SUM(rating) AS total").
+		Where("tenant_id = ? AND entity_id IN ? AND status = ?", tenantID, entityIDs, ReviewStatusApproved).
+		Group("entity_id").
+		Scan(&rows).Error
+	if err != nil {
+		return summary, fmt.Errorf("failed to aggregate reviews: %w", err)
+	}
+
+	var total float64
+	for _, row := range rows {
+		summary.ReviewCount += row.Count
+		total += row.Total
+		if row.EntityID != entityID {
+			summary.SyndicatedCount += row.Count
+		}
+	}
+	if summary.ReviewCount > 0 {
+		summary.AverageRating = total / float64(summary.ReviewCount)
+	}
+
+	return summary, nil
+}
@@ -0,0 +1,105 @@
+package templates
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Vars are the placeholder values available to a template
+type Vars map[string]string
+
+// Format expands placeholders in body. Two forms are supported:
+//
+//	{first_name} just bought {entity_name}
+//	{count, plural, =0 {nobody} one {# person} other {# people}} bought this
+//
+// Unknown placeholders expand to an empty string.
+func Format(body string, vars Vars, locale string) string {
+	var out strings.Builder
+
+	for i := 0; i < len(body); i++ {
+		if body[i] != '{' {
+			out.WriteByte(body[i])
+			continue
+		}
+
+		end := matchingBrace(body, i)
+		if end < 0 {
+			// Unbalanced brace, keep the rest verbatim
+			out.WriteString(body[i:])
+			break
+		}
+
+		out.WriteString(expand(body[i+1:end], vars, locale))
+		i = end
+	}
+
+	return out.String()
+}
+
+func expand(inner string, vars Vars, locale string) string {
+	parts := strings.SplitN(inner, ",", 3)
+	if len(parts) == 3 && strings.TrimSpace(parts[1]) == "plural" {
+		return expandPlural(strings.TrimSpace(parts[0]), parts[2], vars, locale)
+	}
+	return vars[strings.TrimSpace(inner)]
+}
+
+func expandPlural(name, cases string, vars Vars, locale string) string {
+	n, err := strconv.Atoi(vars[name])
+	if err != nil {
+		n = 0
+	}
+
+	options := parseCases(cases)
+	text, ok := options["="+strconv.Itoa(n)]
+	if !ok {
+		text, ok = options[PluralCategory(locale, n)]
+	}
+	if !ok {
+		text = options["other"]
+	}
+
+	text = strings.ReplaceAll(text, "#", strconv.Itoa(n))
+	return Format(text, vars, locale)
+}
+
+// parseCases reads "one {..} other {..}" into a selector -> text map
+func parseCases(s string) map[string]string {
+	options := make(map[string]string)
+
+	for i := 0; i < len(s); {
+		start := strings.IndexByte(s[i:], '{')
+		if start < 0 {
+			break
+		}
+		start += i
+
+		end := matchingBrace(s, start)
+		if end < 0 {
+			break
+		}
+
+		key := strings.TrimSpace(s[i:start])
+		options[key] = s[start+1 : end]
+		i = end + 1
+	}
+
+	return options
+}
+
+func matchingBrace(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,78 @@
+package templates
+
+import (
+	"fmt"
+	"time"
+)
+
+// phrases holds the few built-in strings templates can't supply themselves
+type phrases struct {
+	Someone string
+	JustNow string
+	Minutes map[string]string // plural category -> format with %d
+	Hours   map[string]string
+	Days    map[string]string
+}
+
+var localePhrases = map[string]phrases{
+	"en": {
+		Someone: "Someone",
+		JustNow: "just now",
+		Minutes: map[string]string{"one": "%d minute ago", "other": "%d minutes ago"},
+		Hours:   map[string]string{"one": "%d hour ago", "other": "%d hours ago"},
+		Days:    map[string]string{"one": "%d day ago", "other": "%d days ago"},
+	},
+	"fr": {
+		Someone: "Quelqu'un",
+		JustNow: "à l'instant",
+		Minutes: map[string]string{"one": "il y a %d minute", "other": "il y a %d minutes"},
+		Hours:   map[string]string{"one": "il y a %d heure", "other": "il y a %d heures"},
+		Days:    map[string]string{"one": "il y a %d jour", "other": "il y a %d jours"},
+	},
+	"de": {
+		Someone: "Jemand",
+		JustNow: "gerade eben",
+		Minutes: map[string]string{"one": "vor %d Minute", "other": "vor %d Minuten"},
+		Hours:   map[string]string{"one": "vor %d Stunde", "other": "vor %d Stunden"},
+		Days:    map[string]string{"one": "vor %d Tag", "other": "vor %d Tagen"},
+	},
+	"es": {
+		Someone: "Alguien",
+		JustNow: "justo ahora",
+		Minutes: map[string]string{"one": "hace %d minuto", "other": "hace %d minutos"},
+		Hours:   map[string]string{"one": "hace %d hora", "other": "hace %d horas"},
+		Days:    map[string]string{"one": "hace %d día", "other": "hace %d días"},
+	},
+}
+
+func phrasesFor(locale string) phrases {
+	if p, ok := localePhrases[baseLanguage(locale)]; ok {
+		return p
+	}
+	return localePhrases["en"]
+}
+
+// TimeAgo formats the time elapsed since t in the given locale
+func TimeAgo(t time.Time, now time.Time, locale string) string {
+	p := phrasesFor(locale)
+	elapsed := now.Sub(t)
+
+	pick := func(forms map[string]string, n int) string {
+		format, ok := forms[PluralCategory(locale, n)]
+		if !ok {
+			format = forms["other"]
+		}
+		return fmt.Sprintf(format, n)
+	}
+
+	switch {
+	case elapsed < time.Minute:
+		return p.JustNow
+	case elapsed < time.Hour:
+		return pick(p.Minutes, int(elapsed/time.Minute))
+	case elapsed < 24*time.Hour:
+		return pick(p.Hours, int(elapsed/time.Hour))
+	default:
+		return pick(p.Days, int(elapsed/(24*time.Hour)))
+	}
+}
@@ -0,0 +1,68 @@
+package templates
+
+import (
+	"strings"
+)
+
+// PluralCategory returns the CLDR plural category of n for a locale. Only the
+// rule families needed by the languages we serve are implemented; unknown
+// languages fall back to the English rule.
+func PluralCategory(locale string, n int) string {
+	if n < 0 {
+		n = -n
+	}
+
+	switch baseLanguage(locale) {
+	case "ja", "zh", "ko", "th", "vi", "id":
+		return "other"
+	case "fr", "hi":
+		if n == 0 || n == 1 {
+			return "one"
+		}
+		return "other"
+	case "pt":
+		if locale == "pt" || strings.EqualFold(locale, "pt-BR") {
+			if n == 0 || n == 1 {
+				return "one"
+			}
+			return "other"
+		}
+		if n == 1 {
+			return "one"
+		}
+		return "other"
+	case "ru", "uk":
+		mod10, mod100 := n%10, n%100
+		switch {
+		case mod10 == 1 && mod100 != 11:
+			return "one"
+		case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+			return "few"
+		default:
+			return "many"
+		}
+	case "pl":
+		mod10, mod100 := n%10, n%100
+		switch {
+		case n == 1:
+			return "one"
+		case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+			return "few"
+		default:
+			return "many"
+		}
+	default:
+		if n == 1 {
+			return "one"
+		}
+		return "other"
+	}
+}
+
+func baseLanguage(locale string) string {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	if i := strings.Index(locale, "-"); i > 0 {
+		return locale[:i]
+	}
+	return locale
+}
@@ -0,0 +1,214 @@
+package templates
+
+import (
+	"encoding/json"
+	"fmt"
+	"nyasah-backend/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	NameFull         = "full"
+	NameFirst        = "first"
+	NameFirstInitial = "first_initial"
+	NameAnonymous    = "anonymous"
+
+	defaultLocale = "en"
+)
+
+type Service struct {
+	db *gorm.DB
+}
+
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// RenderProofs replaces each proof's Content with its template rendered for
+// locale. Proofs without a matching template keep the content they were
+// created with.
+func (s *Service) RenderProofs(tenantID uuid.UUID, proofs []models.SocialProof, locale string) error {
+	if len(proofs) == 0 {
+		return nil
+	}
+
+	var tmpls []models.ProofTemplate
+	if err := s.db.Where("tenant_id = ?", tenantID).Find(&tmpls).Error; err != nil {
+		return fmt.Errorf("failed to load proof templates: %w", err)
+	}
+
+	return s.render(tenantID, proofs, locale, tmpls)
+}
+
+// RenderProofsWithBody renders every proof with body instead of the tenant's
+// stored templates, e.g. for an experiment variant
+func (s *Service) RenderProofsWithBody(tenantID uuid.UUID, proofs []models.SocialProof, locale, body string) error {
+	if len(proofs) == 0 {
+		return nil
+	}
+
+	tmpls := make([]models.ProofTemplate, 0, len(proofs))
+	for _, proof := range proofs {
+		tmpls = append(tmpls, models.ProofTemplate{Type: proof.Type, Locale: defaultLocale, Body: body, NameStyle: NameFirstInitial})
+	}
+
+	return s.render(tenantID, proofs, locale, tmpls)
+}
+
+func (s *Service) render(tenantID uuid.UUID, proofs []models.SocialProof, locale string, tmpls []models.ProofTemplate) error {
+	if len(tmpls) == 0 {
+		return nil
+	}
+
+	tenantLocale := s.DefaultLocale(tenantID)
+	if locale == "" {
+		locale = tenantLocale
+	}
+
+	entityNames, err := s.entityNames(proofs)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for i := range proofs {
+		tmpl, ok := pickTemplate(tmpls, proofs[i].Type, locale, tenantLocale)
+		if !ok {
+			continue
+		}
+		vars := ProofVars(proofs[i], entityNames[proofs[i].EntityID], tmpl.NameStyle, locale, now)
+		proofs[i].Content = Format(tmpl.Body, vars, locale)
+	}
+
+	return nil
+}
+
+// ProofVars builds the placeholder values for a proof
+func ProofVars(proof models.SocialProof, entityName, nameStyle, locale string, now time.Time) Vars {
+	vars := make(Vars)
+	for key, value := range proof.Metadata {
+		switch v := value.(type) {
+		case string:
+			vars[key] = v
+		case float64:
+			vars[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			b, _ := json.Marshal(v)
+			vars[key] = string(b)
+		}
+	}
+
+	first, last := vars["first_name"], vars["last_name"]
+	if first == "" {
+		fullName := vars["name"]
+		if fullName == "" {
+			fullName = proof.User.Name
+		}
+		if fields := strings.Fields(fullName); len(fields) > 0 {
+			first = fields[0]
+			last = strings.Join(fields[1:], " ")
+		}
+	}
+
+	vars["name"] = DisplayName(first, last, nameStyle, locale)
+	if nameStyle == NameAnonymous {
+		vars["first_name"] = vars["name"]
+		vars["last_name"] = ""
+	}
+	vars["entity_name"] = entityName
+	vars["time_ago"] = TimeAgo(proof.CreatedAt, now, locale)
+
+	return vars
+}
+
+// DisplayName applies a template's name anonymization style
+func DisplayName(first, last, style, locale string) string {
+	if first == "" || style == NameAnonymous {
+		return phrasesFor(locale).Someone
+	}
+
+	switch style {
+	case NameFull:
+		return strings.TrimSpace(first + " " + last)
+	case NameFirst:
+		return first
+	default:
+		if last == "" {
+			return first
+		}
+		return first + " " + strings.ToUpper(string([]rune(last)[:1])) + "."
+	}
+}
+
+// pickTemplate finds the best template for a type: exact locale, then the
+// base language, then the tenant's default locale, then English
+func pickTemplate(tmpls []models.ProofTemplate, proofType, locale, tenantLocale string) (models.ProofTemplate, bool) {
+	candidates := []string{strings.ToLower(locale), baseLanguage(locale), strings.ToLower(tenantLocale), defaultLocale}
+
+	for _, candidate := range candidates {
+		for _, tmpl := range tmpls {
+			if tmpl.Type == proofType && strings.ToLower(tmpl.Locale) == candidate {
+				return tmpl, true
+			}
+		}
+	}
+
+	return models.ProofTemplate{}, false
+}
+
+// DefaultLocale returns the tenant's "default_locale" setting, or English
+func (s *Service) DefaultLocale(tenantID uuid.UUID) string {
+	var tenant models.Tenant
+	if err := s.db.Select("settings").First(&tenant, "id = ?", tenantID).Error; err != nil || len(tenant.Settings) == 0 {
+		return defaultLocale
+	}
+
+	var settings struct {
+		DefaultLocale string `json:"default_locale"`
+	}
+	if err := json.Unmarshal(tenant.Settings, &settings); err != nil || settings.DefaultLocale == "" {
+		return defaultLocale
+	}
+	return settings.DefaultLocale
+}
+
+func (s *Service) entityNames(proofs []models.SocialProof) (map[uuid.UUID]string, error) {
+	names := make(map[uuid.UUID]string)
+
+	var ids []uuid.UUID
+	for _, proof := range proofs {
+		if proof.Entity.ID != uuid.Nil {
+			names[proof.EntityID] = proof.Entity.Name
+			continue
+		}
+		ids = append(ids, proof.EntityID)
+	}
+	if len(ids) == 0 {
+		return names, nil
+	}
+
+	var entities []models.Entity
+	if err := s.db.Select("id", "name").Where("id IN ?", ids).Find(&entities).Error; err != nil {
+		return nil, fmt.Errorf("failed to load entity names: %w", err)
+	}
+	for _, entity := range entities {
+		names[entity.ID] = entity.Name
+	}
+
+	return names, nil
+}
+
+// LocaleFromHeader returns the first language tag of an Accept-Language header
+func LocaleFromHeader(header string) string {
+	if header == "" {
+		return ""
+	}
+	tag := strings.Split(header, ",")[0]
+	tag = strings.Split(tag, ";")[0]
+	return strings.TrimSpace(tag)
+}
@@ -0,0 +1,166 @@
+package timeframe
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	Hour  = "hour"
+	Day   = "day"
+	Week  = "week"
+	Month = "month"
+)
+
+// MaxFrames bounds how many frames a single range may be split into
+const MaxFrames = 1000
+
+var (
+	ErrInvalidGranularity = errors.New("granularity must be hour, day, week or month")
+	ErrInvalidRange       = errors.New("from must be before to")
+	ErrInvalidTimeZone    = errors.New("unknown time zone")
+	ErrTooManyFrames      = fmt.Errorf("range and granularity exceed %d buckets", MaxFrames)
+)
+
+// Frame is one calendar-aligned bucket, from Start (inclusive) to End (exclusive)
+type Frame struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Spec describes a time range split into calendar buckets in a time zone
+type Spec struct {
+	From        time.Time
+	To          time.Time // exclusive
+	Granularity string
+	Location    *time.Location
+}
+
+// Validate fills in defaults and widens the range to whole buckets
+func (s *Spec) Validate() error {
+	switch s.Granularity {
+	case Hour, Day, Week, Month:
+	case "":
+		s.Granularity = Day
+	default:
+		return ErrInvalidGranularity
+	}
+	if s.Location == nil {
+		s.Location = time.UTC
+	}
+	if !s.From.Before(s.To) {
+		return ErrInvalidRange
+	}
+
+	s.From = Start(s.From, s.Granularity, s.Location)
+	if end := Start(s.To, s.Granularity, s.Location); end.Before(s.To) {
+		s.To = Next(end, s.Granularity)
+	}
+
+	n := 0
+	for start := s.From; start.Before(s.To); start = Next(start, s.Granularity) {
+		if n++; n > MaxFrames {
+			return ErrTooManyFrames
+		}
+	}
+	return nil
+}
+
+// Last returns a spec covering n buckets, ending with the one that contains
+// the instant before to. Like Spec.To, to is exclusive, so the range ending
+// at a bucket boundary does not add the bucket that starts there.
+func Last(n int, to time.Time, granularity string, loc *time.Location) Spec {
+	if loc == nil {
+		loc = time.UTC
+	}
+	last := Start(to.Add(-time.Nanosecond), granularity, loc)
+	start := last
+	for i := 1; i < n; i++ {
+		start = Start(start.Add(-time.Nanosecond), granularity, loc)
+	}
+	return Spec{From: start, To: Next(last, granularity), Granularity: granularity, Location: loc}
+}
+
+// Frames splits a validated spec into consecutive frames, oldest first
+func (s Spec) Frames() []Frame {
+	var frames []Frame
+	for start := s.From; start.Before(s.To); start = Next(start, s.Granularity) {
+		frames = append(frames, Frame{Start: start, End: Next(start, s.Granularity)})
+	}
+	return frames
+}
+
+// Index returns the position of the frame containing t, or -1 when t is
+// outside every frame. frames must be in order, as returned by Frames.
+func Index(frames []Frame, t time.Time) int {
+	i := sort.Search(len(frames), func(i int) bool { return frames[i].End.After(t) })
+	if i == len(frames) || t.Before(frames[i].Start) {
+		return -1
+	}
+	return i
+}
+
+// Start returns the start of the bucket containing t in loc. Weeks start on Monday.
+func Start(t time.Time, granularity string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	switch granularity {
+	case Hour:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+	case Week:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case Month:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	}
+}
+
+// Next returns the start of the bucket after the one starting at start.
+// Days, weeks and months follow the calendar, so they may be 23 or 25 hours
+// long across daylight saving changes.
+func Next(start time.Time, granularity string) time.Time {
+	if granularity == Hour {
+		return start.Add(time.Hour)
+	}
+	y, m, d := start.Date()
+	switch granularity {
+	case Week:
+		return time.Date(y, m, d+7, 0, 0, 0, 0, start.Location())
+	case Month:
+		return time.Date(y, m+1, 1, 0, 0, 0, 0, start.Location())
+	default:
+		return time.Date(y, m, d+1, 0, 0, 0, 0, start.Location())
+	}
+}
+
+// LoadLocation resolves an IANA time zone name, treating "" as UTC
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, ErrInvalidTimeZone
+	}
+	return loc, nil
+}
+
+// TenantLocation returns the "time_zone" from tenant settings, or UTC when it
+// is missing or not a known zone
+func TenantLocation(settings json.RawMessage) *time.Location {
+	var parsed struct {
+		TimeZone string `json:"time_zone"`
+	}
+	if len(settings) == 0 || json.Unmarshal(settings, &parsed) != nil {
+		return time.UTC
+	}
+	loc, err := LoadLocation(parsed.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
@@ -0,0 +1,133 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ExporterNone   = ""       // spans are not recorded, but trace context is still passed on
+	ExporterStdout = "stdout" // spans are printed as JSON, for local use
+	ExporterOTLP   = "otlp"   // spans are sent over OTLP/HTTP to OTEL_EXPORTER_OTLP_ENDPOINT
+)
+
+const instrumentation = "nyasah-backend"
+
+// Span attributes shared across HTTP, database and AI provider spans
+const (
+	TenantKey            = attribute.Key("tenant.id")
+	InputTokensKey       = attribute.Key("gen_ai.usage.input_tokens")
+	OutputTokensKey      = attribute.Key("gen_ai.usage.output_tokens")
+	ProviderKey          = attribute.Key("ai.provider")
+	ProviderOperationKey = attribute.Key("ai.operation")
+)
+
+type Options struct {
+	Exporter    string  // one of the Exporter constants
+	ServiceName string  // reported as service.name unless OTEL_SERVICE_NAME is set
+	SampleRatio float64 // share of new traces recorded; traces started upstream follow the caller's decision
+}
+
+// Setup installs the global tracer provider and W3C trace context
+// propagation. The returned function flushes buffered spans and must be
+// called before the process exits.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch opts.Exporter {
+	case ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q, use %q or %q", opts.Exporter, ExporterStdout, ExporterOTLP)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", opts.Exporter, err)
+	}
+
+	serviceName := opts.ServiceName
+	if serviceName == "" {
+		serviceName = instrumentation
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", serviceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer for the server's own spans
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+type tenantKey struct{}
+
+// WithTenant records the tenant a request or job acts for on its span and on
+// every span started from the returned context
+func WithTenant(ctx context.Context, tenantID uuid.UUID) context.Context {
+	trace.SpanFromContext(ctx).SetAttributes(TenantKey.String(tenantID.String()))
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// Tenant returns the tenant set with WithTenant
+func Tenant(ctx context.Context) (uuid.UUID, bool) {
+	tenantID, ok := ctx.Value(tenantKey{}).(uuid.UUID)
+	return tenantID, ok
+}
+
+// Start starts a span, tagged with the context's tenant if it has one
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if tenantID, ok := Tenant(ctx); ok {
+		attrs = append(attrs, TenantKey.String(tenantID.String()))
+	}
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends a span, marking it failed when err is set
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// AddTokens records the tokens a provider reported on the context's span
+func AddTokens(ctx context.Context, prompt, completion int) {
+	trace.SpanFromContext(ctx).SetAttributes(
+		InputTokensKey.Int(prompt),
+		OutputTokensKey.Int(completion),
+	)
+}
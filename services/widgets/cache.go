@@ -0,0 +1,49 @@
+package widgets
+
+import (
+	"sync"
+	"time"
+)
+
+type cacheEntry struct {
+	widget  Widget
+	expires time.Time
+}
+
+// cache keeps rendered widgets in memory so repeated storefront page loads do
+// not hit the database
+type cache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[string]cacheEntry
+}
+
+func newCache(ttl time.Duration) *cache {
+	return &cache{ttl: ttl, entries: make(map[string]cacheEntry)}
+}
+
+func (c *cache) get(key string) (Widget, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return Widget{}, false
+	}
+	return entry.widget, true
+}
+
+func (c *cache) set(key string, widget Widget) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Drop expired entries opportunistically so the map does not grow unbounded
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+
+	c.entries[key] = cacheEntry{widget: widget, expires: now.Add(c.ttl)}
+}
@@ -0,0 +1,169 @@
+package widgets
+
+import (
+	"strings"
+)
+
+// loaderTemplate is served to storefronts as /widget/loader.js. It looks for
+// elements such as <div data-nyasah-widget="badge" data-entity-id="..."></div>
+// and fills them with rendered widgets.
+const loaderTemplate = `(function () {
+  var base = "{{BASE_URL}}";
+  var key = "{{WIDGET_KEY}}";
+
+  var css = ".nyasah-toasts{position:fixed;z-index:9999;display:flex;flex-direction:column;gap:8px}" +
+    ".nyasah-bottom-left{left:16px;bottom:16px}.nyasah-bottom-right{right:16px;bottom:16px}" +
+    ".nyasah-top-left{left:16px;top:16px}.nyasah-top-right{right:16px;top:16px}" +
+    ".nyasah-toast{padding:12px 16px;box-shadow:0 2px 8px rgba(0,0,0,.15);max-width:320px}" +
+    ".nyasah-carousel{display:flex;gap:12px;overflow-x:auto;scroll-snap-type:x mandatory}" +
+    ".nyasah-review{flex:0 0 280px;margin:0;padding:16px;scroll-snap-align:start;box-shadow:0 1px 4px rgba(0,0,0,.1)}" +
+    ".nyasah-badge,.nyasah-viewers{display:inline-block;padding:4px 8px}";
+  var style = document.createElement("style");
+  style.textContent = css;
+  document.head.appendChild(style);
+
+  // Visitor context for display rules: a per-tab session and a returning flag
+  var session = sessionStorage.getItem("nyasah_session");
+  if (!session) {
+    session = Math.random().toString(36).slice(2) + Date.now().toString(36);
+    sessionStorage.setItem("nyasah_session", session);
+  }
+  var returning = localStorage.getItem("nyasah_seen") === "1";
+  localStorage.setItem("nyasah_seen", "1");
+
+  // Long-lived visitor ID so experiment buckets stay stable across sessions
+  var visitor = localStorage.getItem("nyasah_visitor");
+  if (!visitor) {
+    visitor = uid();
+    localStorage.setItem("nyasah_visitor", visitor);
+  }
+
+  function uid() {
+    return Math.random().toString(36).slice(2) + Date.now().toString(36);
+  }
+
+  // Impressions, clicks and conversions are sent in batches with idempotency IDs
+  var queue = [];
+  function track(type, fields) {
+    var event = { id: uid(), type: type, visitor_id: visitor, timestamp: new Date().toISOString() };
+    for (var k in fields) event[k] = fields[k];
+    queue.push(event);
+    if (queue.length >= 20) sendEvents();
+  }
+  function sendEvents() {
+    if (!queue.length) return;
+    var batch = queue.splice(0, queue.length);
+    fetch(base + "/widget/events?key=" + encodeURIComponent(key), {
+      method: "POST",
+      credentials: "omit",
+      keepalive: true,
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ events: batch })
+    }).catch(function () {});
+  }
+  setInterval(sendEvents, 5000);
+  document.addEventListener("visibilitychange", function () {
+    if (document.visibilityState === "hidden") sendEvents();
+  });
+
+  function render(el) {
+    var type = el.getAttribute("data-nyasah-widget");
+    var url = base + "/widget/render/" + encodeURIComponent(type) + "?key=" + encodeURIComponent(key) +
+      "&session_id=" + encodeURIComponent(session) + "&visitor_id=" + encodeURIComponent(visitor) +
+      "&returning=" + (returning ? "1" : "0") +
+      "&url=" + encodeURIComponent(location.pathname);
+    var cart = el.getAttribute("data-cart-value");
+    if (cart) url += "&cart_value=" + encodeURIComponent(cart);
+    var entity = el.getAttribute("data-entity-id");
+    if (entity) url += "&entity_id=" + encodeURIComponent(entity);
+    var limit = el.getAttribute("data-limit");
+    if (limit) url += "&limit=" + encodeURIComponent(limit);
+
+    fetch(url, { credentials: "omit" })
+      .then(function (res) { return res.ok ? res.json() : null; })
+      .then(function (widget) {
+        if (!widget) return;
+        setTimeout(function () {
+          el.innerHTML = widget.html;
+          var shown = el.querySelectorAll("[data-proof-id]");
+          for (var i = 0; i < shown.length; i++) {
+            track("impression", { proof_id: shown[i].getAttribute("data-proof-id"), entity_id: entity || undefined });
+          }
+        }, (widget.delay_seconds || 0) * 1000);
+      })
+      .catch(function () {});
+  }
+
+  // Presence: heartbeat for each entity on the page so viewer counts stay live
+  function post(path, body) {
+    return fetch(base + path + "?key=" + encodeURIComponent(key), {
+      method: "POST",
+      credentials: "omit",
+      keepalive: true,
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify(body)
+    }).catch(function () {});
+  }
+  function watchPresence(entities) {
+    function ping() {
+      for (var i = 0; i < entities.length; i++) post("/widget/presence/ping", { entity_id: entities[i], visitor_id: visitor });
+    }
+    ping();
+    setInterval(function () { if (document.visibilityState !== "hidden") ping(); }, 20000);
+    window.addEventListener("pagehide", function () {
+      for (var i = 0; i < entities.length; i++) post("/widget/presence/leave", { entity_id: entities[i], visitor_id: visitor });
+    });
+  }
+
+  // Storefronts call Nyasah.convert(orderValue) after a purchase. The
+  // conversion is attributed to the last proof this visitor saw.
+  window.Nyasah = window.Nyasah || {};
+  window.Nyasah.convert = function (value) {
+    track("conversion", { value: Number(value) || 0 });
+    sendEvents();
+    return post("/widget/experiments/convert", { visitor_id: visitor });
+  };
+
+  function init() {
+    var nodes = document.querySelectorAll("[data-nyasah-widget]");
+    var entities = [];
+    for (var i = 0; i < nodes.length; i++) {
+      var el = nodes[i];
+      render(el);
+      el.addEventListener("click", function (e) {
+        var proof = e.target.closest && e.target.closest("[data-proof-id]");
+        if (proof) track("click", { proof_id: proof.getAttribute("data-proof-id") });
+      });
+
+      var entity = el.getAttribute("data-entity-id");
+      if (entity && entities.indexOf(entity) < 0) entities.push(entity);
+      if (entity && el.getAttribute("data-nyasah-widget") === "viewers" && window.EventSource) {
+        // Re-render when the live count changes
+        var feed = new EventSource(base + "/widget/stream/sse?key=" + encodeURIComponent(key) + "&entity_id=" + encodeURIComponent(entity));
+        feed.addEventListener("presence", (function (node) { return function () { render(node); }; })(el));
+      }
+    }
+    if (entities.length) watchPresence(entities);
+  }
+
+  if (document.readyState === "loading") {
+    document.addEventListener("DOMContentLoaded", init);
+  } else {
+    init();
+  }
+})();
+`
+
+// LoaderScript returns the loader bound to a tenant's publishable widget key
+// and the API base URL
+func LoaderScript(baseURL, widgetKey string) string {
+	return strings.NewReplacer(
+		"{{BASE_URL}}", jsString(strings.TrimRight(baseURL, "/")),
+		"{{WIDGET_KEY}}", jsString(widgetKey),
+	).Replace(loaderTemplate)
+}
+
+// jsString escapes a value for use inside a double quoted JS string literal
+func jsString(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "<", `\u003c`, "\n", `\n`).Replace(s)
+}
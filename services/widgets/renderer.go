@@ -0,0 +1,308 @@
+package widgets
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"nyasah-backend/models"
+	"nyasah-backend/services/presence"
+	"nyasah-backend/services/proofs"
+	"nyasah-backend/services/syndication"
+	"nyasah-backend/services/templates"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	TypeToast    = "toast"
+	TypeCarousel = "carousel"
+	TypeBadge    = "badge"
+	TypeViewers  = "viewers"
+)
+
+// Widget is a rendered widget ready to be injected by the loader script
+type Widget struct {
+	Type         string      `json:"type"`
+	HTML         string      `json:"html"`
+	Data         interface{} `json:"data"`
+	DelaySeconds int         `json:"delay_seconds,omitempty"`
+	VariantID    *uuid.UUID  `json:"variant_id,omitempty"`
+	ProofIDs     []uuid.UUID `json:"-"` // proofs shown, for exposure tracking
+}
+
+// Request identifies what a storefront asked for
+type Request struct {
+	Type       string
+	EntityID   uuid.UUID
+	Limit      int
+	Locale     string
+	ProofTypes []string                  // proof types allowed by display rules, empty for the widget default
+	Variant    *models.ExperimentVariant // experiment variant overriding the tenant's defaults
+}
+
+// ProofType returns the proof type a widget displays, used to apply display rules
+func ProofType(widgetType string) string {
+	switch widgetType {
+	case TypeCarousel, TypeBadge:
+		return "review"
+	case TypeViewers:
+		return "view"
+	default:
+		return "purchase"
+	}
+}
+
+type Renderer struct {
+	db          *gorm.DB
+	syndication *syndication.Service
+	templates   *templates.Service
+	proofs      *proofs.Service
+	presence    *presence.Tracker
+	cache       *cache
+}
+
+// NewRenderer creates a renderer. With a presence tracker the viewers widget
+// shows live visitors; without one it counts recent "view" proofs.
+func NewRenderer(db *gorm.DB, cacheTTL time.Duration, tracker *presence.Tracker) *Renderer {
+	return &Renderer{
+		db:          db,
+		syndication: syndication.NewService(db),
+		templates:   templates.NewService(db),
+		proofs:      proofs.NewService(db),
+		presence:    tracker,
+		cache:       newCache(cacheTTL),
+	}
+}
+
+// Render builds the widget for a tenant, serving it from cache when possible
+func (r *Renderer) Render(tenant models.Tenant, req Request) (Widget, error) {
+	if req.Limit <= 0 || req.Limit > 20 {
+		req.Limit = 5
+	}
+
+	variantID := uuid.Nil
+	if req.Variant != nil {
+		variantID = req.Variant.ID
+	}
+	key := fmt.Sprintf("%s:%s:%s:%d:%s:%s:%s", tenant.ID, req.Type, req.EntityID, req.Limit, req.Locale, strings.Join(req.ProofTypes, ","), variantID)
+
+	// Live viewer counts change every second, and rotated toasts must differ
+	// between requests, so only the other widgets are cached
+	cacheable := req.Type != TypeViewers || r.presence == nil
+	if req.Type == TypeToast {
+		rotates, err := r.proofs.Rotates(tenant.ID, toastTypes(req))
+		if err != nil {
+			return Widget{}, err
+		}
+		cacheable = !rotates
+	}
+	if cacheable {
+		if widget, ok := r.cache.get(key); ok {
+			return widget, nil
+		}
+	}
+
+	theme := ThemeFromSettings(tenant.Settings)
+	if req.Variant != nil {
+		applyVariant(&theme, req.Variant.Config)
+	}
+
+	var data interface{}
+	var err error
+	switch req.Type {
+	case TypeToast:
+		data, err = r.toastData(tenant.ID, req, theme.MediaType)
+	case TypeCarousel:
+		data, err = r.carouselData(tenant.ID, req)
+	case TypeBadge:
+		data, err = r.badgeData(tenant.ID, req)
+	case TypeViewers:
+		data, err = r.viewersData(tenant.ID, req)
+	default:
+		return Widget{}, fmt.Errorf("unknown widget type: %s", req.Type)
+	}
+	if err != nil {
+		return Widget{}, err
+	}
+
+	var buf bytes.Buffer
+	err = widgetTemplates.ExecuteTemplate(&buf, req.Type, map[string]interface{}{
+		"Theme": theme,
+		"Data":  data,
+	})
+	if err != nil {
+		return Widget{}, fmt.Errorf("failed to render widget: %w", err)
+	}
+
+	widget := Widget{Type: req.Type, HTML: buf.String(), Data: data, DelaySeconds: theme.DelaySeconds}
+	if req.Variant != nil {
+		widget.VariantID = &variantID
+	}
+	if items, ok := data.([]toastItem); ok {
+		for _, item := range items {
+			widget.ProofIDs = append(widget.ProofIDs, item.ProofID)
+		}
+	}
+	if cacheable {
+		r.cache.set(key, widget)
+	}
+
+	return widget, nil
+}
+
+// applyVariant overrides the theme with an experiment variant's settings
+func applyVariant(theme *Theme, config models.VariantConfig) {
+	if config.Placement != "" {
+		theme.Position = config.Placement
+	}
+	if config.DelaySeconds > 0 {
+		theme.DelaySeconds = config.DelaySeconds
+	}
+	if config.MediaType != "" {
+		theme.MediaType = config.MediaType
+	}
+}
+
+type toastItem struct {
+	ProofID   uuid.UUID `json:"proof_id"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// toastTypes returns the proof types a toast widget selects from
+func toastTypes(req Request) []string {
+	if len(req.ProofTypes) == 0 {
+		return []string{ProofType(TypeToast)}
+	}
+	return req.ProofTypes
+}
+
+func (r *Renderer) toastData(tenantID uuid.UUID, req Request, mediaType string) ([]toastItem, error) {
+	// Freshness, de-duplication and rotation follow the tenant's proof policies
+	selected, err := r.proofs.Select(proofs.Query{
+		TenantID:  tenantID,
+		Types:     toastTypes(req),
+		EntityID:  req.EntityID,
+		MediaType: mediaType,
+		Limit:     req.Limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Variant != nil && req.Variant.Config.TemplateBody != "" {
+		err = r.templates.RenderProofsWithBody(tenantID, selected, req.Locale, req.Variant.Config.TemplateBody)
+	} else {
+		err = r.templates.RenderProofs(tenantID, selected, req.Locale)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]toastItem, 0, len(selected))
+	for _, proof := range selected {
+		items = append(items, toastItem{ProofID: proof.ID, Content: proof.Content, CreatedAt: proof.CreatedAt})
+	}
+	return items, nil
+}
+
+type carouselItem struct {
+	Rating    int       `json:"rating"`
+	Content   string    `json:"content"`
+	Author    string    `json:"author"`
+	Verified  bool      `json:"verified"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (r *Renderer) carouselData(tenantID uuid.UUID, req Request) ([]carouselItem, error) {
+	var reviews []models.Review
+	if req.EntityID != uuid.Nil {
+		syndicated, err := r.syndication.ListReviews(tenantID, req.EntityID)
+		if err != nil {
+			return nil, err
+		}
+		for _, review := range syndicated {
+			reviews = append(reviews, review.Review)
+		}
+	} else {
+		err := r.db.Where("tenant_id = ? AND status = ?", tenantID, syndication.ReviewStatusApproved).
+			Order("created_at DESC").
+			Limit(100).
+			Find(&reviews).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	items := make([]carouselItem, 0, req.Limit)
+	for _, review := range reviews {
+		if review.Rating < 4 {
+			continue
+		}
+		author, _ := review.Metadata["author_name"].(string)
+		items = append(items, carouselItem{
+			Rating:    review.Rating,
+			Content:   review.Content,
+			Author:    author,
+			Verified:  review.Verified,
+			CreatedAt: review.CreatedAt,
+		})
+		if len(items) == req.Limit {
+			break
+		}
+	}
+	return items, nil
+}
+
+func (r *Renderer) badgeData(tenantID uuid.UUID, req Request) (syndication.RatingSummary, error) {
+	if req.EntityID == uuid.Nil {
+		return syndication.RatingSummary{}, fmt.Errorf("badge widget requires an entity")
+	}
+	return r.syndication.Summarize(tenantID, req.EntityID)
+}
+
+type viewersData struct {
+	Count   int64 `json:"count"`
+	Rounded bool  `json:"rounded,omitempty"`
+}
+
+func (r *Renderer) viewersData(tenantID uuid.UUID, req Request) (viewersData, error) {
+	if req.EntityID == uuid.Nil {
+		return viewersData{}, fmt.Errorf("viewers widget requires an entity")
+	}
+
+	if r.presence != nil {
+		count := r.presence.Display(tenantID, req.EntityID)
+		if !count.Visible {
+			return viewersData{}, nil
+		}
+		return viewersData{Count: int64(count.Count), Rounded: count.Rounded}, nil
+	}
+
+	var count int64
+	err := r.db.Model(&models.SocialProof{}).
+		Where("tenant_id = ? AND entity_id = ? AND type = ? AND created_at > ?", tenantID, req.EntityID, "view", time.Now().Add(-15*time.Minute)).
+		Count(&count).Error
+	return viewersData{Count: count}, err
+}
+
+var widgetTemplates = template.Must(template.New("widgets").Funcs(template.FuncMap{
+	"stars": func(rating float64) string {
+		full := int(rating + 0.5)
+		return strings.Repeat("★", full) + strings.Repeat("☆", 5-full)
+	},
+	"float": func(i int) float64 { return float64(i) },
+}).Parse(`
+{{define "style"}}font-family:{{.Theme.FontFamily}};color:{{.Theme.TextColor}};background:{{.Theme.BackgroundColor}};border-radius:{{.Theme.BorderRadius}}px;{{end}}
+
+{{define "toast"}}<div class="nyasah-toasts nyasah-{{.Theme.Position}}">{{$root := .}}{{range .Data}}<div class="nyasah-toast" data-proof-id="{{.ProofID}}" style="{{template "style" $root}}border-left:4px solid {{$root.Theme.PrimaryColor}}">{{.Content}}</div>{{end}}</div>{{end}}
+
+{{define "carousel"}}<div class="nyasah-carousel">{{$root := .}}{{range .Data}}<figure class="nyasah-review" style="{{template "style" $root}}"><div class="nyasah-stars" style="color:{{$root.Theme.PrimaryColor}}">{{stars (float .Rating)}}</div><blockquote>{{.Content}}</blockquote>{{if .Author}}<figcaption>{{.Author}}{{if .Verified}} &middot; Verified{{end}}</figcaption>{{end}}</figure>{{end}}</div>{{end}}
+
+{{define "badge"}}<div class="nyasah-badge" style="{{template "style" .}}"><span class="nyasah-stars" style="color:{{.Theme.PrimaryColor}}">{{stars .Data.AverageRating}}</span> <span>{{printf "%.1f" .Data.AverageRating}} ({{.Data.ReviewCount}})</span></div>{{end}}
+
+{{define "viewers"}}{{if gt .Data.Count 1}}<div class="nyasah-viewers" style="{{template "style" .}}"><span style="color:{{.Theme.PrimaryColor}}">&#9679;</span> {{.Data.Count}}{{if .Data.Rounded}}+{{end}} people are viewing this</div>{{end}}{{end}}
+`))
@@ -0,0 +1,68 @@
+package widgets
+
+import (
+	"encoding/json"
+)
+
+// Theme controls the look of rendered widgets. Tenants configure it under the
+// "widget" key of Tenant.Settings.
+type Theme struct {
+	PrimaryColor    string `json:"primary_color"`
+	TextColor       string `json:"text_color"`
+	BackgroundColor string `json:"background_color"`
+	FontFamily      string `json:"font_family"`
+	BorderRadius    int    `json:"border_radius"`
+	Position        string `json:"position"`                // toast corner: "bottom-left", "bottom-right", ...
+	DelaySeconds    int    `json:"delay_seconds,omitempty"` // wait before the loader shows the widget
+	MediaType       string `json:"media_type,omitempty"`    // only show proofs of this media type
+}
+
+var defaultTheme = Theme{
+	PrimaryColor:    "#f5a623",
+	TextColor:       "#222222",
+	BackgroundColor: "#ffffff",
+	FontFamily:      "inherit",
+	BorderRadius:    8,
+	Position:        "bottom-left",
+}
+
+// ThemeFromSettings reads the widget theme from tenant settings, falling back
+// to defaults for anything not configured
+func ThemeFromSettings(settings json.RawMessage) Theme {
+	theme := defaultTheme
+	if len(settings) == 0 {
+		return theme
+	}
+
+	var parsed struct {
+		Widget Theme `json:"widget"`
+	}
+	if err := json.Unmarshal(settings, &parsed); err != nil {
+		return theme
+	}
+
+	if parsed.Widget.PrimaryColor != "" {
+		theme.PrimaryColor = parsed.Widget.PrimaryColor
+	}
+	if parsed.Widget.TextColor != "" {
+		theme.TextColor = parsed.Widget.TextColor
+	}
+	if parsed.Widget.BackgroundColor != "" {
+		theme.BackgroundColor = parsed.Widget.BackgroundColor
+	}
+	if parsed.Widget.FontFamily != "" {
+		theme.FontFamily = parsed.Widget.FontFamily
+	}
+	if parsed.Widget.BorderRadius > 0 {
+		theme.BorderRadius = parsed.Widget.BorderRadius
+	}
+	if parsed.Widget.Position != "" {
+		theme.Position = parsed.Widget.Position
+	}
+	if parsed.Widget.DelaySeconds > 0 {
+		theme.DelaySeconds = parsed.Widget.DelaySeconds
+	}
+	theme.MediaType = parsed.Widget.MediaType
+
+	return theme
+}
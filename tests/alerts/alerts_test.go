@@ -0,0 +1,221 @@
+package alerts_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"nyasah-backend/models"
+	"nyasah-backend/services/alerts"
+	"nyasah-backend/services/jobs"
+	"nyasah-backend/services/mail"
+	"nyasah-backend/tests/testutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+func (m *fakeMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func setupDB(t *testing.T) *gorm.DB {
+	return testutil.DB(t, &models.Review{}, &models.Entity{}, &models.ReviewRollup{},
+		&models.AlertRule{}, &models.Incident{}, &models.Job{})
+}
+
+func TestRobustScore(t *testing.T) {
+	score := alerts.RobustScore(10, []float64{4, 5, 5, 6, 5, 40}, 0.1)
+	assert.Equal(t, 5.0, score.Baseline)
+	// The past outlier barely widens the scale: MAD is 0.5, scaled to 0.74
+	assert.InDelta(t, 5/(1.4826*0.5), score.Score, 1e-9)
+
+	// A flat baseline falls back to the metric's floor
+	flat := alerts.RobustScore(3, []float64{0, 0, 0, 0}, 1)
+	assert.Equal(t, 3.0, flat.Score)
+}
+
+func TestNormalize(t *testing.T) {
+	rule := models.AlertRule{Metric: alerts.MetricRating}
+	assert.NoError(t, alerts.Normalize(&rule))
+	assert.Equal(t, alerts.MethodRobustZ, rule.Method)
+	assert.Equal(t, alerts.DirectionBelow, rule.Direction)
+	assert.Equal(t, alerts.DefaultThreshold, rule.Threshold)
+	assert.Equal(t, alerts.DefaultWindowHours, rule.WindowHours)
+
+	assert.ErrorIs(t, alerts.Normalize(&models.AlertRule{Metric: "stars"}), alerts.ErrInvalidMetric)
+	assert.ErrorIs(t, alerts.Normalize(&models.AlertRule{Metric: alerts.MetricVolume, Method: "ewma"}), alerts.ErrInvalidMethod)
+	assert.ErrorIs(t, alerts.Normalize(&models.AlertRule{Metric: alerts.MetricVolume, WindowHours: 500}), alerts.ErrInvalidWindow)
+}
+
+func TestDetection(t *testing.T) {
+	db := setupDB(t)
+
+	var (
+		mu       sync.Mutex
+		received []alerts.Notification
+		verified bool
+	)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var notification alerts.Notification
+		json.Unmarshal(body, &notification)
+
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, notification)
+		verified = r.Header.Get(alerts.SignatureHeader) == alerts.Sign("s3cret", body)
+	}))
+	defer hook.Close()
+
+	mailer := &fakeMailer{}
+	// The hook listens on loopback, which the default client refuses
+	service := alerts.NewService(db, mailer, alerts.Options{Client: hook.Client()})
+	queue := jobs.NewQueue(db, jobs.Options{})
+	service.RegisterJobs(queue)
+
+	tenantID := uuid.New()
+	entity := models.Entity{TenantID: tenantID, Type: "product", Name: "Desk Lamp"}
+	assert.NoError(t, db.Create(&entity).Error)
+
+	now := time.Now().UTC()
+	review := func(rating int, at time.Time) {
+		assert.NoError(t, db.Create(&models.Review{
+			TenantID: tenantID, EntityID: entity.ID, UserID: uuid.New(), Rating: rating, CreatedAt: at,
+		}).Error)
+	}
+	// Five weeks of steady, happy reviews
+	for day := 1; day <= 35; day++ {
+		review(5, now.Add(-time.Duration(day)*24*time.Hour))
+		review(4, now.Add(-time.Duration(day)*24*time.Hour+time.Hour))
+	}
+	assert.NoError(t, service.Refresh(now.Add(-60*24*time.Hour)))
+
+	rule := models.AlertRule{
+		TenantID: tenantID, Name: "One-star spike", Enabled: true, Metric: alerts.MetricOneStar,
+		WebhookURL: hook.URL, WebhookSecret: "s3cret", Emails: []string{"ops@example.com"},
+	}
+	assert.NoError(t, db.Create(&rule).Error)
+
+	t.Run("Normal history opens nothing", func(t *testing.T) {
+		opened, err := service.Detect(now)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, opened)
+	})
+
+	// A burst of one-star reviews in the last two hours
+	for i := 0; i < 6; i++ {
+		review(1, now.Add(-time.Duration(i)*20*time.Minute))
+	}
+	assert.NoError(t, service.Refresh(now.Add(-48*time.Hour)))
+
+	var incident models.Incident
+	t.Run("A spike opens one incident and notifies every channel", func(t *testing.T) {
+		opened, err := service.Detect(now)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, opened)
+
+		assert.NoError(t, db.Where("rule_id = ?", rule.ID).First(&incident).Error)
+		assert.Equal(t, alerts.StatusOpen, incident.Status)
+		assert.Equal(t, entity.ID, incident.EntityID)
+		assert.Equal(t, 6.0, incident.Value)
+		assert.Equal(t, 0.0, incident.Baseline)
+		assert.GreaterOrEqual(t, incident.Score, alerts.DefaultThreshold)
+
+		for {
+			found, err := queue.Work(context.Background())
+			assert.NoError(t, err)
+			if !found {
+				break
+			}
+		}
+
+		mu.Lock()
+		assert.Len(t, received, 1)
+		assert.True(t, verified)
+		assert.Equal(t, "Desk Lamp", received[0].Entity.Name)
+		assert.Equal(t, incident.ID, received[0].Incident.ID)
+		mu.Unlock()
+
+		assert.Len(t, mailer.sent, 1)
+		assert.Equal(t, []string{"ops@example.com"}, mailer.sent[0].To)
+		assert.Contains(t, mailer.sent[0].Subject, "Desk Lamp")
+	})
+
+	t.Run("Repeat detections update the open incident", func(t *testing.T) {
+		opened, err := service.Detect(now.Add(15 * time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, opened)
+
+		var count int64
+		db.Model(&models.Incident{}).Where("rule_id = ?", rule.ID).Count(&count)
+		assert.Equal(t, int64(1), count)
+
+		var updated models.Incident
+		assert.NoError(t, db.First(&updated, "id = ?", incident.ID).Error)
+		assert.Equal(t, 2, updated.Occurrences)
+
+		var deliveries int64
+		db.Model(&models.Job{}).Where("type = ?", alerts.TypeDeliver).Count(&deliveries)
+		assert.Equal(t, int64(2), deliveries)
+	})
+
+	t.Run("Incidents can be acknowledged", func(t *testing.T) {
+		_, err := service.Acknowledge(uuid.New(), incident.ID, "someone")
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+		acknowledged, err := service.Acknowledge(tenantID, incident.ID, "user-1")
+		assert.NoError(t, err)
+		assert.Equal(t, alerts.StatusAcknowledged, acknowledged.Status)
+		assert.Equal(t, "user-1", acknowledged.AcknowledgedBy)
+
+		opened, err := service.Detect(now.Add(30 * time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, opened)
+	})
+
+	t.Run("Incidents resolve once the metric recovers", func(t *testing.T) {
+		assert.NoError(t, db.Where("rating = ?", 1).Delete(&models.Review{}).Error)
+		assert.NoError(t, service.Refresh(now.Add(-48*time.Hour)))
+
+		_, err := service.Detect(now.Add(time.Hour))
+		assert.NoError(t, err)
+
+		var resolved models.Incident
+		assert.NoError(t, db.First(&resolved, "id = ?", incident.ID).Error)
+		assert.Equal(t, alerts.StatusResolved, resolved.Status)
+		assert.NotNil(t, resolved.ResolvedAt)
+	})
+
+	t.Run("Seasonal baselines need weeks of history", func(t *testing.T) {
+		seasonal := models.AlertRule{TenantID: tenantID, Metric: alerts.MetricVolume, Method: alerts.MethodSeasonal}
+		opened, err := service.Evaluate(seasonal, now)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, opened)
+
+		fresh := models.Entity{TenantID: tenantID, Type: "product", Name: "New"}
+		assert.NoError(t, db.Create(&fresh).Error)
+		for i := 0; i < 20; i++ {
+			assert.NoError(t, db.Create(&models.Review{TenantID: tenantID, EntityID: fresh.ID, Rating: 5, CreatedAt: now}).Error)
+		}
+		assert.NoError(t, service.Refresh(now.Add(-48*time.Hour)))
+
+		// Only one window of history: too little to call anything unusual
+		opened, err = service.Evaluate(models.AlertRule{TenantID: tenantID, Metric: alerts.MetricVolume, EntityID: &fresh.ID}, now)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, opened)
+	})
+}
@@ -0,0 +1,144 @@
+package analytics_test
+
+import (
+	"encoding/json"
+	"nyasah-backend/models"
+	"nyasah-backend/services/analytics"
+	"nyasah-backend/services/events"
+	"nyasah-backend/services/timeframe"
+	"nyasah-backend/tests/testutil"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryValidate(t *testing.T) {
+	from := time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		query analytics.Query
+		err   error
+	}{
+		{"Defaults to daily buckets", analytics.Query{From: from, To: from.AddDate(0, 0, 7)}, nil},
+		{"Unknown granularity", analytics.Query{From: from, To: from.AddDate(0, 0, 7), Granularity: "year"}, timeframe.ErrInvalidGranularity},
+		{"Unknown group", analytics.Query{From: from, To: from.AddDate(0, 0, 7), GroupBy: []string{"country"}}, analytics.ErrInvalidGroup},
+		{"Inverted range", analytics.Query{From: from, To: from.AddDate(0, 0, -1)}, timeframe.ErrInvalidRange},
+		{"Too many buckets", analytics.Query{From: from, To: from.AddDate(1, 0, 0), Granularity: timeframe.Hour}, timeframe.ErrTooManyFrames},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.query.Validate()
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	db := testutil.DB(t, &models.Tenant{}, &models.Entity{}, &models.SocialProof{},
+		&models.ProofPerformance{}, &models.ProofEvent{}, &models.ProofRollup{})
+
+	tenant := models.Tenant{Name: "Shop", Domain: "shop.test", ApiKey: "key", Settings: json.RawMessage(`{}`)}
+	other := models.Tenant{Name: "Other", Domain: "other.test", ApiKey: "other", Settings: json.RawMessage(`{}`)}
+	assert.NoError(t, db.Create(&tenant).Error)
+	assert.NoError(t, db.Create(&other).Error)
+
+	entity := models.Entity{TenantID: tenant.ID, Name: "Sneakers", Type: "product"}
+	assert.NoError(t, db.Create(&entity).Error)
+
+	purchase := models.SocialProof{TenantID: tenant.ID, Type: "purchase", EntityID: entity.ID, MediaType: "text"}
+	review := models.SocialProof{TenantID: tenant.ID, Type: "review", EntityID: entity.ID, MediaType: "image"}
+	foreign := models.SocialProof{TenantID: other.ID, Type: "purchase", EntityID: uuid.New(), MediaType: "text"}
+	for _, proof := range []*models.SocialProof{&purchase, &review, &foreign} {
+		assert.NoError(t, db.Create(proof).Error)
+	}
+
+	day1 := time.Date(2025, 10, 6, 0, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	n := 0
+	event := func(tenantID uuid.UUID, eventType string, proofID *uuid.UUID, visitor string, at time.Time, value float64) models.ProofEvent {
+		n++
+		return models.ProofEvent{
+			TenantID: tenantID, EventID: uuid.NewString(), Type: eventType, ProofID: proofID,
+			VisitorID: visitor, OccurredAt: at.Add(time.Duration(n) * time.Second), Value: value,
+		}
+	}
+	batch := []models.ProofEvent{
+		event(tenant.ID, events.TypeImpression, &purchase.ID, "a", day1, 0),
+		event(tenant.ID, events.TypeImpression, &purchase.ID, "b", day1, 0),
+		event(tenant.ID, events.TypeClick, &purchase.ID, "a", day1, 0),
+		event(tenant.ID, events.TypeConversion, nil, "a", day1, 40),
+		event(tenant.ID, events.TypeImpression, &review.ID, "c", day2, 0),
+		event(tenant.ID, events.TypeImpression, &review.ID, "d", day2, 0),
+		event(tenant.ID, events.TypeImpression, &purchase.ID, "d", day2, 0),
+		event(other.ID, events.TypeImpression, &foreign.ID, "x", day1, 0),
+	}
+	assert.NoError(t, db.Create(&batch).Error)
+
+	_, err := events.NewAggregator(db, time.Hour).Aggregate()
+	assert.NoError(t, err)
+
+	service := analytics.NewService(db)
+
+	t.Run("Daily totals are scoped to the tenant", func(t *testing.T) {
+		report, err := service.Report(analytics.Query{TenantID: tenant.ID, From: day1, To: day2.AddDate(0, 0, 1)})
+		assert.NoError(t, err)
+
+		assert.Equal(t, int64(5), report.Totals.Impressions)
+		assert.Equal(t, int64(1), report.Totals.Clicks)
+		assert.Equal(t, int64(1), report.Totals.Conversions)
+		assert.Equal(t, 40.0, report.Totals.Revenue)
+		assert.InDelta(t, 0.2, report.Totals.ConversionRate, 1e-9)
+
+		assert.Len(t, report.Series, 1)
+		buckets := report.Series[0].Buckets
+		assert.Len(t, buckets, 2)
+		assert.Equal(t, int64(2), buckets[0].Impressions)
+		assert.Equal(t, int64(3), buckets[1].Impressions)
+	})
+
+	t.Run("Groups by type with zero-filled buckets", func(t *testing.T) {
+		report, err := service.Report(analytics.Query{
+			TenantID: tenant.ID, From: day1, To: day2.AddDate(0, 0, 1), GroupBy: []string{analytics.GroupType},
+		})
+		assert.NoError(t, err)
+
+		assert.Len(t, report.Series, 2)
+		assert.Equal(t, "purchase", report.Series[0].Group[analytics.GroupType])
+		assert.Equal(t, int64(3), report.Series[0].Totals.Impressions)
+		assert.Equal(t, "review", report.Series[1].Group[analytics.GroupType])
+		assert.Equal(t, int64(0), report.Series[1].Buckets[0].Impressions)
+		assert.Equal(t, int64(2), report.Series[1].Buckets[1].Impressions)
+	})
+
+	t.Run("Entity groups carry the entity name", func(t *testing.T) {
+		report, err := service.Report(analytics.Query{
+			TenantID: tenant.ID, From: day1, To: day2, Granularity: timeframe.Week,
+			GroupBy: []string{analytics.GroupEntity, analytics.GroupMedia},
+		})
+		assert.NoError(t, err)
+
+		assert.Len(t, report.Series, 2)
+		for _, series := range report.Series {
+			assert.Equal(t, "Sneakers", series.Group["entity_name"])
+			assert.Len(t, series.Buckets, 1)
+		}
+	})
+
+	t.Run("Other tenants' entities are not named", func(t *testing.T) {
+		assert.NoError(t, db.Create(&models.ProofRollup{
+			TenantID: other.ID, BucketStart: day1, ProofType: "purchase", EntityID: entity.ID, Impressions: 1,
+		}).Error)
+
+		report, err := service.Report(analytics.Query{
+			TenantID: other.ID, From: day1, To: day2, GroupBy: []string{analytics.GroupEntity},
+		})
+		assert.NoError(t, err)
+		for _, series := range report.Series {
+			assert.NotContains(t, series.Group, "entity_name")
+		}
+	})
+}
@@ -0,0 +1,179 @@
+package attribution_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"nyasah-backend/models"
+	"nyasah-backend/services/attribution"
+	"nyasah-backend/services/events"
+	"nyasah-backend/tests/testutil"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func setupDB(t *testing.T) *gorm.DB {
+	return testutil.DB(t, &models.ProofEvent{}, &models.SocialProof{}, &models.Entity{}, &models.HoldoutVisitor{})
+}
+
+func TestFunnel(t *testing.T) {
+	db := setupDB(t)
+	service := attribution.NewService(db)
+
+	tenantID := uuid.New()
+	shoes := models.Entity{TenantID: tenantID, Type: "product", Name: "Shoes"}
+	assert.NoError(t, db.Create(&shoes).Error)
+	purchase := models.SocialProof{TenantID: tenantID, Type: "purchase", EntityID: shoes.ID}
+	review := models.SocialProof{TenantID: tenantID, Type: "review", EntityID: uuid.New()}
+	assert.NoError(t, db.Create(&purchase).Error)
+	assert.NoError(t, db.Create(&review).Error)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	n := 0
+	event := func(eventType string, proofID *uuid.UUID, visitor string, value float64, at time.Time) {
+		n++
+		assert.NoError(t, db.Create(&models.ProofEvent{
+			TenantID: tenantID, EventID: fmt.Sprint(n), Type: eventType, ProofID: proofID,
+			VisitorID: visitor, Value: value, OccurredAt: at,
+		}).Error)
+	}
+
+	// Alice sees the purchase proof, then sees and clicks the review proof
+	event(events.TypeImpression, &purchase.ID, "alice", 0, now.Add(-50*time.Minute))
+	event(events.TypeImpression, &review.ID, "alice", 0, now.Add(-30*time.Minute))
+	event(events.TypeClick, &review.ID, "alice", 0, now.Add(-20*time.Minute))
+	event(events.TypeConversion, nil, "alice", 90, now)
+	// Carol's touch is before the report range but inside the attribution window
+	event(events.TypeImpression, &purchase.ID, "carol", 0, now.Add(-130*time.Minute))
+	event(events.TypeConversion, nil, "carol", 30, now.Add(-90*time.Minute))
+	// Bob's touch is outside the attribution window
+	event(events.TypeImpression, &purchase.ID, "bob", 0, now.Add(-100*time.Minute))
+	event(events.TypeConversion, nil, "bob", 10, now)
+
+	query := attribution.FunnelQuery{TenantID: tenantID, From: now.Add(-2 * time.Hour), To: now.Add(time.Minute), Window: time.Hour}
+
+	t.Run("Conversions are credited under every model", func(t *testing.T) {
+		report, err := service.Funnel(query)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), report.Conversions)
+		assert.Equal(t, int64(2), report.Attributed)
+		assert.InDelta(t, 130, report.Revenue, 1e-9)
+		assert.Len(t, report.Funnels, 2)
+
+		funnels := make(map[string]attribution.Funnel)
+		for _, f := range report.Funnels {
+			funnels[f.Key] = f
+		}
+
+		byPurchase := funnels["purchase"]
+		assert.Equal(t, int64(2), byPurchase.Impressions)
+		assert.Equal(t, int64(2), byPurchase.Reached)
+		assert.InDelta(t, 2, byPurchase.Attribution[attribution.ModelFirstTouch].Conversions, 1e-9)
+		assert.InDelta(t, 120, byPurchase.Attribution[attribution.ModelFirstTouch].Revenue, 1e-9)
+		assert.InDelta(t, 1, byPurchase.Attribution[attribution.ModelLastTouch].Conversions, 1e-9)
+		assert.InDelta(t, 4.0/3, byPurchase.Attribution[attribution.ModelLinear].Conversions, 1e-9)
+		assert.InDelta(t, 60, byPurchase.Attribution[attribution.ModelLinear].Revenue, 1e-9)
+
+		byReview := funnels["review"]
+		assert.Equal(t, int64(1), byReview.Impressions)
+		assert.Equal(t, int64(1), byReview.Clicks)
+		assert.Equal(t, int64(1), byReview.Engaged)
+		assert.Equal(t, int64(1), byReview.Converted)
+		assert.InDelta(t, 1, byReview.ClickRate, 1e-9)
+		assert.InDelta(t, 0, byReview.Attribution[attribution.ModelFirstTouch].Conversions, 1e-9)
+		assert.InDelta(t, 1, byReview.Attribution[attribution.ModelLastTouch].Conversions, 1e-9)
+		assert.InDelta(t, 2.0/3, byReview.Attribution[attribution.ModelLinear].Conversions, 1e-9)
+	})
+
+	t.Run("Grouping by entity names the entities", func(t *testing.T) {
+		query := query
+		query.GroupBy = attribution.GroupEntity
+		report, err := service.Funnel(query)
+		assert.NoError(t, err)
+		assert.Equal(t, shoes.ID.String(), report.Funnels[0].Key)
+		assert.Equal(t, "Shoes", report.Funnels[0].Name)
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		bad := query
+		bad.GroupBy = "media"
+		_, err := service.Funnel(bad)
+		assert.ErrorIs(t, err, attribution.ErrInvalidGroup)
+
+		bad = query
+		bad.From = bad.To
+		_, err = service.Funnel(bad)
+		assert.ErrorIs(t, err, attribution.ErrInvalidRange)
+	})
+}
+
+func TestHoldoutLift(t *testing.T) {
+	db := setupDB(t)
+	service := attribution.NewService(db)
+
+	settings, _ := json.Marshal(map[string]interface{}{"holdout_percent": 50})
+	tenant := models.Tenant{ID: uuid.New(), Settings: settings}
+
+	t.Run("Visitors are bucketed once and keep their group", func(t *testing.T) {
+		held, err := service.Holdout(tenant, "visitor-0")
+		assert.NoError(t, err)
+		assert.Equal(t, attribution.InHoldout(tenant.ID, "visitor-0", 50), held)
+
+		// Shrinking the holdout does not move visitors already seen
+		smaller, _ := json.Marshal(map[string]interface{}{"holdout_percent": 0.01})
+		again, err := service.Holdout(models.Tenant{ID: tenant.ID, Settings: smaller}, "visitor-0")
+		assert.NoError(t, err)
+		assert.Equal(t, held, again)
+
+		held, err = service.Holdout(models.Tenant{ID: tenant.ID}, "someone-else")
+		assert.NoError(t, err)
+		assert.False(t, held)
+	})
+
+	now := time.Now().UTC()
+	heldOut := 0
+	for i := 0; i < 2000; i++ {
+		visitor := fmt.Sprintf("visitor-%d", i)
+		held, err := service.Holdout(tenant, visitor)
+		assert.NoError(t, err)
+
+		// Exposed visitors convert at 30%, held out visitors at 10%
+		converts := i%10 < 3
+		if held {
+			heldOut++
+			converts = i%10 == 0
+		}
+		if converts {
+			assert.NoError(t, db.Create(&models.ProofEvent{
+				TenantID: tenant.ID, EventID: visitor, Type: events.TypeConversion,
+				VisitorID: visitor, Value: 20, OccurredAt: now.Add(time.Minute),
+			}).Error)
+		}
+	}
+	assert.InDelta(t, 1000, heldOut, 100)
+
+	t.Run("Lift has confidence intervals", func(t *testing.T) {
+		lift, err := service.Lift(attribution.LiftQuery{TenantID: tenant.ID, From: now.Add(-time.Hour), To: now.Add(time.Hour)})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2000), lift.Exposed.Visitors+lift.Holdout.Visitors)
+		assert.InDelta(t, 0.3, lift.Exposed.ConversionRate, 0.05)
+		assert.InDelta(t, 0.1, lift.Holdout.ConversionRate, 0.05)
+		assert.InDelta(t, 20*lift.Exposed.ConversionRate, lift.Exposed.RevenuePerVisitor, 1e-9)
+
+		assert.True(t, lift.Significant)
+		assert.Greater(t, lift.Lift, 1.0)
+		assert.Less(t, lift.LiftInterval.Low, lift.Lift)
+		assert.Greater(t, lift.LiftInterval.High, lift.Lift)
+		assert.Greater(t, lift.DifferenceInterval.Low, 0.0)
+		assert.InDelta(t, lift.Difference*float64(lift.Exposed.Visitors), lift.IncrementalConversions, 1e-9)
+		assert.Greater(t, lift.IncrementalInterval.Low, 0.0)
+	})
+
+	t.Run("Confidence is validated", func(t *testing.T) {
+		_, err := service.Lift(attribution.LiftQuery{TenantID: tenant.ID, From: now.Add(-time.Hour), To: now, Confidence: 1.5})
+		assert.ErrorIs(t, err, attribution.ErrInvalidConfidence)
+	})
+}
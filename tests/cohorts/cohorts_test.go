@@ -0,0 +1,175 @@
+package cohorts_test
+
+import (
+	"encoding/json"
+	"nyasah-backend/models"
+	"nyasah-backend/services/cohorts"
+	"nyasah-backend/tests/testutil"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func setupDB(t *testing.T) *gorm.DB {
+	return testutil.DB(t, &models.Tenant{}, &models.Review{}, &models.ProofEvent{})
+}
+
+func createTenant(t *testing.T, db *gorm.DB, timeZone string) models.Tenant {
+	settings, _ := json.Marshal(map[string]string{"time_zone": timeZone})
+	tenant := models.Tenant{Name: "Shop", Domain: uuid.NewString() + ".example.com", Type: "ecommerce", ApiKey: uuid.NewString(), Settings: settings}
+	assert.NoError(t, db.Create(&tenant).Error)
+	return tenant
+}
+
+func review(t *testing.T, db *gorm.DB, tenantID, userID uuid.UUID, status string, at time.Time) {
+	assert.NoError(t, db.Create(&models.Review{TenantID: tenantID, UserID: userID, EntityID: uuid.New(), Rating: 5, Status: status, CreatedAt: at.UTC()}).Error)
+}
+
+func event(t *testing.T, db *gorm.DB, tenantID uuid.UUID, eventType string, userID *uuid.UUID, visitorID string, value float64, at time.Time) {
+	assert.NoError(t, db.Create(&models.ProofEvent{
+		TenantID:   tenantID,
+		EventID:    uuid.NewString(),
+		Type:       eventType,
+		UserID:     userID,
+		VisitorID:  visitorID,
+		Value:      value,
+		OccurredAt: at.UTC(),
+	}).Error)
+}
+
+func day(d int) time.Time {
+	return time.Date(2024, 1, d, 12, 0, 0, 0, time.UTC)
+}
+
+func TestFirstReviewCohorts(t *testing.T) {
+	db := setupDB(t)
+	service := cohorts.NewService(db)
+	tenant := createTenant(t, db, "")
+
+	a, b, c, d, e := uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New()
+
+	// Week of 1 January: a comes back every week in a different way, b never
+	review(t, db, tenant.ID, a, "approved", day(2))
+	review(t, db, tenant.ID, a, "approved", day(3))
+	event(t, db, tenant.ID, "conversion", &a, "v-a", 50, day(10))
+	event(t, db, tenant.ID, "impression", &a, "v-a", 0, day(17))
+	event(t, db, tenant.ID, "click", &a, "v-a", 0, day(17))
+	review(t, db, tenant.ID, b, "approved", day(4))
+
+	// c first reviewed before the range, so belongs to no cohort
+	review(t, db, tenant.ID, c, "approved", time.Date(2023, 12, 20, 12, 0, 0, 0, time.UTC))
+	review(t, db, tenant.ID, c, "approved", day(9))
+
+	// Week of 8 January: d buys twice the week after
+	review(t, db, tenant.ID, d, "approved", day(9))
+	event(t, db, tenant.ID, "conversion", &d, "v-d", 20, day(16))
+	event(t, db, tenant.ID, "conversion", &d, "v-d", 30, day(17))
+
+	// Rejected reviews and purchases of unknown visitors are not counted
+	review(t, db, tenant.ID, e, "rejected", day(2))
+	event(t, db, tenant.ID, "conversion", nil, "v-anonymous", 99, day(10))
+
+	report, err := service.Report(cohorts.Query{
+		TenantID: tenant.ID,
+		From:     time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC),
+		Periods:  3,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, cohorts.ByFirstReview, report.By)
+	assert.Equal(t, "week", report.Granularity)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), report.From)
+	assert.Equal(t, time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), report.To)
+	assert.Len(t, report.Cohorts, 2)
+
+	first := report.Cohorts[0]
+	assert.Equal(t, int64(2), first.Size)
+	assert.Len(t, first.Periods, 4)
+	assert.Equal(t, time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC), first.Periods[1].Start)
+	assert.Equal(t, cohorts.Cell{Period: 0, Start: day(1).Add(-12 * time.Hour), Active: 1, Retention: 0.5, Reviewers: 1, Reviews: 1}, first.Periods[0])
+	assert.Equal(t, int64(1), first.Periods[1].Purchasers)
+	assert.Equal(t, 50.0, first.Periods[1].Revenue)
+	assert.Equal(t, 0.5, first.Periods[1].Retention)
+	assert.Equal(t, int64(1), first.Periods[2].Engaged)
+	assert.Equal(t, int64(1), first.Periods[2].Active)
+	assert.Equal(t, int64(0), first.Periods[3].Active)
+
+	second := report.Cohorts[1]
+	assert.Equal(t, int64(1), second.Size)
+	assert.Equal(t, int64(0), second.Periods[0].Active)
+	assert.Equal(t, int64(2), second.Periods[1].Purchases)
+	assert.Equal(t, int64(1), second.Periods[1].Purchasers)
+	assert.Equal(t, 50.0, second.Periods[1].Revenue)
+	assert.Equal(t, 1.0, second.Periods[1].Retention)
+
+	assert.InDeltaSlice(t, []float64{1.0 / 3, 2.0 / 3, 1.0 / 3, 0}, report.Retention, 1e-9)
+}
+
+func TestFirstPurchaseCohorts(t *testing.T) {
+	db := setupDB(t)
+	service := cohorts.NewService(db)
+	tenant := createTenant(t, db, "Asia/Tokyo")
+	a := uuid.New()
+
+	// A visitor who never signs in is followed by their visitor ID
+	event(t, db, tenant.ID, "conversion", nil, "v-1", 10, day(2))
+	event(t, db, tenant.ID, "conversion", nil, "v-1", 15, day(10))
+
+	// Sunday evening in UTC is already Monday in Tokyo
+	event(t, db, tenant.ID, "conversion", &a, "v-2", 40, time.Date(2024, 1, 7, 20, 0, 0, 0, time.UTC))
+	review(t, db, tenant.ID, a, "approved", day(3))
+	review(t, db, tenant.ID, a, "approved", day(16))
+
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	report, err := service.Report(cohorts.Query{
+		TenantID: tenant.ID,
+		By:       cohorts.ByFirstPurchase,
+		From:     time.Date(2024, 1, 1, 0, 0, 0, 0, tokyo),
+		To:       time.Date(2024, 1, 15, 0, 0, 0, 0, tokyo),
+		Periods:  2,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Asia/Tokyo", report.TimeZone)
+	assert.Len(t, report.Cohorts, 2)
+
+	assert.Equal(t, int64(1), report.Cohorts[0].Size)
+	assert.Equal(t, int64(1), report.Cohorts[0].Periods[1].Purchases)
+	assert.Equal(t, 15.0, report.Cohorts[0].Periods[1].Revenue)
+
+	// The review before their first purchase does not count
+	assert.Equal(t, int64(1), report.Cohorts[1].Size)
+	assert.Equal(t, time.Date(2024, 1, 8, 0, 0, 0, 0, tokyo), report.Cohorts[1].Start)
+	assert.Equal(t, int64(0), report.Cohorts[1].Periods[0].Active)
+	assert.Equal(t, int64(1), report.Cohorts[1].Periods[1].Reviewers)
+}
+
+func TestCohortQuery(t *testing.T) {
+	db := setupDB(t)
+	service := cohorts.NewService(db)
+	tenant := createTenant(t, db, "")
+	from, to := day(1), day(29)
+
+	_, err := service.Report(cohorts.Query{TenantID: tenant.ID, By: "first_visit", From: from, To: to})
+	assert.ErrorIs(t, err, cohorts.ErrInvalidCohort)
+	_, err = service.Report(cohorts.Query{TenantID: tenant.ID, Granularity: "day", From: from, To: to})
+	assert.ErrorIs(t, err, cohorts.ErrInvalidGranularity)
+	_, err = service.Report(cohorts.Query{TenantID: tenant.ID, Periods: cohorts.MaxPeriods + 1, From: from, To: to})
+	assert.ErrorIs(t, err, cohorts.ErrInvalidPeriods)
+	_, err = service.Report(cohorts.Query{TenantID: tenant.ID, From: to, To: from})
+	assert.ErrorIs(t, err, cohorts.ErrInvalidRange)
+	_, err = service.Report(cohorts.Query{TenantID: tenant.ID, From: from, To: from.AddDate(2, 0, 0)})
+	assert.ErrorIs(t, err, cohorts.ErrInvalidRange)
+
+	// Periods that have not started yet are left out
+	now := time.Now().UTC()
+	lastMonth := time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, time.UTC)
+	report, err := service.Report(cohorts.Query{TenantID: tenant.ID, Granularity: "month", From: lastMonth, To: now})
+	assert.NoError(t, err)
+	assert.Len(t, report.Cohorts, 2)
+	assert.Len(t, report.Cohorts[0].Periods, 2)
+	assert.Len(t, report.Cohorts[1].Periods, 1)
+	assert.Equal(t, int64(0), report.Cohorts[0].Size)
+}
@@ -0,0 +1,142 @@
+package events_test
+
+import (
+	"nyasah-backend/models"
+	"nyasah-backend/services/events"
+	"nyasah-backend/tests/testutil"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func setupDB(t *testing.T) *gorm.DB {
+	return testutil.DB(t, &models.ProofEvent{}, &models.ProofPerformance{}, &models.SocialProof{}, &models.ProofRollup{})
+}
+
+func TestIngestion(t *testing.T) {
+	db := setupDB(t)
+	ingester := events.NewIngester(db, events.Options{BufferSize: 10})
+
+	tenantID := uuid.New()
+	proofID := uuid.New()
+	impression := models.ProofEvent{TenantID: tenantID, EventID: "e1", Type: events.TypeImpression, ProofID: &proofID, OccurredAt: time.Now()}
+
+	t.Run("Duplicates in the buffer are skipped", func(t *testing.T) {
+		added, err := ingester.Add([]models.ProofEvent{impression, impression})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, added)
+		assert.Equal(t, 1, ingester.Len())
+	})
+
+	t.Run("Duplicates across flushes are stored once", func(t *testing.T) {
+		assert.NoError(t, ingester.Flush())
+		_, err := ingester.Add([]models.ProofEvent{impression})
+		assert.NoError(t, err)
+		assert.NoError(t, ingester.Flush())
+
+		var count int64
+		db.Model(&models.ProofEvent{}).Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("Full buffer rejects events", func(t *testing.T) {
+		batch := make([]models.ProofEvent, 11)
+		_, err := ingester.Add(batch)
+		assert.ErrorIs(t, err, events.ErrBufferFull)
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		assert.Error(t, events.Validate(models.ProofEvent{EventID: "x", Type: events.TypeImpression}))
+		assert.Error(t, events.Validate(models.ProofEvent{EventID: "x", Type: "hover", ProofID: &proofID}))
+		assert.Error(t, events.Validate(models.ProofEvent{Type: events.TypeClick, ProofID: &proofID}))
+		assert.Error(t, events.Validate(models.ProofEvent{EventID: "x", Type: events.TypeConversion}))
+		assert.NoError(t, events.Validate(models.ProofEvent{EventID: "x", Type: events.TypeConversion, VisitorID: "v"}))
+	})
+}
+
+func TestAggregation(t *testing.T) {
+	db := setupDB(t)
+	ingester := events.NewIngester(db, events.Options{AttributionWindow: time.Hour})
+
+	tenantID := uuid.New()
+	firstProof := models.SocialProof{TenantID: tenantID, EntityID: uuid.New(), Type: "purchase", Content: "Jane bought a mug"}
+	secondProof := models.SocialProof{TenantID: tenantID, EntityID: uuid.New(), Type: "review", Content: "Lovely mug"}
+	assert.NoError(t, db.Create(&firstProof).Error)
+	assert.NoError(t, db.Create(&secondProof).Error)
+	first, second := firstProof.ID, secondProof.ID
+	now := time.Now()
+
+	_, err := ingester.Add([]models.ProofEvent{
+		{TenantID: tenantID, EventID: "i1", Type: events.TypeImpression, ProofID: &first, VisitorID: "alice", OccurredAt: now.Add(-30 * time.Minute)},
+		{TenantID: tenantID, EventID: "i2", Type: events.TypeImpression, ProofID: &second, VisitorID: "alice", OccurredAt: now.Add(-20 * time.Minute)},
+		{TenantID: tenantID, EventID: "c1", Type: events.TypeClick, ProofID: &first, VisitorID: "alice", OccurredAt: now.Add(-10 * time.Minute)},
+		{TenantID: tenantID, EventID: "i3", Type: events.TypeImpression, ProofID: &first, VisitorID: "bob", OccurredAt: now.Add(-3 * time.Hour)},
+		// Alice converts after clicking the first proof last
+		{TenantID: tenantID, EventID: "v1", Type: events.TypeConversion, VisitorID: "alice", Value: 40, OccurredAt: now},
+		// Bob's impression is outside the attribution window
+		{TenantID: tenantID, EventID: "v2", Type: events.TypeConversion, VisitorID: "bob", OccurredAt: now},
+		// Another tenant's storefront reports this tenant's proof
+		{TenantID: uuid.New(), EventID: "f1", Type: events.TypeImpression, ProofID: &first, VisitorID: "mallory", OccurredAt: now},
+		{TenantID: uuid.New(), EventID: "f2", Type: events.TypeClick, ProofID: &first, VisitorID: "mallory", OccurredAt: now},
+	})
+	assert.NoError(t, err)
+
+	processed, err := ingester.Aggregate()
+	assert.NoError(t, err)
+	assert.Equal(t, 8, processed)
+
+	var perf models.ProofPerformance
+	assert.NoError(t, db.Where("proof_id = ? AND variant_id IS NULL", first).First(&perf).Error)
+	assert.Equal(t, 2, perf.Views)
+	assert.Equal(t, 1, perf.Clicks)
+	assert.Equal(t, 1, perf.Conversions)
+	assert.InDelta(t, 0.5, perf.EngagementRate, 1e-9)
+
+	var other models.ProofPerformance
+	assert.NoError(t, db.Where("proof_id = ? AND variant_id IS NULL", second).First(&other).Error)
+	assert.Equal(t, 1, other.Views)
+	assert.Equal(t, 0, other.Conversions)
+
+	var conversion models.ProofEvent
+	assert.NoError(t, db.Where("event_id = ?", "v1").First(&conversion).Error)
+	assert.Equal(t, first, *conversion.ProofID)
+
+	var unattributed models.ProofEvent
+	assert.NoError(t, db.Where("event_id = ?", "v2").First(&unattributed).Error)
+	assert.Nil(t, unattributed.ProofID)
+
+	// Aggregation is incremental: nothing is counted twice
+	processed, err = ingester.Aggregate()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, processed)
+
+	// Later batches add to the same row
+	_, err = ingester.Add([]models.ProofEvent{
+		{TenantID: tenantID, EventID: "i4", Type: events.TypeImpression, ProofID: &first, VisitorID: "carol", OccurredAt: now},
+	})
+	assert.NoError(t, err)
+	_, err = ingester.Aggregate()
+	assert.NoError(t, err)
+
+	var rows []models.ProofPerformance
+	assert.NoError(t, db.Where("proof_id = ? AND variant_id IS NULL", first).Find(&rows).Error)
+	if assert.Len(t, rows, 1) {
+		assert.Equal(t, 3, rows[0].Views)
+		assert.Equal(t, 1, rows[0].Clicks)
+		assert.InDelta(t, 1.0/3, rows[0].EngagementRate, 1e-9)
+	}
+}
+
+func TestCustomerToken(t *testing.T) {
+	userID := uuid.New()
+	token := events.CustomerToken("tenant-api-key", userID)
+
+	assert.True(t, events.VerifyCustomer("tenant-api-key", userID, token))
+	assert.False(t, events.VerifyCustomer("tenant-api-key", uuid.New(), token))
+	assert.False(t, events.VerifyCustomer("other-api-key", userID, token))
+	assert.False(t, events.VerifyCustomer("tenant-api-key", userID, ""))
+	assert.False(t, events.VerifyCustomer("", userID, events.CustomerToken("", userID)))
+}
@@ -0,0 +1,183 @@
+package experiments_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"nyasah-backend/models"
+	"nyasah-backend/services/experiments"
+	"nyasah-backend/tests/testutil"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssign(t *testing.T) {
+	experiment := models.Experiment{
+		ID: uuid.New(),
+		Variants: []models.ExperimentVariant{
+			{ID: uuid.New(), Name: "control", IsControl: true, Weight: 1},
+			{ID: uuid.New(), Name: "treatment", Weight: 3},
+		},
+	}
+
+	first, ok := experiments.Assign(experiment, "visitor-1")
+	assert.True(t, ok)
+
+	// Order of variants must not change the bucket
+	reversed := experiment
+	reversed.Variants = []models.ExperimentVariant{experiment.Variants[1], experiment.Variants[0]}
+	again, _ := experiments.Assign(reversed, "visitor-1")
+	assert.Equal(t, first.ID, again.ID)
+
+	counts := make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		variant, _ := experiments.Assign(experiment, fmt.Sprintf("visitor-%d", i))
+		counts[variant.Name]++
+	}
+	assert.InDelta(t, 1000, counts["control"], 150)
+	assert.InDelta(t, 3000, counts["treatment"], 150)
+
+	_, ok = experiments.Assign(models.Experiment{ID: uuid.New()}, "visitor-1")
+	assert.False(t, ok)
+}
+
+func TestAnalyze(t *testing.T) {
+	t.Run("Significant winner stops the test", func(t *testing.T) {
+		results := experiments.Analyze([]experiments.VariantStats{
+			{VariantID: "a", IsControl: true, Exposures: 5000, Conversions: 250},
+			{VariantID: "b", Exposures: 5000, Conversions: 350},
+		}, 0.95, 1000)
+
+		assert.Equal(t, experiments.RecommendStopWinner, results.Recommendation)
+		assert.Equal(t, "b", results.BestVariantID)
+
+		b := results.Variants[1]
+		assert.True(t, b.Significant)
+		assert.InDelta(t, 0.4, b.Lift, 0.001)
+		assert.Less(t, b.PValue, 0.05)
+		assert.True(t, b.DiffInterval.Low > 0 && b.DiffInterval.High > b.DiffInterval.Low)
+		assert.True(t, b.RateInterval.Low < 0.07 && b.RateInterval.High > 0.07)
+	})
+
+	t.Run("Too few exposures keeps running", func(t *testing.T) {
+		results := experiments.Analyze([]experiments.VariantStats{
+			{VariantID: "a", IsControl: true, Exposures: 100, Conversions: 5},
+			{VariantID: "b", Exposures: 100, Conversions: 30},
+		}, 0.95, 1000)
+
+		assert.Equal(t, experiments.RecommendContinue, results.Recommendation)
+	})
+
+	t.Run("No difference stops without a winner", func(t *testing.T) {
+		results := experiments.Analyze([]experiments.VariantStats{
+			{VariantID: "a", IsControl: true, Exposures: 5000, Conversions: 250},
+			{VariantID: "b", Exposures: 5000, Conversions: 255},
+		}, 0.95, 1000)
+
+		assert.Equal(t, experiments.RecommendStopNoEffect, results.Recommendation)
+		assert.Empty(t, results.BestVariantID)
+	})
+
+	t.Run("Bonferroni correction for several variants", func(t *testing.T) {
+		results := experiments.Analyze([]experiments.VariantStats{
+			{VariantID: "a", IsControl: true},
+			{VariantID: "b"},
+			{VariantID: "c"},
+		}, 0.95, 0)
+
+		assert.InDelta(t, 0.025, results.Alpha, 1e-9)
+	})
+}
+
+func TestExposureConversionAndPromotion(t *testing.T) {
+	db := testutil.DB(t, &models.Tenant{}, &models.ProofTemplate{}, &models.ProofPerformance{},
+		&models.Experiment{}, &models.ExperimentVariant{}, &models.ExperimentAssignment{})
+
+	tenant := models.Tenant{Name: "Shop", Domain: "shop.test", ApiKey: "key", Settings: json.RawMessage(`{"default_locale":"fr"}`)}
+	assert.NoError(t, db.Create(&tenant).Error)
+
+	experiment := models.Experiment{
+		TenantID:        tenant.ID,
+		Name:            "Toast copy",
+		ProofType:       "purchase",
+		Status:          experiments.StatusRunning,
+		ConfidenceLevel: 0.95,
+		MinSampleSize:   1,
+		Variants: []models.ExperimentVariant{
+			{Name: "control", IsControl: true, Weight: 1},
+			{Name: "urgent", Weight: 1, Config: models.VariantConfig{
+				TemplateBody: "{name} just grabbed {entity_name}!",
+				Placement:    "top-right",
+				DelaySeconds: 3,
+			}},
+		},
+	}
+	assert.NoError(t, db.Create(&experiment).Error)
+
+	service := experiments.NewService(db)
+
+	running, err := service.Running(tenant.ID, "purchase")
+	assert.NoError(t, err)
+	assert.NotNil(t, running)
+	assert.Len(t, running.Variants, 2)
+
+	control, treatment := experiment.Variants[0], experiment.Variants[1]
+	proofID := uuid.New()
+
+	// Repeated exposures keep one assignment per visitor but count every view
+	assert.NoError(t, service.RecordExposure(experiment.ID, treatment.ID, "v1", []uuid.UUID{proofID}))
+	assert.NoError(t, service.RecordExposure(experiment.ID, treatment.ID, "v1", []uuid.UUID{proofID}))
+	assert.NoError(t, service.RecordExposure(experiment.ID, control.ID, "v2", []uuid.UUID{proofID}))
+
+	var assignments int64
+	db.Model(&models.ExperimentAssignment{}).Count(&assignments)
+	assert.Equal(t, int64(2), assignments)
+
+	count, err := service.RecordConversion(tenant.ID, "v1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// Converting twice does not double count
+	count, err = service.RecordConversion(tenant.ID, "v1")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	var perf models.ProofPerformance
+	assert.NoError(t, db.Where("proof_id = ? AND variant_id = ?", proofID, treatment.ID).First(&perf).Error)
+	assert.Equal(t, 2, perf.Views)
+	assert.Equal(t, 1, perf.Conversions)
+	assert.InDelta(t, 0.5, perf.EngagementRate, 1e-9)
+
+	// One row per proof and variant, so concurrent renders cannot add another
+	var rows int64
+	db.Model(&models.ProofPerformance{}).Where("proof_id = ? AND variant_id = ?", proofID, treatment.ID).Count(&rows)
+	assert.Equal(t, int64(1), rows)
+	assert.Error(t, db.Create(&models.ProofPerformance{ProofID: proofID, VariantID: &treatment.ID}).Error)
+
+	results, err := service.Results(*running)
+	assert.NoError(t, err)
+	for _, v := range results.Variants {
+		assert.Equal(t, int64(1), v.Exposures)
+		if v.VariantID == treatment.ID.String() {
+			assert.Equal(t, int64(1), v.Conversions)
+		}
+	}
+
+	assert.NoError(t, service.Promote(*running, treatment.ID))
+
+	var tmpl models.ProofTemplate
+	assert.NoError(t, db.Where("tenant_id = ? AND type = ?", tenant.ID, "purchase").First(&tmpl).Error)
+	assert.Equal(t, "fr", tmpl.Locale)
+	assert.Equal(t, treatment.Config.TemplateBody, tmpl.Body)
+
+	var updated models.Tenant
+	assert.NoError(t, db.First(&updated, "id = ?", tenant.ID).Error)
+	assert.JSONEq(t, `{"default_locale":"fr","widget":{"position":"top-right","delay_seconds":3}}`, string(updated.Settings))
+
+	var completed models.Experiment
+	assert.NoError(t, db.First(&completed, "id = ?", experiment.ID).Error)
+	assert.Equal(t, experiments.StatusCompleted, completed.Status)
+	assert.Equal(t, treatment.ID, *completed.WinnerVariantID)
+	assert.NotNil(t, completed.EndedAt)
+}
@@ -0,0 +1,363 @@
+package exports_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"nyasah-backend/models"
+	"nyasah-backend/services/exports"
+	"nyasah-backend/services/jobs"
+	"nyasah-backend/tests/testutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func setupDB(t *testing.T) *gorm.DB {
+	return testutil.DB(t, &models.Tenant{}, &models.Review{}, &models.SocialProof{}, &models.ProofEvent{},
+		&models.AIRecommendation{}, &models.Export{}, &models.ExportSchedule{}, &models.Job{})
+}
+
+func setupService(t *testing.T, db *gorm.DB) (*exports.Service, *jobs.Queue, string) {
+	dir := t.TempDir()
+	service := exports.NewService(db, exports.Options{Dir: dir, SigningKey: []byte("secret")})
+	queue := jobs.NewQueue(db, jobs.Options{})
+	service.RegisterJobs(queue)
+	return service, queue, dir
+}
+
+func createTenant(t *testing.T, db *gorm.DB) models.Tenant {
+	tenant := models.Tenant{Name: "Shop", Domain: uuid.NewString() + ".example.com", Type: "ecommerce", ApiKey: uuid.NewString()}
+	assert.NoError(t, db.Create(&tenant).Error)
+	return tenant
+}
+
+func createReview(t *testing.T, db *gorm.DB, tenantID, entityID uuid.UUID, rating int, at time.Time) models.Review {
+	review := models.Review{
+		TenantID:  tenantID,
+		EntityID:  entityID,
+		Rating:    rating,
+		Content:   "Review " + strconv.Itoa(rating),
+		Status:    "approved",
+		Keywords:  []string{"fit", "quality"},
+		CreatedAt: at,
+		UpdatedAt: at,
+	}
+	assert.NoError(t, db.Create(&review).Error)
+	return review
+}
+
+// runExport creates an export and processes its job
+func runExport(t *testing.T, db *gorm.DB, service *exports.Service, queue *jobs.Queue, export models.Export) models.Export {
+	assert.NoError(t, service.Create(&export))
+	found, err := queue.Work(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.NoError(t, db.First(&export, "id = ?", export.ID).Error)
+	return export
+}
+
+func TestFormats(t *testing.T) {
+	db := setupDB(t)
+	service, queue, _ := setupService(t, db)
+	tenant := createTenant(t, db)
+	other := createTenant(t, db)
+	entityID := uuid.New()
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	first := createReview(t, db, tenant.ID, entityID, 5, base)
+	createReview(t, db, tenant.ID, entityID, 3, base.Add(time.Hour))
+	createReview(t, db, other.ID, entityID, 4, base)
+
+	csvExport := runExport(t, db, service, queue, models.Export{TenantID: tenant.ID, Dataset: exports.DatasetReviews, Format: exports.FormatCSV})
+	assert.Equal(t, exports.StatusCompleted, csvExport.Status)
+	assert.Equal(t, int64(2), csvExport.Rows)
+	assert.NotNil(t, csvExport.ExpiresAt)
+
+	file, err := os.Open(service.File(csvExport))
+	assert.NoError(t, err)
+	lines, err := csv.NewReader(file).ReadAll()
+	file.Close()
+	assert.NoError(t, err)
+	assert.Len(t, lines, 3)
+	assert.Equal(t, []string{"id", "entity_id", "user_id", "rating", "content", "verified", "status",
+		"sentiment", "keywords", "enriched_at", "created_at", "updated_at"}, lines[0])
+	assert.Equal(t, first.ID.String(), lines[1][0])
+	assert.Equal(t, "5", lines[1][3])
+	assert.Equal(t, `["fit","quality"]`, lines[1][8])
+	assert.Equal(t, "", lines[1][9])
+	assert.Equal(t, "2024-05-01T12:00:00Z", lines[1][10])
+
+	ndjsonExport := runExport(t, db, service, queue, models.Export{TenantID: tenant.ID, Dataset: exports.DatasetReviews, Format: exports.FormatNDJSON})
+	file, err = os.Open(service.File(ndjsonExport))
+	assert.NoError(t, err)
+	var records []exports.ReviewRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record exports.ReviewRecord
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	file.Close()
+	assert.Len(t, records, 2)
+	assert.Equal(t, int64(3), records[1].Rating)
+
+	parquetExport := runExport(t, db, service, queue, models.Export{TenantID: tenant.ID, Dataset: exports.DatasetReviews, Format: exports.FormatParquet})
+	assert.Equal(t, exports.StatusCompleted, parquetExport.Status)
+	rows, err := parquet.ReadFile[exports.ReviewRecord](service.File(parquetExport))
+	assert.NoError(t, err)
+	assert.Len(t, rows, 2)
+	assert.Equal(t, first.ID.String(), rows[0].ID)
+	assert.Equal(t, []string{"fit", "quality"}, rows[0].Keywords)
+	assert.True(t, base.Equal(rows[0].CreatedAt))
+	assert.Equal(t, "reviews-"+parquetExport.CompletedAt.UTC().Format("20060102T150405Z")+".parquet", exports.Filename(parquetExport))
+}
+
+func TestFiltersAndCursor(t *testing.T) {
+	db := setupDB(t)
+	service, queue, _ := setupService(t, db)
+	tenant := createTenant(t, db)
+	entityID := uuid.New()
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	createReview(t, db, tenant.ID, entityID, 5, base)
+	low := createReview(t, db, tenant.ID, entityID, 2, base.Add(time.Hour))
+	createReview(t, db, tenant.ID, uuid.New(), 4, base.Add(2*time.Hour))
+
+	assert.ErrorIs(t, exports.Validate("orders", exports.FormatCSV, models.ExportFilters{}, ""), exports.ErrInvalidDataset)
+	assert.ErrorIs(t, exports.Validate(exports.DatasetReviews, "xlsx", models.ExportFilters{}, ""), exports.ErrInvalidFormat)
+	assert.ErrorIs(t, exports.Validate(exports.DatasetInsights, exports.FormatCSV, models.ExportFilters{MinRating: 3}, ""), exports.ErrInvalidFilter)
+	assert.ErrorIs(t, exports.Validate(exports.DatasetReviews, exports.FormatCSV, models.ExportFilters{}, "nonsense"), exports.ErrInvalidCursor)
+
+	filtered := runExport(t, db, service, queue, models.Export{
+		TenantID: tenant.ID,
+		Dataset:  exports.DatasetReviews,
+		Format:   exports.FormatCSV,
+		Filters:  models.ExportFilters{EntityID: &entityID, MinRating: 3},
+	})
+	assert.Equal(t, int64(1), filtered.Rows)
+
+	from, to := base.Add(30*time.Minute), base.Add(90*time.Minute)
+	window := runExport(t, db, service, queue, models.Export{
+		TenantID: tenant.ID,
+		Dataset:  exports.DatasetReviews,
+		Format:   exports.FormatNDJSON,
+		Filters:  models.ExportFilters{From: &from, To: &to},
+	})
+	assert.Equal(t, int64(1), window.Rows)
+
+	// An incremental export picks up new rows and rows changed since the cursor
+	full := runExport(t, db, service, queue, models.Export{TenantID: tenant.ID, Dataset: exports.DatasetReviews, Format: exports.FormatCSV})
+	assert.Equal(t, int64(3), full.Rows)
+	assert.NotEmpty(t, full.NextCursor)
+
+	empty := runExport(t, db, service, queue, models.Export{TenantID: tenant.ID, Dataset: exports.DatasetReviews, Format: exports.FormatCSV, Since: full.NextCursor})
+	assert.Equal(t, int64(0), empty.Rows)
+	assert.Equal(t, full.NextCursor, empty.NextCursor)
+
+	added := createReview(t, db, tenant.ID, entityID, 1, base.Add(3*time.Hour))
+	assert.NoError(t, db.Model(&low).UpdateColumns(map[string]interface{}{"status": "rejected", "updated_at": base.Add(4 * time.Hour)}).Error)
+
+	delta := runExport(t, db, service, queue, models.Export{TenantID: tenant.ID, Dataset: exports.DatasetReviews, Format: exports.FormatNDJSON, Since: full.NextCursor})
+	assert.Equal(t, int64(2), delta.Rows)
+	data, err := os.ReadFile(service.File(delta))
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Contains(t, lines[0], added.ID.String())
+	assert.Contains(t, lines[1], low.ID.String())
+	assert.Contains(t, lines[1], `"status":"rejected"`)
+
+	// A plain time works as since too
+	since := runExport(t, db, service, queue, models.Export{TenantID: tenant.ID, Dataset: exports.DatasetReviews, Format: exports.FormatCSV, Since: base.Add(2 * time.Hour).Format(time.RFC3339)})
+	assert.Equal(t, int64(2), since.Rows)
+}
+
+func TestDownloadURL(t *testing.T) {
+	db := setupDB(t)
+	service, _, _ := setupService(t, db)
+	id := uuid.New()
+	now := time.Now()
+
+	link, expires := service.DownloadURL(id, now)
+	assert.True(t, strings.HasPrefix(link, "/api/exports/"+id.String()+"/download?"))
+	assert.WithinDuration(t, now.Add(15*time.Minute), expires, time.Second)
+
+	u, err := http.NewRequest(http.MethodGet, link, nil)
+	assert.NoError(t, err)
+	query := u.URL.Query()
+
+	assert.NoError(t, service.Verify(id, query.Get("expires"), query.Get("signature"), now))
+	assert.ErrorIs(t, service.Verify(uuid.New(), query.Get("expires"), query.Get("signature"), now), exports.ErrInvalidSignature)
+	assert.ErrorIs(t, service.Verify(id, strconv.FormatInt(expires.Unix()+3600, 10), query.Get("signature"), now), exports.ErrInvalidSignature)
+	assert.ErrorIs(t, service.Verify(id, query.Get("expires"), query.Get("signature"), now.Add(16*time.Minute)), exports.ErrLinkExpired)
+
+	other := exports.NewService(db, exports.Options{SigningKey: []byte("other")})
+	assert.ErrorIs(t, other.Verify(id, query.Get("expires"), query.Get("signature"), now), exports.ErrInvalidSignature)
+
+	// Without a key nothing verifies, not even a signature made with an empty key
+	unsigned := exports.NewService(db, exports.Options{})
+	assert.False(t, unsigned.Signed())
+	path, _ := unsigned.DownloadURL(id, now)
+	u, err = http.NewRequest(http.MethodGet, path, nil)
+	assert.NoError(t, err)
+	query = u.URL.Query()
+	assert.ErrorIs(t, unsigned.Verify(id, query.Get("expires"), query.Get("signature"), now), exports.ErrDownloadsDisabled)
+}
+
+func TestScheduledExport(t *testing.T) {
+	db := setupDB(t)
+	service, queue, dir := setupService(t, db)
+	tenant := createTenant(t, db)
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	createReview(t, db, tenant.ID, uuid.New(), 5, base)
+
+	schedule := models.ExportSchedule{
+		TenantID:    tenant.ID,
+		Name:        "Nightly reviews",
+		Dataset:     exports.DatasetReviews,
+		Format:      exports.FormatNDJSON,
+		Schedule:    "@daily",
+		Destination: models.ExportDestination{Type: exports.DestinationLocal, Path: "warehouse/reviews"},
+		Enabled:     true,
+	}
+	assert.NoError(t, exports.ValidateSchedule(&schedule))
+	now := time.Now()
+	assert.NoError(t, service.Reschedule(&schedule, now))
+	assert.NotNil(t, schedule.NextRunAt)
+	assert.NoError(t, db.Create(&schedule).Error)
+
+	bad := schedule
+	bad.Destination = models.ExportDestination{Type: exports.DestinationLocal, Path: "../elsewhere"}
+	assert.Error(t, exports.ValidateSchedule(&bad))
+	bad.Destination = models.ExportDestination{Type: exports.DestinationS3, Bucket: "exports"}
+	assert.Error(t, exports.ValidateSchedule(&bad))
+	bad.Destination = models.ExportDestination{Type: exports.DestinationS3, Bucket: "exports", AccessKeyID: "AKID", Endpoint: "http://169.254.169.254"}
+	bad.DestinationSecret = "secret"
+	assert.ErrorContains(t, exports.ValidateSchedule(&bad), "public address")
+	bad.Destination = models.ExportDestination{Type: "ftp"}
+	assert.ErrorIs(t, exports.ValidateSchedule(&bad), exports.ErrInvalidDestination)
+
+	// Not due yet
+	started, err := service.Dispatch(now)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, started)
+
+	due := schedule.NextRunAt.Add(time.Minute)
+	started, err = service.Dispatch(due)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, started)
+
+	// The first export is still queued, so the next run is skipped
+	started, err = service.Dispatch(due.Add(24 * time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, started)
+
+	found, err := queue.Work(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	var export models.Export
+	assert.NoError(t, db.First(&export, "schedule_id = ?", schedule.ID).Error)
+	assert.Equal(t, exports.StatusCompleted, export.Status)
+	assert.NotNil(t, export.DeliveredAt)
+
+	delivered := filepath.Join(dir, "destinations", tenant.ID.String(), "warehouse", "reviews", exports.Filename(export))
+	data, err := os.ReadFile(delivered)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(data), "\n"))
+
+	assert.NoError(t, db.First(&schedule, "id = ?", schedule.ID).Error)
+	assert.Equal(t, export.NextCursor, schedule.Cursor)
+
+	// The next run only exports what changed since
+	createReview(t, db, tenant.ID, uuid.New(), 4, base.Add(time.Hour))
+	started, err = service.Dispatch(schedule.NextRunAt.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, started)
+	found, err = queue.Work(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	var next models.Export
+	assert.NoError(t, db.Where("schedule_id = ? AND id <> ?", schedule.ID, export.ID).First(&next).Error)
+	assert.Equal(t, export.NextCursor, next.Since)
+	assert.Equal(t, int64(1), next.Rows)
+	assert.NotNil(t, next.DeliveredAt)
+}
+
+func TestS3Destination(t *testing.T) {
+	var gotPath, gotAuth, gotHash, gotType string
+	var gotBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		gotAuth = r.Header.Get("Authorization")
+		gotHash = r.Header.Get("X-Amz-Content-Sha256")
+		gotType = r.Header.Get("Content-Type")
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	dest := exports.S3Destination{
+		Endpoint:        server.URL,
+		Region:          "eu-west-1",
+		Bucket:          "analytics",
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+	}
+	body := "id,rating\n1,5\n"
+	err := dest.Put(context.Background(), "nyasah/reviews 2024.csv", strings.NewReader(body), int64(len(body)), "text/csv")
+	assert.NoError(t, err)
+
+	assert.Equal(t, "/analytics/nyasah/reviews%202024.csv", gotPath)
+	assert.Equal(t, body, string(gotBody))
+	assert.Equal(t, "text/csv", gotType)
+	assert.Len(t, gotHash, 64)
+	assert.True(t, strings.HasPrefix(gotAuth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/"), gotAuth)
+	assert.Contains(t, gotAuth, "/eu-west-1/s3/aws4_request, SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date, Signature=")
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+	}))
+	defer failing.Close()
+	dest.Endpoint = failing.URL
+	err = dest.Put(context.Background(), "file.csv", strings.NewReader(body), int64(len(body)), "text/csv")
+	assert.ErrorContains(t, err, "403")
+}
+
+func TestCleanup(t *testing.T) {
+	db := setupDB(t)
+	service, queue, _ := setupService(t, db)
+	tenant := createTenant(t, db)
+	createReview(t, db, tenant.ID, uuid.New(), 5, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+
+	export := runExport(t, db, service, queue, models.Export{TenantID: tenant.ID, Dataset: exports.DatasetReviews, Format: exports.FormatCSV})
+	_, err := os.Stat(service.File(export))
+	assert.NoError(t, err)
+
+	removed, err := service.Cleanup(time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+
+	removed, err = service.Cleanup(export.ExpiresAt.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	_, err = os.Stat(service.File(export))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.NoError(t, db.First(&export, "id = ?", export.ID).Error)
+	assert.Equal(t, exports.StatusExpired, export.Status)
+	assert.Empty(t, export.Path)
+}
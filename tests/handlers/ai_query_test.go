@@ -0,0 +1,197 @@
+package handlers_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"nyasah-backend/api/handlers"
+	"nyasah-backend/config"
+	"nyasah-backend/models"
+	"nyasah-backend/services"
+	"nyasah-backend/services/ai/factory"
+	"nyasah-backend/tests/testutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// fakeClaude streams words as Messages API events. With hang set it stops
+// after the first word and waits for the caller to go away.
+func fakeClaude(words []string, hang bool, cancelled chan<- struct{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		send := func(event map[string]interface{}) {
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event["type"], data)
+			w.(http.Flusher).Flush()
+		}
+
+		send(map[string]interface{}{"type": "message_start", "message": map[string]interface{}{
+			"id": "msg_01", "type": "message", "role": "assistant", "model": "claude-test",
+			"content": []interface{}{}, "stop_reason": nil, "stop_sequence": nil,
+			"usage": map[string]interface{}{"input_tokens": 10, "output_tokens": 1},
+		}})
+		send(map[string]interface{}{"type": "content_block_start", "index": 0, "content_block": map[string]interface{}{"type": "text", "text": ""}})
+		for i, word := range words {
+			send(map[string]interface{}{"type": "content_block_delta", "index": 0, "delta": map[string]interface{}{"type": "text_delta", "text": word}})
+			if hang && i == 0 {
+				<-r.Context().Done()
+				close(cancelled)
+				return
+			}
+		}
+		send(map[string]interface{}{"type": "content_block_stop", "index": 0})
+		send(map[string]interface{}{"type": "message_delta",
+			"delta": map[string]interface{}{"stop_reason": "end_turn", "stop_sequence": nil},
+			"usage": map[string]interface{}{"output_tokens": len(words)},
+		})
+		send(map[string]interface{}{"type": "message_stop"})
+	}))
+}
+
+// queryServer serves the AI query endpoint for one tenant. finished is
+// closed when the handler returns.
+func queryServer(t *testing.T, claudeURL string, tenantID uuid.UUID, finished chan struct{}) (*httptest.Server, *gorm.DB) {
+	db := testutil.DB(t, &models.AIQuery{}, &models.Entity{}, &models.Review{}, &models.SocialProof{}, &models.ReviewEmbedding{})
+
+	t.Setenv("CLAUDE_API_KEY", "test-key")
+	t.Setenv("CLAUDE_BASE_URL", claudeURL)
+	aiService := services.NewAIService(db, &config.Config{Provider: factory.Claude})
+
+	router := gin.New()
+	router.POST("/api/ai/query", func(c *gin.Context) {
+		defer close(finished)
+		c.Set("tenant_id", tenantID)
+		c.Next()
+	}, handlers.NewAIQueryHandler(db, aiService).Query)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server, db
+}
+
+type sseEvent struct {
+	name string
+	data map[string]interface{}
+}
+
+// readEvent reads the next Server-Sent Event
+func readEvent(t *testing.T, r *bufio.Reader) sseEvent {
+	var event sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		if !assert.NoError(t, err) {
+			return event
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			return event
+		case strings.HasPrefix(line, "event: "):
+			event.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event.data))
+		}
+	}
+}
+
+func TestAIQueryStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tenantID := uuid.New()
+
+	claude := fakeClaude([]string{"Show ", "recent ", "reviews ", "[R1]."}, false, nil)
+	defer claude.Close()
+	finished := make(chan struct{})
+	server, db := queryServer(t, claude.URL, tenantID, finished)
+
+	review := models.Review{TenantID: tenantID, Rating: 5, Content: "Converted me instantly"}
+	assert.NoError(t, db.Create(&review).Error)
+
+	body, _ := json.Marshal(map[string]interface{}{"query": "How do I convert more?", "stream": true})
+	resp, err := http.Post(server.URL+"/api/ai/query", "application/json", bytes.NewReader(body))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	event := readEvent(t, reader)
+	assert.Equal(t, "sources", event.name)
+	assert.Equal(t, true, event.data["streaming"])
+	if sources, ok := event.data["sources"].([]interface{}); assert.True(t, ok) && assert.Len(t, sources, 1) {
+		assert.Equal(t, review.ID.String(), sources[0].(map[string]interface{})["id"])
+		assert.Equal(t, "R1", sources[0].(map[string]interface{})["label"])
+	}
+
+	var tokens []string
+	event = readEvent(t, reader)
+	for event.name == "token" {
+		tokens = append(tokens, event.data["text"].(string))
+		event = readEvent(t, reader)
+	}
+	assert.Equal(t, []string{"Show ", "recent ", "reviews ", "[R1]."}, tokens)
+
+	assert.Equal(t, "done", event.name)
+	assert.Equal(t, "Show recent reviews [R1].", event.data["response"])
+	assert.Equal(t, []interface{}{review.ID.String()}, event.data["source_review_ids"])
+	<-finished
+
+	var stored models.AIQuery
+	if assert.NoError(t, db.First(&stored).Error) {
+		assert.NotEqual(t, uuid.Nil, stored.ID)
+		assert.Equal(t, event.data["id"], stored.ID.String())
+		assert.Equal(t, tenantID, stored.TenantID)
+		assert.Equal(t, "How do I convert more?", stored.Query)
+		assert.Equal(t, "Show recent reviews [R1].", stored.Response)
+		assert.Equal(t, []uuid.UUID{review.ID}, stored.SourceReviewIDs)
+	}
+}
+
+func TestAIQueryStreamCancelled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cancelled := make(chan struct{})
+	claude := fakeClaude([]string{"Show ", "recent ", "reviews."}, true, cancelled)
+	defer claude.Close()
+	finished := make(chan struct{})
+	server, db := queryServer(t, claude.URL, uuid.New(), finished)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/api/ai/query",
+		strings.NewReader(`{"query": "How do I convert more?"}`))
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	assert.Equal(t, "sources", readEvent(t, reader).name)
+	assert.Equal(t, "token", readEvent(t, reader).name)
+
+	// Hanging up aborts the provider call, and the partial answer is dropped
+	cancel()
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the provider call was not cancelled")
+	}
+	<-finished
+
+	var count int64
+	db.Model(&models.AIQuery{}).Count(&count)
+	assert.Zero(t, count)
+}
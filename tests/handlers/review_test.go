@@ -31,7 +31,7 @@ func TestReviewHandler(t *testing.T) {
 		// Mock user authentication
 		c.Set("user_id", uuid.New())
 
-		handler := handlers.NewReviewHandler(nil)
+		handler := handlers.NewReviewHandler(nil, nil)
 		handler.Create(c)
 
 		assert.Equal(t, http.StatusCreated, w.Code)
@@ -43,7 +43,7 @@ func TestReviewHandler(t *testing.T) {
 		reviewID := uuid.New()
 		c.Request, _ = http.NewRequest("GET", "/api/reviews/"+reviewID.String(), nil)
 
-		handler := handlers.NewReviewHandler(nil)
+		handler := handlers.NewReviewHandler(nil, nil)
 		handler.Get(c)
 
 		assert.Equal(t, http.StatusOK, w.Code)
@@ -6,7 +6,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"nyasah-backend/api/handlers"
+	"nyasah-backend/models"
+	"nyasah-backend/services/stream"
+	"nyasah-backend/tests/testutil"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -31,27 +35,63 @@ func TestSocialProofHandler(t *testing.T) {
 		// Mock user authentication
 		c.Set("user_id", uuid.New())
 
-		handler := handlers.NewSocialProofHandler(nil)
+		handler := handlers.NewSocialProofHandler(nil, stream.NewHub(stream.Options{}), nil)
 		handler.Create(c)
 
 		assert.Equal(t, http.StatusCreated, w.Code)
 	})
 
 	t.Run("Get Analytics", func(t *testing.T) {
+		db := testutil.DB(t, &models.ProofRollup{}, &models.Entity{})
+
+		tenantID := uuid.New()
+		day := time.Now().UTC().Truncate(24 * time.Hour).Add(-24 * time.Hour)
+		assert.NoError(t, db.Create(&models.ProofRollup{
+			TenantID: tenantID, BucketStart: day, ProofType: "purchase", Impressions: 10, Conversions: 2,
+		}).Error)
+		assert.NoError(t, db.Create(&models.ProofRollup{
+			TenantID: uuid.New(), BucketStart: day, ProofType: "purchase", Impressions: 99,
+		}).Error)
+
 		w := httptest.NewRecorder()
 		c, _ := gin.CreateTestContext(w)
-		c.Request, _ = http.NewRequest("GET", "/api/social-proof/analytics", nil)
+		c.Request, _ = http.NewRequest("GET", "/api/social-proof/analytics?granularity=week&group_by=type", nil)
+		c.Set("tenant_id", tenantID)
 
-		handler := handlers.NewSocialProofHandler(nil)
+		handler := handlers.NewSocialProofHandler(db, stream.NewHub(stream.Options{}), nil)
 		handler.GetAnalytics(c)
 
-		var response map[string]int64
+		var response struct {
+			Granularity string `json:"granularity"`
+			Totals      struct {
+				Impressions    int64   `json:"impressions"`
+				Conversions    int64   `json:"conversions"`
+				ConversionRate float64 `json:"conversion_rate"`
+			} `json:"totals"`
+			Series []struct {
+				Group map[string]string `json:"group"`
+			} `json:"series"`
+		}
 		json.Unmarshal(w.Body.Bytes(), &response)
 
 		assert.Equal(t, http.StatusOK, w.Code)
-		assert.Contains(t, response, "total_proofs")
-		assert.Contains(t, response, "purchase_proofs")
-		assert.Contains(t, response, "review_proofs")
-		assert.Contains(t, response, "view_proofs")
+		assert.Equal(t, "week", response.Granularity)
+		assert.Equal(t, int64(10), response.Totals.Impressions)
+		assert.Equal(t, int64(2), response.Totals.Conversions)
+		assert.InDelta(t, 0.2, response.Totals.ConversionRate, 1e-9)
+		assert.Len(t, response.Series, 1)
+		assert.Equal(t, "purchase", response.Series[0].Group["type"])
+	})
+
+	t.Run("Get Analytics rejects unknown granularity", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/api/social-proof/analytics?granularity=year", nil)
+		c.Set("tenant_id", uuid.New())
+
+		handler := handlers.NewSocialProofHandler(nil, stream.NewHub(stream.Options{}), nil)
+		handler.GetAnalytics(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
 }
@@ -0,0 +1,43 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"nyasah-backend/api/handlers"
+	"nyasah-backend/models"
+	"nyasah-backend/tests/testutil"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyndicationHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t, &models.SyndicationGroup{}, &models.SyndicationMember{})
+
+	tenantID := uuid.New()
+	group := models.SyndicationGroup{TenantID: tenantID, Name: "EU listings", Enabled: true}
+	assert.NoError(t, db.Create(&group).Error)
+	assert.NoError(t, db.Create(&models.SyndicationMember{GroupID: group.ID, EntityID: uuid.New()}).Error)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("tenant_id", tenantID) })
+	router.PUT("/syndication/groups/:id", handlers.NewSyndicationHandler(db).UpdateGroup)
+
+	t.Run("Update Group returns the stored values", func(t *testing.T) {
+		body, _ := json.Marshal(map[string]interface{}{"name": "Europe", "enabled": false})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/syndication/groups/"+group.ID.String(), bytes.NewReader(body)))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var updated models.SyndicationGroup
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+		assert.Equal(t, "Europe", updated.Name)
+		assert.False(t, updated.Enabled)
+		assert.Len(t, updated.Members, 1)
+	})
+}
@@ -0,0 +1,110 @@
+package importer_test
+
+import (
+	"nyasah-backend/models"
+	"nyasah-backend/services/importer"
+	"nyasah-backend/tests/testutil"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func setupDB(t *testing.T) *gorm.DB {
+	return testutil.DB(t, &models.User{}, &models.Entity{}, &models.Review{})
+}
+
+func TestImporter(t *testing.T) {
+	db := setupDB(t)
+	tenantID := uuid.New()
+
+	entity := models.Entity{TenantID: tenantID, Type: "product", Name: "Blue Mug"}
+	assert.NoError(t, db.Create(&entity).Error)
+	user := models.User{TenantID: tenantID, Email: "jane@example.com", Password: "x"}
+	assert.NoError(t, db.Create(&user).Error)
+
+	t.Run("CSV with preset", func(t *testing.T) {
+		csv := "review_id,review_content,review_score,display_name,email,product_title,date,verified_buyer\n" +
+			"1,Lovely mug,5,Jane,jane@example.com,Blue Mug,2023-04-01T10:00:00Z,true\n" +
+			"2,Chipped on arrival,2,Bob,bob@example.com,Blue Mug,2023-04-02T10:00:00Z,false\n" +
+			"3,lovely   MUG,5,Jane,jane@example.com,Blue Mug,2023-04-03T10:00:00Z,true\n" +
+			"4,No such product,4,Ann,,Red Mug,2023-04-03T10:00:00Z,true\n"
+
+		mapping, err := importer.ResolveMapping("yotpo", nil)
+		assert.NoError(t, err)
+
+		result, err := importer.NewImporter(db).Import(strings.NewReader(csv), importer.Options{
+			TenantID: tenantID,
+			Format:   importer.FormatCSV,
+			Mapping:  mapping,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 4, result.Total)
+		assert.Equal(t, 2, result.Imported)
+		assert.Equal(t, 1, result.Duplicates)
+		assert.Equal(t, 1, result.Failed)
+
+		var review models.Review
+		assert.NoError(t, db.Where("content = ?", "Lovely mug").First(&review).Error)
+		assert.Equal(t, user.ID, review.UserID)
+		assert.True(t, review.Verified)
+		assert.Equal(t, 2023, review.CreatedAt.Year())
+
+		var anonymous models.Review
+		assert.NoError(t, db.Where("content = ?", "Chipped on arrival").First(&anonymous).Error)
+		assert.Equal(t, uuid.Nil, anonymous.UserID)
+		assert.Equal(t, "Bob", anonymous.Metadata["author_name"])
+	})
+
+	t.Run("NDJSON re-import is de-duplicated", func(t *testing.T) {
+		ndjson := `{"text":"Lovely mug","stars":10,"reviewer":{"name":"Jane","email":"jane@example.com"}}` + "\n" +
+			`{"text":"Great gift","stars":8,"reviewer":{"name":"Tom"}}` + "\n"
+
+		mapping, err := importer.ResolveMapping("", &importer.FieldMapping{
+			Content:     "text",
+			Rating:      "stars",
+			AuthorName:  "reviewer.name",
+			AuthorEmail: "reviewer.email",
+			RatingScale: 10,
+		})
+		assert.NoError(t, err)
+
+		result, err := importer.NewImporter(db).Import(strings.NewReader(ndjson), importer.Options{
+			TenantID:        tenantID,
+			Format:          importer.FormatNDJSON,
+			Mapping:         mapping,
+			DefaultEntityID: entity.ID,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, result.Imported)
+		assert.Equal(t, 1, result.Duplicates)
+
+		var review models.Review
+		assert.NoError(t, db.Where("content = ?", "Great gift").First(&review).Error)
+		assert.Equal(t, 4, review.Rating)
+	})
+
+	t.Run("Reviews created through the API are recognised", func(t *testing.T) {
+		existing := models.Review{TenantID: tenantID, UserID: user.ID, EntityID: entity.ID, Rating: 5, Content: "Sturdy handle",
+			ContentHash: importer.ContentHash(entity.ID, importer.AuthorKey("", user.Email), "Sturdy handle")}
+		assert.NoError(t, db.Create(&existing).Error)
+
+		// The preset maps the reviewer's name as well as their email
+		csv := "review_id,review_content,review_score,display_name,email,product_title\n" +
+			"10,Sturdy handle,5,Jane D.,jane@example.com,Blue Mug\n" +
+			"11,Sturdy handle,5,Tom,tom@example.com,Blue Mug\n"
+		mapping, err := importer.ResolveMapping("yotpo", nil)
+		assert.NoError(t, err)
+
+		result, err := importer.NewImporter(db).Import(strings.NewReader(csv), importer.Options{
+			TenantID: tenantID,
+			Format:   importer.FormatCSV,
+			Mapping:  mapping,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, result.Imported)
+		assert.Equal(t, 1, result.Duplicates)
+	})
+}
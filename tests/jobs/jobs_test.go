@@ -0,0 +1,247 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"nyasah-backend/models"
+	"nyasah-backend/services/jobs"
+	"nyasah-backend/tests/testutil"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func setupDB(t *testing.T) *gorm.DB {
+	return testutil.DB(t, &models.Job{}, &models.Review{}, &models.ReviewEmbedding{})
+}
+
+func reload(t *testing.T, db *gorm.DB, id uuid.UUID) models.Job {
+	var job models.Job
+	assert.NoError(t, db.First(&job, "id = ?", id).Error)
+	return job
+}
+
+// due makes a retried job runnable again without waiting for its backoff
+func due(t *testing.T, db *gorm.DB, id uuid.UUID) {
+	assert.NoError(t, db.Model(&models.Job{}).Where("id = ?", id).Update("run_at", time.Now().Add(-time.Second)).Error)
+}
+
+func TestQueue(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Successful jobs complete", func(t *testing.T) {
+		db := setupDB(t)
+		queue := jobs.NewQueue(db, jobs.Options{})
+
+		var got jobs.ReviewPayload
+		queue.Register("test", func(ctx context.Context, job models.Job) error {
+			return jobs.Decode(job, &got)
+		})
+
+		reviewID := uuid.New()
+		job, err := queue.Enqueue(uuid.New(), "test", "", jobs.ReviewPayload{ReviewID: reviewID})
+		assert.NoError(t, err)
+
+		found, err := queue.Work(ctx)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, reviewID, got.ReviewID)
+
+		stored := reload(t, db, job.ID)
+		assert.Equal(t, jobs.StatusSucceeded, stored.Status)
+		assert.Equal(t, 1, stored.Attempts)
+		assert.NotNil(t, stored.CompletedAt)
+
+		found, err = queue.Work(ctx)
+		assert.NoError(t, err)
+		assert.False(t, found)
+	})
+
+	t.Run("Failures back off exponentially and then dead-letter", func(t *testing.T) {
+		db := setupDB(t)
+		queue := jobs.NewQueue(db, jobs.Options{MaxAttempts: 3, BaseBackoff: time.Minute})
+		queue.Register("flaky", func(ctx context.Context, job models.Job) error {
+			return errors.New("provider unavailable")
+		})
+
+		job, err := queue.Enqueue(uuid.New(), "flaky", "", nil)
+		assert.NoError(t, err)
+
+		var delays []time.Duration
+		for attempt := 1; attempt <= 3; attempt++ {
+			before := time.Now()
+			found, err := queue.Work(ctx)
+			assert.NoError(t, err)
+			assert.True(t, found)
+
+			stored := reload(t, db, job.ID)
+			assert.Equal(t, attempt, stored.Attempts)
+			assert.Equal(t, "provider unavailable", stored.LastError)
+			if attempt < 3 {
+				assert.Equal(t, jobs.StatusQueued, stored.Status)
+				delays = append(delays, stored.RunAt.Sub(before))
+
+				// Not due until the backoff has passed
+				found, _ = queue.Work(ctx)
+				assert.False(t, found)
+				due(t, db, job.ID)
+			} else {
+				assert.Equal(t, jobs.StatusDead, stored.Status)
+			}
+		}
+
+		assert.GreaterOrEqual(t, delays[0], time.Minute)
+		assert.GreaterOrEqual(t, delays[1], 2*time.Minute)
+	})
+
+	t.Run("Permanent errors dead-letter immediately and can be retried", func(t *testing.T) {
+		db := setupDB(t)
+		queue := jobs.NewQueue(db, jobs.Options{})
+		fail := true
+		queue.Register("strict", func(ctx context.Context, job models.Job) error {
+			if fail {
+				return jobs.Permanent(errors.New("review deleted"))
+			}
+			return nil
+		})
+
+		tenantID := uuid.New()
+		job, err := queue.Enqueue(tenantID, "strict", "", nil)
+		assert.NoError(t, err)
+
+		_, err = queue.Retry(tenantID, job.ID)
+		assert.ErrorIs(t, err, jobs.ErrNotDead)
+
+		queue.Work(ctx)
+		assert.Equal(t, jobs.StatusDead, reload(t, db, job.ID).Status)
+
+		_, err = queue.Retry(uuid.New(), job.ID)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+		fail = false
+		_, err = queue.Retry(tenantID, job.ID)
+		assert.NoError(t, err)
+		queue.Work(ctx)
+
+		stored := reload(t, db, job.ID)
+		assert.Equal(t, jobs.StatusSucceeded, stored.Status)
+		assert.Equal(t, 1, stored.Attempts)
+	})
+
+	t.Run("Panics are recorded as failures", func(t *testing.T) {
+		db := setupDB(t)
+		queue := jobs.NewQueue(db, jobs.Options{})
+		queue.Register("panics", func(ctx context.Context, job models.Job) error {
+			panic("boom")
+		})
+
+		job, _ := queue.Enqueue(uuid.New(), "panics", "", nil)
+		queue.Work(ctx)
+
+		stored := reload(t, db, job.ID)
+		assert.Equal(t, jobs.StatusQueued, stored.Status)
+		assert.Contains(t, stored.LastError, "boom")
+	})
+
+	t.Run("Queued jobs with the same key are not duplicated", func(t *testing.T) {
+		db := setupDB(t)
+		queue := jobs.NewQueue(db, jobs.Options{})
+		queue.Register("refresh", func(ctx context.Context, job models.Job) error { return nil })
+
+		tenantID := uuid.New()
+		first, _ := queue.Enqueue(tenantID, "refresh", "tenant", nil)
+		second, _ := queue.Enqueue(tenantID, "refresh", "tenant", nil)
+		other, _ := queue.Enqueue(uuid.New(), "refresh", "tenant", nil)
+		assert.Equal(t, first.ID, second.ID)
+		assert.NotEqual(t, first.ID, other.ID)
+
+		// Once the job has run, new work is queued again
+		queue.Work(ctx)
+		queue.Work(ctx)
+		third, _ := queue.Enqueue(tenantID, "refresh", "tenant", nil)
+		assert.NotEqual(t, first.ID, third.ID)
+	})
+
+	t.Run("Tenants are limited to their concurrency", func(t *testing.T) {
+		db := setupDB(t)
+		queue := jobs.NewQueue(db, jobs.Options{TenantConcurrency: 1})
+
+		release := make(chan struct{})
+		started := make(chan uuid.UUID, 3)
+		queue.Register("slow", func(ctx context.Context, job models.Job) error {
+			started <- job.TenantID
+			<-release
+			return nil
+		})
+
+		busy, quiet := uuid.New(), uuid.New()
+		queue.Enqueue(busy, "slow", "", nil)
+		queue.Enqueue(busy, "slow", "", nil)
+		queue.Enqueue(quiet, "slow", "", nil)
+
+		go queue.Work(ctx)
+		assert.Equal(t, busy, <-started)
+
+		// The busy tenant's second job waits while the quiet tenant's runs
+		go queue.Work(ctx)
+		assert.Equal(t, quiet, <-started)
+
+		var running int64
+		db.Model(&models.Job{}).Where("status = ?", jobs.StatusRunning).Count(&running)
+		assert.Equal(t, int64(2), running)
+
+		found, err := queue.Work(ctx)
+		assert.NoError(t, err)
+		assert.False(t, found)
+
+		close(release)
+	})
+
+	t.Run("Stale running jobs are reclaimed", func(t *testing.T) {
+		db := setupDB(t)
+		queue := jobs.NewQueue(db, jobs.Options{Timeout: time.Minute})
+
+		job, _ := queue.Enqueue(uuid.New(), "orphan", "", nil)
+		assert.NoError(t, db.Model(&models.Job{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+			"status": jobs.StatusRunning, "attempts": 1, "locked_at": time.Now().Add(-time.Hour),
+		}).Error)
+
+		reclaimed, err := queue.Reclaim()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, reclaimed)
+
+		stored := reload(t, db, job.ID)
+		assert.Equal(t, jobs.StatusQueued, stored.Status)
+		assert.Nil(t, stored.LockedAt)
+	})
+}
+
+func TestQueueMissingEmbeddings(t *testing.T) {
+	db := setupDB(t)
+	queue := jobs.NewQueue(db, jobs.Options{})
+	tenantID := uuid.New()
+
+	now := time.Now()
+	analyzed := models.Review{TenantID: tenantID, Content: "Fits well", EnrichedAt: &now}
+	embedded := models.Review{TenantID: tenantID, Content: "Runs small", EnrichedAt: &now}
+	pending := models.Review{TenantID: tenantID, Content: "Not analyzed yet"}
+	for _, review := range []*models.Review{&analyzed, &embedded, &pending} {
+		assert.NoError(t, db.Create(review).Error)
+	}
+	assert.NoError(t, db.Create(&models.ReviewEmbedding{ReviewID: embedded.ID, TenantID: tenantID, Model: "test", Vector: []float32{1, 0}}).Error)
+
+	// Only analyzed reviews without a vector are queued, and only once
+	queued, err := queue.QueueMissingEmbeddings(100)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, queued)
+	queued, err = queue.QueueMissingEmbeddings(100)
+	assert.NoError(t, err)
+	assert.Zero(t, queued)
+
+	var job models.Job
+	assert.NoError(t, db.Where("type = ?", jobs.TypeEmbedding).First(&job).Error)
+	assert.Equal(t, analyzed.ID.String(), job.DedupeKey)
+}
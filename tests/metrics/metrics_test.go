@@ -0,0 +1,195 @@
+package metrics_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"nyasah-backend/api/handlers"
+	"nyasah-backend/api/middleware"
+	"nyasah-backend/config"
+	"nyasah-backend/models"
+	"nyasah-backend/services"
+	"nyasah-backend/services/ai/factory"
+	"nyasah-backend/services/ai/providers"
+	"nyasah-backend/services/jobs"
+	"nyasah-backend/services/metrics"
+	"nyasah-backend/tests/testutil"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func setupDB(t *testing.T) *gorm.DB {
+	return testutil.DB(t, &models.Tenant{}, &models.Job{})
+}
+
+// scrape returns the registry in the exposition format
+func scrape(t *testing.T) string {
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	body, _ := io.ReadAll(w.Body)
+	return string(body)
+}
+
+type fakeProvider struct {
+	err error
+}
+
+func (p fakeProvider) Complete(ctx context.Context, req providers.Request) (providers.Response, error) {
+	return providers.Response{Text: "text", Usage: providers.Usage{InputTokens: 6, OutputTokens: 15}}, p.err
+}
+func (p fakeProvider) Stream(ctx context.Context, req providers.Request) (providers.Stream, error) {
+	resp, err := p.Complete(ctx, req)
+	return providers.SingleChunk(resp), err
+}
+func (p fakeProvider) AnalyzeSentiment(ctx context.Context, text string) (float64, error) {
+	return 0.5, p.err
+}
+
+func TestHTTPMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.MetricsMiddleware())
+	router.GET("/things/:id", func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Thing not found"})
+	})
+
+	for _, path := range []string{"/things/1", "/things/2", "/nowhere"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	body := scrape(t)
+	assert.Contains(t, body, `nyasah_http_request_duration_seconds_count{method="GET",route="/things/:id",status="404"} 2`)
+	assert.Contains(t, body, `nyasah_http_request_duration_seconds_count{method="GET",route="unmatched",status="404"} 1`)
+	assert.Contains(t, body, "go_goroutines")
+}
+
+func TestDatabaseMetrics(t *testing.T) {
+	db := setupDB(t)
+	assert.NoError(t, db.Use(metrics.GormPlugin{}))
+
+	tenant := models.Tenant{Name: "Shop", Domain: "metrics.example.com", Type: "ecommerce", ApiKey: uuid.NewString()}
+	assert.NoError(t, db.Create(&tenant).Error)
+	assert.NoError(t, db.First(&models.Tenant{}, "id = ?", tenant.ID).Error)
+	assert.Error(t, db.First(&models.Tenant{}, "id = ?", uuid.New()).Error)
+	assert.Error(t, db.Create(&models.Tenant{Name: "Copy", Domain: tenant.Domain, Type: "ecommerce", ApiKey: uuid.NewString()}).Error)
+
+	body := scrape(t)
+	assert.Contains(t, body, `nyasah_db_query_duration_seconds_count{operation="create",table="tenants"} 2`)
+	assert.Contains(t, body, `nyasah_db_query_duration_seconds_count{operation="query",table="tenants"} 2`)
+	// The missing record is not an error, the duplicate domain is
+	assert.Contains(t, body, `nyasah_db_query_errors_total{operation="create",table="tenants"} 1`)
+	assert.NotContains(t, body, `nyasah_db_query_errors_total{operation="query"`)
+}
+
+func TestProviderMetrics(t *testing.T) {
+	ok := providers.Instrument("fake", fakeProvider{})
+	failing := providers.Instrument("fake", fakeProvider{err: errors.New("rate limited")})
+
+	ctx := context.Background()
+	_, err := ok.Complete(ctx, providers.Prompt("prompt"))
+	assert.NoError(t, err)
+	_, err = ok.Complete(ctx, providers.Prompt("prompt"))
+	assert.NoError(t, err)
+	_, err = failing.AnalyzeSentiment(ctx, "text")
+	assert.Error(t, err)
+
+	// A stream is observed once it has been read to the end
+	stream, err := ok.Stream(ctx, providers.Prompt("prompt"))
+	assert.NoError(t, err)
+	assert.NotContains(t, scrape(t), `operation="stream"`)
+	for _, err = stream.Recv(); err == nil; _, err = stream.Recv() {
+	}
+	assert.Equal(t, io.EOF, err)
+	assert.NoError(t, stream.Close())
+
+	body := scrape(t)
+	assert.Contains(t, body, `nyasah_ai_provider_requests_total{operation="complete",provider="fake",result="ok"} 2`)
+	assert.Contains(t, body, `nyasah_ai_provider_requests_total{operation="analyze_sentiment",provider="fake",result="error"} 1`)
+	assert.Contains(t, body, `nyasah_ai_provider_requests_total{operation="stream",provider="fake",result="ok"} 1`)
+	assert.Contains(t, body, `nyasah_ai_provider_request_duration_seconds_count{operation="complete",provider="fake"} 2`)
+	assert.Contains(t, body, `nyasah_ai_provider_tokens_total{provider="fake",type="completion"} 45`)
+	assert.Contains(t, body, `nyasah_ai_provider_tokens_total{provider="fake",type="prompt"} 18`)
+}
+
+func TestQueueMetrics(t *testing.T) {
+	db := setupDB(t)
+	queue := jobs.NewQueue(db, jobs.Options{})
+	tenantID := uuid.New()
+	for _, key := range []string{"a", "b"} {
+		_, err := queue.Enqueue(tenantID, "review.sentiment", key, nil)
+		assert.NoError(t, err)
+	}
+	_, err := queue.Enqueue(tenantID, "report.run", "c", nil)
+	assert.NoError(t, err)
+
+	assert.NoError(t, metrics.Register(metrics.NewQueueCollector(queue)))
+	// A second server in the same process replaces the first one's collector
+	assert.NoError(t, metrics.Register(metrics.NewQueueCollector(queue)))
+
+	body := scrape(t)
+	assert.Contains(t, body, `nyasah_jobs{status="queued",type="review.sentiment"} 2`)
+	assert.Contains(t, body, `nyasah_jobs{status="queued",type="report.run"} 1`)
+
+	done := metrics.StreamOpened("sse")
+	assert.Contains(t, scrape(t), `nyasah_stream_connections{transport="sse"} 1`)
+	done()
+	assert.Contains(t, scrape(t), `nyasah_stream_connections{transport="sse"} 0`)
+}
+
+func TestHealthChecks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupDB(t)
+
+	llama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound) // reachable, even without a route for /
+	}))
+	t.Setenv("LLAMA_SERVER_URL", llama.URL)
+	aiService := services.NewAIService(db, &config.Config{Provider: factory.Llama})
+
+	router := gin.New()
+	health := handlers.NewHealthHandler(db, aiService)
+	router.GET("/healthz", health.Healthz)
+	router.GET("/readyz", health.Readyz)
+
+	get := func(path string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var body map[string]interface{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w.Code, body
+	}
+
+	code, body := get("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", body["status"])
+
+	code, body = get("/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]interface{}{"database": "ok", "ai_provider": "ok"}, body["checks"])
+
+	// The provider going away only affects readiness
+	llama.Close()
+	code, body = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "unavailable", body["status"])
+	assert.Equal(t, "ok", body["checks"].(map[string]interface{})["database"])
+	assert.True(t, strings.Contains(body["checks"].(map[string]interface{})["ai_provider"].(string), "connect"))
+
+	code, _ = get("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+
+	sqlDB, _ := db.DB()
+	sqlDB.Close()
+	code, body = get("/healthz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.NotEqual(t, "ok", body["checks"].(map[string]interface{})["database"])
+}
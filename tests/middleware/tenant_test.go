@@ -0,0 +1,71 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"nyasah-backend/api/middleware"
+	"nyasah-backend/models"
+	"nyasah-backend/tests/testutil"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t, &models.Tenant{}, &models.User{})
+
+	shop := models.Tenant{Name: "Shop", Domain: "shop.example.com", Type: "ecommerce", ApiKey: "shop-key"}
+	other := models.Tenant{Name: "Other", Domain: "other.example.com", Type: "ecommerce", ApiKey: "other-key"}
+	assert.NoError(t, db.Create(&shop).Error)
+	assert.NoError(t, db.Create(&other).Error)
+	owner := models.User{TenantID: shop.ID, Email: "owner@shop.example.com", Password: "hash"}
+	stranger := models.User{Email: "stranger@example.com", Password: "hash"}
+	assert.NoError(t, db.Create(&owner).Error)
+	assert.NoError(t, db.Create(&stranger).Error)
+
+	request := func(apiKey string, userID interface{}) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.GET("/", func(c *gin.Context) {
+			if userID != nil {
+				c.Set("user_id", userID)
+			}
+		}, middleware.TenantMiddleware(db), func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"tenant_id": c.MustGet("tenant_id")})
+		})
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-API-Key", apiKey)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Own Tenant", func(t *testing.T) {
+		w := request("shop-key", owner.ID.String())
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), shop.ID.String())
+	})
+
+	t.Run("Another Tenant's Key", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, request("other-key", owner.ID.String()).Code)
+	})
+
+	t.Run("User Without Tenant", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, request("shop-key", stranger.ID.String()).Code)
+	})
+
+	t.Run("Unknown User", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, request("shop-key", uuid.NewString()).Code)
+	})
+
+	t.Run("Not Signed In", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, request("shop-key", nil).Code)
+	})
+
+	t.Run("Invalid Key", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, request("wrong-key", owner.ID.String()).Code)
+	})
+}
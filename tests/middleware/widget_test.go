@@ -0,0 +1,65 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"nyasah-backend/api/handlers"
+	"nyasah-backend/api/middleware"
+	"nyasah-backend/models"
+	"nyasah-backend/tests/testutil"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOriginAllowed(t *testing.T) {
+	assert.True(t, middleware.OriginAllowed("https://shop.example.com", "example.com"))
+	assert.True(t, middleware.OriginAllowed("https://example.com", "www.example.com"))
+	assert.True(t, middleware.OriginAllowed("http://example.com:3000", "https://example.com"))
+	assert.False(t, middleware.OriginAllowed("https://badexample.com", "example.com"))
+	assert.False(t, middleware.OriginAllowed("null", "example.com"))
+}
+
+func TestWidgetMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t, &models.Tenant{})
+
+	tenant := models.Tenant{Name: "Shop", Domain: "shop.example.com", Type: "ecommerce", ApiKey: "secret-key", Active: true}
+	assert.NoError(t, db.Create(&tenant).Error)
+	assert.True(t, strings.HasPrefix(tenant.WidgetKey, "pk_"))
+
+	loader := func(publicURL, key, host string) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.GET("/widget/loader.js", middleware.WidgetMiddleware(db),
+			handlers.NewWidgetHandler(db, nil, nil, "", publicURL).Loader)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/widget/loader.js?key="+key, nil)
+		req.Host = host
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Widget Key", func(t *testing.T) {
+		w := loader("https://api.example.com", tenant.WidgetKey, "evil.example.net")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `var base = "https://api.example.com";`)
+		assert.Contains(t, w.Body.String(), tenant.WidgetKey)
+		assert.NotContains(t, w.Body.String(), "evil.example.net")
+		assert.NotContains(t, w.Body.String(), tenant.ApiKey)
+		assert.Equal(t, "public, max-age=86400", w.Header().Get("Cache-Control"))
+	})
+
+	t.Run("Request Host Is Not Cached Publicly", func(t *testing.T) {
+		w := loader("", tenant.WidgetKey, "api.example.com")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `var base = "http://api.example.com";`)
+		assert.Equal(t, "private, no-cache", w.Header().Get("Cache-Control"))
+	})
+
+	t.Run("Secret API Key", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, loader("https://api.example.com", tenant.ApiKey, "api.example.com").Code)
+	})
+}
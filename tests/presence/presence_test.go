@@ -0,0 +1,96 @@
+package presence_test
+
+import (
+	"encoding/json"
+	"nyasah-backend/models"
+	"nyasah-backend/services/presence"
+	"nyasah-backend/services/stream"
+	"nyasah-backend/tests/testutil"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  presence.Rules
+		actual int
+		want   presence.Count
+	}{
+		{"Lone visitor is hidden", presence.Rules{}, 1, presence.Count{}},
+		{"Exact count by default", presence.Rules{}, 7, presence.Count{Count: 7, Visible: true}},
+		{"Below floor is hidden", presence.Rules{Floor: 5}, 4, presence.Count{}},
+		{"Rounds down", presence.Rules{RoundTo: 5}, 12, presence.Count{Count: 10, Rounded: true, Visible: true}},
+		{"Exact multiple is not marked rounded", presence.Rules{RoundTo: 5}, 15, presence.Count{Count: 15, Visible: true}},
+		{"Rounding below the floor keeps the real count", presence.Rules{Floor: 3, RoundTo: 10}, 7, presence.Count{Count: 7, Visible: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.rules.Apply(tt.actual)
+			assert.Equal(t, tt.want, got)
+			assert.LessOrEqual(t, got.Count, tt.actual)
+		})
+	}
+
+	rules := presence.RulesFromSettings(json.RawMessage(`{"presence": {"floor": 3, "round_to": 5}}`))
+	assert.Equal(t, presence.Rules{Floor: 3, RoundTo: 5}, rules)
+}
+
+func TestTracker(t *testing.T) {
+	db := testutil.DB(t, &models.Tenant{}, &models.Entity{}, &models.PresenceCheckpoint{})
+
+	tenant := models.Tenant{Name: "Shop", Domain: "shop.test", ApiKey: "key", Settings: json.RawMessage(`{}`)}
+	assert.NoError(t, db.Create(&tenant).Error)
+	entity := models.Entity{TenantID: tenant.ID, Type: "product", Name: "Mug"}
+	assert.NoError(t, db.Create(&entity).Error)
+	entityID := entity.ID
+
+	hub := stream.NewHub(stream.Options{})
+	tracker := presence.NewTracker(db, hub, presence.Options{Window: 200 * time.Millisecond})
+
+	t.Run("Counts distinct visitors within the window", func(t *testing.T) {
+		assert.NoError(t, tracker.Ping(tenant.ID, entityID, "a"))
+		assert.NoError(t, tracker.Ping(tenant.ID, entityID, "a"))
+		assert.NoError(t, tracker.Ping(tenant.ID, entityID, "b"))
+		assert.NoError(t, tracker.Ping(tenant.ID, entityID, "c"))
+		assert.Equal(t, 3, tracker.Actual(tenant.ID, entityID))
+		assert.Equal(t, presence.Count{Count: 3, Visible: true}, tracker.Display(tenant.ID, entityID))
+
+		tracker.Leave(tenant.ID, entityID, "c")
+		assert.Equal(t, 2, tracker.Actual(tenant.ID, entityID))
+		assert.Equal(t, 0, tracker.Actual(uuid.New(), entityID))
+	})
+
+	t.Run("Ignores entities the tenant does not have", func(t *testing.T) {
+		assert.ErrorIs(t, tracker.Ping(tenant.ID, uuid.New(), "a"), presence.ErrUnknownEntity)
+		assert.ErrorIs(t, tracker.Ping(uuid.New(), entityID, "a"), presence.ErrUnknownEntity)
+		assert.Equal(t, 0, tracker.Actual(uuid.New(), entityID))
+	})
+
+	t.Run("Checkpoint survives a restart", func(t *testing.T) {
+		assert.NoError(t, tracker.Checkpoint())
+
+		restarted := presence.NewTracker(db, hub, presence.Options{Window: 200 * time.Millisecond})
+		assert.NoError(t, restarted.Restore())
+		assert.Equal(t, 2, restarted.Actual(tenant.ID, entityID))
+	})
+
+	t.Run("Visitors expire after the window", func(t *testing.T) {
+		time.Sleep(250 * time.Millisecond)
+		assert.Equal(t, 0, tracker.Actual(tenant.ID, entityID))
+
+		// Expired visitors are not restored either
+		assert.NoError(t, tracker.Checkpoint())
+		restarted := presence.NewTracker(db, hub, presence.Options{Window: 200 * time.Millisecond})
+		assert.NoError(t, restarted.Restore())
+		assert.Equal(t, 0, restarted.Actual(tenant.ID, entityID))
+
+		var checkpoints int64
+		db.Model(&models.PresenceCheckpoint{}).Count(&checkpoints)
+		assert.Equal(t, int64(0), checkpoints)
+	})
+}
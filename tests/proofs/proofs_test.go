@@ -0,0 +1,214 @@
+package proofs_test
+
+import (
+	"encoding/json"
+	"nyasah-backend/models"
+	"nyasah-backend/services/proofs"
+	"nyasah-backend/tests/testutil"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func setupDB(t *testing.T) (*gorm.DB, models.Tenant) {
+	db := testutil.DB(t, &models.Tenant{}, &models.User{}, &models.Entity{},
+		&models.SocialProof{}, &models.ProofPerformance{}, &models.ProofPolicy{})
+
+	tenant := models.Tenant{Name: "Shop", Domain: "shop.test", ApiKey: "key", Settings: json.RawMessage(`{}`)}
+	assert.NoError(t, db.Create(&tenant).Error)
+	return db, tenant
+}
+
+func createProof(t *testing.T, db *gorm.DB, tenantID uuid.UUID, proofType string, userID uuid.UUID, age time.Duration) models.SocialProof {
+	proof := models.SocialProof{
+		TenantID:  tenantID,
+		Type:      proofType,
+		EntityID:  uuid.New(),
+		UserID:    userID,
+		Content:   proofType,
+		CreatedAt: time.Now().Add(-age),
+	}
+	assert.NoError(t, db.Create(&proof).Error)
+	return proof
+}
+
+func setPolicy(t *testing.T, db *gorm.DB, tenantID uuid.UUID, proofType, rotation string, ttl, dedupe int) {
+	policy := models.ProofPolicy{TenantID: tenantID, Type: proofType, Rotation: rotation, TTLMinutes: ttl, DedupeMinutes: dedupe}
+	assert.NoError(t, db.Create(&policy).Error)
+}
+
+func ids(list []models.SocialProof) []uuid.UUID {
+	result := make([]uuid.UUID, len(list))
+	for i, proof := range list {
+		result[i] = proof.ID
+	}
+	return result
+}
+
+func TestSelectFreshness(t *testing.T) {
+	db, tenant := setupDB(t)
+	service := proofs.NewService(db)
+
+	fresh := createProof(t, db, tenant.ID, "purchase", uuid.New(), time.Hour)
+	createProof(t, db, tenant.ID, "purchase", uuid.New(), 72*time.Hour)
+	oldReview := createProof(t, db, tenant.ID, "review", uuid.New(), 72*time.Hour)
+
+	t.Run("Default purchase TTL hides stale purchases", func(t *testing.T) {
+		selected, err := service.Select(proofs.Query{TenantID: tenant.ID, Types: []string{"purchase"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{fresh.ID}, ids(selected))
+	})
+
+	t.Run("Types without a policy never expire", func(t *testing.T) {
+		selected, err := service.Select(proofs.Query{TenantID: tenant.ID, Types: []string{"review"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{oldReview.ID}, ids(selected))
+	})
+
+	t.Run("Tenant policy overrides the default", func(t *testing.T) {
+		setPolicy(t, db, tenant.ID, "review", proofs.RotationRecent, 60, 0)
+		selected, err := service.Select(proofs.Query{TenantID: tenant.ID, Types: []string{"review"}})
+		assert.NoError(t, err)
+		assert.Empty(t, selected)
+	})
+}
+
+func TestSelectDedupe(t *testing.T) {
+	db, tenant := setupDB(t)
+	service := proofs.NewService(db)
+	setPolicy(t, db, tenant.ID, "purchase", proofs.RotationRecent, 0, 30)
+
+	user := uuid.New()
+	entity := uuid.New()
+	for _, age := range []time.Duration{time.Minute, 5 * time.Minute, 10 * time.Minute, time.Hour} {
+		proof := models.SocialProof{TenantID: tenant.ID, Type: "purchase", EntityID: entity, UserID: user, CreatedAt: time.Now().Add(-age)}
+		assert.NoError(t, db.Create(&proof).Error)
+	}
+	createProof(t, db, tenant.ID, "purchase", uuid.Nil, 2*time.Minute)
+	createProof(t, db, tenant.ID, "purchase", uuid.Nil, 3*time.Minute)
+
+	selected, err := service.Select(proofs.Query{TenantID: tenant.ID})
+	assert.NoError(t, err)
+	// The burst collapses to its latest proof, the hour-old one is outside the
+	// window and anonymous proofs are never merged
+	assert.Len(t, selected, 4)
+}
+
+func TestSelectRotation(t *testing.T) {
+	t.Run("Round robin cycles through every proof", func(t *testing.T) {
+		db, tenant := setupDB(t)
+		service := proofs.NewService(db)
+		setPolicy(t, db, tenant.ID, "review", proofs.RotationRoundRobin, 0, 0)
+
+		for i := 0; i < 5; i++ {
+			createProof(t, db, tenant.ID, "review", uuid.New(), time.Duration(i)*time.Minute)
+		}
+
+		seen := make(map[uuid.UUID]int)
+		for i := 0; i < 5; i++ {
+			selected, err := service.Select(proofs.Query{TenantID: tenant.ID, Limit: 2})
+			assert.NoError(t, err)
+			assert.Len(t, selected, 2)
+			for _, proof := range selected {
+				seen[proof.ID]++
+			}
+		}
+		assert.Len(t, seen, 5)
+		for _, count := range seen {
+			assert.Equal(t, 2, count)
+		}
+	})
+
+	t.Run("Best performing orders by engagement", func(t *testing.T) {
+		db, tenant := setupDB(t)
+		service := proofs.NewService(db)
+		setPolicy(t, db, tenant.ID, "review", proofs.RotationBestPerforming, 0, 0)
+
+		var want []uuid.UUID
+		for i, rate := range []float64{0.9, 0.5, 0.1} {
+			proof := createProof(t, db, tenant.ID, "review", uuid.New(), time.Duration(3-i)*time.Minute)
+			assert.NoError(t, db.Create(&models.ProofPerformance{ProofID: proof.ID, Views: 10, EngagementRate: rate}).Error)
+			want = append(want, proof.ID)
+		}
+
+		selected, err := service.Select(proofs.Query{TenantID: tenant.ID})
+		assert.NoError(t, err)
+		assert.Equal(t, want, ids(selected))
+	})
+
+	t.Run("Weighted random returns every proof once", func(t *testing.T) {
+		db, tenant := setupDB(t)
+		service := proofs.NewService(db)
+		setPolicy(t, db, tenant.ID, "review", proofs.RotationWeightedRandom, 0, 0)
+
+		var want []uuid.UUID
+		for i := 0; i < 6; i++ {
+			want = append(want, createProof(t, db, tenant.ID, "review", uuid.New(), time.Duration(i)*time.Hour).ID)
+		}
+
+		selected, err := service.Select(proofs.Query{TenantID: tenant.ID})
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, want, ids(selected))
+	})
+
+	t.Run("Multiple types are interleaved", func(t *testing.T) {
+		db, tenant := setupDB(t)
+		service := proofs.NewService(db)
+
+		for i := 0; i < 3; i++ {
+			createProof(t, db, tenant.ID, "purchase", uuid.New(), time.Duration(i)*time.Minute)
+		}
+		for i := 0; i < 3; i++ {
+			createProof(t, db, tenant.ID, "review", uuid.New(), time.Duration(i+10)*time.Minute)
+		}
+
+		selected, err := service.Select(proofs.Query{TenantID: tenant.ID, Limit: 4})
+		assert.NoError(t, err)
+		assert.Len(t, selected, 4)
+		var types []string
+		for _, proof := range selected {
+			types = append(types, proof.Type)
+		}
+		assert.Equal(t, []string{"purchase", "review", "purchase", "review"}, types)
+	})
+}
+
+func TestArchive(t *testing.T) {
+	db, tenant := setupDB(t)
+	service := proofs.NewService(db)
+
+	other := models.Tenant{Name: "Other", Domain: "other.test", ApiKey: "other", Settings: json.RawMessage(`{}`)}
+	assert.NoError(t, db.Create(&other).Error)
+	setPolicy(t, db, other.ID, "purchase", proofs.RotationRecent, 0, 0)
+
+	stale := createProof(t, db, tenant.ID, "purchase", uuid.New(), 72*time.Hour)
+	createProof(t, db, tenant.ID, "purchase", uuid.New(), time.Hour)
+	createProof(t, db, tenant.ID, "review", uuid.New(), 72*time.Hour)
+	createProof(t, db, other.ID, "purchase", uuid.New(), 72*time.Hour)
+
+	t.Run("Archives proofs past the effective TTL", func(t *testing.T) {
+		archived, err := service.Archive()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), archived)
+
+		var reloaded models.SocialProof
+		assert.NoError(t, db.First(&reloaded, "id = ?", stale.ID).Error)
+		assert.NotNil(t, reloaded.ArchivedAt)
+	})
+
+	t.Run("Refresh restores proofs a longer TTL keeps fresh", func(t *testing.T) {
+		setPolicy(t, db, tenant.ID, "purchase", proofs.RotationRecent, 7*24*60, 0)
+		assert.NoError(t, service.Refresh(tenant.ID, "purchase"))
+
+		var reloaded models.SocialProof
+		assert.NoError(t, db.First(&reloaded, "id = ?", stale.ID).Error)
+		assert.Nil(t, reloaded.ArchivedAt)
+
+		selected, err := service.Select(proofs.Query{TenantID: tenant.ID, Types: []string{"purchase"}})
+		assert.NoError(t, err)
+		assert.Len(t, selected, 2)
+	})
+}
@@ -0,0 +1,295 @@
+package providers_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"nyasah-backend/services/ai/factory"
+	"nyasah-backend/services/ai/providers"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// messagesAPI stands in for the Anthropic Messages API. It answers every
+// request with reply, streamed word by word when asked, and keeps the last
+// request body.
+type messagesAPI struct {
+	*httptest.Server
+	status  int
+	reply   string
+	headers http.Header
+	request map[string]interface{}
+}
+
+func newMessagesAPI(t *testing.T, reply string) *messagesAPI {
+	api := &messagesAPI{status: http.StatusOK, reply: reply}
+	api.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Path == "/v1/models" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		api.headers = r.Header.Clone()
+		api.request = nil
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&api.request))
+
+		if api.status != http.StatusOK {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(api.status)
+			w.Write([]byte(`{"type": "error", "error": {"type": "invalid_request_error", "message": "max_tokens: too large"}}`))
+			return
+		}
+		if api.request["stream"] == true {
+			api.stream(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":            "msg_01",
+			"type":          "message",
+			"role":          "assistant",
+			"model":         api.request["model"],
+			"content":       []map[string]interface{}{{"type": "text", "text": api.reply}},
+			"stop_reason":   "end_turn",
+			"stop_sequence": nil,
+			"usage":         map[string]interface{}{"input_tokens": 25, "output_tokens": 8},
+		})
+	}))
+	t.Cleanup(api.Close)
+	return api
+}
+
+// stream sends the reply as server-sent events, one word per delta
+func (api *messagesAPI) stream(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	send := func(event map[string]interface{}) {
+		data, _ := json.Marshal(event)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event["type"], data)
+	}
+
+	send(map[string]interface{}{"type": "message_start", "message": map[string]interface{}{
+		"id": "msg_01", "type": "message", "role": "assistant", "model": api.request["model"],
+		"content": []interface{}{}, "stop_reason": nil, "stop_sequence": nil,
+		"usage": map[string]interface{}{"input_tokens": 25, "output_tokens": 1},
+	}})
+	send(map[string]interface{}{"type": "content_block_start", "index": 0, "content_block": map[string]interface{}{"type": "text", "text": ""}})
+	for _, word := range strings.SplitAfter(api.reply, " ") {
+		send(map[string]interface{}{"type": "content_block_delta", "index": 0, "delta": map[string]interface{}{"type": "text_delta", "text": word}})
+	}
+	send(map[string]interface{}{"type": "content_block_stop", "index": 0})
+	send(map[string]interface{}{"type": "message_delta",
+		"delta": map[string]interface{}{"stop_reason": "stop_sequence", "stop_sequence": "###"},
+		"usage": map[string]interface{}{"output_tokens": 8},
+	})
+	send(map[string]interface{}{"type": "message_stop"})
+}
+
+// text returns the text of the request's messages in order
+func (api *messagesAPI) text() []string {
+	var texts []string
+	for _, m := range api.request["messages"].([]interface{}) {
+		content := m.(map[string]interface{})["content"].([]interface{})
+		texts = append(texts, content[0].(map[string]interface{})["text"].(string))
+	}
+	return texts
+}
+
+func TestClaudeComplete(t *testing.T) {
+	api := newMessagesAPI(t, "Show your newest reviews first.")
+	claude := providers.NewClaudeProvider("test-key", providers.ClaudeOptions{
+		Model:       "claude-haiku-4-5",
+		MaxTokens:   300,
+		Temperature: 0.2,
+		BaseURL:     api.URL,
+	})
+
+	resp, err := claude.Complete(context.Background(), providers.Request{
+		System: "You advise online shops.",
+		Messages: []providers.Message{
+			{Role: providers.RoleUser, Content: "How do I get more conversions?"},
+			{Role: providers.RoleAssistant, Content: "Which proofs do you show?"},
+			{Role: providers.RoleUser, Content: "Reviews."},
+		},
+		StopSequences: []string{"###"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Show your newest reviews first.", resp.Text)
+	assert.Equal(t, "end_turn", resp.StopReason)
+	assert.Equal(t, providers.Usage{InputTokens: 25, OutputTokens: 8}, resp.Usage)
+
+	assert.Equal(t, "test-key", api.headers.Get("X-Api-Key"))
+	assert.NotEmpty(t, api.headers.Get("Anthropic-Version"))
+	assert.Equal(t, "claude-haiku-4-5", api.request["model"])
+	assert.Equal(t, float64(300), api.request["max_tokens"])
+	assert.Equal(t, 0.2, api.request["temperature"])
+	assert.Equal(t, []interface{}{"###"}, api.request["stop_sequences"])
+	assert.Equal(t, "You advise online shops.", api.request["system"].([]interface{})[0].(map[string]interface{})["text"])
+	assert.Equal(t, []string{"How do I get more conversions?", "Which proofs do you show?", "Reviews."}, api.text())
+	assert.Equal(t, "assistant", api.request["messages"].([]interface{})[1].(map[string]interface{})["role"])
+
+	// The request's limits override the provider's own
+	_, err = claude.Complete(context.Background(), providers.Request{
+		Messages:    providers.Prompt("Write a headline").Messages,
+		MaxTokens:   40,
+		Temperature: providers.Temperature(0.9),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, float64(40), api.request["max_tokens"])
+	assert.Equal(t, 0.9, api.request["temperature"])
+	assert.Nil(t, api.request["system"])
+
+	// API errors are returned, not retried
+	api.status = http.StatusBadRequest
+	_, err = claude.Complete(context.Background(), providers.Prompt("Write a headline"))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "400")
+	}
+
+	api.status = http.StatusOK
+	api.reply = ""
+	_, err = claude.Complete(context.Background(), providers.Prompt("Write a headline"))
+	assert.Error(t, err)
+}
+
+func TestClaudeStream(t *testing.T) {
+	api := newMessagesAPI(t, "Loved by 2,000 shoppers")
+	claude := providers.NewClaudeProvider("test-key", providers.ClaudeOptions{BaseURL: api.URL})
+
+	stream, err := claude.Stream(context.Background(), providers.Prompt("Write a headline"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer stream.Close()
+
+	var chunks []string
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+		chunks = append(chunks, chunk.Text)
+	}
+	assert.Equal(t, []string{"Loved ", "by ", "2,000 ", "shoppers"}, chunks)
+	assert.Equal(t, true, api.request["stream"])
+
+	resp := stream.Response()
+	assert.Equal(t, "Loved by 2,000 shoppers", resp.Text)
+	assert.Equal(t, "stop_sequence", resp.StopReason)
+	assert.Equal(t, providers.Usage{InputTokens: 25, OutputTokens: 8}, resp.Usage)
+}
+
+func TestClaudeAnalyzeSentiment(t *testing.T) {
+	api := newMessagesAPI(t, " 0.85\n")
+	claude := providers.NewClaudeProvider("test-key", providers.ClaudeOptions{BaseURL: api.URL})
+
+	score, err := claude.AnalyzeSentiment(context.Background(), "Arrived early and works perfectly")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.85, score)
+	assert.Equal(t, providers.DefaultClaudeModel, api.request["model"])
+	assert.Equal(t, float64(0), api.request["temperature"])
+	assert.Contains(t, api.text()[0], "Arrived early and works perfectly")
+
+	api.reply = "I can't tell"
+	_, err = claude.AnalyzeSentiment(context.Background(), "Hmm")
+	assert.Error(t, err)
+}
+
+func TestCancelledCall(t *testing.T) {
+	api := newMessagesAPI(t, "Too late")
+	claude := providers.NewClaudeProvider("test-key", providers.ClaudeOptions{BaseURL: api.URL})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := claude.Complete(ctx, providers.Prompt("Hi"))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, api.request, "the request was never sent")
+}
+
+func TestLlamaComplete(t *testing.T) {
+	var payload map[string]interface{}
+	llama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload = nil
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		w.Write([]byte(`{"text": "Add photos"}`))
+	}))
+	defer llama.Close()
+	provider := providers.NewLlamaProvider(llama.URL)
+
+	// A lone prompt is sent as it is, with the provider's defaults
+	resp, err := provider.Complete(context.Background(), providers.Prompt("Any tips?"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Add photos", resp.Text)
+	assert.Equal(t, "Any tips?", payload["prompt"])
+	assert.Equal(t, float64(1000), payload["max_tokens"])
+	assert.Equal(t, 0.7, payload["temperature"])
+	assert.Nil(t, payload["stop"])
+
+	// A conversation is rendered as a transcript
+	_, err = provider.Complete(context.Background(), providers.Request{
+		System:        "Be brief.",
+		Messages:      []providers.Message{{Role: providers.RoleUser, Content: "Any tips?"}},
+		MaxTokens:     20,
+		Temperature:   providers.Temperature(0),
+		StopSequences: []string{"User:"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Be brief.\n\nUser: Any tips?\n\nAssistant:", payload["prompt"])
+	assert.Equal(t, float64(20), payload["max_tokens"])
+	assert.Equal(t, float64(0), payload["temperature"])
+	assert.Equal(t, []interface{}{"User:"}, payload["stop"])
+
+	// The Llama server cannot stream, so the answer arrives in one chunk
+	stream, err := provider.Stream(context.Background(), providers.Prompt("Any tips?"))
+	assert.NoError(t, err)
+	chunk, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "Add photos", chunk.Text)
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+	assert.NoError(t, stream.Close())
+}
+
+func TestClaudePing(t *testing.T) {
+	api := newMessagesAPI(t, "")
+	claude := providers.NewClaudeProvider("test-key", providers.ClaudeOptions{BaseURL: api.URL})
+	assert.NoError(t, providers.Ping(context.Background(), claude))
+
+	api.Close()
+	assert.Error(t, providers.Ping(context.Background(), claude))
+}
+
+func TestClaudeFactory(t *testing.T) {
+	api := newMessagesAPI(t, "Hello")
+
+	_, err := factory.CreateProvider(factory.Claude, map[string]string{"api_key": ""})
+	assert.Error(t, err)
+
+	_, err = factory.CreateProvider(factory.Claude, map[string]string{"api_key": "test-key", "max_tokens": "lots"})
+	assert.Error(t, err)
+
+	provider, err := factory.CreateProvider(factory.Claude, map[string]string{
+		"api_key":     "test-key",
+		"model":       "claude-3-opus-latest",
+		"max_tokens":  "64",
+		"temperature": "0.5",
+		"base_url":    api.URL,
+	})
+	assert.NoError(t, err)
+
+	resp, err := provider.Complete(context.Background(), providers.Prompt("Hi"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello", resp.Text)
+	assert.Equal(t, "claude-3-opus-latest", api.request["model"])
+	assert.Equal(t, float64(64), api.request["max_tokens"])
+	assert.Equal(t, 0.5, api.request["temperature"])
+}
@@ -0,0 +1,179 @@
+package reports_test
+
+import (
+	"context"
+	"nyasah-backend/models"
+	"nyasah-backend/services/jobs"
+	"nyasah-backend/services/mail"
+	"nyasah-backend/services/reports"
+	"nyasah-backend/tests/testutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+func (m *fakeMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func setupDB(t *testing.T) *gorm.DB {
+	return testutil.DB(t, &models.Tenant{}, &models.Entity{}, &models.Review{}, &models.ProofRollup{},
+		&models.AIRecommendation{}, &models.ReportDefinition{}, &models.ReportRun{}, &models.Job{})
+}
+
+func TestSchedule(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "5-1 * * * *", "@yearly"} {
+		_, err := reports.ParseSchedule(expr)
+		assert.ErrorIs(t, err, reports.ErrInvalidSchedule, expr)
+	}
+
+	ny, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+
+	// Mondays at 08:00 New York time
+	weekly, err := reports.ParseSchedule("0 8 * * 1")
+	assert.NoError(t, err)
+	next := weekly.Next(time.Date(2024, 3, 6, 12, 0, 0, 0, ny), ny)
+	assert.Equal(t, time.Date(2024, 3, 11, 8, 0, 0, 0, ny), next)
+	assert.Equal(t, 12, next.UTC().Hour()) // daylight saving started on the 10th
+
+	// 02:30 does not exist on the day clocks go forward
+	nightly, err := reports.ParseSchedule("30 2 * * *")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 11, 2, 30, 0, 0, ny), nightly.Next(time.Date(2024, 3, 9, 3, 0, 0, 0, ny), ny))
+
+	// With both day fields restricted either one matches
+	either, err := reports.ParseSchedule("0 0 13 * 5")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 9, 6, 0, 0, 0, 0, time.UTC), either.Next(time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC), time.UTC))
+	assert.Equal(t, time.Date(2024, 9, 13, 0, 0, 0, 0, time.UTC), either.Next(time.Date(2024, 9, 6, 0, 0, 0, 0, time.UTC), time.UTC))
+
+	steps, err := reports.ParseSchedule("*/20 9-17 * * 1-5")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 9, 9, 9, 0, 0, 0, time.UTC), steps.Next(time.Date(2024, 9, 6, 17, 40, 0, 0, time.UTC), time.UTC))
+
+	never, err := reports.ParseSchedule("0 0 30 2 *")
+	assert.NoError(t, err)
+	assert.True(t, never.Next(time.Now(), time.UTC).IsZero())
+}
+
+func TestScheduledRun(t *testing.T) {
+	db := setupDB(t)
+	mailer := &fakeMailer{}
+	service := reports.NewService(db, mailer)
+	queue := jobs.NewQueue(db, jobs.Options{})
+	service.RegisterJobs(queue)
+
+	tenant := models.Tenant{Name: "Acme", Domain: "acme.test", Type: "ecommerce", ApiKey: "key",
+		Settings: []byte(`{"time_zone": "Europe/Berlin"}`)}
+	assert.NoError(t, db.Create(&tenant).Error)
+	lamp := models.Entity{TenantID: tenant.ID, Type: "product", Name: "Desk Lamp"}
+	chair := models.Entity{TenantID: tenant.ID, Type: "product", Name: "Office Chair"}
+	assert.NoError(t, db.Create(&lamp).Error)
+	assert.NoError(t, db.Create(&chair).Error)
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+	created := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	def := models.ReportDefinition{
+		TenantID:   tenant.ID,
+		Name:       "Weekly Digest",
+		Schedule:   "0 8 * * 1",
+		Recipients: []string{"team@acme.test"},
+		Enabled:    true,
+	}
+	assert.NoError(t, reports.Normalize(&def))
+	assert.Equal(t, reports.Sections, def.Sections)
+	assert.NoError(t, service.Reschedule(&def, created))
+	assert.NoError(t, db.Create(&def).Error)
+	end := time.Date(2024, 9, 2, 8, 0, 0, 0, berlin).UTC()
+	assert.True(t, end.Equal(*def.NextRunAt))
+
+	enriched := end.Add(-time.Hour)
+	review := func(entity models.Entity, rating int, sentiment float64, at time.Time) {
+		r := models.Review{TenantID: tenant.ID, EntityID: entity.ID, Rating: rating, Content: "Review", Sentiment: sentiment, EnrichedAt: &enriched, CreatedAt: at}
+		assert.NoError(t, db.Create(&r).Error)
+	}
+	// This week: the lamp is reviewed more but its sentiment fell
+	for i := 0; i < 3; i++ {
+		review(lamp, 2, -0.5, end.Add(-time.Duration(i+1)*24*time.Hour))
+	}
+	review(chair, 5, 0.8, end.Add(-48*time.Hour))
+	// The week before
+	review(lamp, 5, 0.6, end.Add(-8*24*time.Hour))
+	review(chair, 5, 0.7, end.Add(-9*24*time.Hour))
+	// Outside both periods
+	review(chair, 1, -0.9, end.Add(time.Hour))
+	assert.NoError(t, db.Create(&models.AIRecommendation{TenantID: tenant.ID, Type: "timing", Suggestion: "Show reviews at checkout", Confidence: 0.8, CreatedAt: end.Add(-time.Hour)}).Error)
+
+	// Nothing is due before the scheduled time
+	n, err := service.Dispatch(end.Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = service.Dispatch(end.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	found, err := queue.Work(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	var runs []models.ReportRun
+	assert.NoError(t, db.Find(&runs).Error)
+	if !assert.Len(t, runs, 1) {
+		return
+	}
+	run := runs[0]
+	assert.True(t, run.PeriodEnd.Equal(end))
+	assert.True(t, run.PeriodStart.Equal(end.Add(-7*24*time.Hour)))
+	assert.NotNil(t, run.DeliveredAt)
+
+	assert.Contains(t, run.HTML, "Weekly Digest")
+	assert.Contains(t, run.HTML, "Mon 26 Aug 2024 08:00 CEST")
+	assert.Contains(t, run.HTML, "Show reviews at checkout")
+	assert.Contains(t, run.CSV, "top_entities,Entity,Reviews,Average rating\ntop_entities,Desk Lamp,3,2.00\ntop_entities,Office Chair,1,5.00\n")
+	assert.Contains(t, run.CSV, "new_reviews,Reviews,4\n")
+	assert.Contains(t, run.CSV, "sentiment_change,Desk Lamp,-0.50,0.60,-1.10,3\n")
+	assert.Contains(t, run.CSV, "proof_conversion,Impressions,0\n")
+
+	if assert.Len(t, mailer.sent, 1) {
+		msg := mailer.sent[0]
+		assert.Equal(t, []string{"team@acme.test"}, msg.To)
+		assert.Equal(t, run.HTML, msg.HTML)
+		if assert.Len(t, msg.Attachments, 1) {
+			assert.Equal(t, "weekly-digest-2024-09-02.csv", msg.Attachments[0].Filename)
+			assert.Equal(t, run.CSV, string(msg.Attachments[0].Data))
+		}
+	}
+
+	// The next run is a week later and picks up where this one ended
+	assert.NoError(t, db.First(&def, "id = ?", def.ID).Error)
+	assert.True(t, def.NextRunAt.Equal(end.AddDate(0, 0, 7)))
+	assert.True(t, def.LastRunAt.Equal(end))
+
+	// Running the same period again neither regenerates nor resends it
+	again, err := service.Generate(def, run.PeriodStart, run.PeriodEnd)
+	assert.NoError(t, err)
+	assert.Equal(t, run.ID, again.ID)
+	assert.Len(t, mailer.sent, 1)
+}
+
+func TestFilename(t *testing.T) {
+	end := time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC)
+	assert.Equal(t, "weekly-digest-2024-03-04.csv", reports.Filename("Weekly Digest!", end, "csv"))
+	assert.Equal(t, "report-2024-03-04.html", reports.Filename("★★★", end, "html"))
+	assert.True(t, strings.HasPrefix(reports.Filename("Q3 / EU", end, "csv"), "q3-eu-"))
+}
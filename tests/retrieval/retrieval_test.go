@@ -0,0 +1,217 @@
+package retrieval_test
+
+import (
+	"context"
+	"nyasah-backend/models"
+	"nyasah-backend/services/ai/providers"
+	"nyasah-backend/services/retrieval"
+	"nyasah-backend/tests/testutil"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func setupDB(t *testing.T) *gorm.DB {
+	return testutil.DB(t, &models.Entity{}, &models.Review{}, &models.SocialProof{}, &models.ReviewEmbedding{})
+}
+
+// textOnly is a provider that cannot embed
+type textOnly struct{}
+
+func (textOnly) Complete(ctx context.Context, req providers.Request) (providers.Response, error) {
+	return providers.Response{}, nil
+}
+func (textOnly) Stream(ctx context.Context, req providers.Request) (providers.Stream, error) {
+	return providers.SingleChunk(providers.Response{}), nil
+}
+func (textOnly) AnalyzeSentiment(ctx context.Context, text string) (float64, error) {
+	return 0, nil
+}
+
+// topics embeds text by the topics its words belong to, so texts about the
+// same topic are similar without sharing words
+type topics struct {
+	textOnly
+}
+
+var topicWords = [][]string{
+	{"delivery", "parcel", "arrived", "shipping", "late", "weeks"},
+	{"size", "sizing", "small", "fit", "tight"},
+}
+
+func (topics) Embed(ctx context.Context, texts []string) (providers.Embeddings, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = make([]float32, len(topicWords))
+		for _, word := range strings.Fields(strings.ToLower(text)) {
+			for topic, words := range topicWords {
+				for _, w := range words {
+					if word == w {
+						vectors[i][topic]++
+					}
+				}
+			}
+		}
+	}
+	return providers.Embeddings{Model: "topics", Vectors: vectors}, nil
+}
+
+func createReview(t *testing.T, db *gorm.DB, review models.Review) models.Review {
+	assert.NoError(t, db.Create(&review).Error)
+	return review
+}
+
+func labels(sources []retrieval.Source) []string {
+	var result []string
+	for _, source := range sources {
+		result = append(result, source.Label)
+	}
+	return result
+}
+
+func TestTerms(t *testing.T) {
+	assert.Equal(t, []string{"customer", "complain", "sizing"}, retrieval.Terms("What are customers complaining about? Sizing!"))
+	assert.Empty(t, retrieval.Terms("What is it?"))
+}
+
+func TestKeywordRetrieval(t *testing.T) {
+	db := setupDB(t)
+	tenantID := uuid.New()
+	now := time.Now()
+
+	sneakers := models.Entity{TenantID: tenantID, Type: "product", Name: "Trail Sneakers", Description: "Waterproof running shoes"}
+	assert.NoError(t, db.Create(&sneakers).Error)
+
+	sizing := createReview(t, db, models.Review{TenantID: tenantID, EntityID: sneakers.ID, Rating: 2,
+		Content: "Sizing runs small, and the sizing chart is wrong", CreatedAt: now.Add(-2 * time.Hour)})
+	tight := createReview(t, db, models.Review{TenantID: tenantID, Rating: 3,
+		Content: "Sizing was a bit tight", CreatedAt: now.Add(-time.Hour)})
+	createReview(t, db, models.Review{TenantID: tenantID, Rating: 5, Content: "Lovely colour", CreatedAt: now})
+	createReview(t, db, models.Review{TenantID: tenantID, Rating: 1, Content: "Sizing is off", Status: "rejected"})
+	createReview(t, db, models.Review{TenantID: uuid.New(), Rating: 1, Content: "Sizing is awful"})
+
+	proof := models.SocialProof{TenantID: tenantID, EntityID: sneakers.ID, Type: "review", Content: "Great sneakers, true to sizing"}
+	assert.NoError(t, db.Create(&proof).Error)
+
+	retriever := retrieval.NewRetriever(db, providers.Instrument("text", textOnly{}), retrieval.Options{})
+	result, err := retriever.Retrieve(context.Background(), tenantID, "Any complaints about sizing of the sneakers?")
+	assert.NoError(t, err)
+
+	// Both sizing reviews, the more relevant first; rejected and other tenants' reviews are left out
+	assert.Equal(t, []string{"R1", "R2", "E1", "P1"}, labels(result.Sources))
+	assert.Equal(t, []uuid.UUID{sizing.ID, tight.ID}, retrieval.ReviewIDs(result.Sources))
+	assert.Equal(t, "Trail Sneakers", result.Sources[0].Entity)
+	assert.Equal(t, sneakers.ID, result.Sources[2].ID)
+	assert.Equal(t, proof.ID, result.Sources[3].ID)
+	assert.Zero(t, result.Omitted)
+
+	context := result.Context()
+	assert.Contains(t, context, "[R1] (review, 2/5 stars, Trail Sneakers) Sizing runs small")
+	assert.Contains(t, context, "[E1] (entity) Trail Sneakers (product): Waterproof running shoes")
+	assert.Contains(t, context, "[P1] (proof, Trail Sneakers) review: Great sneakers")
+}
+
+func TestVectorRetrieval(t *testing.T) {
+	db := setupDB(t)
+	tenantID := uuid.New()
+	provider := providers.Instrument("topics", topics{})
+
+	late := createReview(t, db, models.Review{TenantID: tenantID, Rating: 1, Content: "Parcel arrived three weeks late"})
+	createReview(t, db, models.Review{TenantID: tenantID, Rating: 4, Content: "Fit is a little tight"})
+	mentions := createReview(t, db, models.Review{TenantID: tenantID, Rating: 3, Content: "Slow shipping"})
+	for _, review := range []models.Review{late, mentions} {
+		embeddings, err := providers.Embed(context.Background(), provider, []string{review.Content})
+		assert.NoError(t, err)
+		assert.NoError(t, db.Create(&models.ReviewEmbedding{ReviewID: review.ID, TenantID: tenantID, Model: embeddings.Model, Vector: embeddings.Vectors[0]}).Error)
+	}
+
+	// The late parcel shares no word with the question, but is about delivery
+	retriever := retrieval.NewRetriever(db, provider, retrieval.Options{})
+	result, err := retriever.Retrieve(context.Background(), tenantID, "Is delivery slow?")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []uuid.UUID{late.ID, mentions.ID}, retrieval.ReviewIDs(result.Sources))
+	// Found by both searches, the review mentioning "slow" ranks first
+	assert.Equal(t, mentions.ID, result.Sources[0].ID)
+}
+
+func TestVectorStorage(t *testing.T) {
+	db := setupDB(t)
+	review := createReview(t, db, models.Review{TenantID: uuid.New(), Content: "Great"})
+	vector := models.Vector{0.25, -1.5, 3}
+	assert.NoError(t, db.Create(&models.ReviewEmbedding{ReviewID: review.ID, TenantID: review.TenantID, Vector: vector}).Error)
+
+	// Vectors are stored as four bytes per dimension
+	var size int
+	assert.NoError(t, db.Raw("SELECT length(vector) FROM review_embeddings WHERE typeof(vector) = 'blob'").Scan(&size).Error)
+	assert.Equal(t, 12, size)
+
+	var stored models.ReviewEmbedding
+	assert.NoError(t, db.First(&stored, "review_id = ?", review.ID).Error)
+	assert.Equal(t, vector, stored.Vector)
+}
+
+func TestTokenBudget(t *testing.T) {
+	db := setupDB(t)
+	tenantID := uuid.New()
+	for i := 0; i < 30; i++ {
+		createReview(t, db, models.Review{TenantID: tenantID, Rating: 4, Content: "Comfortable. " + strings.Repeat("Really comfortable shoes ", 100)})
+	}
+
+	retriever := retrieval.NewRetriever(db, textOnly{}, retrieval.Options{MaxReviews: 30, TokenBudget: 1000})
+	result, err := retriever.Retrieve(context.Background(), tenantID, "Are they comfortable?")
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, result.Tokens, 1000)
+	assert.Equal(t, []string{"R1", "R2", "R3"}, labels(result.Sources))
+	assert.Equal(t, 27, result.Omitted)
+
+	// Long reviews are cut so more of them fit
+	assert.Less(t, len(result.Sources[0].Text), 1300)
+	assert.True(t, strings.HasSuffix(result.Sources[0].Text, "…"))
+
+	// Text without spaces is cut between runes
+	other := uuid.New()
+	createReview(t, db, models.Review{TenantID: other, Rating: 5, Content: "a" + strings.Repeat("快適", 500)})
+	result, err = retriever.Retrieve(context.Background(), other, "Are they comfortable?")
+	assert.NoError(t, err)
+	if assert.Len(t, result.Sources, 1) {
+		assert.True(t, utf8.ValidString(result.Sources[0].Text))
+		assert.True(t, strings.HasSuffix(result.Sources[0].Text, "快…"))
+	}
+}
+
+func TestNewestReviewsWithoutMatches(t *testing.T) {
+	db := setupDB(t)
+	tenantID := uuid.New()
+	now := time.Now()
+	old := createReview(t, db, models.Review{TenantID: tenantID, Content: "Good", CreatedAt: now.Add(-time.Hour)})
+	recent := createReview(t, db, models.Review{TenantID: tenantID, Content: "Great", CreatedAt: now})
+
+	retriever := retrieval.NewRetriever(db, textOnly{}, retrieval.Options{})
+	result, err := retriever.Retrieve(context.Background(), tenantID, "What should I improve?")
+	assert.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{recent.ID, old.ID}, retrieval.ReviewIDs(result.Sources))
+
+	empty, err := retriever.Retrieve(context.Background(), uuid.New(), "What should I improve?")
+	assert.NoError(t, err)
+	assert.Empty(t, empty.Sources)
+	assert.Empty(t, empty.Context())
+}
+
+func TestCited(t *testing.T) {
+	result := retrieval.Result{Sources: []retrieval.Source{
+		{Label: "R1", Type: retrieval.SourceReview, ID: uuid.New()},
+		{Label: "R2", Type: retrieval.SourceReview, ID: uuid.New()},
+		{Label: "R3", Type: retrieval.SourceReview, ID: uuid.New()},
+		{Label: "E1", Type: retrieval.SourceEntity, ID: uuid.New()},
+	}}
+
+	cited := result.Cited("Shoppers find them small [R3][E1], and some mention the price [R1, R3]. See [R9].")
+	assert.Equal(t, []string{"R1", "R3", "E1"}, labels(cited))
+	assert.Equal(t, []uuid.UUID{result.Sources[0].ID, result.Sources[2].ID}, retrieval.ReviewIDs(cited))
+	assert.Empty(t, result.Cited("No citations here."))
+}
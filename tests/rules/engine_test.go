@@ -0,0 +1,93 @@
+package rules_test
+
+import (
+	"nyasah-backend/models"
+	"nyasah-backend/services/rules"
+	"nyasah-backend/tests/testutil"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEngine(t *testing.T) {
+	db := testutil.DB(t, &models.DisplayRule{})
+
+	tenantID := uuid.New()
+	minCart := 100.0
+
+	ruleList := []models.DisplayRule{
+		{
+			TenantID: tenantID, Name: "Hide on checkout", Priority: 100, Enabled: true, Action: rules.ActionHide,
+			Conditions: models.RuleConditions{URLPatterns: []string{"/checkout/*"}},
+		},
+		{
+			TenantID: tenantID, Name: "Big carts in FR on mobile", Priority: 50, Enabled: true, Action: rules.ActionShow,
+			ProofTypes:   []string{"purchase"},
+			FrequencyCap: 2,
+			Conditions: models.RuleConditions{
+				Devices:      []string{"mobile"},
+				Countries:    []string{"FR"},
+				VisitorType:  rules.VisitorReturning,
+				MinCartValue: &minCart,
+			},
+		},
+		{
+			TenantID: tenantID, Name: "Products only", Priority: 10, Enabled: true, Action: rules.ActionShow,
+			ProofTypes: []string{"review"},
+			Conditions: models.RuleConditions{URLPatterns: []string{"/products/*"}},
+		},
+	}
+	assert.NoError(t, db.Create(&ruleList).Error)
+
+	engine := rules.NewEngine(db)
+	cart := 150.0
+	iphone := "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Mobile/15E148"
+
+	t.Run("Highest priority match wins", func(t *testing.T) {
+		decision, err := engine.Decide(tenantID, rules.Visitor{URL: "https://shop.test/checkout/pay"})
+		assert.NoError(t, err)
+		assert.False(t, decision.Show)
+		assert.Equal(t, "Hide on checkout", decision.RuleName)
+	})
+
+	t.Run("Audience conditions and frequency cap", func(t *testing.T) {
+		visitor := rules.Visitor{
+			SessionID: "abc",
+			URL:       "/products/mug",
+			UserAgent: iphone,
+			Country:   "fr",
+			Returning: true,
+			CartValue: &cart,
+		}
+
+		for i := 0; i < 2; i++ {
+			decision, err := engine.Decide(tenantID, visitor)
+			assert.NoError(t, err)
+			assert.Equal(t, "Big carts in FR on mobile", decision.RuleName)
+			assert.True(t, decision.Allows("purchase"))
+			assert.False(t, decision.Allows("review"))
+		}
+
+		// Cap reached, the next rule applies
+		decision, trace, err := engine.Evaluate(tenantID, visitor)
+		assert.NoError(t, err)
+		assert.Equal(t, "Products only", decision.RuleName)
+		assert.Equal(t, "frequency_cap", trace[1].Failed)
+	})
+
+	t.Run("Trace reports the failed condition", func(t *testing.T) {
+		decision, trace, err := engine.Evaluate(tenantID, rules.Visitor{URL: "/about", UserAgent: iphone, Country: "DE"})
+		assert.NoError(t, err)
+		assert.True(t, decision.Show)
+		assert.Nil(t, decision.RuleID)
+		assert.Equal(t, "url_patterns", trace[0].Failed)
+		assert.Equal(t, "countries", trace[1].Failed)
+	})
+
+	t.Run("Device detection", func(t *testing.T) {
+		assert.Equal(t, "mobile", rules.DeviceFromUserAgent(iphone))
+		assert.Equal(t, "tablet", rules.DeviceFromUserAgent("Mozilla/5.0 (iPad; CPU OS 17_0 like Mac OS X)"))
+		assert.Equal(t, "desktop", rules.DeviceFromUserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64)"))
+	})
+}
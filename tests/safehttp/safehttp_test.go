@@ -0,0 +1,43 @@
+package safehttp_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"nyasah-backend/services/safehttp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllowed(t *testing.T) {
+	for _, ip := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254",
+		"100.64.0.1", "0.0.0.0", "::1", "fe80::1", "fd00::1", "::ffff:127.0.0.1", "64:ff9b::a9fe:a9fe"} {
+		assert.False(t, safehttp.Allowed(net.ParseIP(ip)), ip)
+	}
+	for _, ip := range []string{"93.184.216.34", "8.8.8.8", "2606:4700:4700::1111"} {
+		assert.True(t, safehttp.Allowed(net.ParseIP(ip)), ip)
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	ctx := context.Background()
+	assert.ErrorIs(t, safehttp.CheckURL(ctx, "http://169.254.169.254/latest/meta-data/"), safehttp.ErrBlockedAddress)
+	assert.ErrorIs(t, safehttp.CheckURL(ctx, "http://[::1]:8080/hook"), safehttp.ErrBlockedAddress)
+	assert.ErrorIs(t, safehttp.CheckURL(ctx, "http://localhost:8080/hook"), safehttp.ErrBlockedAddress)
+	assert.NoError(t, safehttp.CheckURL(ctx, "https://93.184.216.34/hook"))
+}
+
+func TestClientRefusesInternalAddresses(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	_, err := safehttp.NewClient(time.Second).Get(server.URL)
+	assert.ErrorIs(t, err, safehttp.ErrBlockedAddress)
+	assert.False(t, called)
+}
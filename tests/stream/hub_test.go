@@ -0,0 +1,79 @@
+package stream_test
+
+import (
+	"nyasah-backend/services/stream"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHub(t *testing.T) {
+	tenantID := uuid.New()
+	entityID := uuid.New()
+
+	t.Run("Delivers events for the subscribed entity only", func(t *testing.T) {
+		hub := stream.NewHub(stream.Options{})
+		sub, _, err := hub.Subscribe(tenantID, entityID, 0)
+		assert.NoError(t, err)
+
+		hub.Publish(stream.Event{TenantID: tenantID, EntityID: uuid.New(), Type: "proof"})
+		sent := hub.Publish(stream.Event{TenantID: tenantID, EntityID: entityID, Type: "proof"})
+		hub.Publish(stream.Event{TenantID: uuid.New(), EntityID: entityID, Type: "proof"})
+
+		assert.Len(t, sub.Events, 1)
+		assert.Equal(t, sent.ID, (<-sub.Events).ID)
+	})
+
+	t.Run("Replays events after last event ID", func(t *testing.T) {
+		hub := stream.NewHub(stream.Options{})
+		first := hub.Publish(stream.Event{TenantID: tenantID, EntityID: entityID, Type: "proof"})
+		second := hub.Publish(stream.Event{TenantID: tenantID, EntityID: entityID, Type: "proof"})
+
+		_, replay, err := hub.Subscribe(tenantID, entityID, first.ID)
+		assert.NoError(t, err)
+		assert.Len(t, replay, 1)
+		assert.Equal(t, second.ID, replay[0].ID)
+	})
+
+	t.Run("Transient events are delivered but not replayed", func(t *testing.T) {
+		hub := stream.NewHub(stream.Options{})
+		sub, _, err := hub.Subscribe(tenantID, entityID, 0)
+		assert.NoError(t, err)
+
+		first := hub.Publish(stream.Event{TenantID: tenantID, EntityID: entityID, Type: "proof"})
+		hub.Publish(stream.Event{TenantID: tenantID, EntityID: entityID, Type: "presence", Transient: true})
+		assert.Equal(t, "proof", (<-sub.Events).Type)
+		assert.Equal(t, "presence", (<-sub.Events).Type)
+
+		_, replay, err := hub.Subscribe(tenantID, entityID, first.ID-1)
+		assert.NoError(t, err)
+		assert.Len(t, replay, 1)
+	})
+
+	t.Run("Caps connections per tenant", func(t *testing.T) {
+		hub := stream.NewHub(stream.Options{MaxConnectionsPerTenant: 1})
+		sub, _, err := hub.Subscribe(tenantID, uuid.Nil, 0)
+		assert.NoError(t, err)
+
+		_, _, err = hub.Subscribe(tenantID, uuid.Nil, 0)
+		assert.ErrorIs(t, err, stream.ErrTooManyConnections)
+
+		hub.Unsubscribe(sub)
+		assert.Equal(t, 0, hub.Connections(tenantID))
+	})
+
+	t.Run("Drops subscribers that fall behind", func(t *testing.T) {
+		hub := stream.NewHub(stream.Options{BufferSize: 1})
+		sub, _, err := hub.Subscribe(tenantID, uuid.Nil, 0)
+		assert.NoError(t, err)
+
+		hub.Publish(stream.Event{TenantID: tenantID, Type: "proof"})
+		hub.Publish(stream.Event{TenantID: tenantID, Type: "proof"})
+
+		<-sub.Events
+		_, open := <-sub.Events
+		assert.False(t, open)
+		assert.Equal(t, 0, hub.Connections(tenantID))
+	})
+}
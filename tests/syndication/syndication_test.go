@@ -0,0 +1,73 @@
+package syndication_test
+
+import (
+	"nyasah-backend/models"
+	"nyasah-backend/services/syndication"
+	"nyasah-backend/tests/testutil"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyndication(t *testing.T) {
+	db := testutil.DB(t, &models.Review{}, &models.SyndicationGroup{}, &models.SyndicationMember{})
+
+	tenantID := uuid.New()
+	eu, us, other := uuid.New(), uuid.New(), uuid.New()
+
+	reviews := []models.Review{
+		{TenantID: tenantID, EntityID: eu, Rating: 5, Content: "EU review"},
+		{TenantID: tenantID, EntityID: us, Rating: 3, Content: "US review"},
+		{TenantID: tenantID, EntityID: us, Rating: 1, Content: "Pending US review", Status: "pending"},
+		{TenantID: tenantID, EntityID: other, Rating: 1, Content: "Unrelated"},
+	}
+	assert.NoError(t, db.Create(&reviews).Error)
+
+	group := models.SyndicationGroup{
+		TenantID: tenantID,
+		Name:     "Regions",
+		Enabled:  true,
+		Members:  []models.SyndicationMember{{EntityID: eu}, {EntityID: us}},
+	}
+	assert.NoError(t, db.Create(&group).Error)
+
+	service := syndication.NewService(db)
+
+	t.Run("Syndicated reviews are shown with origin", func(t *testing.T) {
+		list, err := service.ListReviews(tenantID, eu)
+		assert.NoError(t, err)
+		assert.Len(t, list, 2)
+
+		for _, review := range list {
+			if review.Content == "US review" {
+				assert.True(t, review.Syndicated)
+				assert.Equal(t, us, review.OriginEntityID)
+			} else {
+				assert.False(t, review.Syndicated)
+			}
+		}
+	})
+
+	t.Run("Aggregates exclude syndicated reviews unless enabled", func(t *testing.T) {
+		summary, err := service.Summarize(tenantID, eu)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), summary.ReviewCount)
+
+		assert.NoError(t, db.Model(&models.SyndicationGroup{ID: group.ID}).Update("count_in_aggregates", true).Error)
+
+		summary, err = service.Summarize(tenantID, eu)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), summary.ReviewCount)
+		assert.Equal(t, int64(1), summary.SyndicatedCount)
+		assert.Equal(t, 4.0, summary.AverageRating)
+	})
+
+	t.Run("Disabled groups stop syndication", func(t *testing.T) {
+		assert.NoError(t, db.Model(&models.SyndicationGroup{ID: group.ID}).Update("enabled", false).Error)
+
+		list, err := service.ListReviews(tenantID, eu)
+		assert.NoError(t, err)
+		assert.Len(t, list, 1)
+	})
+}
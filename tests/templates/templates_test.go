@@ -0,0 +1,81 @@
+package templates_test
+
+import (
+	"nyasah-backend/models"
+	"nyasah-backend/services/templates"
+	"nyasah-backend/tests/testutil"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	vars := templates.Vars{"name": "John D.", "city": "Lyon", "count": "3"}
+
+	t.Run("Placeholders", func(t *testing.T) {
+		assert.Equal(t, "John D. from Lyon", templates.Format("{name} from {city}", vars, "en"))
+		assert.Equal(t, "Hi !", templates.Format("Hi {unknown}!", vars, "en"))
+	})
+
+	t.Run("Plurals", func(t *testing.T) {
+		body := "{count, plural, =0 {Nobody} one {# person} other {# people}} bought this"
+		assert.Equal(t, "3 people bought this", templates.Format(body, vars, "en"))
+		assert.Equal(t, "1 person bought this", templates.Format(body, templates.Vars{"count": "1"}, "en"))
+		assert.Equal(t, "Nobody bought this", templates.Format(body, templates.Vars{"count": "0"}, "en"))
+	})
+
+	t.Run("Plural categories by locale", func(t *testing.T) {
+		assert.Equal(t, "one", templates.PluralCategory("fr", 0))
+		assert.Equal(t, "other", templates.PluralCategory("en", 0))
+		assert.Equal(t, "few", templates.PluralCategory("ru", 3))
+		assert.Equal(t, "many", templates.PluralCategory("ru", 11))
+		assert.Equal(t, "other", templates.PluralCategory("ja", 1))
+	})
+
+	t.Run("Name anonymization", func(t *testing.T) {
+		assert.Equal(t, "John D.", templates.DisplayName("John", "Doe", templates.NameFirstInitial, "en"))
+		assert.Equal(t, "John", templates.DisplayName("John", "Doe", templates.NameFirst, "en"))
+		assert.Equal(t, "Jemand", templates.DisplayName("John", "Doe", templates.NameAnonymous, "de"))
+	})
+}
+
+func TestRenderProofs(t *testing.T) {
+	db := testutil.DB(t, &models.Tenant{}, &models.Entity{}, &models.ProofTemplate{})
+
+	tenantID := uuid.New()
+	entity := models.Entity{TenantID: tenantID, Type: "product", Name: "Blue Mug"}
+	assert.NoError(t, db.Create(&entity).Error)
+
+	tmpls := []models.ProofTemplate{
+		{TenantID: tenantID, Type: "purchase", Locale: "en", Body: "{name} from {city} bought {entity_name} {time_ago}"},
+		{TenantID: tenantID, Type: "purchase", Locale: "fr", Body: "{name} de {city} a acheté {entity_name} {time_ago}", NameStyle: templates.NameFirst},
+	}
+	assert.NoError(t, db.Create(&tmpls).Error)
+
+	newProofs := func() []models.SocialProof {
+		return []models.SocialProof{
+			{
+				TenantID:  tenantID,
+				Type:      "purchase",
+				EntityID:  entity.ID,
+				Content:   "fallback",
+				Metadata:  models.JSON{"first_name": "Marie", "last_name": "Curie", "city": "Paris"},
+				CreatedAt: time.Now().Add(-5 * time.Minute),
+			},
+			{TenantID: tenantID, Type: "review", Content: "No template"},
+		}
+	}
+
+	service := templates.NewService(db)
+
+	proofs := newProofs()
+	assert.NoError(t, service.RenderProofs(tenantID, proofs, "en-GB"))
+	assert.Equal(t, "Marie C. from Paris bought Blue Mug 5 minutes ago", proofs[0].Content)
+	assert.Equal(t, "No template", proofs[1].Content)
+
+	proofs = newProofs()
+	assert.NoError(t, service.RenderProofs(tenantID, proofs, "fr-CA"))
+	assert.Equal(t, "Marie de Paris a acheté Blue Mug il y a 5 minutes", proofs[0].Content)
+}
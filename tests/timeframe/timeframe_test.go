@@ -0,0 +1,124 @@
+package timeframe_test
+
+import (
+	"encoding/json"
+	"nyasah-backend/services/timeframe"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s not available: %v", name, err)
+	}
+	return loc
+}
+
+func TestStart(t *testing.T) {
+	// Wednesday 15 October 2025, 13:45 UTC
+	at := time.Date(2025, 10, 15, 13, 45, 0, 0, time.UTC)
+
+	assert.Equal(t, time.Date(2025, 10, 15, 13, 0, 0, 0, time.UTC), timeframe.Start(at, timeframe.Hour, time.UTC))
+	assert.Equal(t, time.Date(2025, 10, 15, 0, 0, 0, 0, time.UTC), timeframe.Start(at, timeframe.Day, time.UTC))
+	assert.Equal(t, time.Date(2025, 10, 13, 0, 0, 0, 0, time.UTC), timeframe.Start(at, timeframe.Week, time.UTC))
+	assert.Equal(t, time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC), timeframe.Start(at, timeframe.Month, time.UTC))
+
+	// Sunday belongs to the week that started the previous Monday
+	sunday := time.Date(2025, 10, 19, 23, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2025, 10, 13, 0, 0, 0, 0, time.UTC), timeframe.Start(sunday, timeframe.Week, time.UTC))
+
+	t.Run("Buckets follow the local calendar", func(t *testing.T) {
+		kolkata := mustLoad(t, "Asia/Kolkata")
+
+		// Sunday 19:00 UTC is already Monday 00:30 in India
+		got := timeframe.Start(time.Date(2025, 10, 19, 19, 0, 0, 0, time.UTC), timeframe.Week, kolkata)
+		assert.Equal(t, time.Date(2025, 10, 20, 0, 0, 0, 0, kolkata), got)
+		assert.Equal(t, time.Date(2025, 10, 19, 18, 30, 0, 0, time.UTC), got.UTC())
+	})
+}
+
+func TestFrames(t *testing.T) {
+	t.Run("Days across a daylight saving change", func(t *testing.T) {
+		newYork := mustLoad(t, "America/New_York")
+		spec := timeframe.Spec{
+			From:        time.Date(2025, 11, 1, 12, 0, 0, 0, newYork),
+			To:          time.Date(2025, 11, 3, 12, 0, 0, 0, newYork),
+			Granularity: timeframe.Day,
+			Location:    newYork,
+		}
+		assert.NoError(t, spec.Validate())
+
+		frames := spec.Frames()
+		assert.Len(t, frames, 3)
+		assert.Equal(t, time.Date(2025, 11, 1, 0, 0, 0, 0, newYork), frames[0].Start)
+		// Clocks go back on 2 November, so that day lasts 25 hours
+		assert.Equal(t, 25*time.Hour, frames[1].End.Sub(frames[1].Start))
+		assert.Equal(t, time.Date(2025, 11, 4, 0, 0, 0, 0, newYork), frames[2].End)
+	})
+
+	t.Run("Last covers whole buckets ending with the current one", func(t *testing.T) {
+		now := time.Date(2025, 10, 15, 13, 45, 0, 0, time.UTC)
+		spec := timeframe.Last(12, now, timeframe.Week, time.UTC)
+		assert.NoError(t, spec.Validate())
+
+		frames := spec.Frames()
+		assert.Len(t, frames, 12)
+		assert.Equal(t, time.Monday, frames[0].Start.Weekday())
+		assert.Equal(t, time.Date(2025, 10, 20, 0, 0, 0, 0, time.UTC), frames[11].End)
+	})
+
+	t.Run("Last treats its end as exclusive", func(t *testing.T) {
+		// to=2026-10-18 is parsed as the next midnight, the Monday starting a new week
+		end := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+		frames := timeframe.Last(12, end, timeframe.Week, time.UTC).Frames()
+		assert.Len(t, frames, 12)
+		assert.Equal(t, end, frames[11].End)
+		assert.Equal(t, time.Date(2026, 7, 27, 0, 0, 0, 0, time.UTC), frames[0].Start)
+	})
+
+	t.Run("Index finds the frame containing a time", func(t *testing.T) {
+		spec := timeframe.Spec{
+			From:        time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			To:          time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC),
+			Granularity: timeframe.Month,
+		}
+		assert.NoError(t, spec.Validate())
+		frames := spec.Frames()
+
+		assert.Equal(t, 0, timeframe.Index(frames, spec.From))
+		assert.Equal(t, 1, timeframe.Index(frames, time.Date(2025, 2, 28, 23, 0, 0, 0, time.UTC)))
+		assert.Equal(t, 2, timeframe.Index(frames, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)))
+		assert.Equal(t, -1, timeframe.Index(frames, spec.To))
+		assert.Equal(t, -1, timeframe.Index(frames, spec.From.Add(-time.Second)))
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		spec := timeframe.Spec{From: from, To: from.AddDate(0, 0, 1), Granularity: "year"}
+		assert.ErrorIs(t, spec.Validate(), timeframe.ErrInvalidGranularity)
+
+		spec = timeframe.Spec{From: from, To: from}
+		assert.ErrorIs(t, spec.Validate(), timeframe.ErrInvalidRange)
+
+		spec = timeframe.Spec{From: from, To: from.AddDate(1, 0, 0), Granularity: timeframe.Hour}
+		assert.ErrorIs(t, spec.Validate(), timeframe.ErrTooManyFrames)
+	})
+}
+
+func TestLocations(t *testing.T) {
+	loc, err := timeframe.LoadLocation("")
+	assert.NoError(t, err)
+	assert.Equal(t, time.UTC, loc)
+
+	_, err = timeframe.LoadLocation("Mars/Olympus_Mons")
+	assert.ErrorIs(t, err, timeframe.ErrInvalidTimeZone)
+
+	mustLoad(t, "Europe/Berlin")
+	assert.Equal(t, "Europe/Berlin", timeframe.TenantLocation(json.RawMessage(`{"time_zone": "Europe/Berlin"}`)).String())
+	assert.Equal(t, time.UTC, timeframe.TenantLocation(json.RawMessage(`{"time_zone": "Nowhere"}`)))
+	assert.Equal(t, time.UTC, timeframe.TenantLocation(nil))
+}
@@ -0,0 +1,235 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"nyasah-backend/api/handlers"
+	"nyasah-backend/api/middleware"
+	"nyasah-backend/models"
+	"nyasah-backend/services/ai/providers"
+	"nyasah-backend/services/jobs"
+	"nyasah-backend/services/tracing"
+	"nyasah-backend/tests/testutil"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/gorm"
+)
+
+// record installs a tracer provider that keeps finished spans in memory
+func record(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return recorder
+}
+
+func setupDB(t *testing.T) *gorm.DB {
+	db := testutil.DB(t, &models.Tenant{}, &models.User{}, &models.Review{}, &models.Job{})
+	assert.NoError(t, db.Use(tracing.GormPlugin{}))
+	return db
+}
+
+func find(spans []sdktrace.ReadOnlySpan, name string) sdktrace.ReadOnlySpan {
+	for _, span := range spans {
+		if span.Name() == name {
+			return span
+		}
+	}
+	return nil
+}
+
+func attr(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestRequestSpans(t *testing.T) {
+	recorder := record(t)
+	gin.SetMode(gin.TestMode)
+	db := setupDB(t)
+
+	tenant := models.Tenant{Name: "Shop", Domain: "tracing.example.com", Type: "ecommerce", ApiKey: uuid.NewString()}
+	assert.NoError(t, db.Create(&tenant).Error)
+	user := models.User{TenantID: tenant.ID, Email: "owner@tracing.example.com", Password: "hash"}
+	assert.NoError(t, db.Create(&user).Error)
+	assert.Empty(t, recorder.Ended(), "statements outside a trace are not recorded")
+
+	router := gin.New()
+	router.Use(middleware.TracingMiddleware(), func(c *gin.Context) {
+		c.Set("user_id", user.ID.String())
+	}, middleware.TenantMiddleware(db))
+	router.GET("/tenants/:id", func(c *gin.Context) {
+		var found models.Tenant
+		if err := db.WithContext(c.Request.Context()).First(&found, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
+			return
+		}
+		c.JSON(http.StatusOK, found)
+	})
+
+	// The caller's trace is continued
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/tenants/"+tenant.ID.String(), nil)
+	req.Header.Set("X-API-Key", tenant.ApiKey)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	spans := recorder.Ended()
+	server := find(spans, "GET /tenants/:id")
+	if assert.NotNil(t, server) {
+		assert.Equal(t, traceID, server.SpanContext().TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+		assert.Equal(t, tenant.ID.String(), attr(server, tracing.TenantKey).AsString())
+		assert.Equal(t, int64(200), attr(server, "http.response.status_code").AsInt64())
+	}
+
+	// The tenant lookup runs before the tenant is known, the handler's query after
+	var queries []sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		if span.Name() == "db.query tenants" {
+			queries = append(queries, span)
+		}
+	}
+	if assert.Len(t, queries, 2) && server != nil {
+		for _, query := range queries {
+			assert.Equal(t, server.SpanContext().SpanID(), query.Parent().SpanID())
+			assert.Equal(t, "sqlite", attr(query, "db.system").AsString())
+			assert.Contains(t, attr(query, "db.statement").AsString(), "FROM `tenants`")
+		}
+		assert.Equal(t, attribute.INVALID, attr(queries[0], tracing.TenantKey).Type())
+		assert.Equal(t, tenant.ID.String(), attr(queries[1], tracing.TenantKey).AsString())
+	}
+}
+
+func TestHandlerQuerySpans(t *testing.T) {
+	recorder := record(t)
+	gin.SetMode(gin.TestMode)
+	db := setupDB(t)
+	assert.NoError(t, db.Create(&models.Review{TenantID: uuid.New(), Content: "Great"}).Error)
+
+	router := gin.New()
+	router.Use(middleware.TracingMiddleware())
+	router.GET("/reviews", handlers.NewReviewHandler(db, nil).List)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/reviews", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	spans := recorder.Ended()
+	server := find(spans, "GET /reviews")
+	query := find(spans, "db.query reviews")
+	if assert.NotNil(t, server) && assert.NotNil(t, query) {
+		assert.Equal(t, server.SpanContext().SpanID(), query.Parent().SpanID())
+	}
+}
+
+func TestProviderSpans(t *testing.T) {
+	recorder := record(t)
+
+	var traceparent string
+	llama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.Write([]byte(`{"text": "Customers love it"}`))
+	}))
+	defer llama.Close()
+
+	tenantID := uuid.New()
+	ctx, parent := tracing.Start(tracing.WithTenant(context.Background(), tenantID), "request")
+	provider := providers.Instrument("llama", providers.NewLlamaProvider(llama.URL))
+	resp, err := provider.Complete(ctx, providers.Prompt("Summarize"))
+	parent.End()
+	assert.NoError(t, err)
+	assert.Equal(t, "Customers love it", resp.Text)
+
+	spans := recorder.Ended()
+	call := find(spans, "ai.complete")
+	outbound := find(spans, "HTTP POST")
+	if assert.NotNil(t, call) && assert.NotNil(t, outbound) {
+		assert.Equal(t, parent.SpanContext().SpanID(), call.Parent().SpanID())
+		assert.Equal(t, "llama", attr(call, tracing.ProviderKey).AsString())
+		assert.Equal(t, tenantID.String(), attr(call, tracing.TenantKey).AsString())
+		assert.Equal(t, call.SpanContext().SpanID(), outbound.Parent().SpanID())
+
+		// The Llama server received the outbound span as its parent
+		expected := "00-" + outbound.SpanContext().TraceID().String() + "-" + outbound.SpanContext().SpanID().String() + "-01"
+		assert.Equal(t, expected, traceparent)
+	}
+
+	// An unreachable provider fails its span
+	llama.Close()
+	_, err = provider.AnalyzeSentiment(ctx, "Great")
+	assert.Error(t, err)
+	failed := find(recorder.Ended(), "ai.analyze_sentiment")
+	if assert.NotNil(t, failed) {
+		assert.Equal(t, codes.Error, failed.Status().Code)
+	}
+}
+
+func TestTokenAttributes(t *testing.T) {
+	recorder := record(t)
+
+	ctx, span := tracing.Start(context.Background(), "ai.complete")
+	tracing.AddTokens(ctx, 120, 45)
+	tracing.End(span, errors.New("rate limited"))
+
+	ended := find(recorder.Ended(), "ai.complete")
+	if assert.NotNil(t, ended) {
+		assert.Equal(t, int64(120), attr(ended, tracing.InputTokensKey).AsInt64())
+		assert.Equal(t, int64(45), attr(ended, tracing.OutputTokensKey).AsInt64())
+		assert.Equal(t, "rate limited", ended.Status().Description)
+	}
+}
+
+func TestJobSpans(t *testing.T) {
+	recorder := record(t)
+	db := setupDB(t)
+
+	queue := jobs.NewQueue(db, jobs.Options{})
+	queue.Register("report.run", func(ctx context.Context, job models.Job) error {
+		return db.WithContext(ctx).First(&models.Tenant{}).Error
+	})
+	tenantID := uuid.New()
+	_, err := queue.Enqueue(tenantID, "report.run", "", nil)
+	assert.NoError(t, err)
+
+	found, err := queue.Work(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	spans := recorder.Ended()
+	job := find(spans, "job report.run")
+	query := find(spans, "db.query tenants")
+	if assert.NotNil(t, job) && assert.NotNil(t, query) {
+		assert.Equal(t, tenantID.String(), attr(job, tracing.TenantKey).AsString())
+		assert.Equal(t, job.SpanContext().SpanID(), query.Parent().SpanID())
+		assert.Equal(t, codes.Error, job.Status().Code, "no tenant exists, so the job fails")
+	}
+	// Claiming the job is not traced
+	assert.Nil(t, find(spans, "db.update jobs"))
+}
+
+func TestSetup(t *testing.T) {
+	shutdown, err := tracing.Setup(context.Background(), tracing.Options{})
+	assert.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	_, err = tracing.Setup(context.Background(), tracing.Options{Exporter: "zipkin"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,130 @@
+package trends_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"nyasah-backend/config"
+	"nyasah-backend/models"
+	"nyasah-backend/services"
+	"nyasah-backend/services/ai/factory"
+	"nyasah-backend/services/jobs"
+	"nyasah-backend/services/timeframe"
+	"nyasah-backend/tests/testutil"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeLlama answers sentiment and keyword prompts, failing for reviews that
+// mention "broken"
+func fakeLlama(calls *int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(calls, 1)
+
+		var payload struct {
+			Prompt string `json:"prompt"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+
+		if strings.Contains(payload.Prompt, "broken") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		text := "fast, comfy"
+		if strings.Contains(payload.Prompt, "sentiment") {
+			text = "0.8"
+		}
+		json.NewEncoder(w).Encode(map[string]string{"text": text})
+	}))
+}
+
+func TestEnrichmentAndTrends(t *testing.T) {
+	db := testutil.DB(t, &models.Tenant{}, &models.Entity{}, &models.Review{}, &models.ReviewEngagement{},
+		&models.SocialProof{}, &models.ProofPerformance{}, &models.ProofRollup{}, &models.ProductInsights{}, &models.Job{})
+
+	var calls int64
+	server := fakeLlama(&calls)
+	defer server.Close()
+	t.Setenv("LLAMA_SERVER_URL", server.URL)
+
+	tenant := models.Tenant{Name: "Shop", Domain: "shop.test", ApiKey: "key", Settings: json.RawMessage(`{}`)}
+	assert.NoError(t, db.Create(&tenant).Error)
+
+	entity := models.Entity{TenantID: tenant.ID, Name: "Sneakers", Type: "product"}
+	assert.NoError(t, db.Create(&entity).Error)
+
+	now := time.Now()
+	for _, content := range []string{"Great shoes", "Lovely fit", "Arrived broken"} {
+		review := models.Review{TenantID: tenant.ID, EntityID: entity.ID, Rating: 5, Content: content, CreatedAt: now.Add(-time.Hour)}
+		assert.NoError(t, db.Create(&review).Error)
+	}
+	assert.NoError(t, db.Create(&models.ProofRollup{
+		TenantID: tenant.ID, BucketStart: now.UTC().Truncate(time.Hour).Add(-time.Hour), ProofType: "purchase",
+		Impressions: 20, Conversions: 5,
+	}).Error)
+
+	service := services.NewAIService(db, &config.Config{Provider: factory.Llama})
+
+	queue := jobs.NewQueue(db, jobs.Options{BaseBackoff: time.Hour})
+	service.RegisterJobs(queue)
+
+	t.Run("Backfill queues analysis once per review", func(t *testing.T) {
+		queued, err := queue.QueuePendingReviews(100)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, queued)
+
+		// Reviews with analysis already queued are not queued again
+		queued, err = queue.QueuePendingReviews(100)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, queued)
+
+		for {
+			found, err := queue.Work(context.Background())
+			assert.NoError(t, err)
+			if !found {
+				break
+			}
+		}
+
+		var pending []models.Review
+		db.Where("enriched_at IS NULL").Find(&pending)
+		assert.Len(t, pending, 1)
+		assert.Equal(t, "Arrived broken", pending[0].Content)
+
+		var stored models.Review
+		assert.NoError(t, db.Where("content = ?", "Great shoes").First(&stored).Error)
+		assert.InDelta(t, 0.8, stored.Sentiment, 1e-9)
+		assert.Equal(t, []string{"fast", "comfy"}, stored.Keywords)
+
+		// Keyword extraction queued one insight regeneration for the entity
+		var insights models.ProductInsights
+		assert.NoError(t, db.Where("product_id = ?", entity.ID).First(&insights).Error)
+		assert.Equal(t, 5.0, insights.AverageRating)
+	})
+
+	t.Run("Trends are built without provider calls", func(t *testing.T) {
+		before := atomic.LoadInt64(&calls)
+
+		spec := timeframe.Last(4, now, timeframe.Week, time.UTC)
+		assert.NoError(t, spec.Validate())
+		trends, err := service.AnalyzeTrends(context.Background(), tenant.ID, spec)
+		assert.NoError(t, err)
+		assert.Equal(t, before, atomic.LoadInt64(&calls))
+
+		sentiment := trends["sentiment_trends"].(map[string]interface{})
+		assert.InDelta(t, 0.8, sentiment["trends"].([]float64)[3], 1e-9)
+		assert.Equal(t, 2, sentiment["analyzed"].([]int)[3])
+
+		keywords := trends["keyword_trends"].(map[string]interface{})
+		assert.Equal(t, 2, keywords["trends"].([]map[string]int)[3]["fast"])
+
+		engagement := trends["engagement_trends"].(map[string]interface{})
+		assert.InDelta(t, 0.25, engagement["trends"].([]float64)[3], 1e-9)
+		assert.Equal(t, int64(20), engagement["impressions"].([]int64)[3])
+	})
+}
@@ -0,0 +1,71 @@
+package widgets_test
+
+import (
+	"encoding/json"
+	"nyasah-backend/models"
+	"nyasah-backend/services/widgets"
+	"nyasah-backend/tests/testutil"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderer(t *testing.T) {
+	db := testutil.DB(t, &models.Review{}, &models.SocialProof{}, &models.SyndicationGroup{}, &models.SyndicationMember{}, &models.ProofTemplate{},
+		&models.Entity{}, &models.User{}, &models.ProofPerformance{}, &models.ProofPolicy{})
+
+	tenant := models.Tenant{
+		ID:       uuid.New(),
+		Settings: json.RawMessage(`{"widget": {"primary_color": "#ff6600"}}`),
+	}
+	entityID := uuid.New()
+
+	reviews := []models.Review{
+		{TenantID: tenant.ID, EntityID: entityID, Rating: 5, Content: "Love it <3", Metadata: models.JSON{"author_name": "Jane"}},
+		{TenantID: tenant.ID, EntityID: entityID, Rating: 4, Content: "Pretty good"},
+		{TenantID: tenant.ID, EntityID: entityID, Rating: 2, Content: "Meh"},
+	}
+	assert.NoError(t, db.Create(&reviews).Error)
+	assert.NoError(t, db.Create(&models.SocialProof{TenantID: tenant.ID, EntityID: entityID, Type: "purchase", Content: "Sam just bought this"}).Error)
+
+	renderer := widgets.NewRenderer(db, time.Minute, nil)
+
+	t.Run("Badge", func(t *testing.T) {
+		widget, err := renderer.Render(tenant, widgets.Request{Type: widgets.TypeBadge, EntityID: entityID})
+		assert.NoError(t, err)
+		assert.Contains(t, widget.HTML, "3.7 (3)")
+		assert.Contains(t, widget.HTML, "#ff6600")
+	})
+
+	t.Run("Carousel only shows positive reviews and escapes content", func(t *testing.T) {
+		widget, err := renderer.Render(tenant, widgets.Request{Type: widgets.TypeCarousel, EntityID: entityID})
+		assert.NoError(t, err)
+		assert.Contains(t, widget.HTML, "Love it &lt;3")
+		assert.Contains(t, widget.HTML, "Pretty good")
+		assert.NotContains(t, widget.HTML, "Meh")
+	})
+
+	t.Run("Toast", func(t *testing.T) {
+		widget, err := renderer.Render(tenant, widgets.Request{Type: widgets.TypeToast})
+		assert.NoError(t, err)
+		assert.Contains(t, widget.HTML, "Sam just bought this")
+	})
+
+	t.Run("Rotated toasts are not cached", func(t *testing.T) {
+		assert.NoError(t, db.Create(&models.SocialProof{TenantID: tenant.ID, EntityID: entityID, Type: "purchase", Content: "Ava just bought this"}).Error)
+		assert.NoError(t, db.Create(&models.ProofPolicy{TenantID: tenant.ID, Type: "purchase", Rotation: "round_robin"}).Error)
+
+		first, err := renderer.Render(tenant, widgets.Request{Type: widgets.TypeToast, Limit: 1})
+		assert.NoError(t, err)
+		second, err := renderer.Render(tenant, widgets.Request{Type: widgets.TypeToast, Limit: 1})
+		assert.NoError(t, err)
+		assert.NotEqual(t, first.ProofIDs, second.ProofIDs)
+	})
+
+	t.Run("Unknown widget", func(t *testing.T) {
+		_, err := renderer.Render(tenant, widgets.Request{Type: "marquee"})
+		assert.Error(t, err)
+	})
+}